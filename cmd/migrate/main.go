@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/driver"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/migrations"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/dbrepo"
+)
+
+const usage = `usage: migrate [flags] up|down|status
+       migrate [flags] createuser email
+
+commands:
+  up          apply all pending migrations, including the room and restriction seeds
+  down        roll back the newest applied migrations (see -steps)
+  status      list every migration and whether it has been applied
+  createuser  add an admin user who can log in at /user/login, with the
+              password from ADMIN_PASSWORD or the first line of stdin
+
+flags:
+`
+
+// main is the migration tool entry point
+func main() {
+	dbDriver := flag.String("driver", "postgres", "database driver, postgres or sqlite")
+	dsn := flag.String("dsn", "", "database connection string, or the database file for sqlite")
+	steps := flag.Int("steps", 1, "number of migrations to roll back with down")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 && !(flag.Arg(0) == "createuser" && flag.NArg() == 2) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var db *driver.DB
+	var err error
+
+	switch *dbDriver {
+	case "sqlite":
+		if *dsn == "" {
+			*dsn = "bookings.db"
+		}
+		db, err = driver.ConnectSQLite(*dsn)
+	case "postgres":
+		if *dsn == "" {
+			*dsn = "host=localhost port=5432 dbname=bookings user=postgres password="
+		}
+		db, err = driver.ConnectSQL(*dsn)
+	default:
+		log.Fatalf("unknown database driver %q", *dbDriver)
+	}
+	if err != nil {
+		log.Fatal("Cannot connect to database! ", err)
+	}
+	defer db.SQL.Close()
+
+	m, err := migrations.New(db.SQL, *dbDriver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		done, err := m.Up()
+		for _, migration := range done {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("nothing to apply, database is up to date")
+		}
+
+	case "down":
+		done, err := m.Down(*steps)
+		for _, migration := range done {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+
+	case "createuser":
+		password, err := adminPassword()
+		if err != nil {
+			log.Fatal(err)
+		}
+		createUser(db, *dbDriver, flag.Arg(1), password)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// adminPassword reads the password for createuser from ADMIN_PASSWORD, or
+// else from the first line of stdin, so it never shows up in the process list
+// or the shell history
+func adminPassword() (string, error) {
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		return password, nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no password: set ADMIN_PASSWORD or write it to stdin")
+	}
+
+	password := strings.TrimRight(scanner.Text(), "\r")
+	if password == "" {
+		return "", fmt.Errorf("the password is empty")
+	}
+
+	return password, nil
+}
+
+// createUser adds an admin user through the repository, so the password is
+// hashed the same way the web app checks it
+func createUser(db *driver.DB, dbDriver, email, password string) {
+	var repo repository.DatabaseRepo
+	if dbDriver == "sqlite" {
+		repo = dbrepo.NewSQLiteRepo(db.SQL, &config.AppConfig{})
+	} else {
+		repo = dbrepo.NewPostgresRepo(db.SQL, &config.AppConfig{})
+	}
+
+	id, err := repo.InsertUser(models.User{
+		FirstName:  "Admin",
+		Email:      email,
+		Password:   password,
+		AccesLevel: 3,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("created user %d, %s\n", id, email)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/handlers"
+)
+
+const (
+	// balanceInterval is how often guests are asked for balances that fell due
+	balanceInterval = time.Hour
+	// webhookInterval is how often due webhook deliveries are sent
+	webhookInterval = 15 * time.Second
+	// icalInterval is how often the calendars of other platforms are imported
+	icalInterval = 15 * time.Minute
+	// waitlistInterval is how often the waitlist is checked for rooms that freed up
+	waitlistInterval = time.Minute
+	// holdsInterval is how often expired holds and unpaid reservations are let go of
+	holdsInterval = time.Minute
+)
+
+// startJobs runs the background jobs of the app
+func startJobs() {
+	every(balanceInterval, "balances", handlers.Repo.CollectBalances)
+	every(webhookInterval, "webhooks", handlers.Repo.DeliverWebhooks)
+	every(icalInterval, "ical", handlers.Repo.SyncICalFeeds)
+	every(waitlistInterval, "waitlist", handlers.Repo.NotifyWaitlist)
+	every(holdsInterval, "holds", handlers.Repo.ReapHolds)
+	every(holdsInterval, "unpaid reservations", handlers.Repo.ExpireUnpaidReservations)
+}
+
+// every runs job at once and then every interval, in the background, logging
+// its errors under name
+func every(interval time.Duration, name string, job func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := job(context.Background()); err != nil {
+				errorLog.Printf("%s: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -2,16 +2,19 @@ package main
 
 import (
 	"encoding/gob"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/handlers"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/migrations"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/driver"
@@ -32,7 +35,9 @@ func main() {
 		log.Fatal(err)
 	}
 
-	defer db.SQL.Close()
+	if db.SQL != nil {
+		defer db.SQL.Close()
+	}
 
 	// fmt.Println(fmt.Sprintf("Starting application on port %s", portNumber))
 	fmt.Printf("Starting application on port %s \n", portNumber)
@@ -71,9 +76,39 @@ func run() (*driver.DB, error) {
 	
 		app.Session = session
 
+		// read flags
+		dbDriver := flag.String("dbdriver", "postgres", "database driver, postgres, sqlite or memory")
+		dsn := flag.String("dsn", "", "database connection string, or the database file for sqlite")
+		mailServer := flag.String("mailserver", "localhost:1025", "host:port of the SMTP server mail is sent through")
+		mailFrom := flag.String("mailfrom", "bookings@example.com", "address guest emails come from and booking notifications go to")
+		paymentsGateway := flag.String("payments", "fake", "payment gateway, fake or stripe")
+		baseURL := flag.String("baseurl", "http://localhost"+portNumber, "scheme and host links in emails, payment redirects and the fake gateway's webhooks point to")
+		company := flag.String("company", "Fort Smythe Bed and Breakfast", "business name on invoices")
+		companyAddress := flag.String("companyaddress", "", "business address on invoices, lines separated by \\n")
+		companyTaxID := flag.String("companytaxid", "", "tax identification number on invoices")
+		ratesFile := flag.String("rates", "", "JSON file of exchange rates to load on start, see the readme")
+		holdMinutes := flag.Int("holdminutes", 15, "minutes a guest filling in their reservation holds the room")
+		flag.Parse()
+
+		app.DBDriver = *dbDriver
+		app.MailServer = *mailServer
+		app.MailFrom = *mailFrom
+		app.BaseURL = *baseURL
+		app.HoldMinutes = *holdMinutes
+		app.Company = models.Company{
+			Name: *company,
+			Address: strings.ReplaceAll(*companyAddress, `\n`, "\n"),
+			TaxID: *companyTaxID,
+			Email: *mailFrom,
+		}
+
+		// mail is sent in the background so handlers don't wait for the SMTP server
+		app.MailChan = make(chan models.MailData, 100)
+		listenForMail()
+
 		// connect to database
 		log.Println("Connecting to database...")
-		db, err := driver.ConnectSQL("host=localhost port=5432 dbname=bookings user=postgres password=")
+		db, err := connectDB(app.DBDriver, *dsn)
 		if err != nil {
 			log.Fatal("Cannot connect to database! Dying....")
 			return nil, err
@@ -89,10 +124,72 @@ func run() (*driver.DB, error) {
 		app.TemplateCache = tc
 		app.UseCache = false
 	
+		gateway, err := setupPayments(*paymentsGateway)
+		if err != nil {
+			return nil, err
+		}
+	
 		repo := handlers.NewRepo(&app, db)
+		repo.Payments = gateway
 		handlers.NewHandlers(repo)
+
+		if *ratesFile != "" {
+			n, err := loadExchangeRates(repo.DB, *ratesFile)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Loaded %d exchange rates from %s", n, *ratesFile)
+		}
+		app.ExchangeRates = repo.DB.AllExchangeRates
 		render.NewRenderer(&app)
 		helpers.NewHelpers(&app)
 
+		startJobs()
+
 	return db, nil
-}
\ No newline at end of file
+}
+
+// connectDB opens the database for the driver; a SQLite database is migrated
+// on start so the app runs locally without any extra tools, and the memory
+// driver needs no database at all
+func connectDB(dbDriver, dsn string) (*driver.DB, error) {
+	switch dbDriver {
+	case "sqlite":
+		if dsn == "" {
+			dsn = "bookings.db"
+		}
+
+		db, err := driver.ConnectSQLite(dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := migrations.New(db.SQL, "sqlite")
+		if err != nil {
+			return nil, err
+		}
+
+		done, err := m.Up()
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range done {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+
+		return db, nil
+
+	case "memory":
+		// nothing to connect to, the data lives in the repository itself
+		return &driver.DB{}, nil
+
+	case "postgres":
+		if dsn == "" {
+			dsn = "host=localhost port=5432 dbname=bookings user=postgres password="
+		}
+		return driver.ConnectSQL(dsn)
+
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", dbDriver)
+	}
+}
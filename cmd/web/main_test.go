@@ -1,10 +1,18 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"testing"
+)
 
 func TestRun(t *testing.T) {
+	// the memory database lets the app start without a database server
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{args[0], "-dbdriver", "memory"}
+
 	_ ,err := run()
 	if err != nil {
 		t.Error("failed run()")
 	}
-}
\ No newline at end of file
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
 	"github.com/justinas/nosurf"
 )
 
@@ -10,6 +11,9 @@ import (
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 
+	// the payment gateway signs its webhooks instead
+	csrfHandler.ExemptPath("/webhooks/payments")
+
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path: "/",
@@ -23,4 +27,16 @@ func NoSurf(next http.Handler) http.Handler {
 // SessionLoad load and saves the session on every request
 func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
-}
\ No newline at end of file
+}
+
+// Auth sends visitors who are not logged in to the login page
+func Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !helpers.IsAuthenticated(r) {
+			session.Put(r.Context(), "error", "Log in first!")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
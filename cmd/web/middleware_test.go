@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -30,4 +31,38 @@ func TestSessionLoad(t *testing.T) {
 	default:
 		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
 	}
-}
\ No newline at end of file
+}
+func TestAuth(t *testing.T) {
+	var myH myHandler
+
+	h := Auth(&myH)
+
+	switch v := h.(type) {
+	case http.Handler:
+		//do nothing
+	default:
+		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
+	}
+}
+
+func TestNoSurfExemptsWebhooks(t *testing.T) {
+	var myH myHandler
+
+	h := NoSurf(&myH)
+
+	for _, e := range []struct {
+		target string
+		expectedStatusCode int
+	}{
+		{"/webhooks/payments", http.StatusOK},
+		{"/make-reservation", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", e.target, nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("NoSurf for a POST to %s without a token returned %d, wanted %d", e.target, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
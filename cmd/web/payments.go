@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+)
+
+// fakeGatewayAddr is where the fake payment gateway listens
+const fakeGatewayAddr = "localhost:8081"
+
+// fakeWebhookSecret signs the webhooks of the fake payment gateway
+const fakeWebhookSecret = "whsec_fake"
+
+// setupPayments returns the payment gateway to take payments with. The fake
+// gateway is started next to the app, so it runs without a Stripe account,
+// and sends its webhooks to the app at app.BaseURL;
+// Stripe is configured through STRIPE_SECRET_KEY, STRIPE_PUBLISHABLE_KEY
+// and STRIPE_WEBHOOK_SECRET
+func setupPayments(gateway string) (payments.Gateway, error) {
+	switch gateway {
+	case "fake":
+		fake := payments.NewFakeServer(app.BaseURL+"/webhooks/payments", fakeWebhookSecret)
+		go func() {
+			errorLog.Println(http.ListenAndServe(fakeGatewayAddr, fake))
+		}()
+		infoLog.Printf("Fake payment gateway on http://%s", fakeGatewayAddr)
+
+		app.PaymentsCheckoutURL = "http://" + fakeGatewayAddr
+
+		stripe := payments.NewStripe("sk_fake", fakeWebhookSecret)
+		stripe.BaseURL = app.PaymentsCheckoutURL
+		return stripe, nil
+
+	case "stripe":
+		key := os.Getenv("STRIPE_SECRET_KEY")
+		secret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+		app.PaymentsPublicKey = os.Getenv("STRIPE_PUBLISHABLE_KEY")
+
+		if key == "" || secret == "" || app.PaymentsPublicKey == "" {
+			return nil, fmt.Errorf("stripe needs STRIPE_SECRET_KEY, STRIPE_PUBLISHABLE_KEY and STRIPE_WEBHOOK_SECRET")
+		}
+
+		return payments.NewStripe(key, secret), nil
+
+	default:
+		return nil, fmt.Errorf("unknown payment gateway %q", gateway)
+	}
+}
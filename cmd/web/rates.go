@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// rateFileEntry is one currency in the exchange rates file, e.g.
+// {"code": "EUR", "symbol": "€", "rate": "0.92"}; the rate is a string so
+// it is read exactly
+type rateFileEntry struct {
+	Code   string `json:"code"`
+	Symbol string `json:"symbol"`
+	Rate   string `json:"rate"`
+}
+
+// loadExchangeRates saves the rates of an exchange rates file to the
+// database, adding the currencies it does not have yet and updating the rest;
+// currencies only added in the admin area are kept
+func loadExchangeRates(db repository.DatabaseRepo, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []rateFileEntry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, entry := range entries {
+		rate, err := pricing.ParseRate(entry.Rate)
+		if err != nil {
+			return i, fmt.Errorf("%s: %s: %w", path, entry.Code, err)
+		}
+
+		saved, err := db.GetExchangeRateByCode(entry.Code)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			_, err = db.InsertExchangeRate(models.ExchangeRate{Code: entry.Code, Symbol: entry.Symbol, Rate: rate})
+		case err == nil:
+			saved.Symbol = entry.Symbol
+			saved.Rate = rate
+			err = db.UpdateExchangeRate(saved)
+		}
+		if err != nil {
+			return i, fmt.Errorf("%s: %s: %w", path, entry.Code, err)
+		}
+	}
+
+	return len(entries), nil
+}
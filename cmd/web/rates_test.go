@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/dbrepo"
+)
+
+func TestLoadExchangeRates(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	_, err := db.InsertExchangeRate(models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 900000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.InsertExchangeRate(models.ExchangeRate{Code: "CHF", Rate: 880000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	err = os.WriteFile(path, []byte(`[
+		{"code": "eur", "symbol": "€", "rate": "0.92"},
+		{"code": "PLN", "rate": "4.012345"}
+	]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := loadExchangeRates(db, path)
+	if err != nil || n != 2 {
+		t.Fatalf("loaded %d rates: %v", n, err)
+	}
+
+	rates, _ := db.AllExchangeRates()
+	if len(rates) != 3 {
+		t.Fatalf("got %+v, wanted CHF, EUR and PLN", rates)
+	}
+	if rates[0].Code != "CHF" || rates[0].Rate != 880000 {
+		t.Errorf("the CHF rate added in the admin area changed to %+v", rates[0])
+	}
+	if rates[1].Code != "EUR" || rates[1].Rate != 920000 {
+		t.Errorf("the EUR rate was not updated: got %+v", rates[1])
+	}
+	if rates[2].Code != "PLN" || rates[2].Rate != 4012345 || rates[2].Symbol != "" {
+		t.Errorf("the PLN rate was not added: got %+v", rates[2])
+	}
+
+	err = os.WriteFile(path, []byte(`[{"code": "GBP", "rate": "0"}]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadExchangeRates(db, path); err == nil {
+		t.Error("a zero rate was loaded")
+	}
+
+	if _, err := loadExchangeRates(db, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("a missing file was loaded")
+	}
+}
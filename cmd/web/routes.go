@@ -5,6 +5,7 @@ import (
 
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/handlers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 )
@@ -14,28 +15,129 @@ func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(middleware.Recoverer)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
-
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
-
-	mux.Get("/search-availability", handlers.Repo.Availability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-	
-	mux.Get("/contact", handlers.Repo.Contact)
-
-	mux.Get("/make-reservation", handlers.Repo.Reservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+
+	// API clients send their key with every request, so the API has no
+	// session or CSRF token
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(handlers.Repo.APINotFound)
+		mux.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+		mux.With(handlers.Repo.APIAuth(models.ScopeReadAvailability)).Get("/rooms", handlers.Repo.APIRooms)
+		mux.With(handlers.Repo.APIAuth(models.ScopeReadAvailability)).Get("/availability", handlers.Repo.APIAvailability)
+		mux.With(handlers.Repo.APIAuth(models.ScopeCreateReservation)).Post("/reservations", handlers.Repo.APICreateReservation)
+		mux.With(handlers.Repo.APIAuth(models.ScopeReadReservations)).Get("/reservations/{code}", handlers.Repo.APIReservation)
+	})
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(NoSurf)
+		mux.Use(SessionLoad)
+
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/generals-quarters", handlers.Repo.Generals)
+		mux.Get("/majors-suite", handlers.Repo.Majors)
+
+		mux.Get("/search-availability", handlers.Repo.Availability)
+		mux.Post("/search-availability", handlers.Repo.PostAvailability)
+		mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+		mux.Get("/rooms/{id}/calendar.json", handlers.Repo.RoomCalendarJSON)
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+		mux.Get("/book-room", handlers.Repo.BookRoom)
+		mux.Get("/waitlist", handlers.Repo.Waitlist)
+		mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+		mux.Get("/waitlist/{token}", handlers.Repo.WaitlistHold)
+
+		mux.Get("/contact", handlers.Repo.Contact)
+		mux.Post("/currency", handlers.Repo.PostCurrency)
+
+		mux.Get("/make-reservation", handlers.Repo.Reservation)
+		mux.Post("/make-reservation", handlers.Repo.PostReservation)
+		mux.Get("/reservation-payment", handlers.Repo.ReservationPayment)
+		mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+
+		mux.Get("/reservations/{code}", handlers.Repo.ShowReservation)
+		mux.Post("/reservations/{code}/cancel", handlers.Repo.PostCancelReservation)
+		mux.Get("/reservations/{code}/pay", handlers.Repo.PayBalance)
+		mux.Get("/reservations/{code}/invoice.pdf", handlers.Repo.GuestInvoice)
+
+		mux.Get("/ical/rooms/{id}.ics", handlers.Repo.ICalFeed)
+
+		mux.Post("/webhooks/payments", handlers.Repo.PaymentWebhook)
+
+		mux.Get("/api/openapi.json", handlers.Repo.APIOpenAPI)
+		mux.Get("/api/docs", handlers.Repo.APIDocs)
+
+		mux.Get("/user/login", handlers.Repo.ShowLogin)
+		mux.Post("/user/login", handlers.Repo.PostShowLogin)
+		mux.Get("/user/logout", handlers.Repo.Logout)
+
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+
+			mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+
+			mux.Get("/rate-plans", handlers.Repo.AdminRatePlans)
+			mux.Get("/rate-plans/{id}", handlers.Repo.AdminShowRatePlan)
+			mux.Post("/rate-plans/{id}", handlers.Repo.AdminPostRatePlan)
+			mux.Post("/rate-plans/{id}/delete", handlers.Repo.AdminDeleteRatePlan)
+
+			mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+			mux.Get("/promo-codes/{id}", handlers.Repo.AdminShowPromoCode)
+			mux.Post("/promo-codes/{id}", handlers.Repo.AdminPostPromoCode)
+			mux.Post("/promo-codes/{id}/delete", handlers.Repo.AdminDeletePromoCode)
+
+			mux.Get("/fees", handlers.Repo.AdminFees)
+			mux.Get("/fees/{id}", handlers.Repo.AdminShowFee)
+			mux.Post("/fees/{id}", handlers.Repo.AdminPostFee)
+			mux.Post("/fees/{id}/delete", handlers.Repo.AdminDeleteFee)
+
+			mux.Get("/stay-rules", handlers.Repo.AdminStayRules)
+			mux.Get("/stay-rules/{id}", handlers.Repo.AdminShowStayRule)
+			mux.Post("/stay-rules/{id}", handlers.Repo.AdminPostStayRule)
+			mux.Post("/stay-rules/{id}/delete", handlers.Repo.AdminDeleteStayRule)
+
+			mux.Get("/exchange-rates", handlers.Repo.AdminExchangeRates)
+			mux.Get("/exchange-rates/{id}", handlers.Repo.AdminShowExchangeRate)
+			mux.Post("/exchange-rates/{id}", handlers.Repo.AdminPostExchangeRate)
+			mux.Post("/exchange-rates/{id}/delete", handlers.Repo.AdminDeleteExchangeRate)
+
+			mux.Get("/api-keys", handlers.Repo.AdminAPIKeys)
+			mux.Get("/api-keys/{id}", handlers.Repo.AdminShowAPIKey)
+			mux.Post("/api-keys/{id}", handlers.Repo.AdminPostAPIKey)
+			mux.Post("/api-keys/{id}/delete", handlers.Repo.AdminDeleteAPIKey)
+
+			mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+			mux.Get("/webhooks/deliveries", handlers.Repo.AdminWebhookDeliveries)
+			mux.Post("/webhooks/deliveries/{id}/retry", handlers.Repo.AdminRetryWebhookDelivery)
+			mux.Get("/webhooks/{id}", handlers.Repo.AdminShowWebhook)
+			mux.Post("/webhooks/{id}", handlers.Repo.AdminPostWebhook)
+			mux.Post("/webhooks/{id}/delete", handlers.Repo.AdminDeleteWebhook)
+
+			mux.Get("/blocks", handlers.Repo.AdminBlocks)
+			mux.Post("/blocks", handlers.Repo.AdminPostBlock)
+			mux.Post("/blocks/{id}/delete", handlers.Repo.AdminDeleteBlock)
+
+			mux.Get("/reservations", handlers.Repo.AdminReservations)
+			mux.Get("/reservations/{id}", handlers.Repo.AdminShowReservation)
+			mux.Post("/reservations/{id}/cancel", handlers.Repo.AdminCancelReservation)
+			mux.Get("/reservations/{id}/invoice.pdf", handlers.Repo.AdminInvoice)
+
+			mux.Get("/rooms", handlers.Repo.AdminRooms)
+			mux.Get("/rooms/{id}", handlers.Repo.AdminShowRoom)
+			mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+			mux.Post("/rooms/{id}/ical-token", handlers.Repo.AdminResetRoomICalToken)
+			mux.Post("/rooms/{id}/ical-feeds", handlers.Repo.AdminPostICalFeed)
+			mux.Post("/ical-feeds/{id}/sync", handlers.Repo.AdminSyncICalFeed)
+			mux.Post("/ical-feeds/{id}/delete", handlers.Repo.AdminDeleteICalFeed)
+
+			mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+			mux.Get("/cancellation-policies/{id}", handlers.Repo.AdminShowCancellationPolicy)
+			mux.Post("/cancellation-policies/{id}", handlers.Repo.AdminPostCancellationPolicy)
+		})
+
+		fileServer := http.FileServer(http.Dir("./static/"))
+		mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	})
 
 	return mux
 }
@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/handlers"
 	"github.com/go-chi/chi"
 )
 
@@ -19,4 +23,60 @@ func TestRoutes(t *testing.T) {
 	default:
 		t.Error(fmt.Sprintf("type is not *chi.Mux, type is %T", v))
 	}
-}
\ No newline at end of file
+}
+// TestRoutesMatchAPISpec fails when a route under /api/v1 is added or removed
+// without the OpenAPI document following
+func TestRoutesMatchAPISpec(t *testing.T) {
+	var app config.AppConfig
+
+	routed := make(map[string]bool)
+	err := chi.Walk(routes(&app).(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, "/api/v1/") {
+			routed[method+" "+route] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routed) == 0 {
+		t.Fatal("found no routes under /api/v1")
+	}
+
+	documented := make(map[string]bool)
+	for path, operations := range handlers.APISpec().Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for route := range routed {
+		if !documented[route] {
+			t.Errorf("%s is routed but not in the OpenAPI document", route)
+		}
+	}
+	for route := range documented {
+		if !routed[route] {
+			t.Errorf("%s is in the OpenAPI document but not routed", route)
+		}
+	}
+}
+
+// TestRoutesAPIWithoutSession makes sure API requests don't go through the
+// session and CSRF middleware of the pages
+func TestRoutesAPIWithoutSession(t *testing.T) {
+	var app config.AppConfig
+
+	req := httptest.NewRequest("POST", "/api/v1/nowhere", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	routes(&app).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown API path, wanted %d", rr.Code, http.StatusNotFound)
+	}
+	if cookies := rr.Header().Values("Set-Cookie"); len(cookies) != 0 {
+		t.Errorf("the API set the cookies %q", cookies)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/arkadiuszekprogramista/bookingapp/internal/mailer"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// listenForMail sends the messages handlers put on the mail channel, in the background
+func listenForMail() {
+	go func() {
+		for msg := range app.MailChan {
+			sendMsg(msg)
+		}
+	}()
+}
+
+// sendMsg sends one message; a message that can not be sent is logged and dropped
+func sendMsg(msg models.MailData) {
+	err := mailer.Send(app.MailServer, msg)
+	if err != nil {
+		errorLog.Println(err)
+		return
+	}
+
+	infoLog.Printf("Sent %q to %s", msg.Subject, msg.To)
+}
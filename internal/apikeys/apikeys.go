@@ -0,0 +1,112 @@
+// Package apikeys makes and checks the keys partners use the JSON API with,
+// and limits how often each key is used
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the request header the key is sent in
+const Header = "X-API-Key"
+
+// keyStart starts every key, so a key is easy to recognise
+const keyStart = "bk_"
+
+// prefixLength is the length of the part of a key kept in clear, and
+// secretLength the length of the rest
+const (
+	prefixLength = 8
+	secretLength = 32
+)
+
+// encoding writes random bytes as lower case letters and digits
+var encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Generate makes a new key. The prefix is kept in clear to find the key by
+// and show it, only the hash of the whole key is stored
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, 25)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	random := encoding.EncodeToString(b)
+	prefix = random[:prefixLength]
+	key = keyStart + prefix + "_" + random[prefixLength:prefixLength+secretLength]
+
+	return key, prefix, Hash(key), nil
+}
+
+// Prefix gives the prefix of a key, and false when the key isn't one Generate makes
+func Prefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, keyStart) {
+		return "", false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(key, keyStart), "_")
+	if len(parts) != 2 || len(parts[0]) != prefixLength || len(parts[1]) != secretLength {
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+// Hash gives the SHA-256 of a key, in hex
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports if a key has the given hash, taking the same time whether it does or not
+func Matches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
+
+// window counts the requests of a key since start
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter limits the requests of each key to a number per window of time
+type Limiter struct {
+	// Window is how long the requests are counted for
+	Window time.Duration
+
+	mu      sync.Mutex
+	windows map[int]window
+}
+
+// NewLimiter makes a limiter counting requests per window
+func NewLimiter(w time.Duration) *Limiter {
+	return &Limiter{Window: w, windows: make(map[int]window)}
+}
+
+// Allow counts a request of key id, which may make limit requests per window.
+// It returns how many requests the key has left, and when it has none how
+// long it must wait before the next request is allowed
+func (l *Limiter) Allow(id, limit int, now time.Time) (remaining int, retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.windows[id]
+	if now.Sub(w.start) >= l.Window || now.Before(w.start) {
+		w = window{start: now}
+	}
+
+	if w.count >= limit {
+		return 0, w.start.Add(l.Window).Sub(now), false
+	}
+
+	w.count++
+	l.windows[id] = w
+
+	return limit - w.count, 0, true
+}
@@ -0,0 +1,76 @@
+package apikeys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := Prefix(key)
+	if !ok || got != prefix {
+		t.Errorf("Prefix of %q gave %q, %v, wanted %q", key, got, ok, prefix)
+	}
+	if !Matches(key, hash) {
+		t.Errorf("key %q does not match its hash", key)
+	}
+	if Matches(key+"x", hash) {
+		t.Errorf("a changed key matches the hash of %q", key)
+	}
+
+	other, _, _, _ := Generate()
+	if other == key {
+		t.Error("Generate made the same key twice")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		key string
+		ok bool
+	}{
+		{"valid", "bk_abcdefgh_abcdefghijklmnopqrstuvwxyz234567", true},
+		{"no start", "abcdefgh_abcdefghijklmnopqrstuvwxyz234567", false},
+		{"short prefix", "bk_abc_abcdefghijklmnopqrstuvwxyz234567", false},
+		{"short secret", "bk_abcdefgh_abc", false},
+		{"empty", "", false},
+	}
+
+	for _, e := range tests {
+		if _, ok := Prefix(e.key); ok != e.ok {
+			t.Errorf("Prefix for %s gave %v, wanted %v", e.name, ok, e.ok)
+		}
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l := NewLimiter(time.Minute)
+	now := time.Date(2050, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 2; i >= 0; i-- {
+		remaining, _, ok := l.Allow(1, 3, now)
+		if !ok || remaining != i {
+			t.Errorf("Allow gave %d left, %v, wanted %d", remaining, ok, i)
+		}
+	}
+
+	_, retryAfter, ok := l.Allow(1, 3, now.Add(20*time.Second))
+	if ok || retryAfter != 40*time.Second {
+		t.Errorf("Allow over the limit gave %v, retry after %v", ok, retryAfter)
+	}
+
+	// other keys have their own count
+	if _, _, ok := l.Allow(2, 3, now); !ok {
+		t.Error("Allow refused another key")
+	}
+
+	// the count starts again in the next window
+	if remaining, _, ok := l.Allow(1, 3, now.Add(time.Minute)); !ok || remaining != 2 {
+		t.Errorf("Allow in the next window gave %d left, %v", remaining, ok)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
 )
 
 // AppCOnfig holds the application config
@@ -15,4 +16,25 @@ type AppConfig struct {
 	ErrorLog *log.Logger
 	InProduction bool
 	Session *scs.SessionManager
+	DBDriver string
+	MailChan chan models.MailData
+	// MailServer is the host:port of the SMTP server mail is sent through
+	MailServer string
+	// BaseURL is the scheme and host links in emails and payment redirects
+	// point to
+	BaseURL string
+	// MailFrom sends guest emails and receives booking notifications
+	MailFrom string
+	// PaymentsPublicKey is the publishable key Stripe.js uses at checkout
+	PaymentsPublicKey string
+	// PaymentsCheckoutURL is where the fake payment gateway takes card
+	// details; it is empty when guests pay through Stripe.js
+	PaymentsCheckoutURL string
+	// Company is the business named as the seller on invoices
+	Company models.Company
+	// ExchangeRates lists the currencies guests can see prices in
+	ExchangeRates func() ([]models.ExchangeRate, error)
+	// HoldMinutes is how long a guest filling in their reservation holds
+	// the room before anyone else can book it
+	HoldMinutes int
 }
\ No newline at end of file
@@ -2,11 +2,13 @@ package driver
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	_ "github.com/jackc/pgx/v4"
+	_ "modernc.org/sqlite"
 )
 
 // DB holds the database connection pool
@@ -42,6 +44,34 @@ func ConnectSQL(dsn string) (*DB, error) {
 
 }
 
+// ConnectSQLite opens a SQLite database file, creating it when it does not exist
+func ConnectSQLite(path string) (*DB, error) {
+	// foreign keys are off by default in SQLite, and dates are stored in a
+	// sortable text format so the range queries compare them correctly
+	dsn := "file:" + path
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + params
+	} else {
+		dsn += "?" + params
+	}
+
+	d, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, so share one connection
+	d.SetMaxOpenConns(1)
+
+	err = testDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{SQL: d}, nil
+}
+
 // testDB tries to ping to database
 func testDB(d *sql.DB) error {
 	err := d.Ping()
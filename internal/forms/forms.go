@@ -65,4 +65,15 @@ func(f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
 		f.Errors.Add(field, "Invalid email address")
 	}
-}
\ No newline at end of file
+}
+//IsPromoCode checks that an optional promo code looks like one
+func(f *Form) IsPromoCode(field string) {
+	x := strings.TrimSpace(f.Get(field))
+	if x == "" {
+		return
+	}
+
+	if len(x) > 32 || !govalidator.Matches(x, `^[A-Za-z0-9_-]+$`) {
+		f.Errors.Add(field, "Invalid promo code")
+	}
+}
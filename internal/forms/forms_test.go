@@ -130,4 +130,31 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 
-}
\ No newline at end of file
+}
+func TestForm_IsPromoCode(t *testing.T) {
+	postedValues := url.Values{}
+	form := New(postedValues)
+
+	form.IsPromoCode("promo_code")
+	if !form.Valid() {
+		t.Error("got an invalid promo code for an empty field")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("promo_code", "summer-10")
+	form = New(postedValues)
+
+	form.IsPromoCode("promo_code")
+	if !form.Valid() {
+		t.Error("got an invalid promo code when we shoud not have")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("promo_code", "10% off")
+	form = New(postedValues)
+
+	form.IsPromoCode("promo_code")
+	if form.Valid() {
+		t.Error("got valid for an invalid promo code")
+	}
+}
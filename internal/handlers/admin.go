@@ -0,0 +1,1829 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/apikeys"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/forms"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/ical"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/webhooks"
+	"github.com/go-chi/chi"
+)
+
+// AdminDashboard shows the admin dashboard
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
+}
+
+// AdminRatePlans lists all rate plans
+func (m *Repository) AdminRatePlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := m.DB.AllRatePlans()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rate_plans"] = plans
+
+	render.Template(w, r, "admin-rate-plans.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowRatePlan shows the form to edit a rate plan, or to add one when the id is "new"
+func (m *Repository) AdminShowRatePlan(w http.ResponseWriter, r *http.Request) {
+	var plan models.RatePlan
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		plan, err = m.DB.GetRatePlanByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderRatePlan(w, r, plan, forms.New(ratePlanValues(plan)))
+}
+
+// AdminPostRatePlan saves a new or changed rate plan
+func (m *Repository) AdminPostRatePlan(w http.ResponseWriter, r *http.Request) {
+	var plan models.RatePlan
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		plan.ID = id
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "start_date", "end_date")
+
+	layout := "2006-01-02"
+
+	plan.Name = form.Get("name")
+	plan.RoomID = formInt(form, "room_id", 0)
+	plan.Priority = formInt(form, "priority", 0)
+
+	plan.StartDate, err = time.Parse(layout, form.Get("start_date"))
+	if err != nil && form.Has("start_date") {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+
+	plan.EndDate, err = time.Parse(layout, form.Get("end_date"))
+	if err != nil && form.Has("end_date") {
+		form.Errors.Add("end_date", "Invalid date")
+	}
+
+	if form.Has("nightly_rate") {
+		plan.NightlyRate, err = pricing.ParseAmount(form.Get("nightly_rate"))
+		if err != nil || plan.NightlyRate < 0 {
+			form.Errors.Add("nightly_rate", "Invalid amount")
+		}
+	}
+
+	for day := range plan.WeekdayModifiers {
+		plan.WeekdayModifiers[day] = formInt(form, fmt.Sprintf("modifier_%d", day), 0)
+	}
+
+	if !form.Valid() {
+		m.renderRatePlan(w, r, plan, form)
+		return
+	}
+
+	if plan.ID == 0 {
+		_, err = m.DB.InsertRatePlan(plan)
+	} else {
+		err = m.DB.UpdateRatePlan(plan)
+	}
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderRatePlan(w, r, plan, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rate plan saved")
+	http.Redirect(w, r, "/admin/rate-plans", http.StatusSeeOther)
+}
+
+// AdminDeleteRatePlan deletes a rate plan
+func (m *Repository) AdminDeleteRatePlan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteRatePlan(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rate plan deleted")
+	http.Redirect(w, r, "/admin/rate-plans", http.StatusSeeOther)
+}
+
+// renderRatePlan renders the rate plan form with the rooms to pick from
+func (m *Repository) renderRatePlan(w http.ResponseWriter, r *http.Request, plan models.RatePlan, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rate_plan"] = plan
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rate-plan.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// ratePlanValues fills the rate plan form from a saved plan
+func ratePlanValues(plan models.RatePlan) url.Values {
+	values := url.Values{
+		"name":     {plan.Name},
+		"room_id":  {strconv.Itoa(plan.RoomID)},
+		"priority": {strconv.Itoa(plan.Priority)},
+	}
+
+	if plan.ID != 0 {
+		values["start_date"] = []string{plan.StartDate.Format("2006-01-02")}
+		values["end_date"] = []string{plan.EndDate.Format("2006-01-02")}
+	}
+
+	if plan.NightlyRate != 0 {
+		values["nightly_rate"] = []string{pricing.FormatAmount(plan.NightlyRate)}
+	}
+
+	for day, modifier := range plan.WeekdayModifiers {
+		values[fmt.Sprintf("modifier_%d", day)] = []string{strconv.Itoa(modifier)}
+	}
+
+	return values
+}
+
+// formInt reads a whole number from a form, adding an error when it is not
+// one; a blank field gives def
+func formInt(form *forms.Form, field string, def int) int {
+	if !form.Has(field) {
+		return def
+	}
+
+	n, err := strconv.Atoi(form.Get(field))
+	if err != nil {
+		form.Errors.Add(field, "Must be a whole number")
+		return def
+	}
+
+	return n
+}
+
+// AdminPromoCodes lists all promo codes
+func (m *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := m.DB.AllPromoCodes()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["promo_codes"] = codes
+
+	render.Template(w, r, "admin-promo-codes.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowPromoCode shows the form to edit a promo code, or to add one when the id is "new"
+func (m *Repository) AdminShowPromoCode(w http.ResponseWriter, r *http.Request) {
+	promo := models.PromoCode{Kind: models.PromoPercent}
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		promo, err = m.DB.GetPromoCodeByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderPromoCode(w, r, promo, forms.New(promoCodeValues(promo)))
+}
+
+// AdminPostPromoCode saves a new or changed promo code
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	var promo models.PromoCode
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		promo.ID = id
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "kind", "amount", "valid_from", "valid_to")
+	form.IsPromoCode("code")
+
+	layout := "2006-01-02"
+
+	promo.Code = form.Get("code")
+	promo.Kind = form.Get("kind")
+	promo.MaxUses = formInt(form, "max_uses", 0)
+	promo.MinNights = formInt(form, "min_nights", 0)
+
+	if form.Has("amount") {
+		if promo.Kind == models.PromoFixed {
+			promo.Amount, err = pricing.ParseAmount(form.Get("amount"))
+			if err != nil {
+				form.Errors.Add("amount", "Invalid amount")
+			}
+		} else {
+			promo.Amount = formInt(form, "amount", 0)
+		}
+	}
+
+	promo.ValidFrom, err = time.Parse(layout, form.Get("valid_from"))
+	if err != nil && form.Has("valid_from") {
+		form.Errors.Add("valid_from", "Invalid date")
+	}
+
+	promo.ValidTo, err = time.Parse(layout, form.Get("valid_to"))
+	if err != nil && form.Has("valid_to") {
+		form.Errors.Add("valid_to", "Invalid date")
+	}
+
+	for _, value := range form.Values["room_ids"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			form.Errors.Add("room_ids", "Invalid room")
+			continue
+		}
+		promo.RoomIDs = append(promo.RoomIDs, id)
+	}
+
+	if !form.Valid() {
+		m.renderPromoCode(w, r, promo, form)
+		return
+	}
+
+	if promo.ID == 0 {
+		_, err = m.DB.InsertPromoCode(promo)
+	} else {
+		err = m.DB.UpdatePromoCode(promo)
+	}
+	if errors.Is(err, repository.ErrInvalid) || errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderPromoCode(w, r, promo, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code saved")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// AdminDeletePromoCode deletes a promo code
+func (m *Repository) AdminDeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeletePromoCode(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// renderPromoCode renders the promo code form with the rooms to pick from
+func (m *Repository) renderPromoCode(w http.ResponseWriter, r *http.Request, promo models.PromoCode, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range promo.RoomIDs {
+		selected[id] = true
+	}
+
+	data := make(map[string]interface{})
+	data["promo_code"] = promo
+	data["rooms"] = rooms
+	data["selected_rooms"] = selected
+
+	render.Template(w, r, "admin-promo-code.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// promoCodeValues fills the promo code form from a saved code
+func promoCodeValues(promo models.PromoCode) url.Values {
+	values := url.Values{
+		"code":       {promo.Code},
+		"kind":       {promo.Kind},
+		"max_uses":   {strconv.Itoa(promo.MaxUses)},
+		"min_nights": {strconv.Itoa(promo.MinNights)},
+	}
+
+	if promo.ID != 0 {
+		values["valid_from"] = []string{promo.ValidFrom.Format("2006-01-02")}
+		values["valid_to"] = []string{promo.ValidTo.Format("2006-01-02")}
+
+		if promo.Kind == models.PromoFixed {
+			values["amount"] = []string{pricing.FormatAmount(promo.Amount)}
+		} else {
+			values["amount"] = []string{strconv.Itoa(promo.Amount)}
+		}
+	}
+
+	return values
+}
+
+// AdminFees lists the fee and tax rules
+func (m *Repository) AdminFees(w http.ResponseWriter, r *http.Request) {
+	rules, err := m.DB.AllFeeRules()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["fee_rules"] = rules
+
+	render.Template(w, r, "admin-fees.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowFee shows the form to edit a fee rule, or to add one when the id is "new"
+func (m *Repository) AdminShowFee(w http.ResponseWriter, r *http.Request) {
+	rule := models.FeeRule{Kind: models.FeePerStay}
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		rule, err = m.DB.GetFeeRuleByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderFee(w, r, rule, forms.New(feeValues(rule)))
+}
+
+// AdminPostFee saves a new or changed fee rule
+func (m *Repository) AdminPostFee(w http.ResponseWriter, r *http.Request) {
+	var rule models.FeeRule
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		rule.ID = id
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "kind", "amount")
+
+	rule.Name = form.Get("name")
+	rule.Kind = form.Get("kind")
+	rule.Tax = form.Get("tax") != ""
+	rule.RoomID = formInt(form, "room_id", 0)
+
+	// a percentage is read like an amount, so "7.5" is stored as 750 hundredths
+	if form.Has("amount") {
+		rule.Amount, err = pricing.ParseAmount(form.Get("amount"))
+		if err != nil || rule.Amount < 0 {
+			form.Errors.Add("amount", "Invalid amount")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderFee(w, r, rule, form)
+		return
+	}
+
+	if rule.ID == 0 {
+		_, err = m.DB.InsertFeeRule(rule)
+	} else {
+		err = m.DB.UpdateFeeRule(rule)
+	}
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderFee(w, r, rule, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Fee saved")
+	http.Redirect(w, r, "/admin/fees", http.StatusSeeOther)
+}
+
+// AdminDeleteFee deletes a fee rule
+func (m *Repository) AdminDeleteFee(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteFeeRule(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Fee deleted")
+	http.Redirect(w, r, "/admin/fees", http.StatusSeeOther)
+}
+
+// renderFee renders the fee rule form with the rooms to pick from
+func (m *Repository) renderFee(w http.ResponseWriter, r *http.Request, rule models.FeeRule, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["fee_rule"] = rule
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-fee.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// feeValues fills the fee rule form from a saved rule
+func feeValues(rule models.FeeRule) url.Values {
+	values := url.Values{
+		"name":    {rule.Name},
+		"kind":    {rule.Kind},
+		"room_id": {strconv.Itoa(rule.RoomID)},
+	}
+
+	if rule.ID != 0 {
+		values["amount"] = []string{pricing.FormatAmount(rule.Amount)}
+	}
+
+	if rule.Tax {
+		values["tax"] = []string{"1"}
+	}
+
+	return values
+}
+
+// AdminStayRules lists all stay rules
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["stay_rules"] = rules
+
+	render.Template(w, r, "admin-stay-rules.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowStayRule shows the form to edit a stay rule, or to add one when the id is "new"
+func (m *Repository) AdminShowStayRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.StayRule
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		rule, err = m.DB.GetStayRuleByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderStayRule(w, r, rule, forms.New(stayRuleValues(rule)))
+}
+
+// AdminPostStayRule saves a new or changed stay rule
+func (m *Repository) AdminPostStayRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.StayRule
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		rule.ID = id
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "start_date", "end_date")
+
+	layout := "2006-01-02"
+
+	rule.Name = form.Get("name")
+	rule.RoomID = formInt(form, "room_id", 0)
+	rule.MinNights = formInt(form, "min_nights", 0)
+	rule.MaxNights = formInt(form, "max_nights", 0)
+	rule.MinLeadDays = formInt(form, "min_lead_days", 0)
+	rule.MaxLeadDays = formInt(form, "max_lead_days", 0)
+
+	rule.StartDate, err = time.Parse(layout, form.Get("start_date"))
+	if err != nil && form.Has("start_date") {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+
+	rule.EndDate, err = time.Parse(layout, form.Get("end_date"))
+	if err != nil && form.Has("end_date") {
+		form.Errors.Add("end_date", "Invalid date")
+	}
+
+	for day := range rule.ClosedToArrival {
+		rule.ClosedToArrival[day] = form.Get(fmt.Sprintf("no_arrival_%d", day)) != ""
+		rule.ClosedToDeparture[day] = form.Get(fmt.Sprintf("no_departure_%d", day)) != ""
+	}
+
+	if !form.Valid() {
+		m.renderStayRule(w, r, rule, form)
+		return
+	}
+
+	if rule.ID == 0 {
+		_, err = m.DB.InsertStayRule(rule)
+	} else {
+		err = m.DB.UpdateStayRule(rule)
+	}
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderStayRule(w, r, rule, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule saved")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// AdminDeleteStayRule deletes a stay rule
+func (m *Repository) AdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteStayRule(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule deleted")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// renderStayRule renders the stay rule form with the rooms to pick from
+func (m *Repository) renderStayRule(w http.ResponseWriter, r *http.Request, rule models.StayRule, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["stay_rule"] = rule
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-stay-rule.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// stayRuleValues fills the stay rule form from a saved rule
+func stayRuleValues(rule models.StayRule) url.Values {
+	values := url.Values{
+		"name":          {rule.Name},
+		"room_id":       {strconv.Itoa(rule.RoomID)},
+		"min_nights":    {strconv.Itoa(rule.MinNights)},
+		"max_nights":    {strconv.Itoa(rule.MaxNights)},
+		"min_lead_days": {strconv.Itoa(rule.MinLeadDays)},
+		"max_lead_days": {strconv.Itoa(rule.MaxLeadDays)},
+	}
+
+	if rule.ID != 0 {
+		values["start_date"] = []string{rule.StartDate.Format("2006-01-02")}
+		values["end_date"] = []string{rule.EndDate.Format("2006-01-02")}
+	}
+
+	for day := range rule.ClosedToArrival {
+		if rule.ClosedToArrival[day] {
+			values[fmt.Sprintf("no_arrival_%d", day)] = []string{"1"}
+		}
+		if rule.ClosedToDeparture[day] {
+			values[fmt.Sprintf("no_departure_%d", day)] = []string{"1"}
+		}
+	}
+
+	return values
+}
+
+// AdminExchangeRates lists the currencies guests can see prices in
+func (m *Repository) AdminExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := m.DB.AllExchangeRates()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["exchange_rates"] = rates
+
+	render.Template(w, r, "admin-exchange-rates.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowExchangeRate shows the form to edit an exchange rate, or to add one when the id is "new"
+func (m *Repository) AdminShowExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var rate models.ExchangeRate
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		rate, err = m.DB.GetExchangeRateByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderExchangeRate(w, r, rate, forms.New(exchangeRateValues(rate)))
+}
+
+// AdminPostExchangeRate saves a new or changed exchange rate
+func (m *Repository) AdminPostExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var rate models.ExchangeRate
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		rate.ID = id
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "rate")
+
+	rate.Code = strings.ToUpper(strings.TrimSpace(form.Get("code")))
+	rate.Symbol = strings.TrimSpace(form.Get("symbol"))
+
+	// the base currency is what prices are kept in, it has no rate
+	if rate.Code == pricing.BaseCurrency() {
+		form.Errors.Add("code", "Prices are already in "+rate.Code)
+	}
+
+	if form.Has("rate") {
+		rate.Rate, err = pricing.ParseRate(form.Get("rate"))
+		if err != nil {
+			form.Errors.Add("rate", "Invalid rate, use a number above 0 with up to 6 decimals")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderExchangeRate(w, r, rate, form)
+		return
+	}
+
+	if rate.ID == 0 {
+		_, err = m.DB.InsertExchangeRate(rate)
+	} else {
+		err = m.DB.UpdateExchangeRate(rate)
+	}
+	if errors.Is(err, repository.ErrInvalid) || errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderExchangeRate(w, r, rate, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Exchange rate saved")
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// AdminDeleteExchangeRate deletes an exchange rate; guests who picked its
+// currency see prices in the base currency again
+func (m *Repository) AdminDeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteExchangeRate(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Exchange rate deleted")
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// renderExchangeRate renders the exchange rate form
+func (m *Repository) renderExchangeRate(w http.ResponseWriter, r *http.Request, rate models.ExchangeRate, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["exchange_rate"] = rate
+
+	render.Template(w, r, "admin-exchange-rate.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// exchangeRateValues fills the exchange rate form from a saved rate
+func exchangeRateValues(rate models.ExchangeRate) url.Values {
+	values := url.Values{
+		"code":   {rate.Code},
+		"symbol": {rate.Symbol},
+	}
+
+	if rate.ID != 0 {
+		values["rate"] = []string{pricing.FormatRate(rate.Rate)}
+	}
+
+	return values
+}
+
+// AdminAPIKeys lists the keys partners use the JSON API with
+func (m *Repository) AdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := m.DB.AllAPIKeys()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["api_keys"] = keys
+	data["now"] = m.Pricing.Now()
+
+	render.Template(w, r, "admin-api-keys.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowAPIKey shows the form to edit an API key, or to add one when the
+// id is "new". Right after a key is made it shows the key itself, once
+func (m *Repository) AdminShowAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := models.APIKey{RateLimit: 60, ExpiresOn: m.Pricing.Now().AddDate(1, 0, 0)}
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		key, err = m.DB.GetAPIKeyByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderAPIKey(w, r, key, forms.New(apiKeyValues(key)))
+}
+
+// AdminPostAPIKey saves a new or changed API key. A new key is shown once on
+// the next page, only its hash is kept
+func (m *Repository) AdminPostAPIKey(w http.ResponseWriter, r *http.Request) {
+	var key models.APIKey
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		key, err = m.DB.GetAPIKeyByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "rate_limit", "expires_on")
+
+	key.Name = strings.TrimSpace(form.Get("name"))
+	key.RateLimit = formInt(form, "rate_limit", 0)
+
+	key.Scopes = nil
+	for _, scope := range models.APIScopes {
+		if form.Get("scope_"+scope) != "" {
+			key.Scopes = append(key.Scopes, scope)
+		}
+	}
+	if len(key.Scopes) == 0 {
+		form.Errors.Add("scopes", "Pick at least one scope")
+	}
+
+	if form.Has("rate_limit") && key.RateLimit < 1 {
+		form.Errors.Add("rate_limit", "Allow at least one request a minute")
+	}
+
+	key.ExpiresOn, err = time.Parse("2006-01-02", form.Get("expires_on"))
+	if err != nil && form.Has("expires_on") {
+		form.Errors.Add("expires_on", "Invalid date")
+	}
+
+	if !form.Valid() {
+		m.renderAPIKey(w, r, key, form)
+		return
+	}
+
+	var plain string
+	if key.ID == 0 {
+		plain, key.Prefix, key.Hash, err = apikeys.Generate()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		key.ID, err = m.DB.InsertAPIKey(key)
+	} else {
+		err = m.DB.UpdateAPIKey(key)
+	}
+	if errors.Is(err, repository.ErrInvalid) || errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderAPIKey(w, r, key, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	if plain != "" {
+		m.App.Session.Put(r.Context(), "api_key", plain)
+		m.App.Session.Put(r.Context(), "flash", "API key created, copy it now: it won't be shown again")
+		http.Redirect(w, r, fmt.Sprintf("/admin/api-keys/%d", key.ID), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API key saved")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// AdminDeleteAPIKey revokes an API key, requests made with it are refused
+// from then on
+func (m *Repository) AdminDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteAPIKey(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API key revoked")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// renderAPIKey renders the API key form, with the key itself when it was just made
+func (m *Repository) renderAPIKey(w http.ResponseWriter, r *http.Request, key models.APIKey, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["api_key"] = key
+	data["scopes"] = models.APIScopes
+	data["plain_key"] = m.App.Session.PopString(r.Context(), "api_key")
+	data["header"] = apikeys.Header
+
+	render.Template(w, r, "admin-api-key.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// apiKeyValues fills the API key form from a saved key
+func apiKeyValues(key models.APIKey) url.Values {
+	values := url.Values{
+		"name":       {key.Name},
+		"rate_limit": {strconv.Itoa(key.RateLimit)},
+		"expires_on": {key.ExpiresOn.Format("2006-01-02")},
+	}
+
+	for _, scope := range key.Scopes {
+		values["scope_"+scope] = []string{"1"}
+	}
+
+	return values
+}
+
+// AdminWebhooks lists the webhooks told about reservation and block events
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := m.DB.AllWebhooks()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhooks"] = hooks
+
+	render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowWebhook shows the form to edit a webhook with its latest
+// deliveries, or to add one when the id is "new"
+func (m *Repository) AdminShowWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := models.Webhook{Events: models.WebhookEvents, Active: true}
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		hook, err = m.DB.GetWebhookByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	m.renderWebhook(w, r, hook, forms.New(webhookValues(hook)))
+}
+
+// AdminPostWebhook saves a new or changed webhook. A blank secret is
+// replaced by a new one
+func (m *Repository) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook models.Webhook
+
+	if chi.URLParam(r, "id") != "new" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		hook, err = m.DB.GetWebhookByID(id)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+
+	hook.URL = strings.TrimSpace(form.Get("url"))
+	hook.Secret = strings.TrimSpace(form.Get("secret"))
+	hook.Active = form.Get("active") != ""
+
+	hook.Events = nil
+	for _, event := range models.WebhookEvents {
+		if form.Get("event_"+event) != "" {
+			hook.Events = append(hook.Events, event)
+		}
+	}
+	if len(hook.Events) == 0 {
+		form.Errors.Add("events", "Pick at least one event")
+	}
+
+	if !form.Valid() {
+		m.renderWebhook(w, r, hook, form)
+		return
+	}
+
+	if hook.Secret == "" {
+		hook.Secret, err = webhooks.GenerateSecret()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if hook.ID == 0 {
+		hook.ID, err = m.DB.InsertWebhook(hook)
+	} else {
+		err = m.DB.UpdateWebhook(hook)
+	}
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderWebhook(w, r, hook, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+// AdminDeleteWebhook deletes a webhook and its deliveries
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteWebhook(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// renderWebhook renders the webhook form, with the latest deliveries of a saved webhook
+func (m *Repository) renderWebhook(w http.ResponseWriter, r *http.Request, hook models.Webhook, form *forms.Form) {
+	var deliveries []models.WebhookDelivery
+	if hook.ID != 0 {
+		var err error
+		deliveries, err = m.DB.WebhookDeliveries(hook.ID, 20)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["webhook"] = hook
+	data["events"] = models.WebhookEvents
+	data["deliveries"] = deliveries
+	data["signature_header"] = webhooks.SignatureHeader
+
+	render.Template(w, r, "admin-webhook.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// webhookValues fills the webhook form from a saved webhook
+func webhookValues(hook models.Webhook) url.Values {
+	values := url.Values{
+		"url":    {hook.URL},
+		"secret": {hook.Secret},
+	}
+
+	if hook.Active {
+		values["active"] = []string{"1"}
+	}
+	for _, event := range hook.Events {
+		values["event_"+event] = []string{"1"}
+	}
+
+	return values
+}
+
+// AdminWebhookDeliveries shows the log of the latest deliveries to every webhook
+func (m *Repository) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := m.DB.WebhookDeliveries(0, 100)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["deliveries"] = deliveries
+
+	render.Template(w, r, "admin-webhook-deliveries.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminRetryWebhookDelivery sends a delivery again, with a fresh set of attempts
+func (m *Repository) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.retryWebhookDelivery(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Delivery will be sent again")
+	http.Redirect(w, r, "/admin/webhooks/deliveries", http.StatusSeeOther)
+}
+
+// AdminBlocks lists the nights the owner closed rooms for, with a form to close more
+func (m *Repository) AdminBlocks(w http.ResponseWriter, r *http.Request) {
+	m.renderBlocks(w, r, forms.New(nil))
+}
+
+// AdminPostBlock closes a room for a range of nights
+func (m *Repository) AdminPostBlock(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "start_date", "end_date")
+
+	layout := "2006-01-02"
+
+	block := models.RoomRestriction{RoomID: formInt(form, "room_id", 0)}
+
+	block.StartDate, err = time.Parse(layout, form.Get("start_date"))
+	if err != nil && form.Has("start_date") {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+
+	block.EndDate, err = time.Parse(layout, form.Get("end_date"))
+	if err != nil && form.Has("end_date") {
+		form.Errors.Add("end_date", "Invalid date")
+	}
+
+	if !form.Valid() {
+		m.renderBlocks(w, r, form)
+		return
+	}
+
+	id, err := m.DB.InsertBlock(block, m.Pricing.Now())
+	if errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", "The room is already taken on some of those nights")
+		m.renderBlocks(w, r, form)
+		return
+	}
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderBlocks(w, r, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	block, err = m.DB.GetBlockByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+	m.blockEvent(models.EventBlockAdded, block)
+
+	m.App.Session.Put(r.Context(), "flash", "Room blocked")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// AdminDeleteBlock opens the nights of a block again
+func (m *Repository) AdminDeleteBlock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	block, err := m.DB.GetBlockByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	// the next sync would only bring it back
+	if block.ICalFeedID != 0 {
+		m.App.Session.Put(r.Context(), "error", "The block comes from a calendar import, remove the stay on the platform it was booked on")
+		http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteBlock(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+	m.blockEvent(models.EventBlockRemoved, block)
+
+	m.App.Session.Put(r.Context(), "flash", "Block removed")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// renderBlocks renders the list of blocks with the form to add one
+func (m *Repository) renderBlocks(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	blocks, err := m.DB.AllBlocks()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["blocks"] = blocks
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-blocks.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// AdminReservations lists all reservations, the latest arrivals first
+func (m *Repository) AdminReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllReservations()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+
+	render.Template(w, r, "admin-reservations.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowReservation shows a reservation with its payments, and what
+// cancelling it would refund
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	ledger, err := m.DB.PaymentsForReservation(res.ID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	paid := pricing.Paid(ledger)
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["payments"] = ledger
+	data["paid"] = paid
+	data["refund"] = pricing.Refund(res.Policy, paid, res.StartDate, m.Pricing.Now())
+	data["invoiced"] = m.invoiced(res)
+
+	render.Template(w, r, "admin-reservation.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminCancelReservation cancels a reservation, refunding the guest what its
+// cancellation policy allows
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	page := fmt.Sprintf("/admin/reservations/%d", res.ID)
+
+	refund, err := m.cancelReservation(r.Context(), res)
+	if errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", "The reservation is already cancelled")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation cancelled, %s refunded", pricing.FormatMoney(refund)))
+	http.Redirect(w, r, page, http.StatusSeeOther)
+}
+
+// AdminRooms lists the rooms with their rates and cancellation policies
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	names := make(map[int]string)
+	for _, p := range policies {
+		names[p.ID] = p.Name
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["policy_names"] = names
+
+	render.Template(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowRoom shows the form to edit a room
+func (m *Repository) AdminShowRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.renderRoom(w, r, room, forms.New(roomValues(room)))
+}
+
+// AdminPostRoom saves a changed room
+func (m *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_name", "nightly_rate", "cancellation_policy_id", "max_occupancy", "beds", "included_guests", "extra_guest_rate")
+
+	room := models.Room{
+		ID:                   id,
+		RoomName:             form.Get("room_name"),
+		CancellationPolicyID: formInt(form, "cancellation_policy_id", 0),
+		MaxOccupancy:         formInt(form, "max_occupancy", 0),
+		Beds:                 formInt(form, "beds", 0),
+		IncludedGuests:       formInt(form, "included_guests", 0),
+	}
+
+	if form.Has("nightly_rate") {
+		room.NightlyRate, err = pricing.ParseAmount(form.Get("nightly_rate"))
+		if err != nil || room.NightlyRate < 0 {
+			form.Errors.Add("nightly_rate", "Invalid amount")
+		}
+	}
+
+	if form.Has("extra_guest_rate") {
+		room.ExtraGuestRate, err = pricing.ParseAmount(form.Get("extra_guest_rate"))
+		if err != nil || room.ExtraGuestRate < 0 {
+			form.Errors.Add("extra_guest_rate", "Invalid amount")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderRoom(w, r, room, form)
+		return
+	}
+
+	err = m.DB.UpdateRoom(room)
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderRoom(w, r, room, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// renderRoom renders the room form with the cancellation policies to pick from
+func (m *Repository) renderRoom(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["policies"] = policies
+	data["feed_url"] = m.feedURL(room)
+
+	feeds, err := m.DB.ICalFeedsForRoom(room.ID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+	data["ical_feeds"] = feeds
+
+	render.Template(w, r, "admin-room.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// AdminResetRoomICalToken gives the calendar feed of a room a new URL, the
+// old one stops working
+func (m *Repository) AdminResetRoomICalToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	token, err := ical.GenerateToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.SetRoomICalToken(id, token)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar feed URL changed")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", id), http.StatusSeeOther)
+}
+
+// AdminPostICalFeed adds the calendar of another platform to a room, and
+// imports it right away
+func (m *Repository) AdminPostICalFeed(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := fmt.Sprintf("/admin/rooms/%d", roomID)
+
+	feed := models.ICalFeed{
+		RoomID: roomID,
+		Name:   strings.TrimSpace(r.Form.Get("feed_name")),
+		URL:    strings.TrimSpace(r.Form.Get("feed_url")),
+	}
+
+	id, err := m.DB.InsertICalFeed(feed)
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	feed, err = m.DB.GetICalFeedByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.flashICalSync(r, feed)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminSyncICalFeed imports a calendar now, without waiting for the next sync
+func (m *Repository) AdminSyncICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	feed, err := m.DB.GetICalFeedByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.flashICalSync(r, feed)
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", feed.RoomID), http.StatusSeeOther)
+}
+
+// flashICalSync syncs a feed and tells the admin how it went
+func (m *Repository) flashICalSync(r *http.Request, feed models.ICalFeed) {
+	result, err := m.syncICalFeed(r.Context(), feed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "The calendar could not be imported: "+err.Error())
+		return
+	}
+
+	msg := fmt.Sprintf("Calendar imported: %d stays blocked, %d opened", len(result.Added), len(result.Removed))
+	if len(result.Conflicts) > 0 {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%d stays on the calendar overlap nights already taken here", len(result.Conflicts)))
+	}
+	m.App.Session.Put(r.Context(), "flash", msg)
+}
+
+// AdminDeleteICalFeed stops importing a calendar and opens the nights it blocked
+func (m *Repository) AdminDeleteICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	feed, err := m.DB.GetICalFeedByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	restrictions, err := m.DB.RoomRestrictionsForRoom(feed.RoomID, time.Time{}, m.Pricing.Now())
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteICalFeed(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	for _, rr := range restrictions {
+		if rr.ICalFeedID == id {
+			m.blockEvent(models.EventBlockRemoved, rr)
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar import removed")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", feed.RoomID), http.StatusSeeOther)
+}
+
+// roomValues fills the room form from a saved room
+func roomValues(room models.Room) url.Values {
+	return url.Values{
+		"room_name":              {room.RoomName},
+		"nightly_rate":           {pricing.FormatAmount(room.NightlyRate)},
+		"cancellation_policy_id": {strconv.Itoa(room.CancellationPolicyID)},
+		"max_occupancy":          {strconv.Itoa(room.MaxOccupancy)},
+		"beds":                   {strconv.Itoa(room.Beds)},
+		"included_guests":        {strconv.Itoa(room.IncludedGuests)},
+		"extra_guest_rate":       {pricing.FormatAmount(room.ExtraGuestRate)},
+	}
+}
+
+// AdminCancellationPolicies lists the cancellation policies rooms can have
+func (m *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+
+	render.Template(w, r, "admin-cancellation-policies.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowCancellationPolicy shows the form to edit a cancellation policy
+func (m *Repository) AdminShowCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	policy, err := m.DB.GetCancellationPolicyByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.renderCancellationPolicy(w, r, policy, forms.New(cancellationPolicyValues(policy)))
+}
+
+// AdminPostCancellationPolicy saves a changed cancellation policy. Reservations
+// keep the policy they were made under
+func (m *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "deposit_percent", "balance_days", "full_refund_days")
+
+	policy := models.CancellationPolicy{
+		ID:                   id,
+		Name:                 form.Get("name"),
+		DepositPercent:       formInt(form, "deposit_percent", 0),
+		BalanceDays:          formInt(form, "balance_days", 0),
+		FullRefundDays:       formInt(form, "full_refund_days", 0),
+		PartialRefundDays:    formInt(form, "partial_refund_days", 0),
+		PartialRefundPercent: formInt(form, "partial_refund_percent", 0),
+	}
+
+	if !form.Valid() {
+		m.renderCancellationPolicy(w, r, policy, form)
+		return
+	}
+
+	err = m.DB.UpdateCancellationPolicy(policy)
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		m.renderCancellationPolicy(w, r, policy, form)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy saved")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// renderCancellationPolicy renders the cancellation policy form
+func (m *Repository) renderCancellationPolicy(w http.ResponseWriter, r *http.Request, policy models.CancellationPolicy, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["policy"] = policy
+
+	render.Template(w, r, "admin-cancellation-policy.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// cancellationPolicyValues fills the cancellation policy form from a saved policy
+func cancellationPolicyValues(policy models.CancellationPolicy) url.Values {
+	return url.Values{
+		"name":                   {policy.Name},
+		"deposit_percent":        {strconv.Itoa(policy.DepositPercent)},
+		"balance_days":           {strconv.Itoa(policy.BalanceDays)},
+		"full_refund_days":       {strconv.Itoa(policy.FullRefundDays)},
+		"partial_refund_days":    {strconv.Itoa(policy.PartialRefundDays)},
+		"partial_refund_percent": {strconv.Itoa(policy.PartialRefundPercent)},
+	}
+}
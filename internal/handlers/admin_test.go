@@ -0,0 +1,1739 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/apikeys"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/go-chi/chi"
+)
+
+// adminRequest builds a request for an admin route with the chi id parameter set
+func adminRequest(method, target, id string, body url.Values) (*http.Request, context.Context) {
+	var req *http.Request
+	if body == nil {
+		req, _ = http.NewRequest(method, target, nil)
+	} else {
+		req, _ = http.NewRequest(method, target, strings.NewReader(body.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	ctx := getCtx(req)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+
+	return req.WithContext(ctx), ctx
+}
+
+func TestRepository_AdminRatePlans(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2050-07-01")
+	end, _ := time.Parse("2006-01-02", "2050-08-31")
+
+	id, err := testDB.InsertRatePlan(models.RatePlan{
+		Name: "Summer listing",
+		StartDate: start,
+		EndDate: end,
+		NightlyRate: 15000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteRatePlan(id)
+
+	req, _ := adminRequest("GET", "/admin/rate-plans", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRatePlans).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminRatePlans returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "Summer listing") {
+		t.Error("AdminRatePlans did not list the rate plan")
+	}
+
+	testDB.SetFault("AllRatePlans", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRatePlans).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminRatePlans returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowRatePlan(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2050-07-01")
+
+	id, err := testDB.InsertRatePlan(models.RatePlan{
+		Name: "Show me",
+		StartDate: start,
+		EndDate: start,
+		NightlyRate: 12345,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteRatePlan(id)
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"new plan", "new", http.StatusOK, "New Rate Plan"},
+		{"existing plan", strconv.Itoa(id), http.StatusOK, "123.45"},
+		{"missing plan", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/rate-plans/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowRatePlan).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowRatePlan for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowRatePlan for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostRatePlan(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("name", "Christmas")
+	valid.Add("room_id", "1")
+	valid.Add("start_date", "2050-12-20")
+	valid.Add("end_date", "2050-12-27")
+	valid.Add("nightly_rate", "199.50")
+	valid.Add("priority", "10")
+	valid.Add("modifier_6", "15")
+
+	req, _ := adminRequest("POST", "/admin/rate-plans/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostRatePlan).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostRatePlan returned wrong response code for a new plan: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	plans, _ := testDB.AllRatePlans()
+	var saved models.RatePlan
+	for _, p := range plans {
+		if p.Name == "Christmas" {
+			saved = p
+		}
+	}
+	defer testDB.DeleteRatePlan(saved.ID)
+
+	if saved.ID == 0 || saved.RoomID != 1 || saved.NightlyRate != 19950 || saved.Priority != 10 || saved.WeekdayModifiers[time.Saturday] != 15 {
+		t.Fatalf("AdminPostRatePlan saved %+v", saved)
+	}
+
+	// update the saved plan
+	changed := url.Values{}
+	for k, v := range valid {
+		changed[k] = v
+	}
+	changed.Set("nightly_rate", "")
+
+	req, _ = adminRequest("POST", "/admin/rate-plans/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostRatePlan).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostRatePlan returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if p, _ := testDB.GetRatePlanByID(saved.ID); p.NightlyRate != 0 {
+		t.Errorf("AdminPostRatePlan did not clear the nightly rate: got %d", p.NightlyRate)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing name", "new", func(v url.Values) { v.Set("name", "") }, http.StatusOK},
+		{"invalid date", "new", func(v url.Values) { v.Set("start_date", "20-12-2050") }, http.StatusOK},
+		{"invalid amount", "new", func(v url.Values) { v.Set("nightly_rate", "a lot") }, http.StatusOK},
+		{"invalid modifier", "new", func(v url.Values) { v.Set("modifier_0", "ten") }, http.StatusOK},
+		{"end before start", "new", func(v url.Values) { v.Set("end_date", "2050-12-01") }, http.StatusOK},
+		{"missing plan", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/rate-plans/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostRatePlan).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostRatePlan for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	plans, _ = testDB.AllRatePlans()
+	if len(plans) != 1 {
+		t.Errorf("AdminPostRatePlan saved invalid plans: got %d plans, wanted 1", len(plans))
+	}
+}
+
+func TestRepository_AdminDeleteRatePlan(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2050-07-01")
+
+	id, err := testDB.InsertRatePlan(models.RatePlan{Name: "Delete me", StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+	}{
+		{"existing plan", strconv.Itoa(id), http.StatusSeeOther},
+		{"already deleted", strconv.Itoa(id), http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("POST", "/admin/rate-plans/"+e.id+"/delete", e.id, url.Values{})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteRatePlan).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteRatePlan for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminPromoCodes(t *testing.T) {
+	from, _ := time.Parse("2006-01-02", "2050-01-01")
+
+	id, err := testDB.InsertPromoCode(models.PromoCode{
+		Code: "LISTME",
+		Kind: models.PromoFixed,
+		Amount: 2500,
+		ValidFrom: from,
+		ValidTo: from,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeletePromoCode(id)
+
+	req, _ := adminRequest("GET", "/admin/promo-codes", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPromoCodes).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminPromoCodes returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "LISTME") || !strings.Contains(rr.Body.String(), "$25.00") {
+		t.Error("AdminPromoCodes did not list the promo code")
+	}
+
+	testDB.SetFault("AllPromoCodes", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPromoCodes).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminPromoCodes returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowPromoCode(t *testing.T) {
+	from, _ := time.Parse("2006-01-02", "2050-01-01")
+
+	id, err := testDB.InsertPromoCode(models.PromoCode{
+		Code: "SHOWME",
+		Kind: models.PromoFixed,
+		Amount: 1250,
+		ValidFrom: from,
+		ValidTo: from,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeletePromoCode(id)
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"new code", "new", http.StatusOK, "New Promo Code"},
+		{"existing code", strconv.Itoa(id), http.StatusOK, "12.50"},
+		{"missing code", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/promo-codes/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowPromoCode).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowPromoCode for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowPromoCode for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostPromoCode(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("code", "summer25")
+	valid.Add("kind", "percent")
+	valid.Add("amount", "25")
+	valid.Add("valid_from", "2050-06-01")
+	valid.Add("valid_to", "2050-08-31")
+	valid.Add("max_uses", "100")
+	valid.Add("min_nights", "3")
+	valid.Add("room_ids", "2")
+
+	req, _ := adminRequest("POST", "/admin/promo-codes/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostPromoCode).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostPromoCode returned wrong response code for a new code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	saved, err := testDB.GetPromoCodeByCode("SUMMER25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeletePromoCode(saved.ID)
+
+	if saved.Amount != 25 || saved.MaxUses != 100 || saved.MinNights != 3 || len(saved.RoomIDs) != 1 || saved.RoomIDs[0] != 2 {
+		t.Fatalf("AdminPostPromoCode saved %+v", saved)
+	}
+
+	// change the saved code to a fixed amount for every room
+	changed := url.Values{}
+	for k, v := range valid {
+		changed[k] = v
+	}
+	changed.Set("kind", "fixed")
+	changed.Set("amount", "30.50")
+	changed.Del("room_ids")
+
+	req, _ = adminRequest("POST", "/admin/promo-codes/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostPromoCode).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostPromoCode returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if p, _ := testDB.GetPromoCodeByID(saved.ID); p.Amount != 3050 || len(p.RoomIDs) != 0 {
+		t.Errorf("AdminPostPromoCode did not update the code: got %+v", p)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing code", "new", func(v url.Values) { v.Set("code", "") }, http.StatusOK},
+		{"invalid code", "new", func(v url.Values) { v.Set("code", "10% off") }, http.StatusOK},
+		{"duplicate code", "new", func(v url.Values) {}, http.StatusOK},
+		{"invalid date", "new", func(v url.Values) { v.Set("code", "OTHER"); v.Set("valid_to", "31-08-2050") }, http.StatusOK},
+		{"invalid amount", "new", func(v url.Values) { v.Set("code", "OTHER"); v.Set("kind", "fixed"); v.Set("amount", "a lot") }, http.StatusOK},
+		{"percent over 100", "new", func(v url.Values) { v.Set("code", "OTHER"); v.Set("amount", "150") }, http.StatusOK},
+		{"invalid room", "new", func(v url.Values) { v.Set("code", "OTHER"); v.Set("room_ids", "two") }, http.StatusOK},
+		{"missing code id", "100000", func(v url.Values) { v.Set("code", "OTHER") }, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/promo-codes/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostPromoCode).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostPromoCode for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	codes, _ := testDB.AllPromoCodes()
+	if len(codes) != 1 {
+		t.Errorf("AdminPostPromoCode saved invalid codes: got %d codes, wanted 1", len(codes))
+	}
+}
+
+func TestRepository_AdminDeletePromoCode(t *testing.T) {
+	from, _ := time.Parse("2006-01-02", "2050-01-01")
+
+	id, err := testDB.InsertPromoCode(models.PromoCode{Code: "DELETEME", Kind: models.PromoPercent, Amount: 5, ValidFrom: from, ValidTo: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+	}{
+		{"existing code", strconv.Itoa(id), http.StatusSeeOther},
+		{"already deleted", strconv.Itoa(id), http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("POST", "/admin/promo-codes/"+e.id+"/delete", e.id, url.Values{})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeletePromoCode).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeletePromoCode for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminFees(t *testing.T) {
+	id, err := testDB.InsertFeeRule(models.FeeRule{Name: "Resort fee", Kind: models.FeePerNight, Amount: 1500, RoomID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteFeeRule(id)
+
+	req, _ := adminRequest("GET", "/admin/fees", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminFees).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminFees returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "Resort fee") || !strings.Contains(rr.Body.String(), "$15.00 per night") {
+		t.Error("AdminFees did not list the fee")
+	}
+
+	testDB.SetFault("AllFeeRules", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminFees).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminFees returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowFee(t *testing.T) {
+	id, err := testDB.InsertFeeRule(models.FeeRule{Name: "VAT", Kind: models.FeePercent, Amount: 750, Tax: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteFeeRule(id)
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"new fee", "new", http.StatusOK, "New Fee"},
+		{"existing fee", strconv.Itoa(id), http.StatusOK, "7.50"},
+		{"missing fee", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/fees/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowFee).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowFee for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowFee for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostFee(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("name", "City tax")
+	valid.Add("kind", "per_guest")
+	valid.Add("amount", "2.50")
+	valid.Add("tax", "1")
+	valid.Add("room_id", "0")
+
+	req, _ := adminRequest("POST", "/admin/fees/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostFee).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostFee returned wrong response code for a new fee: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	rules, _ := testDB.AllFeeRules()
+	if len(rules) != 1 {
+		t.Fatalf("AdminPostFee saved %d fees, wanted 1", len(rules))
+	}
+	saved := rules[0]
+	defer testDB.DeleteFeeRule(saved.ID)
+
+	if saved.Name != "City tax" || saved.Kind != models.FeePerGuest || saved.Amount != 250 || !saved.Tax {
+		t.Fatalf("AdminPostFee saved %+v", saved)
+	}
+
+	// make it a percentage for one room that is not a tax
+	changed := url.Values{}
+	for k, v := range valid {
+		changed[k] = v
+	}
+	changed.Set("kind", "percent")
+	changed.Set("amount", "12.5")
+	changed.Set("room_id", "1")
+	changed.Del("tax")
+
+	req, _ = adminRequest("POST", "/admin/fees/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostFee).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostFee returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if f, _ := testDB.GetFeeRuleByID(saved.ID); f.Amount != 1250 || f.Tax || f.RoomID != 1 {
+		t.Errorf("AdminPostFee did not update the fee: got %+v", f)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing name", "new", func(v url.Values) { v.Set("name", "") }, http.StatusOK},
+		{"invalid amount", "new", func(v url.Values) { v.Set("amount", "a lot") }, http.StatusOK},
+		{"negative amount", "new", func(v url.Values) { v.Set("amount", "-1") }, http.StatusOK},
+		{"invalid kind", "new", func(v url.Values) { v.Set("kind", "per_towel") }, http.StatusOK},
+		{"missing room", "new", func(v url.Values) { v.Set("room_id", "1000") }, http.StatusOK},
+		{"missing fee", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/fees/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostFee).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostFee for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	rules, _ = testDB.AllFeeRules()
+	if len(rules) != 1 {
+		t.Errorf("AdminPostFee saved invalid fees: got %d fees, wanted 1", len(rules))
+	}
+}
+
+func TestRepository_AdminDeleteFee(t *testing.T) {
+	id, err := testDB.InsertFeeRule(models.FeeRule{Name: "Delete me", Kind: models.FeePerStay, Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+	}{
+		{"existing fee", strconv.Itoa(id), http.StatusSeeOther},
+		{"already deleted", strconv.Itoa(id), http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("POST", "/admin/fees/"+e.id+"/delete", e.id, url.Values{})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteFee).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteFee for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminStayRules(t *testing.T) {
+	rule := models.StayRule{Name: "Festival", RoomID: 2, StartDate: time.Date(2056, time.August, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2056, time.August, 10, 0, 0, 0, 0, time.UTC), MinNights: 3}
+	rule.ClosedToArrival[time.Sunday] = true
+	id, err := testDB.InsertStayRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteStayRule(id)
+
+	req, _ := adminRequest("GET", "/admin/stay-rules", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminStayRules).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminStayRules returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "Festival") || !strings.Contains(rr.Body.String(), "Sunday") {
+		t.Error("AdminStayRules did not list the rule")
+	}
+
+	testDB.SetFault("AllStayRules", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminStayRules).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminStayRules returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowStayRule(t *testing.T) {
+	id, err := testDB.InsertStayRule(models.StayRule{Name: "Long weekends", StartDate: time.Date(2056, time.May, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2056, time.May, 31, 0, 0, 0, 0, time.UTC), MaxLeadDays: 180})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteStayRule(id)
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"new rule", "new", http.StatusOK, "New Stay Rule"},
+		{"existing rule", strconv.Itoa(id), http.StatusOK, "2056-05-31"},
+		{"missing rule", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/stay-rules/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowStayRule).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowStayRule for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowStayRule for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostStayRule(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("name", "High season")
+	valid.Add("room_id", "0")
+	valid.Add("start_date", "2056-07-01")
+	valid.Add("end_date", "2056-08-31")
+	valid.Add("min_nights", "3")
+	valid.Add("max_nights", "14")
+	valid.Add("min_lead_days", "0")
+	valid.Add("max_lead_days", "0")
+	valid.Add("no_arrival_6", "1")
+	valid.Add("no_departure_0", "1")
+
+	req, _ := adminRequest("POST", "/admin/stay-rules/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostStayRule).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostStayRule returned wrong response code for a new rule: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	rules, _ := testDB.AllStayRules()
+	if len(rules) != 1 {
+		t.Fatalf("AdminPostStayRule saved %d rules, wanted 1", len(rules))
+	}
+	saved := rules[0]
+	defer testDB.DeleteStayRule(saved.ID)
+
+	if saved.Name != "High season" || saved.MinNights != 3 || saved.MaxNights != 14 || !saved.ClosedToArrival[time.Saturday] || !saved.ClosedToDeparture[time.Sunday] {
+		t.Fatalf("AdminPostStayRule saved %+v", saved)
+	}
+
+	// move it to one room and open Saturdays
+	changed := url.Values{}
+	for k, v := range valid {
+		changed[k] = v
+	}
+	changed.Set("room_id", "1")
+	changed.Set("min_lead_days", "2")
+	changed.Del("no_arrival_6")
+
+	req, _ = adminRequest("POST", "/admin/stay-rules/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostStayRule).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostStayRule returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if s, _ := testDB.GetStayRuleByID(saved.ID); s.RoomID != 1 || s.MinLeadDays != 2 || s.ClosedToArrival[time.Saturday] {
+		t.Errorf("AdminPostStayRule did not update the rule: got %+v", s)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing name", "new", func(v url.Values) { v.Set("name", "") }, http.StatusOK},
+		{"invalid date", "new", func(v url.Values) { v.Set("start_date", "soon") }, http.StatusOK},
+		{"end before start", "new", func(v url.Values) { v.Set("end_date", "2056-06-01") }, http.StatusOK},
+		{"invalid nights", "new", func(v url.Values) { v.Set("min_nights", "a few") }, http.StatusOK},
+		{"maximum below minimum", "new", func(v url.Values) { v.Set("max_nights", "2") }, http.StatusOK},
+		{"missing room", "new", func(v url.Values) { v.Set("room_id", "1000") }, http.StatusOK},
+		{"missing rule", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/stay-rules/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostStayRule).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostStayRule for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	rules, _ = testDB.AllStayRules()
+	if len(rules) != 1 {
+		t.Errorf("AdminPostStayRule saved invalid rules: got %d rules, wanted 1", len(rules))
+	}
+}
+
+func TestRepository_AdminDeleteStayRule(t *testing.T) {
+	id, err := testDB.InsertStayRule(models.StayRule{Name: "Delete me", StartDate: time.Date(2056, time.March, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2056, time.March, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+	}{
+		{"existing rule", strconv.Itoa(id), http.StatusSeeOther},
+		{"already deleted", strconv.Itoa(id), http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("POST", "/admin/stay-rules/"+e.id+"/delete", e.id, url.Values{})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteStayRule).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteStayRule for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminReservations(t *testing.T) {
+	res := paidTestReservation(t, "2054-02-01", "2054-02-03", "admin-list@example.com")
+
+	req, _ := adminRequest("GET", "/admin/reservations", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReservations).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminReservations returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), res.ConfirmationCode) {
+		t.Error("AdminReservations did not list the reservation")
+	}
+
+	testDB.SetFault("AllReservations", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReservations).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminReservations returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowReservation(t *testing.T) {
+	res := paidTestReservation(t, "2054-02-05", "2054-02-07", "admin-show@example.com")
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"existing reservation", strconv.Itoa(res.ID), http.StatusOK, res.PaymentIntentID},
+		{"missing reservation", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/reservations/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowReservation for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowReservation for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminCancelReservation(t *testing.T) {
+	res := paidTestReservation(t, "2054-02-10", "2054-02-12", "admin-cancel@example.com")
+
+	// on the day of arrival nothing is refunded, but the owner may still cancel
+	now, _ := time.Parse("2006-01-02", "2054-02-10")
+	defer withNow(now)()
+
+	id := strconv.Itoa(res.ID)
+
+	req, ctx := adminRequest("POST", "/admin/reservations/"+id+"/cancel", id, url.Values{})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminCancelReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/reservations/"+id {
+		t.Fatalf("AdminCancelReservation returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if flash := session.GetString(ctx, "flash"); flash != "Reservation cancelled, $0.00 refunded" {
+		t.Errorf("got flash %q", flash)
+	}
+
+	saved, _ := testDB.GetReservationByID(res.ID)
+	if saved.Status != models.ReservationCancelled {
+		t.Errorf("the reservation is %q, wanted %q", saved.Status, models.ReservationCancelled)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+	}{
+		{"already cancelled", id, http.StatusSeeOther},
+		{"missing reservation", "100000", http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("POST", "/admin/reservations/"+e.id+"/cancel", e.id, url.Values{})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminCancelReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminCancelReservation for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminRooms(t *testing.T) {
+	req, _ := adminRequest("GET", "/admin/rooms", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRooms).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminRooms returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "General&#39;s Quarters") || !strings.Contains(rr.Body.String(), "Moderate") {
+		t.Error("AdminRooms did not list the rooms with their policies")
+	}
+
+	testDB.SetFault("AllCancellationPolicies", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRooms).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminRooms returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowRoom(t *testing.T) {
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"existing room", "2", http.StatusOK, "Major&#39;s Suite"},
+		{"missing room", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/rooms/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowRoom).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowRoom for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowRoom for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostRoom(t *testing.T) {
+	original, _ := testDB.GetRoomByID(2)
+	defer testDB.UpdateRoom(original)
+
+	valid := url.Values{}
+	valid.Add("room_name", "Major's Suite")
+	valid.Add("nightly_rate", "120.00")
+	valid.Add("cancellation_policy_id", "3")
+	valid.Add("max_occupancy", "5")
+	valid.Add("beds", "3")
+	valid.Add("included_guests", "2")
+	valid.Add("extra_guest_rate", "25.00")
+
+	req, _ := adminRequest("POST", "/admin/rooms/2", "2", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostRoom).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostRoom returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if room, _ := testDB.GetRoomByID(2); room.NightlyRate != 12000 || room.CancellationPolicyID != 3 || room.MaxOccupancy != 5 || room.Beds != 3 || room.IncludedGuests != 2 || room.ExtraGuestRate != 2500 {
+		t.Errorf("AdminPostRoom did not update the room: got %+v", room)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing name", "2", func(v url.Values) { v.Set("room_name", "") }, http.StatusOK},
+		{"invalid rate", "2", func(v url.Values) { v.Set("nightly_rate", "cheap") }, http.StatusOK},
+		{"invalid policy", "2", func(v url.Values) { v.Set("cancellation_policy_id", "soft") }, http.StatusOK},
+		{"missing policy", "2", func(v url.Values) { v.Set("cancellation_policy_id", "1000") }, http.StatusOK},
+		{"missing occupancy", "2", func(v url.Values) { v.Del("max_occupancy") }, http.StatusOK},
+		{"no one sleeps", "2", func(v url.Values) { v.Set("max_occupancy", "0") }, http.StatusOK},
+		{"invalid beds", "2", func(v url.Values) { v.Set("beds", "two") }, http.StatusOK},
+		{"missing included guests", "2", func(v url.Values) { v.Del("included_guests") }, http.StatusOK},
+		{"invalid extra guest rate", "2", func(v url.Values) { v.Set("extra_guest_rate", "-5") }, http.StatusOK},
+		{"missing room", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/rooms/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostRoom).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostRoom for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	if room, _ := testDB.GetRoomByID(2); room.CancellationPolicyID != 3 || room.MaxOccupancy != 5 {
+		t.Errorf("AdminPostRoom saved an invalid room: got %+v", room)
+	}
+}
+
+func TestRepository_AdminCancellationPolicies(t *testing.T) {
+	req, _ := adminRequest("GET", "/admin/cancellation-policies", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminCancellationPolicies).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminCancellationPolicies returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, name := range []string{"Flexible", "Moderate", "Strict"} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("AdminCancellationPolicies did not list %s", name)
+		}
+	}
+
+	testDB.SetFault("AllCancellationPolicies", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminCancellationPolicies).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminCancellationPolicies returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminShowCancellationPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		id string
+		expectedStatusCode int
+		expectedBody string
+	}{
+		{"existing policy", "3", http.StatusOK, "Strict"},
+		{"missing policy", "100000", http.StatusNotFound, ""},
+		{"invalid id", "abc", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := adminRequest("GET", "/admin/cancellation-policies/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowCancellationPolicy).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowCancellationPolicy for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("AdminShowCancellationPolicy for %s did not show %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostCancellationPolicy(t *testing.T) {
+	original, _ := testDB.GetCancellationPolicyByID(1)
+	defer testDB.UpdateCancellationPolicy(original)
+
+	valid := url.Values{}
+	valid.Add("name", "Flexible")
+	valid.Add("deposit_percent", "10")
+	valid.Add("balance_days", "2")
+	valid.Add("full_refund_days", "2")
+	valid.Add("partial_refund_days", "1")
+	valid.Add("partial_refund_percent", "25")
+
+	req, _ := adminRequest("POST", "/admin/cancellation-policies/1", "1", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostCancellationPolicy).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostCancellationPolicy returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if p, _ := testDB.GetCancellationPolicyByID(1); p.DepositPercent != 10 || p.PartialRefundPercent != 25 {
+		t.Errorf("AdminPostCancellationPolicy did not update the policy: got %+v", p)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing name", "1", func(v url.Values) { v.Set("name", "") }, http.StatusOK},
+		{"invalid deposit", "1", func(v url.Values) { v.Set("deposit_percent", "half") }, http.StatusOK},
+		{"deposit above 100%", "1", func(v url.Values) { v.Set("deposit_percent", "120") }, http.StatusOK},
+		{"partial refund after full refund", "1", func(v url.Values) { v.Set("partial_refund_days", "5") }, http.StatusOK},
+		{"missing policy", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/cancellation-policies/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostCancellationPolicy).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostCancellationPolicy for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminExchangeRates(t *testing.T) {
+	defer withRate(t, models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 920000})()
+
+	req, _ := adminRequest("GET", "/admin/exchange-rates", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminExchangeRates).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminExchangeRates returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "1 USD = 0.92 EUR") || !strings.Contains(rr.Body.String(), "$100.00 is €92.00") {
+		t.Error("AdminExchangeRates did not list the rate")
+	}
+
+	testDB.SetFault("AllExchangeRates", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminExchangeRates).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminExchangeRates returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminPostExchangeRate(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("code", "gbp")
+	valid.Add("symbol", "£")
+	valid.Add("rate", "0.79")
+
+	req, _ := adminRequest("POST", "/admin/exchange-rates/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostExchangeRate).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostExchangeRate returned wrong response code for a new rate: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	saved, err := testDB.GetExchangeRateByCode("GBP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteExchangeRate(saved.ID)
+
+	if saved.Symbol != "£" || saved.Rate != 790000 {
+		t.Fatalf("AdminPostExchangeRate saved %+v", saved)
+	}
+
+	// the form shows the saved rate as it was typed
+	req, _ = adminRequest("GET", "/admin/exchange-rates/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminShowExchangeRate).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="0.79"`) {
+		t.Errorf("AdminShowExchangeRate returned %d without the rate", rr.Code)
+	}
+
+	changed := url.Values{"code": {"GBP"}, "symbol": {"£"}, "rate": {"0.8"}}
+	req, _ = adminRequest("POST", "/admin/exchange-rates/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostExchangeRate).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostExchangeRate returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if r, _ := testDB.GetExchangeRateByID(saved.ID); r.Rate != 800000 {
+		t.Errorf("AdminPostExchangeRate did not update the rate: got %+v", r)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing code", "new", func(v url.Values) { v.Set("code", "") }, http.StatusOK},
+		{"invalid code", "new", func(v url.Values) { v.Set("code", "POUND") }, http.StatusOK},
+		{"base currency", "new", func(v url.Values) { v.Set("code", "usd") }, http.StatusOK},
+		{"invalid rate", "new", func(v url.Values) { v.Set("rate", "a lot") }, http.StatusOK},
+		{"zero rate", "new", func(v url.Values) { v.Set("rate", "0") }, http.StatusOK},
+		{"duplicate currency", "new", func(v url.Values) {}, http.StatusOK},
+		{"missing rate", "100000", func(v url.Values) { v.Set("code", "CHF") }, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/exchange-rates/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostExchangeRate).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostExchangeRate for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	if rates, _ := testDB.AllExchangeRates(); len(rates) != 1 {
+		t.Errorf("invalid rates were saved: got %+v", rates)
+	}
+
+	req, _ = adminRequest("POST", "/admin/exchange-rates/"+strconv.Itoa(saved.ID)+"/delete", strconv.Itoa(saved.ID), nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteExchangeRate).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteExchangeRate returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if _, err := testDB.GetExchangeRateByID(saved.ID); err == nil {
+		t.Error("AdminDeleteExchangeRate did not delete the rate")
+	}
+}
+
+func TestRepository_AdminAPIKeys(t *testing.T) {
+	expired := testAPIKey(t, 60, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), models.ScopeReadAvailability)
+	prefix, _ := apikeys.Prefix(expired)
+
+	req, _ := adminRequest("GET", "/admin/api-keys", "", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminAPIKeys).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminAPIKeys returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "bk_"+prefix+"_") || !strings.Contains(rr.Body.String(), "Expired") {
+		t.Error("AdminAPIKeys did not list the expired key")
+	}
+	if strings.Contains(rr.Body.String(), expired) {
+		t.Error("AdminAPIKeys showed a whole key")
+	}
+
+	testDB.SetFault("AllAPIKeys", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminAPIKeys).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminAPIKeys returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminPostAPIKey(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("name", "Partner site")
+	valid.Add("scope_"+models.ScopeReadAvailability, "1")
+	valid.Add("scope_"+models.ScopeCreateReservation, "1")
+	valid.Add("rate_limit", "30")
+	valid.Add("expires_on", "2099-12-31")
+
+	req, ctx := adminRequest("POST", "/admin/api-keys/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostAPIKey).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostAPIKey returned wrong response code for a new key: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	// the key is shown once on the page the admin is sent to, and only its hash is saved
+	plain := session.GetString(ctx, "api_key")
+	prefix, ok := apikeys.Prefix(plain)
+	if !ok {
+		t.Fatalf("AdminPostAPIKey made the key %q", plain)
+	}
+
+	saved, err := testDB.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteAPIKey(saved.ID)
+
+	if rr.Header().Get("Location") != "/admin/api-keys/"+strconv.Itoa(saved.ID) {
+		t.Errorf("AdminPostAPIKey sent the admin to %q", rr.Header().Get("Location"))
+	}
+	if saved.Name != "Partner site" || saved.RateLimit != 30 || len(saved.Scopes) != 2 || saved.ExpiresOn.Format("2006-01-02") != "2099-12-31" || !apikeys.Matches(plain, saved.Hash) {
+		t.Fatalf("AdminPostAPIKey saved %+v", saved)
+	}
+
+	req, _ = adminRequest("GET", "/admin/api-keys/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), nil)
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chi.RouteContext(req.Context())))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminShowAPIKey).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), plain) {
+		t.Errorf("AdminShowAPIKey returned %d without the new key", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminShowAPIKey).ServeHTTP(rr, req)
+
+	if strings.Contains(rr.Body.String(), plain) {
+		t.Error("AdminShowAPIKey showed the key a second time")
+	}
+
+	// the new key works with the API
+	if rr, _ := callAPIWithKey(t, plain, "GET", "/api/v1/rooms", "", nil); rr.Code != http.StatusOK {
+		t.Errorf("the new key got %d from the API", rr.Code)
+	}
+
+	changed := url.Values{"name": {"Partner"}, "scope_" + models.ScopeReadReservations: {"1"}, "rate_limit": {"10"}, "expires_on": {"2098-01-01"}}
+	req, _ = adminRequest("POST", "/admin/api-keys/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostAPIKey).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostAPIKey returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if k, _ := testDB.GetAPIKeyByID(saved.ID); k.Name != "Partner" || !k.HasScope(models.ScopeReadReservations) || k.HasScope(models.ScopeReadAvailability) || k.Hash != saved.Hash {
+		t.Errorf("AdminPostAPIKey did not update the key: got %+v", k)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing name", "new", func(v url.Values) { v.Set("name", "") }, http.StatusOK},
+		{"no scopes", "new", func(v url.Values) { v.Del("scope_" + models.ScopeReadAvailability); v.Del("scope_" + models.ScopeCreateReservation) }, http.StatusOK},
+		{"zero rate limit", "new", func(v url.Values) { v.Set("rate_limit", "0") }, http.StatusOK},
+		{"invalid rate limit", "new", func(v url.Values) { v.Set("rate_limit", "lots") }, http.StatusOK},
+		{"invalid expiry", "new", func(v url.Values) { v.Set("expires_on", "never") }, http.StatusOK},
+		{"missing key", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	before, _ := testDB.AllAPIKeys()
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/api-keys/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostAPIKey).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostAPIKey for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	if keys, _ := testDB.AllAPIKeys(); len(keys) != len(before) {
+		t.Errorf("invalid keys were saved: got %+v", keys)
+	}
+
+	req, _ = adminRequest("POST", "/admin/api-keys/"+strconv.Itoa(saved.ID)+"/delete", strconv.Itoa(saved.ID), nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteAPIKey).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteAPIKey returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	// a revoked key no longer works
+	if rr, _ := callAPIWithKey(t, plain, "GET", "/api/v1/rooms", "", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("the revoked key got %d from the API", rr.Code)
+	}
+}
+
+func TestRepository_AdminPostWebhook(t *testing.T) {
+	valid := url.Values{}
+	valid.Add("url", "https://partner.example.com/hooks")
+	valid.Add("event_"+models.EventReservationCreated, "1")
+	valid.Add("event_"+models.EventBlockAdded, "1")
+	valid.Add("active", "1")
+
+	req, _ := adminRequest("POST", "/admin/webhooks/new", "new", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostWebhook).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostWebhook returned wrong response code for a new webhook: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	hooks, _ := testDB.AllWebhooks()
+	if len(hooks) != 1 {
+		t.Fatalf("AdminPostWebhook saved %d webhooks, wanted 1", len(hooks))
+	}
+	saved := hooks[0]
+	defer testDB.DeleteWebhook(saved.ID)
+
+	// a blank secret is made up
+	if saved.URL != "https://partner.example.com/hooks" || !strings.HasPrefix(saved.Secret, "whsec_") || len(saved.Events) != 2 || !saved.Active {
+		t.Fatalf("AdminPostWebhook saved %+v", saved)
+	}
+	if rr.Header().Get("Location") != "/admin/webhooks/"+strconv.Itoa(saved.ID) {
+		t.Errorf("AdminPostWebhook sent the admin to %q", rr.Header().Get("Location"))
+	}
+
+	req, _ = adminRequest("GET", "/admin/webhooks/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminShowWebhook).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), saved.Secret) {
+		t.Errorf("AdminShowWebhook returned %d without the secret", rr.Code)
+	}
+
+	// pausing keeps the secret it is given
+	changed := url.Values{"url": {saved.URL}, "secret": {"mine"}, "event_" + models.EventBlockRemoved: {"1"}}
+	req, _ = adminRequest("POST", "/admin/webhooks/"+strconv.Itoa(saved.ID), strconv.Itoa(saved.ID), changed)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostWebhook).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostWebhook returned wrong response code for an update: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if w, _ := testDB.GetWebhookByID(saved.ID); w.Active || w.Secret != "mine" || !w.Subscribes(models.EventBlockRemoved) || w.Subscribes(models.EventBlockAdded) {
+		t.Errorf("AdminPostWebhook did not update the webhook: got %+v", w)
+	}
+
+	tests := []struct {
+		name string
+		id string
+		change func(v url.Values)
+		expectedStatusCode int
+	}{
+		{"missing url", "new", func(v url.Values) { v.Set("url", "") }, http.StatusOK},
+		{"not a url", "new", func(v url.Values) { v.Set("url", "ftp://example.com") }, http.StatusOK},
+		{"no events", "new", func(v url.Values) { v.Del("event_" + models.EventReservationCreated); v.Del("event_" + models.EventBlockAdded) }, http.StatusOK},
+		{"missing webhook", "100000", func(v url.Values) {}, http.StatusNotFound},
+		{"invalid id", "abc", func(v url.Values) {}, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/webhooks/"+e.id, e.id, body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostWebhook).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostWebhook for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	if hooks, _ := testDB.AllWebhooks(); len(hooks) != 1 {
+		t.Errorf("invalid webhooks were saved: got %+v", hooks)
+	}
+
+	req, _ = adminRequest("GET", "/admin/webhooks", "", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminWebhooks).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), saved.URL) {
+		t.Errorf("AdminWebhooks returned %d without the webhook", rr.Code)
+	}
+
+	req, _ = adminRequest("POST", "/admin/webhooks/"+strconv.Itoa(saved.ID)+"/delete", strconv.Itoa(saved.ID), nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteWebhook).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteWebhook returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if _, err := testDB.GetWebhookByID(saved.ID); err == nil {
+		t.Error("AdminDeleteWebhook did not delete the webhook")
+	}
+}
+
+func TestRepository_AdminBlocks(t *testing.T) {
+	_, hook := newWebhookReceiver(t, "s3cret", models.EventBlockAdded, models.EventBlockRemoved)
+
+	valid := url.Values{"room_id": {"1"}, "start_date": {"2056-01-10"}, "end_date": {"2056-01-12"}}
+
+	req, _ := adminRequest("POST", "/admin/blocks", "", valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostBlock).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminPostBlock returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	blocks, _ := testDB.AllBlocks()
+	var block models.RoomRestriction
+	for _, b := range blocks {
+		if b.RoomID == 1 && b.StartDate.Format("2006-01-02") == "2056-01-10" {
+			block = b
+		}
+	}
+	if block.ID == 0 || block.EndDate.Format("2006-01-02") != "2056-01-12" {
+		t.Fatalf("AdminPostBlock did not save the block: got %+v", blocks)
+	}
+
+	// the room can't be booked on the blocked nights
+	start, _ := time.Parse("2006-01-02", "2056-01-11")
+	if free, _ := testDB.SerachAvailabilityByDatesByRoomID(start, start.AddDate(0, 0, 1), 1, Repo.Pricing.Now()); free {
+		t.Error("the blocked room is still free")
+	}
+
+	req, _ = adminRequest("GET", "/admin/blocks", "", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminBlocks).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "2056-01-10") {
+		t.Errorf("AdminBlocks returned %d without the block", rr.Code)
+	}
+
+	tests := []struct {
+		name string
+		change func(v url.Values)
+	}{
+		{"taken nights", func(v url.Values) {}},
+		{"end before start", func(v url.Values) { v.Set("start_date", "2056-02-10"); v.Set("end_date", "2056-02-08") }},
+		{"invalid date", func(v url.Values) { v.Set("start_date", "soon") }},
+		{"missing room", func(v url.Values) { v.Del("room_id") }},
+	}
+
+	for _, e := range tests {
+		body := url.Values{}
+		for k, v := range valid {
+			body[k] = append([]string(nil), v...)
+		}
+		e.change(body)
+
+		req, _ := adminRequest("POST", "/admin/blocks", "", body)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostBlock).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("AdminPostBlock for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusOK)
+		}
+	}
+
+	if after, _ := testDB.AllBlocks(); len(after) != len(blocks) {
+		t.Errorf("invalid blocks were saved: got %+v", after)
+	}
+
+	req, _ = adminRequest("POST", "/admin/blocks/"+strconv.Itoa(block.ID)+"/delete", strconv.Itoa(block.ID), nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteBlock).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteBlock returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if _, err := testDB.GetBlockByID(block.ID); err == nil {
+		t.Error("AdminDeleteBlock did not delete the block")
+	}
+
+	// the webhook is told about both
+	queued, _ := testDB.WebhookDeliveries(hook.ID, 0)
+	if len(queued) != 2 || queued[0].Event != models.EventBlockRemoved || queued[1].Event != models.EventBlockAdded || !strings.Contains(queued[1].Payload, `"start_date":"2056-01-10"`) {
+		t.Errorf("the blocks queued %+v", queued)
+	}
+
+	// reservations are not blocks
+	res := paidTestReservation(t, "2057-08-01", "2057-08-03", "notablock@example.com")
+	restrictions, _ := testDB.AllBlocks()
+	for _, b := range restrictions {
+		if b.StartDate.Equal(res.StartDate) {
+			t.Errorf("AllBlocks lists the reservation %d", res.ID)
+		}
+	}
+
+	req, _ = adminRequest("POST", "/admin/blocks/100000/delete", "100000", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteBlock).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("AdminDeleteBlock of a missing block returned %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminResetRoomICalToken(t *testing.T) {
+	before, _ := testDB.GetRoomByID(2)
+
+	req, _ := adminRequest("GET", "/admin/rooms/2", "2", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminShowRoom).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), "/ical/rooms/2.ics?token="+before.ICalToken) {
+		t.Error("AdminShowRoom does not show the calendar feed URL")
+	}
+
+	req, _ = adminRequest("POST", "/admin/rooms/2/ical-token", "2", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminResetRoomICalToken).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/2" {
+		t.Fatalf("AdminResetRoomICalToken returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	after, _ := testDB.GetRoomByID(2)
+	if after.ICalToken == "" || after.ICalToken == before.ICalToken {
+		t.Errorf("AdminResetRoomICalToken left the token %q", after.ICalToken)
+	}
+
+	// the old URL stops working
+	req, _ = http.NewRequest("GET", "/ical/rooms/2.ics?token="+before.ICalToken, nil)
+	rr = httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("the old feed URL returned %d", rr.Code)
+	}
+
+	req, _ = adminRequest("POST", "/admin/rooms/100/ical-token", "100", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminResetRoomICalToken).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("AdminResetRoomICalToken for a missing room returned %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminICalFeeds(t *testing.T) {
+	cal := newCalendarServer(t, "imported@other 20580301 20580304")
+
+	// a URL that is not one
+	req, ctx := adminRequest("POST", "/admin/rooms/2/ical-feeds", "2", url.Values{"feed_name": {"Other"}, "feed_url": {"not a url"}})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostICalFeed).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || session.GetString(ctx, "error") == "" {
+		t.Errorf("AdminPostICalFeed of a bad URL returned %d with error %q", rr.Code, session.GetString(ctx, "error"))
+	}
+	if feeds, _ := testDB.ICalFeedsForRoom(2); len(feeds) != 0 {
+		t.Fatalf("AdminPostICalFeed saved %+v", feeds)
+	}
+
+	// the calendar is imported as soon as it is added
+	req, ctx = adminRequest("POST", "/admin/rooms/2/ical-feeds", "2", url.Values{"feed_name": {"Other"}, "feed_url": {cal.server.URL}})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostICalFeed).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/2" {
+		t.Fatalf("AdminPostICalFeed returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if flash := session.GetString(ctx, "flash"); flash != "Calendar imported: 1 stays blocked, 0 opened" {
+		t.Errorf("AdminPostICalFeed flashed %q", flash)
+	}
+
+	feeds, _ := testDB.ICalFeedsForRoom(2)
+	if len(feeds) != 1 || feeds[0].Name != "Other" || feeds[0].LastSyncedAt.IsZero() {
+		t.Fatalf("AdminPostICalFeed saved %+v", feeds)
+	}
+	feedID := strconv.Itoa(feeds[0].ID)
+	defer testDB.DeleteICalFeed(feeds[0].ID)
+
+	blocks := externalBlocks(t, 2, feeds[0].ID)
+	if len(blocks) != 1 {
+		t.Fatalf("AdminPostICalFeed made blocks %+v", blocks)
+	}
+
+	req, _ = adminRequest("GET", "/admin/rooms/2", "2", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminShowRoom).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), cal.server.URL) {
+		t.Error("AdminShowRoom does not list the imported calendar")
+	}
+
+	// imported blocks are not opened by hand
+	blockID := strconv.Itoa(blocks[0].ID)
+	req, ctx = adminRequest("POST", "/admin/blocks/"+blockID+"/delete", blockID, nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteBlock).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || session.GetString(ctx, "error") == "" {
+		t.Errorf("AdminDeleteBlock of an imported block returned %d", rr.Code)
+	}
+	if _, err := testDB.GetBlockByID(blocks[0].ID); err != nil {
+		t.Errorf("AdminDeleteBlock opened an imported block: %v", err)
+	}
+
+	// the stay is cancelled on the other platform
+	cal.serve(http.StatusOK)
+
+	req, ctx = adminRequest("POST", "/admin/ical-feeds/"+feedID+"/sync", feedID, nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminSyncICalFeed).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || session.GetString(ctx, "flash") != "Calendar imported: 0 stays blocked, 1 opened" {
+		t.Errorf("AdminSyncICalFeed returned %d with %q", rr.Code, session.GetString(ctx, "flash"))
+	}
+
+	// the calendar can't be reached
+	cal.serve(http.StatusNotFound)
+
+	req, ctx = adminRequest("POST", "/admin/ical-feeds/"+feedID+"/sync", feedID, nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminSyncICalFeed).ServeHTTP(rr, req)
+
+	if !strings.Contains(session.GetString(ctx, "error"), "404") {
+		t.Errorf("AdminSyncICalFeed of a missing calendar set error %q", session.GetString(ctx, "error"))
+	}
+
+	cal.serve(http.StatusOK, "imported@other 20580301 20580304")
+	if _, err := Repo.syncICalFeed(context.Background(), feeds[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ = adminRequest("POST", "/admin/ical-feeds/"+feedID+"/delete", feedID, nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminDeleteICalFeed).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms/2" {
+		t.Fatalf("AdminDeleteICalFeed returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if _, err := testDB.GetICalFeedByID(feeds[0].ID); err == nil {
+		t.Error("AdminDeleteICalFeed kept the feed")
+	}
+	if len(externalBlocks(t, 2, feeds[0].ID)) != 0 {
+		t.Error("AdminDeleteICalFeed kept the blocks of the feed")
+	}
+
+	req, _ = adminRequest("POST", "/admin/ical-feeds/100000/sync", "100000", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminSyncICalFeed).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("AdminSyncICalFeed of a missing feed returned %d", rr.Code)
+	}
+}
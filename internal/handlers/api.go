@@ -0,0 +1,629 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/apikeys"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/forms"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/stayrules"
+	"github.com/go-chi/chi"
+)
+
+// maxAPIBodySize is the largest request body the API reads
+const maxAPIBodySize = 64 << 10
+
+// apiDate is how the API writes and reads dates
+const apiDate = "2006-01-02"
+
+// apiEnvelope wraps every successful API response
+type apiEnvelope struct {
+	Data interface{} `json:"data"`
+}
+
+// apiErrorEnvelope wraps every failed API response
+type apiErrorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+// apiError says why an API request failed. Fields has the problem with each
+// invalid field of the request, if any
+type apiError struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// apiRoom is a room as the API shows it. Amounts are in cents of Currency
+type apiRoom struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	NightlyRate  int    `json:"nightly_rate"`
+	Currency     string `json:"currency"`
+	MaxOccupancy int    `json:"max_occupancy"`
+	Beds         int    `json:"beds"`
+}
+
+// apiNight is the price of one night of a quote
+type apiNight struct {
+	Date   string `json:"date" format:"date"`
+	Amount int    `json:"amount"`
+}
+
+// apiFee is a fee or tax line of a quote
+type apiFee struct {
+	Name   string `json:"name"`
+	Tax    bool   `json:"tax"`
+	Amount int    `json:"amount"`
+}
+
+// apiQuote is the price of a stay, in cents of Currency
+type apiQuote struct {
+	Nights    []apiNight `json:"nights"`
+	Subtotal  int        `json:"subtotal"`
+	PromoCode string     `json:"promo_code,omitempty"`
+	Discount  int        `json:"discount"`
+	Guests    int        `json:"guests"`
+	Fees      []apiFee   `json:"fees"`
+	FeesTotal int        `json:"fees_total"`
+	TaxTotal  int        `json:"tax_total"`
+	Total     int        `json:"total"`
+	Currency  string     `json:"currency"`
+}
+
+// apiOffer is a room free for the stay asked about, with its price
+type apiOffer struct {
+	Room  apiRoom  `json:"room"`
+	Quote apiQuote `json:"quote"`
+}
+
+// apiAvailability answers an availability query. When no room is free it
+// suggests other stays instead, if there are any
+type apiAvailability struct {
+	StartDate   string          `json:"start_date" format:"date"`
+	EndDate     string          `json:"end_date" format:"date"`
+	Adults      int             `json:"adults"`
+	Children    int             `json:"children"`
+	Rooms       []apiOffer      `json:"rooms"`
+	Suggestions *apiSuggestions `json:"suggestions,omitempty"`
+}
+
+// apiSuggestions are the stays suggested when no room is free for the one
+// asked about. Dates are the nearest stays of the same length, Partial the
+// rooms free for part of it
+type apiSuggestions struct {
+	Dates   []apiStay `json:"dates"`
+	Partial []apiStay `json:"partial"`
+}
+
+// apiStay is a suggested stay and the rooms free for it
+type apiStay struct {
+	StartDate string     `json:"start_date" format:"date"`
+	EndDate   string     `json:"end_date" format:"date"`
+	Rooms     []apiOffer `json:"rooms"`
+}
+
+// apiReservation is a reservation as the API shows it
+type apiReservation struct {
+	ConfirmationCode   string   `json:"confirmation_code"`
+	Status             string   `json:"status"`
+	RoomID             int      `json:"room_id"`
+	RoomName           string   `json:"room_name"`
+	StartDate          string   `json:"start_date" format:"date"`
+	EndDate            string   `json:"end_date" format:"date"`
+	Adults             int      `json:"adults"`
+	Children           int      `json:"children"`
+	FirstName          string   `json:"first_name"`
+	LastName           string   `json:"last_name"`
+	Email              string   `json:"email" format:"email"`
+	Phone              string   `json:"phone"`
+	Quote              apiQuote `json:"quote"`
+	CancellationPolicy string   `json:"cancellation_policy"`
+	Deposit            int      `json:"deposit"`
+	BalanceDueDate     string   `json:"balance_due_date,omitempty" format:"date"`
+	// Payment is how to pay the deposit of a reservation waiting for it
+	Payment *apiPayment `json:"payment,omitempty"`
+}
+
+// apiPayment tells the client how to pay for a new reservation at the gateway
+type apiPayment struct {
+	Amount       int    `json:"amount"`
+	Currency     string `json:"currency"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// apiReservationRequest is the body of a request to book a room
+type apiReservationRequest struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+	Adults    int    `json:"adults"`
+	Children  int    `json:"children"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email" format:"email"`
+	Phone     string `json:"phone"`
+	PromoCode string `json:"promo_code"`
+}
+
+// APIRooms lists the rooms
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	out := make([]apiRoom, 0, len(rooms))
+	for _, room := range rooms {
+		out = append(out, toAPIRoom(room))
+	}
+
+	writeAPI(w, http.StatusOK, out)
+}
+
+// APIAvailability lists the rooms free from start to end that sleep the
+// guests and whose stay rules allow the stay, with their prices. room_id
+// narrows the search to one room
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	start, end, fields := parseAPIStay(query.Get("start_date"), query.Get("end_date"))
+
+	adults, children, err := guestCounts(query)
+	if err != nil {
+		fields["adults"] = guestsMessage
+	}
+
+	roomID := 0
+	if v := query.Get("room_id"); v != "" {
+		roomID, err = strconv.Atoi(v)
+		if err != nil {
+			fields["room_id"] = "Must be a whole number"
+		}
+	}
+
+	if len(fields) > 0 {
+		writeAPIError(w, apiError{Status: http.StatusBadRequest, Message: "invalid query", Fields: fields})
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(start, end, adults+children, m.Pricing.Now())
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	offers := []apiOffer{}
+	for _, room := range rooms {
+		if roomID != 0 && room.ID != roomID {
+			continue
+		}
+		if stayrules.Check(rules, room.ID, start, end, m.Pricing.Now()) != nil {
+			continue
+		}
+
+		quote, err := m.Pricing.Quote(room.ID, start, end, adults+children)
+		if err != nil {
+			m.apiRepoError(w, err)
+			return
+		}
+
+		offers = append(offers, apiOffer{Room: toAPIRoom(room), Quote: toAPIQuote(quote)})
+	}
+
+	out := apiAvailability{
+		StartDate: start.Format(apiDate),
+		EndDate:   end.Format(apiDate),
+		Adults:    adults,
+		Children:  children,
+		Rooms:     offers,
+	}
+
+	if len(offers) == 0 {
+		s, err := m.suggestStays(start, end, adults+children, roomID)
+		if err != nil {
+			m.apiRepoError(w, err)
+			return
+		}
+		if !s.empty() {
+			out.Suggestions = toAPISuggestions(s)
+		}
+	}
+
+	writeAPI(w, http.StatusOK, out)
+}
+
+// APICreateReservation books a room. Like the reservation form, a stay with a
+// deposit waits for its payment, which the client takes at the gateway with
+// the client secret in the response
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var req apiReservationRequest
+	if !readAPI(w, r, &req) {
+		return
+	}
+
+	start, end, fields := parseAPIStay(req.StartDate, req.EndDate)
+
+	// the fields are checked as the reservation form checks them
+	values := url.Values{}
+	values.Set("first_name", req.FirstName)
+	values.Set("last_name", req.LastName)
+	values.Set("email", req.Email)
+	values.Set("promo_code", req.PromoCode)
+
+	form := forms.New(values)
+	form.Required("first_name", "last_name", "email")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+	form.IsPromoCode("promo_code")
+	for field := range form.Errors {
+		fields[field] = form.Errors.Get(field)
+	}
+
+	if req.Adults == 0 && req.Children == 0 {
+		req.Adults = 1
+	}
+	if req.Adults < 1 || req.Children < 0 {
+		fields["adults"] = guestsMessage
+	}
+	if req.RoomID == 0 {
+		fields["room_id"] = "This field cannot be blank"
+	}
+
+	if len(fields) > 0 {
+		writeAPIError(w, apiError{Status: http.StatusUnprocessableEntity, Message: "invalid reservation", Fields: fields})
+		return
+	}
+
+	res := models.Reservation{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    req.RoomID,
+		Adults:    req.Adults,
+		Children:  req.Children,
+	}
+
+	room, err := m.DB.GetRoomByID(res.RoomID)
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	if reason := roomTooSmall(room, res.Guests()); reason != "" {
+		writeAPIError(w, apiError{Status: http.StatusUnprocessableEntity, Message: reason})
+		return
+	}
+
+	err = m.checkStay(res.RoomID, res.StartDate, res.EndDate)
+	var violation *stayrules.Violation
+	if errors.As(err, &violation) {
+		writeAPIError(w, apiError{Status: http.StatusUnprocessableEntity, Message: violation.Reason})
+		return
+	}
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	res.Quote, err = m.Pricing.QuoteWithPromo(res.RoomID, res.StartDate, res.EndDate, res.Guests(), req.PromoCode)
+	var promoErr *pricing.PromoError
+	if errors.As(err, &promoErr) {
+		writeAPIError(w, apiError{
+			Status:  http.StatusUnprocessableEntity,
+			Message: "invalid reservation",
+			Fields:  map[string]string{"promo_code": promoErr.Reason},
+		})
+		return
+	}
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	err = m.schedulePayment(&res, room)
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	res, intent, err := m.placeBooking(r.Context(), res)
+	if errors.Is(err, errGatewayDown) {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, apiError{Status: http.StatusServiceUnavailable, Message: "payments are unavailable, please try again later"})
+		return
+	}
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	out := toAPIReservation(res)
+	if intent.ID != "" {
+		out.Payment = &apiPayment{Amount: res.Deposit, Currency: pricing.BaseCurrency(), ClientSecret: intent.ClientSecret}
+	}
+
+	w.Header().Set("Location", "/api/v1/reservations/"+res.ConfirmationCode)
+	writeAPI(w, http.StatusCreated, out)
+}
+
+// APIReservation shows a reservation by its confirmation code
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByCode(chi.URLParam(r, "code"))
+	if err != nil {
+		m.apiRepoError(w, err)
+		return
+	}
+
+	writeAPI(w, http.StatusOK, toAPIReservation(res))
+}
+
+// APIAuth lets through API requests sent with a key that has scope and is
+// within its rate limit. Requests without a working key get 401, keys
+// without the scope 403, and keys over their limit 429 with Retry-After
+func (m *Repository) APIAuth(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := m.Pricing.Now()
+
+			key, err := m.apiKey(r.Header.Get(apikeys.Header), now)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", apikeys.Header)
+				writeAPIError(w, apiError{Status: http.StatusUnauthorized, Message: err.Error()})
+				return
+			}
+
+			if !key.HasScope(scope) {
+				writeAPIError(w, apiError{Status: http.StatusForbidden, Message: fmt.Sprintf("The API key does not have the %s scope", scope)})
+				return
+			}
+
+			remaining, retryAfter, ok := m.APILimiter.Allow(key.ID, key.RateLimit, now)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(key.RateLimit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !ok {
+				seconds := int((retryAfter + time.Second - 1) / time.Second)
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				writeAPIError(w, apiError{Status: http.StatusTooManyRequests, Message: fmt.Sprintf("The API key is over its limit of %d requests a minute", key.RateLimit)})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKey finds the stored key a request was sent with, and says what is
+// wrong with it when there is none that works
+func (m *Repository) apiKey(plain string, now time.Time) (models.APIKey, error) {
+	if plain == "" {
+		return models.APIKey{}, fmt.Errorf("Send your API key in the %s header", apikeys.Header)
+	}
+
+	invalid := errors.New("The API key is not valid")
+
+	prefix, ok := apikeys.Prefix(plain)
+	if !ok {
+		return models.APIKey{}, invalid
+	}
+
+	key, err := m.DB.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			m.App.ErrorLog.Println(err)
+		}
+		return models.APIKey{}, invalid
+	}
+
+	if !apikeys.Matches(plain, key.Hash) {
+		return models.APIKey{}, invalid
+	}
+
+	if key.Expired(now) {
+		return models.APIKey{}, fmt.Errorf("The API key expired on %s", key.ExpiresOn.Format(apiDate))
+	}
+
+	return key, nil
+}
+
+// APINotFound answers API requests for paths the API doesn't have
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, apiError{Status: http.StatusNotFound, Message: "not found"})
+}
+
+// APIMethodNotAllowed answers API requests with a method the path doesn't take
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, apiError{Status: http.StatusMethodNotAllowed, Message: "method not allowed"})
+}
+
+// parseAPIStay reads the dates of a stay, with the problem with each of them
+// in fields
+func parseAPIStay(start, end string) (time.Time, time.Time, map[string]string) {
+	fields := make(map[string]string)
+
+	startDate, err := time.Parse(apiDate, start)
+	if err != nil {
+		fields["start_date"] = "Must be a date like 2050-01-31"
+	}
+
+	endDate, err := time.Parse(apiDate, end)
+	if err != nil {
+		fields["end_date"] = "Must be a date like 2050-01-31"
+	}
+
+	if len(fields) == 0 && !endDate.After(startDate) {
+		fields["end_date"] = "Must be after the start date"
+	}
+
+	return startDate, endDate, fields
+}
+
+// readAPI decodes the JSON body of a request into v. It sends the error
+// response and returns false when the body isn't JSON v can take
+func readAPI(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeAPIError(w, apiError{Status: http.StatusUnsupportedMediaType, Message: "the request body must be application/json"})
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err != nil {
+		writeAPIError(w, apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf("invalid JSON body: %v", err)})
+		return false
+	}
+
+	return true
+}
+
+// writeAPI sends a successful API response
+func writeAPI(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, status, apiEnvelope{Data: data})
+}
+
+// writeAPIError sends a failed API response
+func writeAPIError(w http.ResponseWriter, e apiError) {
+	if e.Message == "" {
+		e.Message = http.StatusText(e.Status)
+	}
+
+	writeJSON(w, e.Status, apiErrorEnvelope{Error: e})
+}
+
+// apiRepoError sends the API response for an error from the repository: 404, 409
+// or 400 for errors of the client, and 500 for the rest, which is logged
+func (m *Repository) apiRepoError(w http.ResponseWriter, err error) {
+	status := helpers.ErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, apiError{Status: status})
+		return
+	}
+
+	writeAPIError(w, apiError{Status: status, Message: err.Error()})
+}
+
+// writeJSON sends v as the JSON body of a response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+func toAPIRoom(room models.Room) apiRoom {
+	return apiRoom{
+		ID:           room.ID,
+		Name:         room.RoomName,
+		NightlyRate:  room.NightlyRate,
+		Currency:     pricing.BaseCurrency(),
+		MaxOccupancy: room.MaxOccupancy,
+		Beds:         room.Beds,
+	}
+}
+
+func toAPISuggestions(s suggestions) *apiSuggestions {
+	out := &apiSuggestions{Dates: []apiStay{}, Partial: []apiStay{}}
+
+	for _, window := range s.Windows {
+		out.Dates = append(out.Dates, toAPIStay(window.StartDate, window.EndDate, window.Options))
+	}
+	for _, option := range s.Partial {
+		out.Partial = append(out.Partial, toAPIStay(option.StartDate, option.EndDate, []stayOption{option}))
+	}
+
+	return out
+}
+
+func toAPIStay(start, end time.Time, options []stayOption) apiStay {
+	stay := apiStay{
+		StartDate: start.Format(apiDate),
+		EndDate:   end.Format(apiDate),
+		Rooms:     []apiOffer{},
+	}
+	for _, option := range options {
+		stay.Rooms = append(stay.Rooms, apiOffer{Room: toAPIRoom(option.Room), Quote: toAPIQuote(option.Quote)})
+	}
+	return stay
+}
+
+func toAPIQuote(quote models.Quote) apiQuote {
+	out := apiQuote{
+		Nights:    make([]apiNight, 0, len(quote.Nights)),
+		Subtotal:  quote.Subtotal,
+		PromoCode: quote.PromoCode,
+		Discount:  quote.Discount,
+		Guests:    quote.Guests,
+		Fees:      make([]apiFee, 0, len(quote.Fees)),
+		FeesTotal: quote.FeesTotal,
+		TaxTotal:  quote.TaxTotal,
+		Total:     quote.Total,
+		Currency:  pricing.BaseCurrency(),
+	}
+
+	for _, night := range quote.Nights {
+		out.Nights = append(out.Nights, apiNight{Date: night.Date.Format(apiDate), Amount: night.Amount})
+	}
+	for _, fee := range quote.Fees {
+		out.Fees = append(out.Fees, apiFee{Name: fee.Name, Tax: fee.Tax, Amount: fee.Amount})
+	}
+
+	return out
+}
+
+func toAPIReservation(res models.Reservation) apiReservation {
+	out := apiReservation{
+		ConfirmationCode:   res.ConfirmationCode,
+		Status:             res.Status,
+		RoomID:             res.RoomID,
+		RoomName:           res.Room.RoomName,
+		StartDate:          res.StartDate.Format(apiDate),
+		EndDate:            res.EndDate.Format(apiDate),
+		Adults:             res.Adults,
+		Children:           res.Children,
+		FirstName:          res.FirstName,
+		LastName:           res.LastName,
+		Email:              res.Email,
+		Phone:              res.Phone,
+		Quote:              toAPIQuote(res.Quote),
+		CancellationPolicy: res.Policy.Name,
+		Deposit:            res.Deposit,
+	}
+
+	if out.Status == "" {
+		out.Status = models.ReservationConfirmed
+	}
+	if !res.BalanceDueDate.IsZero() {
+		out.BalanceDueDate = res.BalanceDueDate.Format(apiDate)
+	}
+
+	return out
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/apikeys"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// apiResponse is the envelope of an API response, with the data left raw
+type apiResponse struct {
+	Data json.RawMessage `json:"data"`
+	Error *apiError `json:"error"`
+}
+
+// allScopesKey is an API key with every scope, which callAPI sends
+var allScopesKey string
+
+// testAPIKey adds an API key with the given limit, expiry and scopes, and
+// returns the key to send
+func testAPIKey(t *testing.T, rateLimit int, expiresOn time.Time, scopes ...string) string {
+	t.Helper()
+
+	key, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testDB.InsertAPIKey(models.APIKey{Name: "Test " + prefix, Prefix: prefix, Hash: hash, Scopes: scopes, RateLimit: rateLimit, ExpiresOn: expiresOn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// callAPI sends a request through the routes with a key that may do
+// anything, and decodes its envelope
+func callAPI(t *testing.T, method, target, contentType string, body io.Reader) (*httptest.ResponseRecorder, apiResponse) {
+	t.Helper()
+
+	if allScopesKey == "" {
+		allScopesKey = testAPIKey(t, 100000, time.Date(2099, time.December, 31, 0, 0, 0, 0, time.UTC), models.APIScopes...)
+	}
+
+	return callAPIWithKey(t, allScopesKey, method, target, contentType, body)
+}
+
+// callAPIWithKey sends a request through the routes with key, and decodes its envelope
+func callAPIWithKey(t *testing.T, key, method, target, contentType string, body io.Reader) (*httptest.ResponseRecorder, apiResponse) {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if key != "" {
+		req.Header.Set(apikeys.Header, key)
+	}
+
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s answered with %q, wanted application/json", method, target, ct)
+	}
+
+	var resp apiResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s did not answer with JSON: %v", method, target, err)
+	}
+	if (resp.Error != nil) != (rr.Code >= 400) {
+		t.Errorf("%s %s answered %d with error %+v", method, target, rr.Code, resp.Error)
+	}
+	if resp.Error != nil && resp.Error.Status != rr.Code {
+		t.Errorf("%s %s answered %d with an error for %d", method, target, rr.Code, resp.Error.Status)
+	}
+
+	return rr, resp
+}
+
+func TestRepository_APIRooms(t *testing.T) {
+	rr, resp := callAPI(t, "GET", "/api/v1/rooms", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("APIRooms returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	var rooms []apiRoom
+	if err := json.Unmarshal(resp.Data, &rooms); err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 || rooms[0].Name != "General's Quarters" || rooms[1].MaxOccupancy != 4 || rooms[0].Currency != "USD" {
+		t.Errorf("APIRooms returned %+v", rooms)
+	}
+
+	testDB.SetFault("AllRooms", func(args ...interface{}) error { return errors.New("some error") })
+	defer testDB.ClearFaults()
+
+	rr, resp = callAPI(t, "GET", "/api/v1/rooms", "", nil)
+	if rr.Code != http.StatusInternalServerError || resp.Error.Message != "Internal Server Error" {
+		t.Errorf("APIRooms for a database error returned %d with %+v", rr.Code, resp.Error)
+	}
+}
+
+func TestRepository_APIAvailability(t *testing.T) {
+	tests := []struct {
+		name string
+		query string
+		expectedStatusCode int
+		rooms []int
+		field string
+	}{
+		{"both rooms", "start_date=2056-05-01&end_date=2056-05-03", http.StatusOK, []int{1, 2}, ""},
+		{"family", "start_date=2056-05-01&end_date=2056-05-03&adults=2&children=1", http.StatusOK, []int{2}, ""},
+		{"one room", "start_date=2056-05-01&end_date=2056-05-03&room_id=1", http.StatusOK, []int{1}, ""},
+		{"booked", "start_date=2050-01-01&end_date=2050-01-02", http.StatusOK, nil, ""},
+		{"missing start", "end_date=2056-05-03", http.StatusBadRequest, nil, "start_date"},
+		{"end before start", "start_date=2056-05-03&end_date=2056-05-01", http.StatusBadRequest, nil, "end_date"},
+		{"no adults", "start_date=2056-05-01&end_date=2056-05-03&adults=0", http.StatusBadRequest, nil, "adults"},
+		{"invalid room", "start_date=2056-05-01&end_date=2056-05-03&room_id=one", http.StatusBadRequest, nil, "room_id"},
+	}
+
+	for _, e := range tests {
+		rr, resp := callAPI(t, "GET", "/api/v1/availability?"+e.query, "", nil)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("APIAvailability for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.field != "" {
+			if resp.Error.Fields[e.field] == "" {
+				t.Errorf("APIAvailability for %s did not point at %s: %+v", e.name, e.field, resp.Error)
+			}
+			continue
+		}
+
+		var availability apiAvailability
+		if err := json.Unmarshal(resp.Data, &availability); err != nil {
+			t.Fatal(err)
+		}
+
+		var rooms []int
+		for _, offer := range availability.Rooms {
+			rooms = append(rooms, offer.Room.ID)
+			if offer.Quote.Total == 0 || len(offer.Quote.Nights) != 2 {
+				t.Errorf("APIAvailability for %s quoted %+v", e.name, offer.Quote)
+			}
+		}
+		if len(rooms) != len(e.rooms) {
+			t.Errorf("APIAvailability for %s offered rooms %v, wanted %v", e.name, rooms, e.rooms)
+			continue
+		}
+		for i := range rooms {
+			if rooms[i] != e.rooms[i] {
+				t.Errorf("APIAvailability for %s offered rooms %v, wanted %v", e.name, rooms, e.rooms)
+			}
+		}
+	}
+}
+
+func TestRepository_APICreateReservation(t *testing.T) {
+	valid := `{"room_id": 2, "start_date": "2056-06-01", "end_date": "2056-06-03", "adults": 2, "children": 1,
+		"first_name": "Johny", "last_name": "Smith", "email": "api@example.com", "phone": "123 456"}`
+
+	rr, resp := callAPI(t, "POST", "/api/v1/reservations", "application/json", strings.NewReader(valid))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("APICreateReservation returned wrong response code: got %d, wanted %d: %+v", rr.Code, http.StatusCreated, resp.Error)
+	}
+
+	var res apiReservation
+	if err := json.Unmarshal(resp.Data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ConfirmationCode == "" || rr.Header().Get("Location") != "/api/v1/reservations/"+res.ConfirmationCode {
+		t.Errorf("APICreateReservation returned code %q at %q", res.ConfirmationCode, rr.Header().Get("Location"))
+	}
+	if res.RoomName != "Major's Suite" || res.Adults != 2 || res.Children != 1 || res.Quote.Guests != 3 || len(res.Quote.Nights) != 2 {
+		t.Errorf("APICreateReservation returned %+v", res)
+	}
+	if res.Deposit > 0 && (res.Status != "pending_payment" || res.Payment == nil || res.Payment.ClientSecret == "" || res.Payment.Amount != res.Deposit) {
+		t.Errorf("APICreateReservation did not ask for the deposit: %+v", res)
+	}
+
+	// the new reservation is found by its code
+	rr, resp = callAPI(t, "GET", "/api/v1/reservations/"+res.ConfirmationCode, "", nil)
+	var found apiReservation
+	json.Unmarshal(resp.Data, &found)
+	if rr.Code != http.StatusOK || found.ConfirmationCode != res.ConfirmationCode || found.Email != "api@example.com" {
+		t.Errorf("APIReservation returned %d with %+v", rr.Code, found)
+	}
+
+	tests := []struct {
+		name string
+		contentType string
+		body string
+		expectedStatusCode int
+		field string
+	}{
+		{"form body", "application/x-www-form-urlencoded", "room_id=1", http.StatusUnsupportedMediaType, ""},
+		{"broken JSON", "application/json", `{"room_id": 1`, http.StatusBadRequest, ""},
+		{"unknown field", "application/json", `{"room": 1}`, http.StatusBadRequest, ""},
+		{"invalid fields", "application/json", `{"room_id": 1, "start_date": "2056-06-01", "end_date": "2056-06-03", "first_name": "Jo", "last_name": "Smith", "email": "nope"}`, http.StatusUnprocessableEntity, "email"},
+		{"missing dates", "application/json", `{"room_id": 1, "first_name": "Johny", "last_name": "Smith", "email": "api@example.com"}`, http.StatusUnprocessableEntity, "start_date"},
+		{"invalid promo code", "application/json", `{"room_id": 1, "start_date": "2056-06-01", "end_date": "2056-06-03", "first_name": "Johny", "last_name": "Smith", "email": "api@example.com", "promo_code": "NOPE"}`, http.StatusUnprocessableEntity, "promo_code"},
+		{"too many guests", "application/json", `{"room_id": 1, "start_date": "2056-06-01", "end_date": "2056-06-03", "adults": 3, "first_name": "Johny", "last_name": "Smith", "email": "api@example.com"}`, http.StatusUnprocessableEntity, ""},
+		{"missing room", "application/json", `{"room_id": 100, "start_date": "2056-06-01", "end_date": "2056-06-03", "first_name": "Johny", "last_name": "Smith", "email": "api@example.com"}`, http.StatusNotFound, ""},
+		{"room taken", "application/json", valid, http.StatusConflict, ""},
+	}
+
+	for _, e := range tests {
+		rr, resp := callAPI(t, "POST", "/api/v1/reservations", e.contentType, strings.NewReader(e.body))
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("APICreateReservation for %s returned wrong response code: got %d, wanted %d: %+v", e.name, rr.Code, e.expectedStatusCode, resp.Error)
+			continue
+		}
+		if e.field != "" && resp.Error.Fields[e.field] == "" {
+			t.Errorf("APICreateReservation for %s did not point at %s: %+v", e.name, e.field, resp.Error)
+		}
+	}
+}
+
+func TestRepository_APIErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		method string
+		target string
+		expectedStatusCode int
+	}{
+		{"unknown code", "GET", "/api/v1/reservations/NOPE", http.StatusNotFound},
+		{"unknown path", "GET", "/api/v1/nope", http.StatusNotFound},
+		{"wrong method", "DELETE", "/api/v1/rooms", http.StatusMethodNotAllowed},
+	}
+
+	for _, e := range tests {
+		rr, _ := callAPI(t, e.method, e.target, "", nil)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("API for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_APIAuth(t *testing.T) {
+	future := time.Date(2099, time.December, 31, 0, 0, 0, 0, time.UTC)
+	reader := testAPIKey(t, 100, future, models.ScopeReadAvailability)
+	expired := testAPIKey(t, 100, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), models.ScopeReadAvailability)
+	revoked := testAPIKey(t, 100, future, models.ScopeReadAvailability)
+
+	prefix, _ := apikeys.Prefix(revoked)
+	k, _ := testDB.GetAPIKeyByPrefix(prefix)
+	testDB.DeleteAPIKey(k.ID)
+
+	// change the last character of the secret, to one it isn't already
+	wrongSecret := reader[:len(reader)-1] + "x"
+	if wrongSecret == reader {
+		wrongSecret = reader[:len(reader)-1] + "y"
+	}
+
+	tests := []struct {
+		name string
+		key string
+		method string
+		target string
+		expectedStatusCode int
+	}{
+		{"no key", "", "GET", "/api/v1/rooms", http.StatusUnauthorized},
+		{"not a key", "letmein", "GET", "/api/v1/rooms", http.StatusUnauthorized},
+		{"wrong secret", wrongSecret, "GET", "/api/v1/rooms", http.StatusUnauthorized},
+		{"expired", expired, "GET", "/api/v1/rooms", http.StatusUnauthorized},
+		{"revoked", revoked, "GET", "/api/v1/rooms", http.StatusUnauthorized},
+		{"in scope", reader, "GET", "/api/v1/rooms", http.StatusOK},
+		{"out of scope", reader, "POST", "/api/v1/reservations", http.StatusForbidden},
+		{"reading reservations", reader, "GET", "/api/v1/reservations/NOPE", http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		rr, resp := callAPIWithKey(t, e.key, e.method, e.target, "application/json", strings.NewReader("{}"))
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("API for %s returned wrong response code: got %d, wanted %d: %+v", e.name, rr.Code, e.expectedStatusCode, resp.Error)
+		}
+		if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") != apikeys.Header {
+			t.Errorf("API for %s did not say how to authenticate", e.name)
+		}
+	}
+}
+
+func TestRepository_APIAuthRateLimit(t *testing.T) {
+	key := testAPIKey(t, 2, time.Date(2099, time.December, 31, 0, 0, 0, 0, time.UTC), models.ScopeReadAvailability)
+
+	now := time.Date(2056, time.May, 1, 12, 0, 0, 0, time.UTC)
+	restore := withNow(now)
+	defer restore()
+
+	for i := 1; i >= 0; i-- {
+		rr, _ := callAPIWithKey(t, key, "GET", "/api/v1/rooms", "", nil)
+		if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != strconv.Itoa(i) {
+			t.Errorf("API within the limit returned %d with %q left", rr.Code, rr.Header().Get("X-RateLimit-Remaining"))
+		}
+	}
+
+	Repo.Pricing.Now = func() time.Time { return now.Add(15500 * time.Millisecond) }
+
+	rr, resp := callAPIWithKey(t, key, "GET", "/api/v1/rooms", "", nil)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "45" {
+		t.Errorf("API over the limit returned %d with Retry-After %q: %+v", rr.Code, rr.Header().Get("Retry-After"), resp.Error)
+	}
+
+	// the next minute the key may make requests again
+	Repo.Pricing.Now = func() time.Time { return now.Add(time.Minute) }
+
+	if rr, _ := callAPIWithKey(t, key, "GET", "/api/v1/rooms", "", nil); rr.Code != http.StatusOK {
+		t.Errorf("API in the next minute returned %d", rr.Code)
+	}
+}
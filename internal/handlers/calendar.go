@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/stayrules"
+	"github.com/go-chi/chi"
+)
+
+// calendarDays is how many days a room calendar covers when the request
+// doesn't say, maxCalendarDays the most it covers
+const (
+	calendarDays    = 90
+	maxCalendarDays = 366
+)
+
+// calendarDay is one day of a room calendar. The night starting on the day
+// is available when nobody booked or blocked it and it isn't over
+type calendarDay struct {
+	Date      string `json:"date"`
+	Available bool   `json:"available"`
+	Booked    bool   `json:"booked"`
+	Blocked   bool   `json:"blocked"`
+	// MinNights and MaxNights bound stays arriving on the day, MaxNights is
+	// left out when there is no upper bound
+	MinNights   int  `json:"min_nights"`
+	MaxNights   int  `json:"max_nights,omitempty"`
+	NoArrival   bool `json:"no_arrival"`
+	NoDeparture bool `json:"no_departure"`
+	// Price is what the night costs in cents of the base currency, PriceLabel
+	// is that price in the currency the guest picked
+	Price      int    `json:"price"`
+	PriceLabel string `json:"price_label"`
+}
+
+// roomCalendar is the answer of RoomCalendarJSON
+type roomCalendar struct {
+	RoomID    int           `json:"room_id"`
+	StartDate string        `json:"start_date"`
+	EndDate   string        `json:"end_date"`
+	Currency  string        `json:"currency"`
+	Days      []calendarDay `json:"days"`
+}
+
+// RoomCalendarJSON tells date pickers, day by day from start up to but not
+// including end, which nights of a room can be booked, the stay rules for
+// arriving and leaving on each day and what each night costs. Without dates
+// it covers calendarDays from today
+func (m *Repository) RoomCalendarJSON(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		availabilityError(w, http.StatusNotFound, "room not found")
+		return
+	}
+
+	now := m.Pricing.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	layout := "2006-01-02"
+	query := r.URL.Query()
+
+	start := today
+	if v := query.Get("start"); v != "" {
+		start, err = time.Parse(layout, v)
+		if err != nil {
+			availabilityError(w, http.StatusBadRequest, "invalid start date")
+			return
+		}
+	}
+
+	end := start.AddDate(0, 0, calendarDays)
+	if v := query.Get("end"); v != "" {
+		end, err = time.Parse(layout, v)
+		if err != nil {
+			availabilityError(w, http.StatusBadRequest, "invalid end date")
+			return
+		}
+	}
+
+	if !end.After(start) || end.After(start.AddDate(0, 0, maxCalendarDays)) {
+		availabilityError(w, http.StatusBadRequest, "the end date must be after the start date and at most a year later")
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if errors.Is(err, repository.ErrNotFound) {
+		availabilityError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if err != nil {
+		availabilityError(w, helpers.ErrorStatus(err), "error querying database")
+		return
+	}
+
+	restrictions, err := m.DB.RoomRestrictionsForRoom(roomID, start, now)
+	if err != nil {
+		availabilityError(w, helpers.ErrorStatus(err), "error querying database")
+		return
+	}
+
+	plans, err := m.DB.RatePlansForRoom(roomID, start, end)
+	if err != nil {
+		availabilityError(w, helpers.ErrorStatus(err), "error querying database")
+		return
+	}
+
+	rules, err := m.DB.StayRulesForRoom(roomID)
+	if err != nil {
+		availabilityError(w, helpers.ErrorStatus(err), "error querying database")
+		return
+	}
+
+	currency := m.guestCurrency(r)
+
+	cal := roomCalendar{
+		RoomID:    roomID,
+		StartDate: start.Format(layout),
+		EndDate:   end.Format(layout),
+		Currency:  pricing.BaseCurrency(),
+		Days:      []calendarDay{},
+	}
+	if currency.Code != "" {
+		cal.Currency = currency.Code
+	}
+
+	for date := start; date.Before(end); date = date.AddDate(0, 0, 1) {
+		limits := stayrules.ForDay(rules, roomID, date, now)
+		price := pricing.NightPrice(room, plans, date)
+
+		d := calendarDay{
+			Date:        date.Format(layout),
+			MinNights:   limits.MinNights,
+			MaxNights:   limits.MaxNights,
+			NoArrival:   limits.NoArrival || date.Before(today),
+			NoDeparture: limits.NoDeparture,
+			Price:       price.Amount,
+			PriceLabel:  pricing.FormatIn(price.Amount, currency),
+		}
+
+		for _, rr := range restrictions {
+			if date.Before(rr.StartDate) || !date.Before(rr.EndDate) {
+				continue
+			}
+			if rr.ReservationID != 0 {
+				d.Booked = true
+			} else {
+				d.Blocked = true
+			}
+		}
+
+		d.Available = !d.Booked && !d.Blocked && !date.Before(today)
+		cal.Days = append(cal.Days, d)
+	}
+
+	out, _ := json.MarshalIndent(cal, "", "    ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// guestCurrency is the currency the guest picked to see prices in, the zero
+// rate, which formats in the base currency, when they didn't pick one or it
+// lost its rate
+func (m *Repository) guestCurrency(r *http.Request) models.ExchangeRate {
+	code := m.App.Session.GetString(r.Context(), "currency")
+	if code == "" {
+		return models.ExchangeRate{}
+	}
+
+	rate, err := m.DB.GetExchangeRateByCode(code)
+	if err != nil {
+		return models.ExchangeRate{}
+	}
+	return rate
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+)
+
+func TestRepository_RoomCalendarJSON(t *testing.T) {
+	march := func(day int) time.Time {
+		return time.Date(2059, time.March, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	restore := withNow(march(3).Add(10 * time.Hour))
+	defer restore()
+
+	paidTestReservation(t, "2059-03-05", "2059-03-07", "calendar@example.com")
+
+	block, err := testDB.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: march(10), EndDate: march(12)}, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteBlock(block)
+
+	rule := models.StayRule{Name: "Calendar", RoomID: 1, StartDate: march(14), EndDate: march(20), MinNights: 3, MaxNights: 5}
+	rule.ClosedToArrival[march(16).Weekday()] = true
+	rule.ClosedToDeparture[march(17).Weekday()] = true
+	ruleID, err := testDB.InsertStayRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteStayRule(ruleID)
+
+	defer withRate(t, models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 920000})()
+
+	req, _ := http.NewRequest("GET", "/rooms/1/calendar.json?start=2059-03-01&end=2059-03-21", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "currency", "EUR")
+
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("RoomCalendarJSON returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var cal roomCalendar
+	if err := json.Unmarshal(rr.Body.Bytes(), &cal); err != nil {
+		t.Fatal(err)
+	}
+	if cal.RoomID != 1 || cal.StartDate != "2059-03-01" || cal.EndDate != "2059-03-21" || cal.Currency != "EUR" || len(cal.Days) != 20 {
+		t.Fatalf("got calendar %+v", cal)
+	}
+
+	room, _ := testDB.GetRoomByID(1)
+	days := make(map[int]calendarDay)
+	for i, d := range cal.Days {
+		days[i+1] = d
+		if d.Price != room.NightlyRate || d.PriceLabel != pricing.FormatIn(room.NightlyRate, models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 920000}) {
+			t.Errorf("%s costs %d, %q", d.Date, d.Price, d.PriceLabel)
+		}
+	}
+
+	tests := []struct {
+		name string
+		day  int
+		want calendarDay
+	}{
+		{"over", 2, calendarDay{Date: "2059-03-02", MinNights: 1, NoArrival: true}},
+		{"today", 3, calendarDay{Date: "2059-03-03", Available: true, MinNights: 1}},
+		{"booked", 5, calendarDay{Date: "2059-03-05", Booked: true, MinNights: 1}},
+		{"checkout day", 7, calendarDay{Date: "2059-03-07", Available: true, MinNights: 1}},
+		{"blocked", 11, calendarDay{Date: "2059-03-11", Blocked: true, MinNights: 1}},
+		{"minimum stay", 14, calendarDay{Date: "2059-03-14", Available: true, MinNights: 3, MaxNights: 5}},
+		{"no arrivals", 16, calendarDay{Date: "2059-03-16", Available: true, MinNights: 3, MaxNights: 5, NoArrival: true}},
+		{"no departures", 17, calendarDay{Date: "2059-03-17", Available: true, MinNights: 3, MaxNights: 5, NoDeparture: true}},
+	}
+
+	for _, e := range tests {
+		got := days[e.day]
+		got.Price, got.PriceLabel = 0, ""
+		if got != e.want {
+			t.Errorf("%s: got %+v, wanted %+v", e.name, got, e.want)
+		}
+	}
+
+	// without dates it starts today
+	req, _ = http.NewRequest("GET", "/rooms/1/calendar.json", nil)
+	rr = httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	cal = roomCalendar{}
+	json.Unmarshal(rr.Body.Bytes(), &cal)
+	if cal.StartDate != "2059-03-03" || len(cal.Days) != calendarDays || cal.Currency != pricing.BaseCurrency() {
+		t.Errorf("got calendar from %s with %d days in %s", cal.StartDate, len(cal.Days), cal.Currency)
+	}
+
+	errors := []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+	}{
+		{"invalid start", "/rooms/1/calendar.json?start=soon", http.StatusBadRequest},
+		{"invalid end", "/rooms/1/calendar.json?end=later", http.StatusBadRequest},
+		{"end before start", "/rooms/1/calendar.json?start=2059-03-10&end=2059-03-01", http.StatusBadRequest},
+		{"more than a year", "/rooms/1/calendar.json?start=2059-03-01&end=2060-04-01", http.StatusBadRequest},
+		{"missing room", "/rooms/100/calendar.json", http.StatusNotFound},
+		{"invalid room", "/rooms/abc/calendar.json", http.StatusNotFound},
+	}
+
+	for _, e := range errors {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: RoomCalendarJSON returned %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// PostCurrency keeps the currency the guest picked to see prices in and sends
+// them back to the page they picked it on. Picking the base currency, or a
+// currency without a rate, shows prices as they are charged again
+func (m *Repository) PostCurrency(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	back := backTo(r)
+
+	code := r.Form.Get("currency")
+	if code == "" || code == pricing.BaseCurrency() {
+		m.App.Session.Remove(r.Context(), "currency")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	rate, err := m.DB.GetExchangeRateByCode(code)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Remove(r.Context(), "currency")
+		m.App.Session.Put(r.Context(), "error", "We can't show prices in that currency")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "currency", rate.Code)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// backTo is the page of this site a request came from, or the home page. Only
+// the path is kept, so the referrer can't send the guest elsewhere
+func backTo(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || !strings.HasPrefix(ref.Path, "/") || strings.HasPrefix(ref.Path, "//") {
+		return "/"
+	}
+
+	if ref.RawQuery != "" {
+		return ref.Path + "?" + ref.RawQuery
+	}
+	return ref.Path
+}
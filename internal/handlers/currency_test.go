@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// withRate adds an exchange rate until the returned func is called
+func withRate(t *testing.T, rate models.ExchangeRate) func() {
+	t.Helper()
+
+	id, err := testDB.InsertExchangeRate(rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() { testDB.DeleteExchangeRate(id) }
+}
+
+func TestRepository_PostCurrency(t *testing.T) {
+	defer withRate(t, models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 920000})()
+
+	tests := []struct {
+		name string
+		currency string
+		referer string
+		expectedCurrency string
+		expectedLocation string
+		expectedError bool
+	}{
+		{"euro", "EUR", "http://example.com/make-reservation", "EUR", "/make-reservation", false},
+		{"lower case", "eur", "http://example.com/search-availability?x=1", "EUR", "/search-availability?x=1", false},
+		{"base currency", "USD", "http://example.com/about", "", "/about", false},
+		{"no rate", "PLN", "http://example.com/about", "", "/about", true},
+		{"no referer", "EUR", "", "EUR", "/", false},
+		{"other site", "EUR", "http://evil.example.org/phish", "EUR", "/", false},
+		{"protocol relative path", "EUR", "http://example.com//evil.example.org", "EUR", "/", false},
+	}
+
+	for _, e := range tests {
+		body := url.Values{"currency": {e.currency}}
+		req, _ := http.NewRequest("POST", "http://example.com/currency", strings.NewReader(body.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.referer != "" {
+			req.Header.Set("Referer", e.referer)
+		}
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		// a guest who picked euros before
+		session.Put(ctx, "currency", "EUR")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostCurrency).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: PostCurrency returned %d to %q, wanted %q", e.name, rr.Code, rr.Header().Get("Location"), e.expectedLocation)
+		}
+		if got := session.GetString(ctx, "currency"); got != e.expectedCurrency {
+			t.Errorf("%s: the session has currency %q, wanted %q", e.name, got, e.expectedCurrency)
+		}
+		if got := session.GetString(ctx, "error"); (got != "") != e.expectedError {
+			t.Errorf("%s: got error %q", e.name, got)
+		}
+	}
+}
+
+func TestRepository_ReservationInCurrency(t *testing.T) {
+	defer withRate(t, models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 920000})()
+
+	start, _ := time.Parse("2006-01-02", "2050-06-01")
+	end, _ := time.Parse("2006-01-02", "2050-06-03")
+
+	reservation := models.Reservation{
+		RoomID: 1,
+		StartDate: start,
+		EndDate: end,
+		Room: models.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "reservation", reservation)
+	session.Put(ctx, "currency", "EUR")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.Reservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Reservation returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	// two nights at $99.00 are €91.08 each, and still charged in dollars
+	for _, want := range []string{"€91.08", "€182.16", "Charged in USD", "$198.00", `<option value="EUR" selected>`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("the reservation page does not show %q", want)
+		}
+	}
+
+	// the reservation kept in the session is priced in dollars
+	res, _ := session.Get(ctx, "reservation").(models.Reservation)
+	defer testDB.DeleteHold(res.HoldID)
+	if res.Quote.Total != 19800 {
+		t.Errorf("the quote total is %d, wanted 19800 cents", res.Quote.Total)
+	}
+}
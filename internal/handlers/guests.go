@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// errGuests is returned for guest counts that make no sense
+var errGuests = errors.New("invalid guest counts")
+
+// guestsMessage tells the guest what guest counts are accepted
+const guestsMessage = "Please tell us how many adults and children are staying, with at least one adult"
+
+// guestCounts reads the adults and children fields of a search or booking,
+// giving errGuests for counts that make no sense. Left out, they are one
+// adult and no children
+func guestCounts(values url.Values) (adults, children int, err error) {
+	adults, children = 1, 0
+
+	if v := strings.TrimSpace(values.Get("adults")); v != "" {
+		adults, err = strconv.Atoi(v)
+		if err != nil || adults < 1 {
+			return 0, 0, errGuests
+		}
+	}
+
+	if v := strings.TrimSpace(values.Get("children")); v != "" {
+		children, err = strconv.Atoi(v)
+		if err != nil || children < 0 {
+			return 0, 0, errGuests
+		}
+	}
+
+	return adults, children, nil
+}
+
+// roomTooSmall tells the guest why a room can't take their party, or returns
+// "" when it can
+func roomTooSmall(room models.Room, guests int) string {
+	if guests <= room.MaxOccupancy {
+		return ""
+	}
+
+	return fmt.Sprintf("%s sleeps at most %d guests, please search again for a room that fits everyone", room.RoomName, room.MaxOccupancy)
+}
+
+// fitsParty reads the guest counts of a form and tells why the room can't
+// take them, or returns "" when it can
+func (m *Repository) fitsParty(roomID int, values url.Values) (string, error) {
+	adults, children, err := guestCounts(values)
+	if err != nil {
+		return guestsMessage, nil
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		return "", err
+	}
+
+	return roomTooSmall(room, adults+children), nil
+}
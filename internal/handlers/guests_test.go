@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+func TestRepository_PostAvailabilityGuests(t *testing.T) {
+	tests := []struct {
+		name string
+		adults string
+		children string
+		expectedStatusCode int
+		reason string
+		rooms []string
+	}{
+		{"one adult", "1", "", http.StatusOK, "", []string{"/choose-room/1", "/choose-room/2"}},
+		{"couple", "2", "0", http.StatusOK, "", []string{"/choose-room/1", "/choose-room/2"}},
+		{"family", "2", "1", http.StatusOK, "", []string{"/choose-room/2"}},
+		{"too many for every room", "4", "1", http.StatusSeeOther, "No availability", nil},
+		{"no adults", "0", "2", http.StatusSeeOther, guestsMessage, nil},
+		{"negative children", "2", "-1", http.StatusSeeOther, guestsMessage, nil},
+		{"invalid adults", "two", "0", http.StatusSeeOther, guestsMessage, nil},
+	}
+
+	for _, e := range tests {
+		postData := url.Values{}
+		postData.Add("start", "2056-03-01")
+		postData.Add("end", "2056-03-03")
+		postData.Add("adults", e.adults)
+		postData.Add("children", e.children)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("PostAvailability for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.reason != "" {
+			if msg := session.GetString(ctx, "error"); msg != e.reason {
+				t.Errorf("PostAvailability for %s said %q, wanted %q", e.name, msg, e.reason)
+			}
+			continue
+		}
+
+		for _, room := range []string{"/choose-room/1", "/choose-room/2"} {
+			offered := strings.Contains(rr.Body.String(), room)
+			wanted := false
+			for _, r := range e.rooms {
+				wanted = wanted || r == room
+			}
+			if offered != wanted {
+				t.Errorf("PostAvailability for %s offered %s: %v, wanted %v", e.name, room, offered, wanted)
+			}
+		}
+	}
+}
+
+func TestRepository_BookRoomGuests(t *testing.T) {
+	tests := []struct {
+		name string
+		url string
+		expectedLocation string
+		reason string
+	}{
+		{"fits the room", "/book-room?id=1&s=2056-03-01&e=2056-03-03&adults=2", "/make-reservation", ""},
+		{"too many for the room", "/book-room?id=1&s=2056-03-01&e=2056-03-03&adults=2&children=1", "/search-availability", "sleeps at most 2 guests"},
+		{"no adults", "/book-room?id=2&s=2056-03-01&e=2056-03-03&adults=0", "/search-availability", guestsMessage},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.BookRoom).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("BookRoom for %s returned %d to %q, wanted a redirect to %q", e.name, rr.Code, rr.Header().Get("Location"), e.expectedLocation)
+			continue
+		}
+
+		if e.reason != "" {
+			if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.reason) {
+				t.Errorf("BookRoom for %s said %q, wanted it to mention %q", e.name, msg, e.reason)
+			}
+		}
+	}
+}
+
+func TestRepository_PostReservationGuests(t *testing.T) {
+	var reqBody reqBody
+
+	// room 1 sleeps 2
+	body := reqBody.urlValues("2056-04-01", "2056-04-03", "Johny", "Smith", "family@example.com", "123 456", "1")
+	body.Set("adults", "2")
+	body.Set("children", "2")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("PostReservation for too many guests returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if msg := session.GetString(ctx, "error"); !strings.Contains(msg, "sleeps at most 2 guests") {
+		t.Errorf("PostReservation for too many guests said %q", msg)
+	}
+
+	// room 2 sleeps 4
+	body.Set("room_id", "2")
+
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservation-payment" {
+		t.Fatalf("PostReservation for a family returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	res, _ := session.Get(req.Context(), "reservation").(models.Reservation)
+	if res.Quote.Guests != 4 {
+		t.Errorf("PostReservation quoted for %d guests, wanted 4", res.Quote.Guests)
+	}
+
+	saved, err := testDB.GetReservationByID(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Adults != 2 || saved.Children != 2 {
+		t.Errorf("PostReservation saved %d adults and %d children, wanted 2 and 2", saved.Adults, saved.Children)
+	}
+}
+
+func TestRepository_AvailabilityJSONGuests(t *testing.T) {
+	postData := url.Values{}
+	postData.Add("start", "2056-03-01")
+	postData.Add("end", "2056-03-03")
+	postData.Add("room_id", "1")
+	postData.Add("adults", "3")
+
+	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(postData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(rr, req)
+
+	var j jsonResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+		t.Fatal("failed to parse json!")
+	}
+
+	if j.Ok || !strings.Contains(j.Message, "sleeps at most 2 guests") {
+		t.Errorf("AvailabilityJSON for too many guests returned ok %v with %q", j.Ok, j.Message)
+	}
+}
@@ -2,18 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/arkadiuszekprogramista/bookingapp/internal/apikeys"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/driver"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/forms"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/dbrepo"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/stayrules"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/webhooks"
 	"github.com/go-chi/chi"
 )
 
@@ -23,22 +29,52 @@ var Repo *Repository
 type Repository struct {
 	App *config.AppConfig
 	DB repository.DatabaseRepo
+	Pricing *pricing.Service
+	// Payments takes the payment for a reservation
+	Payments payments.Gateway
+	// APILimiter counts the requests of each API key against its rate limit
+	APILimiter *apikeys.Limiter
+	// Webhooks sends reservation and block events to the webhooks admins set up
+	Webhooks *webhooks.Sender
+	// Calendars fetches the calendar feeds of other platforms
+	Calendars *http.Client
 }
 
 
-// NewRepo create a new repository
+// NewRepo create a new repository, backed by the database driver set in the config
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
+	var dbRepo repository.DatabaseRepo
+
+	switch a.DBDriver {
+	case "sqlite":
+		dbRepo = dbrepo.NewSQLiteRepo(db.SQL, a)
+	case "memory":
+		dbRepo = dbrepo.NewMemoryRepo(a)
+	default:
+		dbRepo = dbrepo.NewPostgresRepo(db.SQL, a)
+	}
+
 	return &Repository{
 		App: a,
-		DB: dbrepo.NewPostgresRepo(db.SQL, a),
+		DB: dbRepo,
+		Pricing: pricing.NewService(dbRepo),
+		APILimiter: apikeys.NewLimiter(time.Minute),
+		Webhooks: webhooks.NewSender(10*time.Second),
+		Calendars: &http.Client{Timeout: 20*time.Second},
 	}
 }
 
-// NewTestRepo create a new repository
+// NewTestRepo create a new repository backed by an in-memory database
 func NewTestRepo(a *config.AppConfig) *Repository {
+	dbRepo := dbrepo.NewMemoryRepo(a)
+
 	return &Repository{
 		App: a,
-		DB: dbrepo.NewTestingRepo(a),
+		DB: dbRepo,
+		Pricing: pricing.NewService(dbRepo),
+		APILimiter: apikeys.NewLimiter(time.Minute),
+		Webhooks: webhooks.NewSender(10*time.Second),
+		Calendars: &http.Client{Timeout: 20*time.Second},
 	}
 }
 
@@ -70,13 +106,42 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	room, err := m.DB.GetRoomByID(res.RoomID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error","can't get room from session")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		helpers.RepoError(w, err)
+		return
 	}
 
 
 	res.Room.RoomName = room.RoomName
 
+	// reservations put in the session before guests were counted are for one adult
+	if res.Adults < 1 {
+		res.Adults = 1
+	}
+
+	quote, err := m.Pricing.Quote(res.RoomID, res.StartDate, res.EndDate, res.Guests())
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+	res.Quote = quote
+
+	err = m.schedulePayment(&res, room)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	err = m.holdRoom(&res)
+	if errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", holdTaken)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	sd := res.StartDate.Format("2006-01-02")
@@ -117,12 +182,14 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't parse star date")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 
 	endDate, err := time.Parse(layout, ed)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't parse end date")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 
 	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
@@ -132,6 +199,13 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	adults, children, err := guestCounts(r.Form)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", guestsMessage)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	reservation := models.Reservation {
 		FirstName: r.Form.Get("first_name"),
 		LastName: r.Form.Get("last_name"),
@@ -140,52 +214,105 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		StartDate: startDate,
 		EndDate: endDate,
 		RoomID: roomID,
+		Adults: adults,
+		Children: children,
 
 	}
 
+	// the booking takes over the hold placed when the form was shown
+	reservation.HoldID = m.sessionHold(r, reservation)
+
 	form := forms.New(r.PostForm)
 
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
+	form.IsPromoCode("promo_code")
+
+	room, err := m.DB.GetRoomByID(reservation.RoomID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+	reservation.Room.RoomName = room.RoomName
+
+	if reason := roomTooSmall(room, reservation.Guests()); reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	err = m.checkStay(reservation.RoomID, reservation.StartDate, reservation.EndDate)
+	if m.stayRefused(w, r, err) {
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	// price the stay again, the rates may have changed since the form was shown
+	promoCode := ""
+	if form.Errors.Get("promo_code") == "" {
+		promoCode = form.Get("promo_code")
+	}
+
+	reservation.Quote, err = m.Pricing.QuoteWithPromo(reservation.RoomID, reservation.StartDate, reservation.EndDate, reservation.Guests(), promoCode)
+	var promoErr *pricing.PromoError
+	if errors.As(err, &promoErr) {
+		form.Errors.Add("promo_code", promoErr.Reason)
+		reservation.Quote, err = m.Pricing.Quote(reservation.RoomID, reservation.StartDate, reservation.EndDate, reservation.Guests())
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	err = m.schedulePayment(&reservation, room)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = sd
+		stringMap["end_date"] = ed
+
 		http.Error(w, "form is not valid", http.StatusSeeOther)
 		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 			Form: form,
 			Data: data,
+			StringMap: stringMap,
 		})
 		return
 	}
 
-	newReservationID ,err := m.DB.InsertReservation(reservation)
+	reservation, intent, err := m.placeBooking(r.Context(), reservation)
+	if errors.Is(err, errGatewayDown) {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "We can't take payments right now, please try again later")
+		http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cant't insert reservation to database!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		helpers.RepoError(w, err)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate: reservation.StartDate,
-		EndDate: reservation.EndDate,
-		RoomID: reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
-
-	}
+	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	err = m.DB.InsertRoomRestriction(restriction)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cant't insert room restriction!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	if intent.ID == "" {
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	m.App.Session.Put(r.Context(), "client_secret", intent.ClientSecret)
 
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	http.Redirect(w, r, "/reservation-payment", http.StatusSeeOther)
 
 	
 }
@@ -233,31 +360,111 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	adults, children, err := guestCounts(r.Form)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cant't get availability for rooms!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		m.App.Session.Put(r.Context(), "error", guestsMessage)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children, m.Pricing.Now())
+	if err != nil {
+		helpers.RepoError(w, err)
 		return
 	}
 
 	if len(rooms) == 0 {
-		//no availability
-		m.App.Session.Put(r.Context(), "error","No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		//no availability, offer other dates or part of the stay if there are
+		//any, and the waitlist of the rooms that would do
+		s, err := m.suggestStays(startDate, endDate, adults+children, 0)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+
+		waitlist, err := m.waitlistRooms(startDate, endDate, adults+children)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+
+		if s.empty() && len(waitlist) == 0 {
+			m.App.Session.Put(r.Context(), "error","No availability")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		if s.empty() {
+			m.App.Session.Put(r.Context(), "error", "No availability for those dates, but you can join the waitlist")
+		} else {
+			m.App.Session.Put(r.Context(), "error", "No availability for those dates, but you could book one of these instead")
+		}
+
+		data := make(map[string]interface{})
+		data["suggestions"] = s
+		data["waitlist"] = waitlist
+		data["start_date"] = start
+		data["end_date"] = end
+		data["adults"] = adults
+		data["children"] = children
+
+		render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	// only offer the rooms whose stay rules allow the stay
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	var allowed []models.Room
+	var refused error
+	for _, room := range rooms {
+		err := stayrules.Check(rules, room.ID, startDate, endDate, m.Pricing.Now())
+		if err != nil {
+			refused = err
+			continue
+		}
+		allowed = append(allowed, room)
+	}
+	rooms = allowed
+
+	if len(rooms) == 0 {
+		m.stayRefused(w, r, refused)
 		return
 	}
 
+	quotes := make(map[int]models.Quote)
+	for _, room := range rooms {
+		quote, err := m.Pricing.Quote(room.ID, startDate, endDate, adults+children)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+		quotes[room.ID] = quote
+	}
+
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["quotes"] = quotes
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate: endDate,
+		Adults: adults,
+		Children: children,
 	}
+	m.keepHold(r, &res)
 
 	m.App.Session.Put(r.Context(),"reservation", res)
 
 
+	data["reservation"] = res
+
 	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
 		Data: data,
 	})
@@ -266,7 +473,7 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 
 type jsonResponse struct {
 	Ok bool `json:"ok"`
-	Messeage string `json:"message"`
+	Message string `json:"message"`
 	RoomID string `json:"room_id"`
 	StartDate string `json:"start_date"`
 	EndDate string `json:"end_date"`
@@ -277,17 +484,8 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	// need to pars equest body
 	err := r.ParseForm()
-
 	if err != nil {
-		//can't parse form, return appropriate json
-		resp := jsonResponse {
-			Ok: false,
-			Messeage: "internal server error",
-		}
-
-		out, _ := json.MarshalIndent(resp, "","    ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+		availabilityError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
@@ -295,27 +493,45 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	ed := r.Form.Get("end")
 
 	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		availabilityError(w, http.StatusBadRequest, "invalid start date")
+		return
+	}
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	endDate, err := time.Parse(layout, ed)
+	if err != nil {
+		availabilityError(w, http.StatusBadRequest, "invalid end date")
+		return
+	}
 
-	available, err := m.DB.SerachAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
-		resp := jsonResponse{
-			Ok: false,
-			Messeage: "error querying database",
+		availabilityError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+
+	available, err := m.DB.SerachAvailabilityByDatesByRoomID(startDate, endDate, roomID, m.Pricing.Now())
+	message := ""
+	if err == nil && available {
+		message, err = m.fitsParty(roomID, r.Form)
+		available = message == ""
+	}
+	if err == nil && available {
+		err = m.checkStay(roomID, startDate, endDate)
+		var violation *stayrules.Violation
+		if errors.As(err, &violation) {
+			available, message, err = false, violation.Reason, nil
 		}
-		
-		out, _ := json.MarshalIndent(resp,"","    ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+	}
+	if err != nil {
+		availabilityError(w, helpers.ErrorStatus(err), "error querying database")
 		return
 	}
 	
 	resp := jsonResponse{
 		Ok: available,
-		Messeage: "",
+		Message: message,
 		StartDate: sd,
 		EndDate: ed,
 		RoomID: strconv.Itoa(roomID),
@@ -327,6 +543,19 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(out)
 }
 
+// availabilityError sends the JSON answer of AvailabilityJSON for a request it can't answer
+func availabilityError(w http.ResponseWriter, status int, message string) {
+	resp := jsonResponse{
+		Ok: false,
+		Message: message,
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "    ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
 
 // Contact renders the contact page
 func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
@@ -344,7 +573,24 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
+	// the payment may have been confirmed since the reservation was made
+	if reservation.PaymentIntentID != "" {
+		if r.URL.Query().Get("redirect_status") == "failed" {
+			m.App.Session.Put(r.Context(), "error", "Your payment did not go through, please try again")
+			http.Redirect(w, r, "/reservation-payment", http.StatusSeeOther)
+			return
+		}
+
+		saved, err := m.DB.GetReservationByID(reservation.ID)
+		if err != nil {
+			helpers.RepoError(w, err)
+			return
+		}
+		reservation.Status = saved.Status
+	}
+
 	m.App.Session.Remove(r.Context(),"reservation")
+	m.App.Session.Remove(r.Context(), "client_secret")
 	
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
@@ -373,7 +619,19 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, errors.New("can't get reservation from session"))
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomId)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	if reason := roomTooSmall(room, res.Guests()); reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
@@ -412,20 +670,98 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 
 	var res models.Reservation
 
+	res.Adults, res.Children, err = guestCounts(r.URL.Query())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", guestsMessage)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	room, err := m.DB.GetRoomByID(roomID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.RepoError(w, err)
+		return
 	}
 
-	
+	if reason := roomTooSmall(room, res.Guests()); reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	err = m.checkStay(roomID, startDate, endDate)
+	if m.stayRefused(w, r, err) {
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
 
 	res.RoomID = roomID
 	res.StartDate = startDate
 	res.EndDate = endDate
 	res.Room.RoomName = room.RoomName
+	m.keepHold(r, &res)
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 
-}
\ No newline at end of file
+}
+// ShowLogin shows the login screen
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostShowLogin handles logging the user in
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+	// a new session id on login prevents session fixation
+	_ = m.App.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	id, _, err := m.DB.Authenticate(email, password)
+	if errors.Is(err, repository.ErrInvalid) {
+		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// Logout logs a user out
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -3,14 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/go-chi/chi"
 )
 
 type reqBody struct {
@@ -82,13 +86,13 @@ var TestForPostMethods = []struct {
 	reqBody reqBody
 }{
 	{"checking if all data are valid", "/make-reservation", "POST", http.StatusSeeOther, reqBody{
-		StartDate: "2050-01-01",
-		EndDate: "2050-01-02",
+		StartDate: "2050-02-01",
+		EndDate: "2050-02-02",
 		FirstName: "John",
 		LastName: "Smith",
 		Email: "john@email.com",
 		Phone: "233 111 333",
-		RoomID: "1 ",
+		RoomID: "1",
 		},
 	},
 	{"invalid start date", "/make-reservation", "POST", http.StatusTemporaryRedirect, reqBody{
@@ -144,10 +148,15 @@ func TestHandlers(t *testing.T) {
 
 
 func TestRepository_Reservation(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2050-06-01")
+	end, _ := time.Parse("2006-01-02", "2050-06-03")
+
 	reservation := models.Reservation{
-		RoomID: 3,
+		RoomID: 1,
+		StartDate: start,
+		EndDate: end,
 		Room: models.Room{
-			ID: 3,
+			ID: 1,
 			RoomName: "General's Quarters",
 		},
 	}
@@ -167,6 +176,14 @@ func TestRepository_Reservation(t *testing.T) {
 		t.Errorf("Reservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
 	}
 
+	// two nights in room 1 at $99.00
+	if !strings.Contains(rr.Body.String(), "$198.00") {
+		t.Error("Reservation handler did not show the stay total")
+	}
+
+	held, _ := session.Get(ctx, "reservation").(models.Reservation)
+	testDB.DeleteHold(held.HoldID)
+
 	// test case where reservation is not in session (reset everething)
 	req, _ = http.NewRequest("GET", "/make-reservation", nil)
 	ctx = getCtx(req)
@@ -189,8 +206,8 @@ func TestRepository_Reservation(t *testing.T) {
 	session.Put(ctx, "reservation", reservation)
 
 	handler.ServeHTTP(rr, req)
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Reservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Reservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusNotFound)
 	}
 
 }
@@ -239,8 +256,13 @@ func TestRepository_PostReservation(t *testing.T) {
 	}
 
 	//test inserction reservation
+	testDB.SetFault("InsertReservation", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
 	var reqBody reqBody
-	body := reqBody.urlValues("2050-01-01", "2050-01-02","Johny","Smith","email@email.com", "123131 31313  133", "2")
+	body := reqBody.urlValues("2050-03-01", "2050-03-02","Johny","Smith","email@email.com", "123131 31313  133", "1")
 
 	req, _ = http.NewRequest("POST","/make-reservation", strings.NewReader(body.Encode()))
 	ctx = getCtx(req)
@@ -255,12 +277,17 @@ func TestRepository_PostReservation(t *testing.T) {
 	
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler returned wrong response code for test insercion reservation: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("PostReservation handler returned wrong response code for test insercion reservation: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
 	}
 
 	//test inserction room restriction
-	body = reqBody.urlValues("2050-01-01", "2050-01-02","Johny","Smith","email@email.com", "123131 31313  133", "1000")
+	testDB.ClearFaults()
+	testDB.SetFault("InsertRoomRestriction", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+
+	body = reqBody.urlValues("2050-03-01", "2050-03-02","Johny","Smith","email@email.com", "123131 31313  133", "1")
 
 	req, _ = http.NewRequest("POST","/make-reservation", strings.NewReader(body.Encode()))
 	ctx = getCtx(req)
@@ -275,17 +302,191 @@ func TestRepository_PostReservation(t *testing.T) {
 	
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler returned wrong response code for insertion room restriction: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("PostReservation handler returned wrong response code for insertion room restriction: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
 	}
 
+	//test dates that are already booked
+	testDB.ClearFaults()
+
+	body = reqBody.urlValues("2050-01-01", "2050-01-02","Johny","Smith","email@email.com", "123131 31313  133", "1")
+
+	req, _ = http.NewRequest("POST","/make-reservation", strings.NewReader(body.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostReservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("PostReservation handler returned wrong response code for booked dates: got %d, wanted %d", rr.Code, http.StatusConflict)
+	}
+
+	//test room that does not exist
+	body = reqBody.urlValues("2050-03-01", "2050-03-02","Johny","Smith","email@email.com", "123131 31313  133", "100")
+
+	req, _ = http.NewRequest("POST","/make-reservation", strings.NewReader(body.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostReservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("PostReservation handler returned wrong response code for a missing room: got %d, wanted %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestRepository_PostReservationPromo(t *testing.T) {
+	from, _ := time.Parse("2006-01-02", "2000-01-01")
+	to, _ := time.Parse("2006-01-02", "2099-12-31")
+
+	id, err := testDB.InsertPromoCode(models.PromoCode{
+		Code: "SPRING10",
+		Kind: models.PromoPercent,
+		Amount: 10,
+		ValidFrom: from,
+		ValidTo: to,
+		MaxUses: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeletePromoCode(id)
+
+	var reqBody reqBody
+
+	post := func(start, end, code string) *httptest.ResponseRecorder {
+		body := reqBody.urlValues(start, end, "Johny", "Smith", "email@email.com", "123131 31313  133", "1")
+		body.Add("promo_code", code)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+		return rr
+	}
+
+	//test a code that does not exist
+	rr := post("2051-04-01", "2051-04-03", "NOPE")
+	if rr.Code != http.StatusSeeOther || !strings.Contains(rr.Body.String(), "this code does not exist") {
+		t.Errorf("PostReservation did not reject an unknown promo code: got %d", rr.Code)
+	}
+
+	//test the booking failing leaves the code unused
+	testDB.SetFault("CreateBooking", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	rr = post("2051-04-01", "2051-04-03", "spring10")
+	testDB.ClearFaults()
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("PostReservation returned wrong response code for a failed booking: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+	if promo, _ := testDB.GetPromoCodeByID(id); promo.Uses != 0 {
+		t.Errorf("PostReservation used the promo code for a failed booking: got %d uses", promo.Uses)
+	}
+
+	//test a valid code, entered in lower case
+	rr = post("2051-04-01", "2051-04-03", "spring10")
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostReservation returned wrong response code for a valid promo code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if promo, _ := testDB.GetPromoCodeByID(id); promo.Uses != 1 {
+		t.Errorf("PostReservation did not use the promo code: got %d uses", promo.Uses)
+	}
+
+	//test the code is used up
+	rr = post("2051-05-01", "2051-05-03", "SPRING10")
+	if !strings.Contains(rr.Body.String(), "this code has been used up") {
+		t.Error("PostReservation accepted a used up promo code")
+	}
+}
+
+func TestRepository_PostReservationFees(t *testing.T) {
+	cleaning, err := testDB.InsertFeeRule(models.FeeRule{Name: "Cleaning", Kind: models.FeePerStay, Amount: 2500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteFeeRule(cleaning)
+
+	cityTax, err := testDB.InsertFeeRule(models.FeeRule{Name: "City tax", Kind: models.FeePerGuest, Amount: 200, Tax: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteFeeRule(cityTax)
+
+	resetMail()
+
+	var reqBody reqBody
+	body := reqBody.urlValues("2052-04-01", "2052-04-03", "Johny", "Smith", "fees@example.com", "123 456", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostReservation returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	res, ok := session.Get(ctx, "reservation").(models.Reservation)
+	if !ok {
+		t.Fatal("PostReservation did not put the reservation in the session")
+	}
+	if len(res.Quote.Fees) != 2 || res.Quote.FeesTotal != 2500 || res.Quote.TaxTotal != 400 || res.Quote.Total != 19800+2900 {
+		t.Errorf("PostReservation priced the fees wrong: got %+v", res.Quote)
+	}
+
+	saved, err := testDB.GetReservationByID(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Quote.TaxTotal != 400 || saved.Quote.Total != res.Quote.Total {
+		t.Errorf("PostReservation did not store the fees: got %+v", saved.Quote)
+	}
+
+	// the confirmation is sent once the guest has paid
+	if _, err := fakeGateway.Confirm(res.PaymentIntentID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	guest, ok := mailTo("fees@example.com")
+	if !ok {
+		t.Fatal("PostReservation did not email the guest")
+	}
+	for _, want := range []string{"Cleaning", "$25.00", "City tax", "$4.00", "$227.00"} {
+		if !strings.Contains(guest.Content, want) {
+			t.Errorf("the confirmation email does not show %q", want)
+		}
+	}
+
+	if _, ok := mailTo("owner@example.com"); !ok {
+		t.Error("PostReservation did not tell the owner")
+	}
 }
 
 func TestRepository_PostAvailabilty(t *testing.T) {
-	//room are not available
+	//room are not available, and no other stay sleeps nine to suggest instead
 	postedData := url.Values{}
 	postedData.Add("start", "2050-01-01")
 	postedData.Add("end", "2050-01-02")
+	postedData.Add("adults", "9")
 
 	req, _ := http.NewRequest("POST","/search-availability", strings.NewReader(postedData.Encode()))
 	ctx := getCtx(req)
@@ -388,6 +589,11 @@ func TestRepository_PostAvailabilty(t *testing.T) {
 	}
 	
 	//database query fails
+	testDB.SetFault("SearchAvailabilityForAllRooms", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
 	postedData = url.Values{}
 	postedData.Add("start","2060-01-01")
 	postedData.Add("end", "2060-01-02")
@@ -404,8 +610,31 @@ func TestRepository_PostAvailabilty(t *testing.T) {
 	handler = http.HandlerFunc(Repo.PostAvailability)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Post availability with invalid end date gave wrong status code: got %d, wnated %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Post availability when the database fails gave wrong status code: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	//end date before start date
+	testDB.ClearFaults()
+
+	postedData = url.Values{}
+	postedData.Add("start", "2040-01-05")
+	postedData.Add("end", "2040-01-02")
+
+	req, _ = http.NewRequest("POST","/search-availability", strings.NewReader(postedData.Encode()))
+
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostAvailability)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Post availability with end date before start date gave wrong status code: got %d, wanted %d", rr.Code, http.StatusBadRequest)
 	}
 
 }
@@ -417,7 +646,7 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	postData := url.Values{}
 	postData.Add("start", "2050-01-01")
 	postData.Add("end", "2050-01-02")
-	postData.Add("room_id", "3")
+	postData.Add("room_id", "1")
 
 	//create requestt
 	req, _ := http.NewRequest("POST","/search-availability-json", strings.NewReader(postData.Encode()))
@@ -453,9 +682,9 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	//rooms are available
 	//create request body
 	postData = url.Values{}
-	postData.Add("start", "2050-01-01")
-	postData.Add("end", "2050-01-02")
-	postData.Add("room_id", "3")
+	postData.Add("start", "2050-04-01")
+	postData.Add("end", "2050-04-02")
+	postData.Add("room_id", "1")
 
 	//create requestt
 	req, _ = http.NewRequest("POST","/search-availability-json", strings.NewReader(postData.Encode()))
@@ -482,7 +711,7 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 		t.Error("failed to parse json!")
 	}
 
-	if j.Ok {
+	if !j.Ok {
 		t.Error("Got no availability when some was expected in AvailabilityJSON")
 	}
 
@@ -502,11 +731,49 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	if err != nil {
 		t.Error("failed to parse json")
 	}
-	if j.Ok || j.Messeage != "internal server error" {
+	if rr.Code != http.StatusBadRequest || j.Ok || j.Message != "invalid request body" {
 		t.Error("Got availability when request body was empty")
 	}
 
+	//invalid dates and room
+	for _, e := range []struct {
+		start string
+		end string
+		roomID string
+		message string
+	}{
+		{"tomorrow", "2060-01-02", "1", "invalid start date"},
+		{"2060-01-01", "", "1", "invalid end date"},
+		{"2060-01-01", "2060-01-02", "one", "invalid room id"},
+	} {
+		postData = url.Values{}
+		postData.Add("start", e.start)
+		postData.Add("end", e.end)
+		postData.Add("room_id", e.roomID)
+
+		req, _ = http.NewRequest("POST","/search-availability-json", strings.NewReader(postData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(rr, req)
+
+		j = jsonResponse{}
+		err = json.Unmarshal(rr.Body.Bytes(), &j)
+		if err != nil {
+			t.Error("failed to parse json!")
+		}
+		if rr.Code != http.StatusBadRequest || j.Ok || j.Message != e.message {
+			t.Errorf("AvailabilityJSON for %q returned %d with %q, wanted %q", e.message, rr.Code, j.Message, e.message)
+		}
+	}
+
 	//database error
+	testDB.SetFault("SerachAvailabilityByDatesByRoomID", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
 	postData = url.Values{}
 	postData.Add("start", "2060-01-01")
 	postData.Add("end", "2060-01-02")
@@ -526,13 +793,71 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	if err != nil {
 		t.Error("failed to parse json!")
 	}
-	if j.Ok != false && j.Messeage != "error querying database" {
+	if j.Ok != false && j.Message != "error querying database" {
 		t.Error("Got availability when simulating database error")
 	}
 
 
 }
 
+func TestRepository_ChooseRoom(t *testing.T) {
+	tests := []struct {
+		name string
+		roomID string
+		expectedStatusCode int
+	}{
+		{"existing room", "1", http.StatusSeeOther},
+		{"room does not exist", "100", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/choose-room/"+e.roomID, nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.roomID)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		session.Put(ctx, "reservation", models.Reservation{})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ChooseRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("ChooseRoom for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_BookRoom(t *testing.T) {
+	tests := []struct {
+		name string
+		url string
+		expectedStatusCode int
+	}{
+		{"existing room", "/book-room?id=1&s=2050-05-01&e=2050-05-02", http.StatusSeeOther},
+		{"room does not exist", "/book-room?id=100&s=2050-05-01&e=2050-05-02", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.BookRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("BookRoom for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
 func getCtx(req *http.Request) context.Context{
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 	if err != nil{
@@ -545,7 +870,7 @@ func (b *reqBody) urlValues(startDate, endDate, firstName, lastName, email, phon
 
 	postData := url.Values{}
 	postData.Add("start_date", startDate)
-	postData.Add("end_data", endDate)
+	postData.Add("end_date", endDate)
 	postData.Add("first_name", firstName)
 	postData.Add("last_name", lastName)
 	postData.Add("email", email)
@@ -554,3 +879,47 @@ func (b *reqBody) urlValues(startDate, endDate, firstName, lastName, email, phon
 
 	return postData
 }
+
+func TestRepository_PostShowLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		email string
+		password string
+		expectedStatusCode int
+		expectedLocation string
+	}{
+		{"valid credentials", "admin@example.com", "password", http.StatusSeeOther, "/admin/dashboard"},
+		{"wrong password", "admin@example.com", "wrong", http.StatusSeeOther, "/user/login"},
+		{"unknown user", "nobody@example.com", "password", http.StatusSeeOther, "/user/login"},
+		{"invalid form", "not-an-email", "", http.StatusOK, ""},
+	}
+
+	for _, e := range tests {
+		postData := url.Values{}
+		postData.Add("email", e.email)
+		postData.Add("password", e.password)
+
+		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostShowLogin)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("PostShowLogin for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("PostShowLogin for %s redirected to %s, wanted %s", e.name, rr.Header().Get("Location"), e.expectedLocation)
+		}
+
+		loggedIn := session.Exists(ctx, "user_id")
+		if loggedIn != (e.expectedLocation == "/admin/dashboard") {
+			t.Errorf("PostShowLogin for %s left user_id in session: %v", e.name, loggedIn)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// defaultHoldMinutes is how long a hold lasts when the config doesn't say
+const defaultHoldMinutes = 15
+
+// holdTaken is told to a guest whose room was booked or held by someone else
+// before they reached the reservation form
+const holdTaken = "Sorry, someone else has just taken this room for these dates, please search again"
+
+// holdFor is how long a guest filling in their reservation holds the room
+func (m *Repository) holdFor() time.Duration {
+	minutes := m.App.HoldMinutes
+	if minutes <= 0 {
+		minutes = defaultHoldMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// holdRoom holds the room of a reservation for the guest filling it in, so
+// nobody else can book it until they submit or the hold expires. A hold the
+// guest has from an earlier visit is moved to the stay, and res.HoldID set.
+// The hold lasts at least until res.HoldUntil
+func (m *Repository) holdRoom(res *models.Reservation) error {
+	now := m.Pricing.Now()
+	expires := now.Add(m.holdFor())
+	if res.HoldUntil.After(expires) {
+		expires = res.HoldUntil
+	}
+
+	id, err := m.DB.PlaceHold(models.RoomRestriction{
+		ID:        res.HoldID,
+		RoomID:    res.RoomID,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+		ExpiresAt: expires,
+	}, now)
+	if err != nil {
+		return err
+	}
+
+	res.HoldID = id
+	return nil
+}
+
+// sessionHold is the hold in the session when it is for the room and nights
+// of res, so the booking can take it over. A hold for another stay is left
+// to expire, it can't be turned into a booking of other nights
+func (m *Repository) sessionHold(r *http.Request, res models.Reservation) int {
+	held, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || held.RoomID != res.RoomID || !held.StartDate.Equal(res.StartDate) || !held.EndDate.Equal(res.EndDate) {
+		return 0
+	}
+
+	return held.HoldID
+}
+
+// keepHold carries the hold in the session over to res, which replaces the
+// session reservation. The reservation form moves the hold to the stay of
+// res, so a guest who goes back to pick another room or other nights still
+// holds one room, not each they picked
+func (m *Repository) keepHold(r *http.Request, res *models.Reservation) {
+	held, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		return
+	}
+
+	res.HoldID = held.HoldID
+	res.HoldUntil = held.HoldUntil
+}
+
+// ReapHolds lets go of the holds of guests who didn't finish their
+// reservation in time, so the rooms can be booked again. It is run in the
+// background every minute
+func (m *Repository) ReapHolds(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	n, err := m.DB.DeleteExpiredHolds(m.Pricing.Now())
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		m.App.InfoLog.Printf("Let go of %d expired holds", n)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// showReservationForm sends a guest with the session ctx to the reservation
+// form of room 1 from 2059-09-10 to 2059-09-12
+func showReservationForm(ctx context.Context) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+	req = req.WithContext(ctx)
+
+	if _, ok := session.Get(ctx, "reservation").(models.Reservation); !ok {
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2059, time.September, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2059, time.September, 12, 0, 0, 0, 0, time.UTC),
+			Adults:    1,
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.Reservation).ServeHTTP(rr, req)
+
+	return rr
+}
+
+// roomOneHolds gives the holds on room 1 in September 2059
+func roomOneHolds(t *testing.T) []models.RoomRestriction {
+	t.Helper()
+
+	restrictions, err := testDB.RoomRestrictionsForRoom(1, time.Date(2059, time.September, 1, 0, 0, 0, 0, time.UTC), Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var holds []models.RoomRestriction
+	for _, rr := range restrictions {
+		if !rr.ExpiresAt.IsZero() {
+			holds = append(holds, rr)
+		}
+	}
+	return holds
+}
+
+func TestRepository_Holds(t *testing.T) {
+	now := time.Date(2059, time.September, 1, 10, 0, 0, 0, time.UTC)
+	restore := withNow(now)
+	defer func() { restore() }()
+
+	first, _ := http.NewRequest("GET", "/make-reservation", nil)
+	firstCtx := getCtx(first)
+	second, _ := http.NewRequest("GET", "/make-reservation", nil)
+	secondCtx := getCtx(second)
+
+	rr := showReservationForm(firstCtx)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Reservation returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	held, _ := session.Get(firstCtx, "reservation").(models.Reservation)
+	holds := roomOneHolds(t)
+	if len(holds) != 1 || holds[0].ID != held.HoldID || !holds[0].ExpiresAt.Equal(now.Add(defaultHoldMinutes*time.Minute)) {
+		t.Fatalf("got holds %+v for the guest's hold %d", holds, held.HoldID)
+	}
+
+	// nobody else can book the room while the first guest fills in the form
+	rr = showReservationForm(secondCtx)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("Reservation for a held room returned %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if msg := session.GetString(secondCtx, "error"); msg != holdTaken {
+		t.Errorf("Reservation for a held room said %q", msg)
+	}
+
+	// the first guest coming back to the form keeps one hold, from now
+	restore()
+	now = now.Add(5 * time.Minute)
+	restore = withNow(now)
+
+	if rr = showReservationForm(firstCtx); rr.Code != http.StatusOK {
+		t.Fatalf("Reservation for the guest's own hold returned %d", rr.Code)
+	}
+	if holds = roomOneHolds(t); len(holds) != 1 || !holds[0].ExpiresAt.Equal(now.Add(defaultHoldMinutes*time.Minute)) {
+		t.Fatalf("got holds %+v after the guest came back", holds)
+	}
+
+	if err := Repo.ReapHolds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if holds = roomOneHolds(t); len(holds) != 1 {
+		t.Fatalf("got holds %+v, the hold was reaped before it expired", holds)
+	}
+
+	// the hold runs out and the second guest gets the room
+	restore()
+	restore = withNow(now.Add(defaultHoldMinutes * time.Minute))
+
+	if err := Repo.ReapHolds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if holds = roomOneHolds(t); len(holds) != 0 {
+		t.Fatalf("got holds %+v after the hold expired", holds)
+	}
+
+	if rr = showReservationForm(secondCtx); rr.Code != http.StatusOK {
+		t.Fatalf("Reservation after the hold expired returned %d", rr.Code)
+	}
+
+	// submitting the form turns the hold into the reservation
+	var reqBody reqBody
+	body := reqBody.urlValues("2059-09-10", "2059-09-12", "Second", "Guest", "second@example.com", "555 555 555", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	req = req.WithContext(secondCtx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostReservation with a hold returned %d", rr.Code)
+	}
+	if holds = roomOneHolds(t); len(holds) != 0 {
+		t.Errorf("got holds %+v after booking", holds)
+	}
+
+	booked, _ := session.Get(secondCtx, "reservation").(models.Reservation)
+	if booked.ID == 0 || booked.HoldID != 0 {
+		t.Errorf("got %+v in the session after booking", booked)
+	}
+}
+
+func TestRepository_PostReservationOtherStayThanHeld(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+	ctx := getCtx(req)
+
+	session.Put(ctx, "reservation", models.Reservation{
+		RoomID:    1,
+		StartDate: time.Date(2059, time.September, 20, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2059, time.September, 22, 0, 0, 0, 0, time.UTC),
+		Adults:    1,
+	})
+	if rr := showReservationForm(ctx); rr.Code != http.StatusOK {
+		t.Fatalf("Reservation returned %d", rr.Code)
+	}
+	held, _ := session.Get(ctx, "reservation").(models.Reservation)
+
+	// the guest posts the form for other nights than they hold
+	var reqBody reqBody
+	body := reqBody.urlValues("2059-09-24", "2059-09-26", "Other", "Nights", "other-nights@example.com", "555 555 555", "1")
+
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostReservation for other nights returned %d", rr.Code)
+	}
+
+	booked, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if !booked.StartDate.Equal(time.Date(2059, time.September, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("booked %+v, wanted the posted nights", booked)
+	}
+
+	// the hold was not turned into the booking of the other nights
+	holds := roomOneHolds(t)
+	if len(holds) != 1 || holds[0].ID != held.HoldID || !holds[0].StartDate.Equal(held.StartDate) {
+		t.Errorf("got holds %+v, wanted the guest's hold %d left as it was", holds, held.HoldID)
+	}
+
+	if err := testDB.DeleteHold(held.HoldID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepository_PickAnotherRoomKeepsOneHold(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/book-room", nil)
+	ctx := getCtx(req)
+
+	// the guest picks room 1, then goes back and picks room 2
+	for _, id := range []string{"1", "2"} {
+		req, _ := http.NewRequest("GET", "/book-room?id="+id+"&s=2059-09-14&e=2059-09-16&adults=1", nil)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.BookRoom).ServeHTTP(rr, req)
+		if rr.Code != http.StatusSeeOther {
+			t.Fatalf("BookRoom for room %s returned %d", id, rr.Code)
+		}
+
+		if rr = showReservationForm(ctx); rr.Code != http.StatusOK {
+			t.Fatalf("Reservation for room %s returned %d", id, rr.Code)
+		}
+	}
+
+	held, _ := session.Get(ctx, "reservation").(models.Reservation)
+
+	var holds []models.RoomRestriction
+	for _, roomID := range []int{1, 2} {
+		restrictions, err := testDB.RoomRestrictionsForRoom(roomID, time.Date(2059, time.September, 1, 0, 0, 0, 0, time.UTC), Repo.Pricing.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rr := range restrictions {
+			if !rr.ExpiresAt.IsZero() {
+				holds = append(holds, rr)
+			}
+		}
+	}
+	if len(holds) != 1 || holds[0].ID != held.HoldID || holds[0].RoomID != 2 {
+		t.Fatalf("got holds %+v, wanted only the guest's hold %d on room 2", holds, held.HoldID)
+	}
+
+	if err := testDB.DeleteHold(held.HoldID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/ical"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/go-chi/chi"
+)
+
+// feedHistory is how many days of past stays and blocks a calendar feed keeps
+const feedHistory = 30
+
+// maxFeedSize is the largest calendar imported from another platform, in bytes
+const maxFeedSize = 5 << 20
+
+// ICalFeed serves the calendar of a room, with its reservations and blocks as
+// events, to platforms that import it. The URL carries the room's token
+func (m *Repository) ICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if room.ICalToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(room.ICalToken)) != 1 {
+		helpers.ClientError(w, http.StatusForbidden)
+		return
+	}
+
+	since := m.Pricing.Now().AddDate(0, 0, -feedHistory)
+
+	restrictions, err := m.DB.RoomRestrictionsForRoom(room.ID, since, m.Pricing.Now())
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	cal := ical.Calendar{Name: room.RoomName}
+	for _, rr := range restrictions {
+		// nights booked on other platforms are not sent back to them
+		if rr.ICalFeedID != 0 {
+			continue
+		}
+		// nor are the few minutes a guest holds the room while booking
+		if !rr.ExpiresAt.IsZero() {
+			continue
+		}
+		cal.Events = append(cal.Events, m.restrictionEvent(rr))
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="room-%d.ics"`, room.ID))
+	w.Header().Set("Cache-Control", "no-cache")
+	cal.Write(w)
+}
+
+// restrictionEvent is the feed event of a reservation or a block. It says
+// nothing about the guest, only that the room is taken
+func (m *Repository) restrictionEvent(rr models.RoomRestriction) ical.Event {
+	summary := "Blocked"
+	if rr.ReservationID != 0 {
+		summary = "Reserved"
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("restriction-%d@%s", rr.ID, m.uidDomain()),
+		Summary:     summary,
+		Description: rr.Restriction.RestrictionName,
+		Start:       rr.StartDate,
+		End:         rr.EndDate,
+		Stamp:       rr.UpdatedAt,
+	}
+}
+
+// stayAttachment is the guest's stay as a calendar file, attached to their confirmation
+func (m *Repository) stayAttachment(res models.Reservation) models.Attachment {
+	location := strings.TrimSpace(m.App.Company.Name + "\n" + m.App.Company.Address)
+
+	cal := ical.Calendar{
+		Name: "Your stay",
+		Events: []ical.Event{{
+			UID:         fmt.Sprintf("reservation-%s@%s", res.ConfirmationCode, m.uidDomain()),
+			Summary:     "Stay in " + res.Room.RoomName,
+			Description: fmt.Sprintf("Confirmation code %s\nSee or cancel your reservation: %s", res.ConfirmationCode, m.manageURL(res)),
+			Location:    location,
+			URL:         m.manageURL(res),
+			Start:       res.StartDate,
+			End:         res.EndDate,
+			Stamp:       m.Pricing.Now(),
+		}},
+	}
+
+	return models.Attachment{
+		Name:        "reservation-" + res.ConfirmationCode + ".ics",
+		ContentType: ical.ContentType,
+		Data:        cal.Bytes(),
+	}
+}
+
+// feedURL is the address of the calendar feed of a room
+func (m *Repository) feedURL(room models.Room) string {
+	return fmt.Sprintf("%s/ical/rooms/%d.ics?token=%s", m.App.BaseURL, room.ID, url.QueryEscape(room.ICalToken))
+}
+
+// uidDomain is the host event UIDs are made unique with
+func (m *Repository) uidDomain() string {
+	u, err := url.Parse(m.App.BaseURL)
+	if err != nil || u.Hostname() == "" {
+		return "bookings"
+	}
+	return u.Hostname()
+}
+
+// SyncICalFeeds imports the calendars of other platforms, so our rooms are
+// closed on the nights they were booked there. A feed that can't be fetched
+// or read keeps the blocks it had and saves the error for admins to see, the
+// other feeds are synced anyway. It is run in the background every few minutes
+func (m *Repository) SyncICalFeeds(ctx context.Context) error {
+	feeds, err := m.DB.AllICalFeeds()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range feeds {
+		if _, err := m.syncICalFeed(ctx, f); err != nil {
+			m.App.InfoLog.Printf("calendar feed %d: %v", f.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// syncICalFeed fetches a feed and makes its external blocks match the stays
+// in it that are not over. Webhooks are told about the blocks it adds and
+// removes; events overlapping nights already taken here are not imported,
+// they are saved as the feed's error
+func (m *Repository) syncICalFeed(ctx context.Context, f models.ICalFeed) (models.ICalSync, error) {
+	var result models.ICalSync
+
+	events, err := m.fetchICal(ctx, f.URL)
+	if err == nil {
+		now := m.Pricing.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+		var blocks []models.RoomRestriction
+		for _, e := range events {
+			if e.End.After(today) {
+				blocks = append(blocks, models.RoomRestriction{ExternalUID: externalUID(e.UID), StartDate: e.Start, EndDate: e.End})
+			}
+		}
+
+		result, err = m.DB.SyncICalFeed(f.ID, blocks, now)
+	}
+
+	for _, b := range result.Removed {
+		m.blockEvent(models.EventBlockRemoved, b)
+	}
+	for _, b := range result.Added {
+		m.blockEvent(models.EventBlockAdded, b)
+	}
+
+	lastError := ""
+	switch {
+	case err != nil:
+		lastError = err.Error()
+	case len(result.Conflicts) > 0:
+		var nights []string
+		for _, c := range result.Conflicts {
+			nights = append(nights, c.StartDate.Format("2006-01-02")+" to "+c.EndDate.Format("2006-01-02"))
+		}
+		lastError = fmt.Sprintf("not imported, the room is already taken here: %s", strings.Join(nights, ", "))
+	}
+
+	if saveErr := m.DB.SetICalFeedSynced(f.ID, m.Pricing.Now(), lastError); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	return result, err
+}
+
+// fetchICal gets and reads a calendar, webcal URLs are fetched over https
+func (m *Repository) fetchICal(ctx context.Context, feedURL string) ([]ical.Event, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "webcal" {
+		u.Scheme = "https"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := m.Calendars.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("the calendar answered %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFeedSize {
+		return nil, errors.New("the calendar is too big")
+	}
+
+	return ical.Parse(bytes.NewReader(body))
+}
+
+// externalUID keeps the UID of an event short enough to be saved; a long
+// one is replaced by its hash, which is as unique and stays the same
+func externalUID(uid string) string {
+	if len(uid) <= 255 {
+		return uid
+	}
+	sum := sha256.Sum256([]byte(uid))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+)
+
+func TestRepository_ICalFeed(t *testing.T) {
+	res := paidTestReservation(t, "2057-09-01", "2057-09-04", "feed@example.com")
+
+	start, _ := time.Parse("2006-01-02", "2057-09-10")
+	block, err := testDB.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2)}, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteBlock(block)
+
+	room, _ := testDB.GetRoomByID(1)
+	other, _ := testDB.GetRoomByID(2)
+
+	req, _ := http.NewRequest("GET", "/ical/rooms/1.ics?token="+room.ICalToken, nil)
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ICalFeed returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("ICalFeed answered with %q", rr.Header().Get("Content-Type"))
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR",
+		"X-WR-CALNAME:" + room.RoomName,
+		"DTSTART;VALUE=DATE:20570901\r\nDTEND;VALUE=DATE:20570904\r\nSUMMARY:Reserved",
+		"DTSTART;VALUE=DATE:20570910\r\nDTEND;VALUE=DATE:20570912\r\nSUMMARY:Blocked",
+		"UID:restriction-" + strconv.Itoa(block) + "@",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the feed does not have %q", want)
+		}
+	}
+	if strings.Contains(body, res.Email) || strings.Contains(body, res.LastName) {
+		t.Error("the feed tells who is staying")
+	}
+
+	// the same request gives the same events, importers match them by UID
+	rr2 := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr2, req)
+	if rr2.Body.String() != body {
+		t.Error("the feed changed between two requests")
+	}
+
+	tests := []struct {
+		name string
+		url string
+		expectedStatusCode int
+	}{
+		{"no token", "/ical/rooms/1.ics", http.StatusForbidden},
+		{"wrong token", "/ical/rooms/1.ics?token=nope", http.StatusForbidden},
+		{"token of another room", "/ical/rooms/1.ics?token=" + other.ICalToken, http.StatusForbidden},
+		{"missing room", "/ical/rooms/100.ics?token=" + room.ICalToken, http.StatusNotFound},
+		{"invalid id", "/ical/rooms/abc.ics?token=" + room.ICalToken, http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("ICalFeed for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	testDB.SetFault("RoomRestrictionsForRoom", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	defer testDB.ClearFaults()
+
+	rr = httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("ICalFeed returned wrong response code for a database error: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_StayInConfirmationMail(t *testing.T) {
+	resetMail()
+
+	res, _ := postTestReservation(t, "2057-09-20", "2057-09-22", "ics-mail@example.com")
+
+	if _, err := fakeGateway.Confirm(res.PaymentIntentID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := mailTo("ics-mail@example.com")
+	if !ok {
+		t.Fatal("the guest was not sent a confirmation")
+	}
+
+	var ics *models.Attachment
+	for i, a := range msg.Attachments {
+		if strings.HasSuffix(a.Name, ".ics") {
+			ics = &msg.Attachments[i]
+		}
+	}
+	if ics == nil {
+		t.Fatalf("the confirmation has no calendar file, only %d attachments", len(msg.Attachments))
+	}
+
+	data := string(ics.Data)
+	for _, want := range []string{
+		"UID:reservation-" + res.ConfirmationCode + "@",
+		"DTSTART;VALUE=DATE:20570920",
+		"DTEND;VALUE=DATE:20570922",
+		"SUMMARY:Stay in " + res.Room.RoomName,
+		"/reservations/" + res.ConfirmationCode,
+	} {
+		if !strings.Contains(strings.ReplaceAll(data, "\r\n ", ""), want) {
+			t.Errorf("the calendar file does not have %q:\n%s", want, data)
+		}
+	}
+	if ics.Name != "reservation-"+res.ConfirmationCode+".ics" || !strings.HasPrefix(ics.ContentType, "text/calendar") {
+		t.Errorf("got attachment %q of type %q", ics.Name, ics.ContentType)
+	}
+
+	mailTo(app.MailFrom)
+}
+
+// calendarServer stands in for the calendar feed of another platform
+type calendarServer struct {
+	sync.Mutex
+	server *httptest.Server
+	status int
+	events []string
+}
+
+// newCalendarServer starts a calendar serving events, written as
+// "uid start end" with the dates as 20060102
+func newCalendarServer(t *testing.T, events ...string) *calendarServer {
+	t.Helper()
+
+	cal := &calendarServer{status: http.StatusOK, events: events}
+	cal.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cal.Lock()
+		defer cal.Unlock()
+
+		if cal.status != http.StatusOK {
+			w.WriteHeader(cal.status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar")
+		fmt.Fprint(w, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Other//Platform//EN\r\n")
+		for _, e := range cal.events {
+			f := strings.Fields(e)
+			fmt.Fprintf(w, "BEGIN:VEVENT\r\nUID:%s\r\nDTSTART;VALUE=DATE:%s\r\nDTEND;VALUE=DATE:%s\r\nSUMMARY:Reserved\r\nEND:VEVENT\r\n", f[0], f[1], f[2])
+		}
+		fmt.Fprint(w, "END:VCALENDAR\r\n")
+	}))
+	t.Cleanup(cal.server.Close)
+
+	return cal
+}
+
+// serve changes what the calendar answers
+func (cal *calendarServer) serve(status int, events ...string) {
+	cal.Lock()
+	defer cal.Unlock()
+	cal.status = status
+	cal.events = events
+}
+
+// externalBlocks lists the blocks imported from a feed
+func externalBlocks(t *testing.T, roomID, feedID int) []models.RoomRestriction {
+	t.Helper()
+
+	restrictions, err := testDB.RoomRestrictionsForRoom(roomID, time.Time{}, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks []models.RoomRestriction
+	for _, rr := range restrictions {
+		if rr.ICalFeedID == feedID {
+			blocks = append(blocks, rr)
+		}
+	}
+	return blocks
+}
+
+func TestRepository_SyncICalFeeds(t *testing.T) {
+	now, _ := time.Parse("2006-01-02", "2058-01-15")
+	restore := withNow(now)
+	defer restore()
+
+	cal := newCalendarServer(t,
+		"stay-1@other 20580120 20580123",
+		"stay-2@other 20580201 20580203",
+		// over already, it is not imported
+		"stay-0@other 20580102 20580104",
+	)
+
+	_, hook := newWebhookReceiver(t, "s3cret", models.EventBlockAdded, models.EventBlockRemoved)
+
+	feedID, err := testDB.InsertICalFeed(models.ICalFeed{RoomID: 1, Name: "Other", URL: cal.server.URL + "/calendar.ics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteICalFeed(feedID)
+
+	if err := Repo.SyncICalFeeds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := externalBlocks(t, 1, feedID)
+	if len(blocks) != 2 || blocks[0].ExternalUID != "stay-1@other" || blocks[1].ExternalUID != "stay-2@other" {
+		t.Fatalf("the sync made blocks %+v", blocks)
+	}
+
+	start, _ := time.Parse("2006-01-02", "2058-01-21")
+	if ok, _ := testDB.SerachAvailabilityByDatesByRoomID(start, start.AddDate(0, 0, 1), 1, Repo.Pricing.Now()); ok {
+		t.Error("room 1 is available on a night booked on the other platform")
+	}
+
+	feed, _ := testDB.GetICalFeedByID(feedID)
+	if !feed.LastSyncedAt.Equal(now) || feed.LastError != "" {
+		t.Errorf("the sync saved %+v", feed)
+	}
+
+	if queued, _ := testDB.WebhookDeliveries(hook.ID, 0); len(queued) != 2 {
+		t.Errorf("the sync queued %d webhook deliveries, wanted 2", len(queued))
+	}
+
+	// the calendar feed of the room doesn't send them back
+	room, _ := testDB.GetRoomByID(1)
+	req, _ := http.NewRequest("GET", "/ical/rooms/1.ics?token="+room.ICalToken, nil)
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+	if strings.Contains(rr.Body.String(), "20580120") {
+		t.Error("the feed has a stay imported from another platform")
+	}
+
+	// syncing the same calendar changes nothing
+	if err := Repo.SyncICalFeeds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	again := externalBlocks(t, 1, feedID)
+	if len(again) != 2 || again[0].ID != blocks[0].ID || again[1].ID != blocks[1].ID {
+		t.Errorf("syncing again changed the blocks to %+v", again)
+	}
+	if queued, _ := testDB.WebhookDeliveries(hook.ID, 0); len(queued) != 2 {
+		t.Errorf("syncing again queued %d webhook deliveries", len(queued))
+	}
+
+	// a calendar that can't be fetched keeps the blocks
+	cal.serve(http.StatusInternalServerError)
+	if err := Repo.SyncICalFeeds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if feed, _ := testDB.GetICalFeedByID(feedID); !strings.Contains(feed.LastError, "500") {
+		t.Errorf("the failed sync saved error %q", feed.LastError)
+	}
+	if len(externalBlocks(t, 1, feedID)) != 2 {
+		t.Error("a failed sync removed the blocks")
+	}
+
+	// a cancelled stay opens its nights, and one clashing with a stay here is not imported
+	res := paidTestReservation(t, "2058-02-10", "2058-02-12", "clash@example.com")
+	cal.serve(http.StatusOK, "stay-1@other 20580120 20580123", "stay-3@other 20580211 20580213")
+	if err := Repo.SyncICalFeeds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks = externalBlocks(t, 1, feedID)
+	if len(blocks) != 1 || blocks[0].ExternalUID != "stay-1@other" {
+		t.Errorf("after the cancellation the blocks are %+v", blocks)
+	}
+	if feed, _ := testDB.GetICalFeedByID(feedID); !strings.Contains(feed.LastError, "2058-02-11 to 2058-02-13") {
+		t.Errorf("the clash saved error %q", feed.LastError)
+	}
+	if got, _ := testDB.GetReservationByID(res.ID); got.Status == models.ReservationCancelled {
+		t.Error("the sync cancelled the reservation made here")
+	}
+
+	// a page instead of a calendar is an error too
+	cal.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Please log in</html>")
+	})
+	if err := Repo.SyncICalFeeds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if feed, _ := testDB.GetICalFeedByID(feedID); feed.LastError == "" || len(externalBlocks(t, 1, feedID)) != 1 {
+		t.Errorf("a page that is not a calendar saved %+v", feed)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/invoices"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/go-chi/chi"
+)
+
+// errNotInvoiced is returned for reservations that have no invoice and are
+// not confirmed, so can't be given one yet
+var errNotInvoiced = errors.New("the reservation is not confirmed")
+
+// GuestInvoice downloads the invoice of a reservation for the guest
+func (m *Repository) GuestInvoice(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByCode(chi.URLParam(r, "code"))
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.writeInvoice(w, r, res, "/reservations/"+res.ConfirmationCode)
+}
+
+// AdminInvoice downloads the invoice of a reservation for the owner
+func (m *Repository) AdminInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.writeInvoice(w, r, res, fmt.Sprintf("/admin/reservations/%d", res.ID))
+}
+
+// writeInvoice sends the invoice of a reservation as a PDF download, or
+// sends the user back to page when the reservation has none yet
+func (m *Repository) writeInvoice(w http.ResponseWriter, r *http.Request, res models.Reservation, page string) {
+	attachment, err := m.invoiceAttachment(res)
+	if errors.Is(err, errNotInvoiced) {
+		m.App.Session.Put(r.Context(), "error", "The invoice is issued once the reservation is confirmed")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+attachment.Name+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(attachment.Data)))
+	_, _ = w.Write(attachment.Data)
+}
+
+// invoiced tells whether a reservation has an invoice to download, or is
+// confirmed so gets one when it is first downloaded
+func (m *Repository) invoiced(res models.Reservation) bool {
+	if res.Status == models.ReservationConfirmed {
+		return true
+	}
+
+	_, err := m.DB.GetInvoiceByReservation(res.ID)
+	return err == nil
+}
+
+// invoiceAttachment renders the invoice of a reservation as a PDF file
+func (m *Repository) invoiceAttachment(res models.Reservation) (models.Attachment, error) {
+	inv, err := m.invoiceFor(res)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	var buf bytes.Buffer
+	err = invoices.Render(&buf, inv, res)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	return models.Attachment{
+		Name:        invoices.Filename(inv),
+		ContentType: invoices.ContentType,
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// invoiceFor returns the invoice of a reservation, issuing it with the next
+// number the first time a confirmed reservation asks for one. Invoices keep
+// the seller they were issued by, so later changes to the company details
+// don't alter them
+func (m *Repository) invoiceFor(res models.Reservation) (models.Invoice, error) {
+	inv, err := m.DB.GetInvoiceByReservation(res.ID)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return inv, err
+	}
+
+	if res.Status != models.ReservationConfirmed {
+		return inv, errNotInvoiced
+	}
+
+	inv, err = m.DB.InsertInvoice(models.Invoice{
+		ReservationID: res.ID,
+		Seller:        m.App.Company,
+		IssuedAt:      m.Pricing.Now(),
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		// issued by another request in the meantime
+		return m.DB.GetInvoiceByReservation(res.ID)
+	}
+	return inv, err
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+)
+
+func TestRepository_InvoiceInConfirmationMail(t *testing.T) {
+	resetMail()
+
+	res, _ := postTestReservation(t, "2054-09-01", "2054-09-03", "invoice-mail@example.com")
+
+	if _, err := fakeGateway.Confirm(res.PaymentIntentID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := mailTo("invoice-mail@example.com")
+	if !ok {
+		t.Fatal("the guest was not sent a confirmation")
+	}
+
+	inv, err := testDB.GetInvoiceByReservation(res.ID)
+	if err != nil {
+		t.Fatalf("confirming the reservation did not issue an invoice: %v", err)
+	}
+	if inv.Seller != app.Company {
+		t.Errorf("the invoice is issued by %+v, wanted %+v", inv.Seller, app.Company)
+	}
+
+	if len(msg.Attachments) != 2 {
+		t.Fatalf("the confirmation has %d attachments, wanted the invoice and the stay", len(msg.Attachments))
+	}
+	a := msg.Attachments[0]
+	if a.Name != inv.Code()+".pdf" || a.ContentType != "application/pdf" || !bytes.HasPrefix(a.Data, []byte("%PDF-")) {
+		t.Errorf("got attachment %q of type %q, wanted the invoice %s", a.Name, a.ContentType, inv.Code())
+	}
+
+	// the owner's notification goes without it
+	if msg, ok := mailTo(app.MailFrom); !ok || len(msg.Attachments) != 0 {
+		t.Errorf("the owner got %d attachments", len(msg.Attachments))
+	}
+}
+
+func TestRepository_GuestInvoice(t *testing.T) {
+	res := paidTestReservation(t, "2054-09-05", "2054-09-07", "invoice@example.com")
+	inv, _ := testDB.GetInvoiceByReservation(res.ID)
+
+	req, _ := guestRequest("GET", "/reservations/"+res.ConfirmationCode+"/invoice.pdf", res.ConfirmationCode)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.GuestInvoice).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GuestInvoice returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if rr.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")) {
+		t.Errorf("GuestInvoice did not send a PDF: got %q", rr.Header().Get("Content-Type"))
+	}
+	if want := `attachment; filename="` + inv.Code() + `.pdf"`; rr.Header().Get("Content-Disposition") != want {
+		t.Errorf("got Content-Disposition %q, wanted %q", rr.Header().Get("Content-Disposition"), want)
+	}
+
+	// downloading again keeps the number
+	again, _ := testDB.GetInvoiceByReservation(res.ID)
+	if again.Number != inv.Number {
+		t.Errorf("the invoice was renumbered from %d to %d", inv.Number, again.Number)
+	}
+
+	// the next reservation gets the next number
+	next := paidTestReservation(t, "2054-09-10", "2054-09-12", "invoice-next@example.com")
+	nextInv, _ := testDB.GetInvoiceByReservation(next.ID)
+	if nextInv.Number <= inv.Number {
+		t.Errorf("got invoice number %d after %d", nextInv.Number, inv.Number)
+	}
+
+	req, _ = guestRequest("GET", "/reservations/NOPE/invoice.pdf", "NOPE")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.GuestInvoice).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("GuestInvoice returned wrong response code for an unknown code: got %d, wanted %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestRepository_GuestInvoiceBeforePayment(t *testing.T) {
+	res, _ := postTestReservation(t, "2054-09-15", "2054-09-17", "invoice-pending@example.com")
+	saved, _ := testDB.GetReservationByID(res.ID)
+
+	req, ctx := guestRequest("GET", "/reservations/"+saved.ConfirmationCode+"/invoice.pdf", saved.ConfirmationCode)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.GuestInvoice).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservations/"+saved.ConfirmationCode {
+		t.Errorf("GuestInvoice of an unpaid reservation returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if session.GetString(ctx, "error") == "" {
+		t.Error("GuestInvoice of an unpaid reservation did not say why")
+	}
+	if _, err := testDB.GetInvoiceByReservation(res.ID); err == nil {
+		t.Error("an invoice was issued before the reservation was paid")
+	}
+}
+
+func TestRepository_AdminInvoice(t *testing.T) {
+	res := paidTestReservation(t, "2054-09-20", "2054-09-22", "invoice-admin@example.com")
+	id := strconv.Itoa(res.ID)
+
+	req, _ := adminRequest("GET", "/admin/reservations/"+id+"/invoice.pdf", id, nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminInvoice).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")) {
+		t.Errorf("AdminInvoice returned %d without a PDF", rr.Code)
+	}
+
+	req, _ = adminRequest("GET", "/admin/reservations/x/invoice.pdf", "x", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminInvoice).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("AdminInvoice returned wrong response code for a bad id: got %d, wanted %d", rr.Code, http.StatusBadRequest)
+	}
+}
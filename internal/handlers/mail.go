@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+)
+
+// sendMail renders an email template with the given data and queues the
+// message for sending; a template that fails to render is logged and skipped
+func (m *Repository) sendMail(to, subject, tmpl string, data map[string]interface{}, attachments ...models.Attachment) {
+	content, err := render.Mail(tmpl, &models.TemplateData{Data: data})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.MailChan <- models.MailData{
+		To:          to,
+		From:        m.App.MailFrom,
+		Subject:     subject,
+		Content:     content,
+		Attachments: attachments,
+	}
+}
+
+// sendReservationMail sends the guest a confirmation of their booking, with
+// the price itemized and the invoice and the stay as a calendar file
+// attached, and tells the owner about it.
+// An invoice that can't be made is logged and the confirmation sent without it
+func (m *Repository) sendReservationMail(res models.Reservation) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["manage_url"] = m.manageURL(res)
+
+	var attachments []models.Attachment
+	invoice, err := m.invoiceAttachment(res)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	} else {
+		attachments = append(attachments, invoice)
+	}
+	attachments = append(attachments, m.stayAttachment(res))
+
+	m.sendMail(res.Email, "Reservation Confirmation", "reservation-confirmation.mail.tmpl", data, attachments...)
+	m.sendMail(m.App.MailFrom, "New Reservation", "reservation-notification.mail.tmpl", data)
+}
+
+// sendCancellationMail tells the guest and the owner a reservation was
+// cancelled and what is refunded; outstanding is the part of the refund
+// the gateway did not make, which the owner pays back by hand
+func (m *Repository) sendCancellationMail(res models.Reservation, refund, outstanding int) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["refund"] = refund
+	data["outstanding"] = outstanding
+
+	m.sendMail(res.Email, "Reservation Cancelled", "reservation-cancelled.mail.tmpl", data)
+	m.sendMail(m.App.MailFrom, "Reservation Cancelled", "reservation-cancelled.mail.tmpl", data)
+}
+
+// sendBalanceMail asks the guest to pay the balance of their reservation
+func (m *Repository) sendBalanceMail(res models.Reservation) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["pay_url"] = m.manageURL(res) + "/pay"
+
+	m.sendMail(res.Email, "Your Balance Is Due", "balance-due.mail.tmpl", data)
+}
+
+// manageURL is the page guests see and cancel their reservation on
+func (m *Repository) manageURL(res models.Reservation) string {
+	return m.App.BaseURL + "/reservations/" + res.ConfirmationCode
+}
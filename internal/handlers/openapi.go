@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/apikeys"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+)
+
+// APIVersion is the version of the API in the OpenAPI document
+const APIVersion = "1.0.0"
+
+// OpenAPIDocument is an OpenAPI 3 document, with the parts of it the API uses
+type OpenAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       OpenAPIInfo                            `json:"info"`
+	Servers    []OpenAPIServer                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                      `json:"components"`
+}
+
+// OpenAPIInfo describes the API
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenAPIServer is where the API is served
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIOperation is one method of one path
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	// Security names the security schemes of the operation, each with no scopes
+	Security []map[string][]string `json:"security,omitempty"`
+}
+
+// OpenAPIParameter is a path or query parameter of an operation
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody is the JSON body an operation takes
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is one response of an operation
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]OpenAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIHeader is a header of a response
+type OpenAPIHeader struct {
+	Description string         `json:"description,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIMediaType gives the schema of a body
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIComponents holds the named schemas and security schemes the
+// operations refer to
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// OpenAPISecurityScheme is a way requests are authenticated
+type OpenAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPISchema is a JSON schema, or a reference to one of the components
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// apiParam is a parameter of an API operation
+type apiParam struct {
+	name        string
+	in          string
+	description string
+	required    bool
+	// kind is the Go value the parameter is read into
+	kind interface{}
+	// format is the OpenAPI format of a string parameter
+	format string
+	// minimum is the smallest value of an integer parameter, if any
+	minimum *int
+}
+
+// apiOperation describes an API operation, the OpenAPI document is built
+// from these and the types the operations read and write
+type apiOperation struct {
+	method      string
+	path        string
+	id          string
+	summary     string
+	description string
+	params      []apiParam
+	// scope is the scope the API key of a request needs
+	scope string
+	// request is the value the JSON body is read into, if the operation takes one
+	request interface{}
+	// status is the status of a successful response and response the value
+	// in its data
+	status   int
+	response interface{}
+	// errors are the statuses the operation fails with
+	errors []int
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// apiOperations are the operations of the API, kept in step with the routes
+// under /api/v1
+var apiOperations = []apiOperation{
+	{
+		method:   http.MethodGet,
+		path:     "/api/v1/rooms",
+		id:       "listRooms",
+		summary:  "List the rooms",
+		scope:    models.ScopeReadAvailability,
+		status:   http.StatusOK,
+		response: []apiRoom{},
+		errors:   []int{http.StatusInternalServerError},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/v1/availability",
+		id:          "getAvailability",
+		summary:     "Find the rooms free for a stay",
+		description: "Lists the rooms free from the start date to the end date that sleep the guests and whose stay rules allow the stay, with the price of the stay in each. When none is, suggests the same number of nights up to two weeks earlier or later and the rooms free for part of the stay.",
+		params: []apiParam{
+			{name: "start_date", in: "query", description: "Arrival date", required: true, kind: "", format: "date"},
+			{name: "end_date", in: "query", description: "Departure date, after the arrival date", required: true, kind: "", format: "date"},
+			{name: "adults", in: "query", description: "Adults staying, 1 when left out", kind: 0, minimum: intPtr(1)},
+			{name: "children", in: "query", description: "Children staying, 0 when left out", kind: 0, minimum: intPtr(0)},
+			{name: "room_id", in: "query", description: "Only look at this room", kind: 0},
+		},
+		scope:    models.ScopeReadAvailability,
+		status:   http.StatusOK,
+		response: apiAvailability{},
+		errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/v1/reservations",
+		id:          "createReservation",
+		summary:     "Book a room",
+		description: "Books a room for a stay. A stay with a deposit is created waiting for its payment, which is taken at the payment gateway with the client secret in the response.",
+		scope:       models.ScopeCreateReservation,
+		request:     apiReservationRequest{},
+		status:      http.StatusCreated,
+		response:    apiReservation{},
+		errors: []int{
+			http.StatusBadRequest,
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusUnsupportedMediaType,
+			http.StatusUnprocessableEntity,
+			http.StatusInternalServerError,
+			http.StatusServiceUnavailable,
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/reservations/{code}",
+		id:      "getReservation",
+		summary: "Show a reservation by its confirmation code",
+		params: []apiParam{
+			{name: "code", in: "path", description: "Confirmation code of the reservation", required: true, kind: ""},
+		},
+		scope:    models.ScopeReadReservations,
+		status:   http.StatusOK,
+		response: apiReservation{},
+		errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+}
+
+// apiKeyScheme is the name of the API key security scheme in the document
+const apiKeyScheme = "ApiKey"
+
+// APISpec builds the OpenAPI document of the API
+func APISpec() OpenAPIDocument {
+	doc := OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "Bookings API",
+			Description: "Search and book rooms. Amounts are in cents. Successful responses wrap the result in data, failed ones give the reason in error.",
+			Version:     APIVersion,
+		},
+		Servers: []OpenAPIServer{{URL: "/"}},
+		Paths:   make(map[string]map[string]OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]*OpenAPISchema),
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				apiKeyScheme: {
+					Type:        "apiKey",
+					Name:        apikeys.Header,
+					In:          "header",
+					Description: "A key made in the admin area. Each key has scopes that say which operations it may call, an expiry date and a limit of requests a minute.",
+				},
+			},
+		},
+	}
+
+	errorRef := schemaFor(reflect.TypeOf(apiErrorEnvelope{}), doc.Components.Schemas)
+
+	for _, op := range apiOperations {
+		operation := OpenAPIOperation{
+			OperationID: op.id,
+			Summary:     op.summary,
+			Description: op.description,
+			Responses:   make(map[string]OpenAPIResponse),
+		}
+
+		errors := op.errors
+		if op.scope != "" {
+			operation.Description = strings.TrimSpace(operation.Description + " Needs an API key with the " + op.scope + " scope.")
+			operation.Security = []map[string][]string{{apiKeyScheme: {}}}
+			errors = append([]int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests}, errors...)
+		}
+
+		for _, p := range op.params {
+			schema := schemaFor(reflect.TypeOf(p.kind), doc.Components.Schemas)
+			schema.Format = p.format
+			schema.Minimum = p.minimum
+
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:        p.name,
+				In:          p.in,
+				Description: p.description,
+				Required:    p.required,
+				Schema:      schema,
+			})
+		}
+
+		if op.request != nil {
+			operation.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {Schema: schemaFor(reflect.TypeOf(op.request), doc.Components.Schemas)},
+				},
+			}
+		}
+
+		operation.Responses[strconv.Itoa(op.status)] = OpenAPIResponse{
+			Description: http.StatusText(op.status),
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: &OpenAPISchema{
+					Type:       "object",
+					Properties: map[string]*OpenAPISchema{"data": schemaFor(reflect.TypeOf(op.response), doc.Components.Schemas)},
+					Required:   []string{"data"},
+				}},
+			},
+		}
+
+		for _, status := range errors {
+			response := OpenAPIResponse{
+				Description: http.StatusText(status),
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {Schema: errorRef},
+				},
+			}
+			if status == http.StatusTooManyRequests {
+				response.Headers = map[string]OpenAPIHeader{
+					"Retry-After": {Description: "Seconds until the key may make requests again", Schema: &OpenAPISchema{Type: "integer"}},
+				}
+			}
+			operation.Responses[strconv.Itoa(status)] = response
+		}
+
+		if doc.Paths[op.path] == nil {
+			doc.Paths[op.path] = make(map[string]OpenAPIOperation)
+		}
+		doc.Paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	return doc
+}
+
+// schemaName is the name a type of the API is known by in the document
+func schemaName(t reflect.Type) string {
+	return strings.TrimPrefix(t.Name(), "api")
+}
+
+// schemaFor gives the schema of a type. Structs are added to schemas by
+// name and referred to, their properties come from the json tags of their
+// fields: a field without omitempty is required, and a format tag gives the
+// format of a string
+func schemaFor(t reflect.Type, schemas map[string]*OpenAPISchema) *OpenAPISchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), schemas)
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Slice:
+		return &OpenAPISchema{Type: "array", Items: schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		return structSchema(t, schemas)
+	}
+
+	// anything, like the data of a response
+	return &OpenAPISchema{}
+}
+
+// structSchema adds the schema of a struct to schemas and refers to it
+func structSchema(t reflect.Type, schemas map[string]*OpenAPISchema) *OpenAPISchema {
+	name := schemaName(t)
+	ref := &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+
+	schema := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+	// added before its fields, so a type that refers to itself ends
+	schemas[name] = schema
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+
+		property := schemaFor(field.Type, schemas)
+		if format := field.Tag.Get("format"); format != "" {
+			property.Format = format
+		}
+		schema.Properties[tag[0]] = property
+
+		omitempty := false
+		for _, option := range tag[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		if !omitempty {
+			schema.Required = append(schema.Required, tag[0])
+		}
+	}
+
+	return ref
+}
+
+// APIOpenAPI serves the OpenAPI document of the API
+func (m *Repository) APIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APISpec())
+}
+
+// docOperation is an operation as the docs page lists it
+type docOperation struct {
+	Method string
+	Path   string
+	// Scope is the scope the API key needs, if any
+	Scope string
+	OpenAPIOperation
+	// Statuses are the response statuses in order
+	Statuses []string
+}
+
+// APIDocs renders the docs page of the API from its OpenAPI document
+func (m *Repository) APIDocs(w http.ResponseWriter, r *http.Request) {
+	spec := APISpec()
+
+	var operations []docOperation
+	for _, op := range apiOperations {
+		operation := spec.Paths[op.path][strings.ToLower(op.method)]
+
+		var statuses []string
+		for status := range operation.Responses {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+
+		operations = append(operations, docOperation{
+			Method:           op.method,
+			Path:             op.path,
+			Scope:            op.scope,
+			OpenAPIOperation: operation,
+			Statuses:         statuses,
+		})
+	}
+
+	var names []string
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := make(map[string]interface{})
+	data["spec"] = spec
+	data["operations"] = operations
+	data["schema_names"] = names
+
+	render.Template(w, r, "api-docs.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// TypeName describes the type of a schema for people, like "array of Night"
+// or "string (date)"
+func (s *OpenAPISchema) TypeName() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	case s.Type == "array":
+		return "array of " + s.Items.TypeName()
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map of " + s.AdditionalProperties.TypeName()
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	case s.Type == "":
+		return "any"
+	}
+
+	return s.Type
+}
+
+// IsRequired reports if a property of an object schema is required
+func (s *OpenAPISchema) IsRequired(property string) bool {
+	for _, name := range s.Required {
+		if name == property {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RefName is the name of the component a schema, or the items of an array
+// schema, refer to, or "" for other schemas
+func (s *OpenAPISchema) RefName() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	case s.Type == "array":
+		return s.Items.RefName()
+	}
+
+	return ""
+}
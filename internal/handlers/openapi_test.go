@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// refs collects the $ref values anywhere in a decoded JSON document
+func refs(v interface{}, found map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				found[ref] = true
+			}
+			refs(value, found)
+		}
+	case []interface{}:
+		for _, value := range v {
+			refs(value, found)
+		}
+	}
+}
+
+func TestRepository_APIOpenAPI(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("APIOpenAPI returned %d with %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("APIOpenAPI returned version %v", doc["openapi"])
+	}
+
+	// every reference is to a schema in the document
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	found := make(map[string]bool)
+	refs(doc, found)
+	for ref := range found {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("APIOpenAPI refers to %s, which it does not have", ref)
+		}
+	}
+
+	for _, name := range []string{"Room", "Reservation", "ReservationRequest", "Availability", "Quote", "Error"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("APIOpenAPI has no %s schema", name)
+		}
+	}
+}
+
+// checkSchema makes sure an object the API answered with has the properties
+// the named schema of the OpenAPI document describes, and no others
+func checkSchema(t *testing.T, spec OpenAPIDocument, name string, value map[string]interface{}) {
+	t.Helper()
+
+	schema, ok := spec.Components.Schemas[name]
+	if !ok {
+		t.Errorf("APISpec has no %s schema", name)
+		return
+	}
+
+	for property, v := range value {
+		prop, ok := schema.Properties[property]
+		if !ok {
+			t.Errorf("the API answered a %s with %q, which APISpec does not describe", name, property)
+			continue
+		}
+		checkValue(t, spec, name+"."+property, prop, v)
+	}
+
+	for _, property := range schema.Required {
+		if _, ok := value[property]; !ok {
+			t.Errorf("APISpec requires %s.%s, which the API left out", name, property)
+		}
+	}
+}
+
+// checkValue makes sure a value the API answered with is of the type its
+// schema says
+func checkValue(t *testing.T, spec OpenAPIDocument, at string, schema *OpenAPISchema, v interface{}) {
+	t.Helper()
+
+	if v == nil {
+		return
+	}
+
+	if schema.Ref != "" {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			t.Errorf("the API answered %s with %v, APISpec says it is a %s", at, v, schema.RefName())
+			return
+		}
+		checkSchema(t, spec, schema.RefName(), object)
+		return
+	}
+
+	ok := true
+	switch schema.Type {
+	case "integer":
+		n, isNumber := v.(float64)
+		ok = isNumber && n == float64(int(n))
+	case "string":
+		var str string
+		str, ok = v.(string)
+		if ok && schema.Format == "date" {
+			_, err := time.Parse("2006-01-02", str)
+			ok = err == nil
+		}
+		if ok && schema.Format == "date-time" {
+			_, err := time.Parse(time.RFC3339, str)
+			ok = err == nil
+		}
+	case "boolean":
+		_, ok = v.(bool)
+	case "object":
+		_, ok = v.(map[string]interface{})
+	case "array":
+		var items []interface{}
+		items, ok = v.([]interface{})
+		for i, item := range items {
+			checkValue(t, spec, fmt.Sprintf("%s[%d]", at, i), schema.Items, item)
+		}
+	}
+
+	if !ok {
+		t.Errorf("the API answered %s with %v, APISpec says it is %s", at, v, schema.TypeName())
+	}
+}
+
+func TestAPISpec(t *testing.T) {
+	spec := APISpec()
+
+	// which operations there are is checked against the router in cmd/web
+	for path, methods := range spec.Paths {
+		for method, operation := range methods {
+			name := strings.ToUpper(method) + " " + path
+			if _, ok := operation.Responses["500"]; !ok {
+				t.Errorf("APISpec does not say %s can fail", name)
+			}
+
+			scoped := false
+			for _, scope := range models.APIScopes {
+				if strings.Contains(operation.Description, "the "+scope+" scope") {
+					scoped = true
+				}
+			}
+			if _, ok := operation.Responses["401"]; !ok || len(operation.Security) != 1 || !scoped {
+				t.Errorf("APISpec does not say which key %s needs", name)
+			}
+			if _, ok := operation.Responses["429"].Headers["Retry-After"]; !ok {
+				t.Errorf("APISpec does not say when %s may be retried", name)
+			}
+		}
+	}
+
+	if scheme := spec.Components.SecuritySchemes[apiKeyScheme]; scheme.Type != "apiKey" || scheme.In != "header" || scheme.Name != "X-API-Key" {
+		t.Errorf("APISpec described the API key as %+v", scheme)
+	}
+
+	// the schemas describe what the API really answers with
+	_, resp := callAPI(t, "GET", "/api/v1/rooms", "", nil)
+	var rooms []map[string]interface{}
+	if err := json.Unmarshal(resp.Data, &rooms); err != nil || len(rooms) == 0 {
+		t.Fatalf("APIRooms returned %s", resp.Data)
+	}
+	for _, room := range rooms {
+		checkSchema(t, spec, "Room", room)
+	}
+
+	_, resp = callAPI(t, "GET", "/api/v1/availability?start_date=2059-11-01&end_date=2059-11-03", "", nil)
+	var availability map[string]interface{}
+	if err := json.Unmarshal(resp.Data, &availability); err != nil {
+		t.Fatal(err)
+	}
+	checkSchema(t, spec, "Availability", availability)
+
+	body := `{"room_id": 1, "start_date": "2059-11-10", "end_date": "2059-11-12", "first_name": "Johny", "last_name": "Smith", "email": "spec@example.com"}`
+	_, resp = callAPI(t, "POST", "/api/v1/reservations", "application/json", strings.NewReader(body))
+	var reservation map[string]interface{}
+	if err := json.Unmarshal(resp.Data, &reservation); err != nil || reservation["payment"] == nil {
+		t.Fatalf("APICreateReservation returned %s", resp.Data)
+	}
+	checkSchema(t, spec, "Reservation", reservation)
+
+	rr, _ := callAPI(t, "GET", "/api/v1/reservations/NOPE", "", nil)
+	var failed struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &failed); err != nil || failed.Error == nil {
+		t.Fatalf("APIReservation for a missing code returned %s", rr.Body.String())
+	}
+	checkSchema(t, spec, "Error", failed.Error)
+}
+
+func TestRepository_APIDocs(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/docs", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.APIDocs).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("APIDocs returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	for _, want := range []string{"/api/v1/reservations/{code}", "Book a room", "X-API-Key", "create-reservation", `id="schema-Reservation"`, `href="#schema-Quote"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("APIDocs does not show %q", want)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// maxWebhookSize is the largest webhook payload read
+const maxWebhookSize = 64 << 10
+
+// unpaidMessage is told to a guest whose reservation was let go of because
+// the deposit failed or wasn't paid in time
+const unpaidMessage = "Your payment did not go through in time and the room was let go of, please book again"
+
+// ReservationPayment shows the guest the deposit they owe for the reservation
+// they just made and takes their card details
+func (m *Repository) ReservationPayment(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || res.PaymentIntentID == "" {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	saved, err := m.DB.GetReservationByID(res.ID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	if saved.Status == models.ReservationCancelled {
+		m.App.Session.Put(r.Context(), "error", unpaidMessage)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// paid already, e.g. the guest came back with the browser's back button
+	if saved.Status != models.ReservationPendingPayment {
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return
+	}
+
+	m.renderPayment(w, r, res, payments.Intent{
+		ID:           res.PaymentIntentID,
+		Amount:       res.Deposit,
+		ClientSecret: m.App.Session.GetString(r.Context(), "client_secret"),
+	}, m.App.BaseURL+"/reservation-summary")
+}
+
+// renderPayment renders the card form for an intent of a reservation, the
+// gateway sends the guest to returnURL once they paid
+func (m *Repository) renderPayment(w http.ResponseWriter, r *http.Request, res models.Reservation, intent payments.Intent, returnURL string) {
+	stringMap := make(map[string]string)
+	stringMap["intent_id"] = intent.ID
+	stringMap["client_secret"] = intent.ClientSecret
+	stringMap["checkout_url"] = m.App.PaymentsCheckoutURL
+	stringMap["public_key"] = m.App.PaymentsPublicKey
+	stringMap["return_url"] = returnURL
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["amount"] = intent.Amount
+	data["balance"] = intent.ID == res.BalanceIntentID
+	data["test_cards"] = []string{payments.TestCardVisa, payments.TestCardDeclined}
+
+	render.Template(w, r, "reservation-payment.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// PaymentWebhook takes the events of the payment gateway. An authorized
+// payment is captured, and a captured one goes in the ledger of its
+// reservation; a deposit also confirms the reservation. A failed deposit
+// cancels the reservation and lets go of its room. Errors are answered
+// with a 500 so the gateway sends the event again. A confirmed reservation
+// is sent to the webhooks as modified
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "can't read the event", http.StatusBadRequest)
+		return
+	}
+
+	event, err := m.Payments.VerifyWebhook(payload, r.Header.Get(payments.SignatureHeader))
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	intent := event.Intent()
+
+	res, err := m.DB.GetReservationByPaymentIntent(intent.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// not a payment for a reservation, nothing to do
+		m.App.InfoLog.Printf("payment %s is not for a reservation", intent.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	balance := intent.ID == res.BalanceIntentID
+
+	switch event.Type {
+	case payments.EventAmountCapturable:
+		// a deposit is only taken while the room is kept for it, and a
+		// balance while the reservation stands
+		if (!balance && res.Status != models.ReservationPendingPayment) || (balance && res.Status != models.ReservationConfirmed) {
+			break
+		}
+
+		_, err = m.Payments.CaptureIntent(r.Context(), intent.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+	case payments.EventSucceeded:
+		payment := models.Payment{
+			ReservationID: res.ID,
+			Kind:          models.PaymentDeposit,
+			Amount:        intent.AmountReceived,
+			IntentID:      intent.ID,
+			Reference:     intent.ID,
+		}
+		if balance {
+			payment.Kind = models.PaymentBalance
+		}
+
+		// the gateway may send an event twice, the ledger keeps one entry per intent
+		_, err = m.DB.InsertPayment(payment)
+		if err != nil && !errors.Is(err, repository.ErrConflict) {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// a deposit that comes in for a reservation cancelled already, e.g.
+		// one that ran out of time to pay, is paid back once
+		if !balance && res.Status == models.ReservationCancelled && err == nil {
+			m.refundDeposit(r.Context(), res, intent)
+			break
+		}
+
+		if balance || res.Status != models.ReservationPendingPayment {
+			break
+		}
+
+		// only the update that wins mails the guest
+		err = m.DB.UpdateReservationStatus(res.ID, models.ReservationPendingPayment, models.ReservationConfirmed)
+		if errors.Is(err, repository.ErrConflict) {
+			break
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		res.Status = models.ReservationConfirmed
+		m.sendReservationMail(res)
+		m.reservationEvent(models.EventReservationModified, res)
+
+	case payments.EventPaymentFailed:
+		m.App.InfoLog.Printf("payment %s failed", intent.ID)
+
+		_, err = m.DB.InsertPayment(models.Payment{
+			ReservationID: res.ID,
+			Kind:          models.PaymentFailed,
+			Amount:        intent.Amount,
+			IntentID:      intent.ID,
+			Reference:     event.ID,
+		})
+		if err != nil && !errors.Is(err, repository.ErrConflict) {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if balance || res.Status != models.ReservationPendingPayment {
+			break
+		}
+
+		err = m.releaseUnpaid(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// releaseUnpaid cancels a reservation whose deposit failed or wasn't paid in
+// time and lets go of its room. A reservation paid in the meantime stands
+func (m *Repository) releaseUnpaid(res models.Reservation) error {
+	err := m.DB.CancelUnpaidReservation(res.ID)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.App.InfoLog.Printf("reservation %d was not paid, its room is let go of", res.ID)
+
+	res.Status = models.ReservationCancelled
+	m.reservationEvent(models.EventReservationCancelled, res)
+	return nil
+}
+
+// refundDeposit pays back the deposit of a reservation that was cancelled
+// before it came in. A refund the gateway turns down is logged and left to
+// the owner
+func (m *Repository) refundDeposit(ctx context.Context, res models.Reservation, intent payments.Intent) {
+	paid, err := m.Payments.Refund(ctx, intent.ID, intent.AmountReceived)
+	if err != nil {
+		m.App.ErrorLog.Printf("refund of the late deposit %s: %v", intent.ID, err)
+		return
+	}
+
+	_, err = m.DB.InsertPayment(models.Payment{
+		ReservationID: res.ID,
+		Kind:          models.PaymentRefund,
+		Amount:        paid.Amount,
+		IntentID:      intent.ID,
+		Reference:     paid.ID,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// ExpireUnpaidReservations cancels the reservations whose deposit wasn't paid
+// in time, so their rooms can be booked again. It is run in the background
+// every minute with the holds
+func (m *Repository) ExpireUnpaidReservations(ctx context.Context) error {
+	unpaid, err := m.DB.UnpaidReservations(m.Pricing.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, res := range unpaid {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = m.releaseUnpaid(res)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schedulePayment gives a reservation the cancellation policy of its room,
+// and works out the deposit taken at booking and when the balance is due
+func (m *Repository) schedulePayment(res *models.Reservation, room models.Room) error {
+	policy, err := m.DB.GetCancellationPolicyByID(room.CancellationPolicyID)
+	if err != nil {
+		return err
+	}
+
+	res.Policy = policy
+	res.Deposit, res.BalanceDueDate = pricing.Schedule(policy, res.Quote.Total, res.StartDate, m.Pricing.Now())
+	return nil
+}
+
+// errGatewayDown is returned by placeBooking when the gateway can't take the deposit
+var errGatewayDown = errors.New("the payment gateway is unavailable")
+
+// placeBooking books a priced reservation. The guest is asked for the deposit
+// first and the reservation is confirmed once the gateway tells us the payment
+// went through, or cancelled if it isn't paid in time; a policy without a
+// deposit confirms it straight away and the guest is sent their confirmation.
+// The intent is empty when nothing is paid now. When the booking fails the
+// deposit's intent is cancelled
+func (m *Repository) placeBooking(ctx context.Context, res models.Reservation) (models.Reservation, payments.Intent, error) {
+	res.Status = models.ReservationConfirmed
+
+	var intent payments.Intent
+	if res.Deposit > 0 {
+		var err error
+		intent, err = m.Payments.CreateIntent(ctx, res.Deposit, pricing.Currency, map[string]string{
+			"room_id": strconv.Itoa(res.RoomID),
+			"start_date": res.StartDate.Format("2006-01-02"),
+			"end_date": res.EndDate.Format("2006-01-02"),
+			"email": res.Email,
+			"purpose": models.PaymentDeposit,
+		})
+		if err != nil {
+			return res, intent, fmt.Errorf("%w: %v", errGatewayDown, err)
+		}
+
+		res.Status = models.ReservationPendingPayment
+		res.PaymentIntentID = intent.ID
+		// the room is held for the guest while they pay, as while they booked
+		res.PaymentExpiresAt = m.Pricing.Now().Add(m.holdFor())
+	}
+
+	// the reservation, its room restriction and the promo code use are saved together
+	id, err := m.DB.CreateBooking(res, m.Pricing.Now())
+	if err != nil {
+		// nothing is booked, so the deposit must not be payable
+		if intent.ID != "" {
+			if _, cancelErr := m.Payments.CancelIntent(ctx, intent.ID); cancelErr != nil {
+				m.App.ErrorLog.Printf("cancelling payment %s of a booking that failed: %v", intent.ID, cancelErr)
+			}
+		}
+		return res, payments.Intent{}, err
+	}
+
+	// read it back for the confirmation code it was given
+	res, err = m.DB.GetReservationByID(id)
+	if err != nil {
+		return res, intent, err
+	}
+
+	if intent.ID == "" {
+		m.sendReservationMail(res)
+	}
+	m.reservationEvent(models.EventReservationCreated, res)
+
+	return res, intent, nil
+}
+
+// cancelReservation cancels a reservation and pays back what its cancellation
+// policy allows, from the newest payment back. It returns the refund owed;
+// a refund the gateway turns down is logged and left to the owner, who is
+// told about it in their copy of the cancellation
+func (m *Repository) cancelReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ledger, err := m.DB.PaymentsForReservation(res.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	refund := pricing.Refund(res.Policy, pricing.Paid(ledger), res.StartDate, m.Pricing.Now())
+
+	err = m.DB.CancelReservation(res.ID)
+	if err != nil {
+		return 0, err
+	}
+	res.Status = models.ReservationCancelled
+
+	left := refund
+	for i := len(ledger) - 1; i >= 0 && left > 0; i-- {
+		charge := ledger[i]
+		if charge.Kind != models.PaymentDeposit && charge.Kind != models.PaymentBalance {
+			continue
+		}
+
+		amount := charge.Amount
+		if amount > left {
+			amount = left
+		}
+
+		paid, err := m.Payments.Refund(ctx, charge.IntentID, amount)
+		if err != nil {
+			m.App.ErrorLog.Printf("refund of %d on %s: %v", amount, charge.IntentID, err)
+			break
+		}
+
+		_, err = m.DB.InsertPayment(models.Payment{
+			ReservationID: res.ID,
+			Kind:          models.PaymentRefund,
+			Amount:        paid.Amount,
+			IntentID:      charge.IntentID,
+			Reference:     paid.ID,
+		})
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+
+		left -= paid.Amount
+	}
+
+	m.sendCancellationMail(res, refund, left)
+	m.reservationEvent(models.EventReservationCancelled, res)
+
+	return refund, nil
+}
+
+// CollectBalances asks the guests whose balance is due for it: a payment is
+// created for the balance and they are mailed a link to pay it. It is run
+// in the background every so often
+func (m *Repository) CollectBalances(ctx context.Context) error {
+	due, err := m.DB.DueBalances(m.Pricing.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, res := range due {
+		intent, err := m.balanceIntent(ctx, res)
+		if errors.Is(err, repository.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		res.BalanceIntentID = intent.ID
+		m.sendBalanceMail(res)
+	}
+
+	return nil
+}
+
+// balanceIntent creates the payment for the balance of a reservation. It
+// fails with repository.ErrConflict when the reservation has one already
+func (m *Repository) balanceIntent(ctx context.Context, res models.Reservation) (payments.Intent, error) {
+	intent, err := m.Payments.CreateIntent(ctx, res.Balance(), pricing.Currency, map[string]string{
+		"reservation_id": strconv.Itoa(res.ID),
+		"purpose":        models.PaymentBalance,
+	})
+	if err != nil {
+		return intent, err
+	}
+
+	err = m.DB.SetBalanceIntent(res.ID, intent.ID)
+	return intent, err
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// mailCount counts the messages sent to an address since the last resetMail
+func mailCount(to string) int {
+	sentMail.Lock()
+	defer sentMail.Unlock()
+
+	n := 0
+	for _, msg := range sentMail.messages {
+		if msg.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+// webhookRequest builds a payment webhook for an event, signed with secret
+func webhookRequest(event payments.Event, secret string) *http.Request {
+	payload, _ := json.Marshal(event)
+
+	req, _ := http.NewRequest("POST", "/webhooks/payments", strings.NewReader(string(payload)))
+	req.Header.Set(payments.SignatureHeader, payments.SignWebhook(secret, payload, time.Now()))
+	return req
+}
+
+// postTestReservation makes a reservation through PostReservation and returns
+// it with the context of the session it is in
+func postTestReservation(t *testing.T, start, end, email string) (models.Reservation, *http.Request) {
+	t.Helper()
+
+	var reqBody reqBody
+	body := reqBody.urlValues(start, end, "Johny", "Smith", email, "123 456", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservation-payment" {
+		t.Fatalf("PostReservation returned %d to %q, wanted a redirect to the payment page", rr.Code, rr.Header().Get("Location"))
+	}
+
+	res, ok := session.Get(req.Context(), "reservation").(models.Reservation)
+	if !ok {
+		t.Fatal("PostReservation did not put the reservation in the session")
+	}
+
+	return res, req
+}
+
+func TestRepository_PaymentFlow(t *testing.T) {
+	resetMail()
+
+	res, req := postTestReservation(t, "2053-04-01", "2053-04-03", "payer@example.com")
+
+	saved, err := testDB.GetReservationByID(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != models.ReservationPendingPayment || saved.PaymentIntentID == "" {
+		t.Fatalf("PostReservation stored status %q and intent %q, wanted a pending payment", saved.Status, saved.PaymentIntentID)
+	}
+
+	// room 1 has the moderate policy, a 30% deposit
+	if res.Deposit != (res.Quote.Total*30+50)/100 || res.Balance() == 0 {
+		t.Errorf("PostReservation scheduled a deposit of %d of %d", res.Deposit, res.Quote.Total)
+	}
+
+	intent, ok := fakeGateway.Intent(saved.PaymentIntentID)
+	if !ok || intent.Amount != res.Deposit || intent.Currency != "usd" {
+		t.Errorf("PostReservation asked for %+v, wanted %d usd", intent, res.Deposit)
+	}
+	if mailCount("payer@example.com") != 0 {
+		t.Error("PostReservation confirmed the reservation before it was paid")
+	}
+
+	// the payment page posts the card to the gateway
+	payReq, _ := http.NewRequest("GET", "http://evil.example.com/reservation-payment", nil)
+	payReq = payReq.WithContext(req.Context())
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationPayment).ServeHTTP(rr, payReq)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ReservationPayment returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if strings.Contains(rr.Body.String(), "evil.example.com") {
+		t.Error("the payment page sends the guest back to the host the request named")
+	}
+	for _, want := range []string{"/v1/payment_intents/" + intent.ID + "/confirm", intent.ClientSecret, payments.TestCardDeclined, app.BaseURL + "/reservation-summary"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("the payment page does not show %q", want)
+		}
+	}
+
+	if _, err := fakeGateway.Confirm(intent.ID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ = testDB.GetReservationByID(res.ID)
+	if saved.Status != models.ReservationConfirmed {
+		t.Errorf("the payment left the reservation %q, wanted %q", saved.Status, models.ReservationConfirmed)
+	}
+
+	intent, _ = fakeGateway.Intent(intent.ID)
+	if intent.Status != payments.StatusSucceeded || intent.AmountReceived != res.Deposit {
+		t.Errorf("the payment was not captured: got %+v", intent)
+	}
+
+	ledger, _ := testDB.PaymentsForReservation(res.ID)
+	if len(ledger) != 1 || ledger[0].Kind != models.PaymentDeposit || ledger[0].Amount != res.Deposit {
+		t.Errorf("the ledger has %+v, wanted the deposit", ledger)
+	}
+
+	if _, ok := mailTo("payer@example.com"); !ok {
+		t.Error("the guest did not get a confirmation once they paid")
+	}
+
+	// coming back to the payment page goes on to the summary
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationPayment).ServeHTTP(rr, payReq)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservation-summary" {
+		t.Errorf("ReservationPayment of a paid reservation returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	sumReq, _ := http.NewRequest("GET", "/reservation-summary?payment_intent="+intent.ID+"&redirect_status=succeeded", nil)
+	sumReq = sumReq.WithContext(req.Context())
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationSummary).ServeHTTP(rr, sumReq)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("ReservationSummary returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if strings.Contains(rr.Body.String(), "waiting for your payment") {
+		t.Error("the summary of a paid reservation says the payment is pending")
+	}
+}
+
+// roomOneFree reports if room 1 can be booked from start to end
+func roomOneFree(t *testing.T, start, end string) bool {
+	t.Helper()
+
+	s, _ := time.Parse("2006-01-02", start)
+	e, _ := time.Parse("2006-01-02", end)
+
+	free, err := testDB.SerachAvailabilityByDatesByRoomID(s, e, 1, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return free
+}
+
+func TestRepository_DeclinedDeposit(t *testing.T) {
+	res, req := postTestReservation(t, "2053-04-10", "2053-04-12", "declined-deposit@example.com")
+
+	if roomOneFree(t, "2053-04-10", "2053-04-12") {
+		t.Fatal("the reservation waiting for its deposit does not hold the room")
+	}
+
+	if _, err := fakeGateway.Confirm(res.PaymentIntentID, payments.TestCardDeclined); err == nil {
+		t.Fatal("the declined card was accepted")
+	}
+
+	saved, _ := testDB.GetReservationByID(res.ID)
+	if saved.Status != models.ReservationCancelled {
+		t.Errorf("a declined card left the reservation %q, wanted %q", saved.Status, models.ReservationCancelled)
+	}
+	if !roomOneFree(t, "2053-04-10", "2053-04-12") {
+		t.Error("the room is still taken after the deposit was declined")
+	}
+
+	ledger, _ := testDB.PaymentsForReservation(res.ID)
+	if len(ledger) != 1 || ledger[0].Kind != models.PaymentFailed {
+		t.Errorf("the ledger has %+v, wanted the declined card", ledger)
+	}
+
+	// the guest can't pay for the room let go of
+	payReq, _ := http.NewRequest("GET", "/reservation-payment", nil)
+	payReq = payReq.WithContext(req.Context())
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationPayment).ServeHTTP(rr, payReq)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("ReservationPayment of a cancelled reservation returned %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if msg := session.GetString(req.Context(), "error"); msg != unpaidMessage {
+		t.Errorf("ReservationPayment of a cancelled reservation said %q", msg)
+	}
+}
+
+func TestRepository_FailedBookingCancelsDeposit(t *testing.T) {
+	testDB.SetFault("CreateBooking", func(args ...interface{}) error { return repository.ErrConflict })
+	defer testDB.ClearFaults()
+
+	var reqBody reqBody
+	body := reqBody.urlValues("2053-04-14", "2053-04-16", "Johny", "Smith", "failed-booking@example.com", "123 456", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("PostReservation for a booking that failed returned %d, wanted %d", rr.Code, http.StatusConflict)
+	}
+
+	// the deposit asked for can no longer be paid
+	events := fakeGateway.Events()
+	if len(events) == 0 {
+		t.Fatal("the gateway was not told about the failed booking")
+	}
+	last := events[len(events)-1]
+	if last.Type != payments.EventCanceled || last.Intent().Metadata["email"] != "failed-booking@example.com" {
+		t.Fatalf("got event %+v, wanted the deposit cancelled", last)
+	}
+	if intent, _ := fakeGateway.Intent(last.Intent().ID); intent.Status != payments.StatusCanceled {
+		t.Errorf("the deposit of the failed booking is %q", intent.Status)
+	}
+}
+
+func TestRepository_ExpireUnpaidReservations(t *testing.T) {
+	resetMail()
+
+	now := time.Now()
+	restore := withNow(now)
+	defer func() { restore() }()
+
+	res, _ := postTestReservation(t, "2053-04-20", "2053-04-22", "slow-payer@example.com")
+
+	if !res.PaymentExpiresAt.Equal(now.Add(defaultHoldMinutes * time.Minute).UTC().Truncate(time.Second)) {
+		t.Errorf("the deposit is due by %s", res.PaymentExpiresAt)
+	}
+
+	// the guest still has time to pay
+	if err := Repo.ExpireUnpaidReservations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := testDB.GetReservationByID(res.ID); saved.Status != models.ReservationPendingPayment {
+		t.Fatalf("the reservation is %q before its time to pay ran out", saved.Status)
+	}
+
+	restore()
+	restore = withNow(now.Add(defaultHoldMinutes * time.Minute))
+
+	if err := Repo.ExpireUnpaidReservations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := testDB.GetReservationByID(res.ID); saved.Status != models.ReservationCancelled {
+		t.Errorf("the reservation is %q after its time to pay ran out", saved.Status)
+	}
+	if !roomOneFree(t, "2053-04-20", "2053-04-22") {
+		t.Error("the room is still taken after the time to pay ran out")
+	}
+
+	// a deposit that comes in late is not taken
+	if _, err := fakeGateway.Confirm(res.PaymentIntentID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	intent, _ := fakeGateway.Intent(res.PaymentIntentID)
+	if intent.Status != payments.StatusRequiresCapture {
+		t.Errorf("the late deposit is %q, wanted it left uncaptured", intent.Status)
+	}
+	if ledger, _ := testDB.PaymentsForReservation(res.ID); len(ledger) != 0 {
+		t.Errorf("the ledger has %+v for a reservation that ran out of time", ledger)
+	}
+	if saved, _ := testDB.GetReservationByID(res.ID); saved.Status != models.ReservationCancelled {
+		t.Errorf("a late deposit moved the reservation to %q", saved.Status)
+	}
+	if mailCount("slow-payer@example.com") != 0 {
+		t.Error("the guest was sent a confirmation for a reservation that ran out of time")
+	}
+}
+
+func TestRepository_ReservationSummaryFailedPayment(t *testing.T) {
+	res, req := postTestReservation(t, "2053-05-01", "2053-05-03", "declined@example.com")
+
+	sumReq, _ := http.NewRequest("GET", "/reservation-summary?payment_intent="+res.PaymentIntentID+"&redirect_status=failed", nil)
+	sumReq = sumReq.WithContext(req.Context())
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationSummary).ServeHTTP(rr, sumReq)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservation-payment" {
+		t.Errorf("ReservationSummary after a failed payment returned %d to %q, wanted the payment page", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestRepository_PaymentWebhook(t *testing.T) {
+	resetMail()
+
+	res, _ := postTestReservation(t, "2053-06-01", "2053-06-03", "webhook@example.com")
+
+	intent, _ := fakeGateway.Intent(res.PaymentIntentID)
+	intent.Status = payments.StatusSucceeded
+
+	var event payments.Event
+	event.ID = "evt_test"
+	event.Type = payments.EventSucceeded
+	event.Data.Object = intent
+
+	// a webhook not signed by the gateway is refused
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PaymentWebhook).ServeHTTP(rr, webhookRequest(event, "whsec_other"))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("PaymentWebhook with a bad signature returned %d, wanted %d", rr.Code, http.StatusBadRequest)
+	}
+	saved, _ := testDB.GetReservationByID(res.ID)
+	if saved.Status != models.ReservationPendingPayment {
+		t.Errorf("a forged webhook moved the reservation to %q", saved.Status)
+	}
+
+	// the gateway may send the same event more than once
+	for i := 0; i < 2; i++ {
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(Repo.PaymentWebhook).ServeHTTP(rr, webhookRequest(event, "whsec_test"))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("PaymentWebhook returned %d, wanted %d", rr.Code, http.StatusOK)
+		}
+	}
+
+	saved, _ = testDB.GetReservationByID(res.ID)
+	if saved.Status != models.ReservationConfirmed {
+		t.Errorf("PaymentWebhook left the reservation %q, wanted %q", saved.Status, models.ReservationConfirmed)
+	}
+
+	if _, ok := mailTo("webhook@example.com"); !ok {
+		t.Fatal("PaymentWebhook did not confirm the reservation to the guest")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := mailCount("webhook@example.com"); n != 1 {
+		t.Errorf("the guest got %d confirmations, wanted 1", n)
+	}
+
+	// payments for something else are acknowledged and ignored
+	event.Data.Object.ID = "pi_unknown"
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PaymentWebhook).ServeHTTP(rr, webhookRequest(event, "whsec_test"))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("PaymentWebhook for an unknown intent returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/go-chi/chi"
+)
+
+// ShowReservation shows guests their reservation by its confirmation code,
+// with what they paid, the balance left and what cancelling refunds
+func (m *Repository) ShowReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByCode(chi.URLParam(r, "code"))
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	// the gateway sends the guest back here after paying the balance
+	if r.URL.Query().Get("redirect_status") == "failed" {
+		m.App.Session.Put(r.Context(), "error", "Your payment did not go through, please try again")
+	}
+
+	ledger, err := m.DB.PaymentsForReservation(res.ID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	paid := pricing.Paid(ledger)
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["payments"] = ledger
+	data["paid"] = paid
+	data["refund"] = pricing.Refund(res.Policy, paid, res.StartDate, m.Pricing.Now())
+	data["can_pay"] = m.balanceOpen(res, ledger)
+	data["can_cancel"] = m.cancellable(res)
+	data["invoiced"] = m.invoiced(res)
+
+	render.Template(w, r, "reservation.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostCancelReservation cancels a reservation for the guest and refunds them
+// what its cancellation policy allows
+func (m *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByCode(chi.URLParam(r, "code"))
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	page := "/reservations/" + res.ConfirmationCode
+
+	if !m.cancellable(res) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can't be cancelled")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	refund, err := m.cancelReservation(r.Context(), res)
+	if errors.Is(err, repository.ErrConflict) {
+		m.App.Session.Put(r.Context(), "error", "This reservation is already cancelled")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Your reservation is cancelled, %s is refunded", pricing.FormatMoney(refund)))
+	http.Redirect(w, r, page, http.StatusSeeOther)
+}
+
+// PayBalance takes the card details for the balance of a reservation. The
+// payment is made here if the guest pays before the balance is asked for
+func (m *Repository) PayBalance(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByCode(chi.URLParam(r, "code"))
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	page := "/reservations/" + res.ConfirmationCode
+
+	ledger, err := m.DB.PaymentsForReservation(res.ID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	if !m.balanceOpen(res, ledger) {
+		m.App.Session.Put(r.Context(), "error", "There is nothing to pay for this reservation")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	intent, err := m.openBalanceIntent(r.Context(), res)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "We can't take payments right now, please try again later")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+	res.BalanceIntentID = intent.ID
+
+	if intent.Status != payments.StatusRequiresPaymentMethod {
+		m.App.Session.Put(r.Context(), "flash", "Your payment is on its way")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	m.renderPayment(w, r, res, intent, m.App.BaseURL+page)
+}
+
+// openBalanceIntent returns the payment for the balance of a reservation,
+// making it when the balance has not been asked for yet
+func (m *Repository) openBalanceIntent(ctx context.Context, res models.Reservation) (payments.Intent, error) {
+	if res.BalanceIntentID == "" {
+		intent, err := m.balanceIntent(ctx, res)
+		if !errors.Is(err, repository.ErrConflict) {
+			return intent, err
+		}
+
+		// the balance worker made one in the meantime
+		res, err = m.DB.GetReservationByID(res.ID)
+		if err != nil {
+			return intent, err
+		}
+	}
+
+	return m.Payments.GetIntent(ctx, res.BalanceIntentID)
+}
+
+// balanceOpen tells whether the balance of a reservation is still to be paid
+func (m *Repository) balanceOpen(res models.Reservation, ledger []models.Payment) bool {
+	if res.Status != models.ReservationConfirmed || res.Balance() <= 0 {
+		return false
+	}
+
+	for _, p := range ledger {
+		if p.Kind == models.PaymentBalance {
+			return false
+		}
+	}
+	return true
+}
+
+// cancellable tells whether a reservation may still be cancelled, which it
+// may until the day of arrival
+func (m *Repository) cancellable(res models.Reservation) bool {
+	if res.Status == models.ReservationCancelled {
+		return false
+	}
+	return m.Pricing.Now().Before(res.StartDate)
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/go-chi/chi"
+)
+
+// guestRequest builds a request for a guest reservation route with the chi
+// code parameter set
+func guestRequest(method, target, code string) (*http.Request, context.Context) {
+	req, _ := http.NewRequest(method, target, nil)
+
+	ctx := getCtx(req)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("code", code)
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+
+	return req.WithContext(ctx), ctx
+}
+
+// paidTestReservation makes a reservation and pays its deposit, then forgets
+// the confirmation mail so tests see only what they send
+func paidTestReservation(t *testing.T, start, end, email string) models.Reservation {
+	t.Helper()
+
+	res, _ := postTestReservation(t, start, end, email)
+
+	if _, err := fakeGateway.Confirm(res.PaymentIntentID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := testDB.GetReservationByID(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != models.ReservationConfirmed {
+		t.Fatalf("paying the deposit left the reservation %q", saved.Status)
+	}
+
+	mailTo(email)
+	mailTo(app.MailFrom)
+	resetMail()
+
+	return saved
+}
+
+// withNow sets the time the handlers price and refund against until the
+// returned func is called
+func withNow(now time.Time) func() {
+	saved := Repo.Pricing.Now
+	Repo.Pricing.Now = func() time.Time { return now }
+	return func() { Repo.Pricing.Now = saved }
+}
+
+func TestRepository_ShowReservation(t *testing.T) {
+	res := paidTestReservation(t, "2054-06-01", "2054-06-03", "show@example.com")
+
+	req, _ := guestRequest("GET", "/reservations/"+res.ConfirmationCode, strings.ToLower(res.ConfirmationCode))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ShowReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ShowReservation returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, want := range []string{res.ConfirmationCode, "Cancel Reservation", "/reservations/" + res.ConfirmationCode + "/pay"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("the reservation page does not show %q", want)
+		}
+	}
+
+	req, _ = guestRequest("GET", "/reservations/NOPE", "NOPE")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.ShowReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("ShowReservation returned wrong response code for an unknown code: got %d, wanted %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestRepository_PostCancelReservation(t *testing.T) {
+	var tests = []struct {
+		name string
+		start string
+		end string
+		email string
+		now string
+		refundPercent int
+	}{
+		{"full refund", "2053-07-01", "2053-07-03", "cancel-full@example.com", "2053-01-01", 100},
+		{"partial refund", "2053-07-05", "2053-07-07", "cancel-partial@example.com", "2053-07-02", 50},
+	}
+
+	for _, e := range tests {
+		resetMail()
+
+		res := paidTestReservation(t, e.start, e.end, e.email)
+
+		now, _ := time.Parse("2006-01-02", e.now)
+		restore := withNow(now)
+
+		req, ctx := guestRequest("POST", "/reservations/"+res.ConfirmationCode+"/cancel", res.ConfirmationCode)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostCancelReservation).ServeHTTP(rr, req)
+
+		restore()
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservations/"+res.ConfirmationCode {
+			t.Errorf("%s: PostCancelReservation returned %d to %q", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if flash := session.GetString(ctx, "flash"); !strings.Contains(flash, "cancelled") {
+			t.Errorf("%s: got flash %q", e.name, flash)
+		}
+
+		saved, _ := testDB.GetReservationByID(res.ID)
+		if saved.Status != models.ReservationCancelled {
+			t.Errorf("%s: the reservation is %q, wanted %q", e.name, saved.Status, models.ReservationCancelled)
+		}
+
+		refund := (res.Deposit*e.refundPercent + 50) / 100
+
+		var refunded int
+		ledger, _ := testDB.PaymentsForReservation(res.ID)
+		for _, p := range ledger {
+			if p.Kind == models.PaymentRefund {
+				refunded += p.Amount
+			}
+		}
+		if refunded != refund {
+			t.Errorf("%s: refunded %d of a %d deposit, wanted %d", e.name, refunded, res.Deposit, refund)
+		}
+
+		msg, ok := mailTo(e.email)
+		if !ok || msg.Subject != "Reservation Cancelled" {
+			t.Errorf("%s: the guest was not told about the cancellation: got %+v", e.name, msg)
+		}
+		if _, ok := mailTo(app.MailFrom); !ok {
+			t.Errorf("%s: the owner was not told about the cancellation", e.name)
+		}
+
+		// the dates are free again
+		start, _ := time.Parse("2006-01-02", e.start)
+		end, _ := time.Parse("2006-01-02", e.end)
+		free, _ := testDB.SerachAvailabilityByDatesByRoomID(start, end, res.RoomID, Repo.Pricing.Now())
+		if !free {
+			t.Errorf("%s: the room is still booked after the cancellation", e.name)
+		}
+
+		// cancelling again changes nothing
+		req, ctx = guestRequest("POST", "/reservations/"+res.ConfirmationCode+"/cancel", res.ConfirmationCode)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostCancelReservation).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || session.GetString(ctx, "error") == "" {
+			t.Errorf("%s: cancelling twice returned %d without an error", e.name, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostCancelReservationAfterArrival(t *testing.T) {
+	res := paidTestReservation(t, "2053-07-20", "2053-07-22", "arrived@example.com")
+
+	now, _ := time.Parse("2006-01-02", "2053-07-20")
+	defer withNow(now)()
+
+	req, ctx := guestRequest("POST", "/reservations/"+res.ConfirmationCode+"/cancel", res.ConfirmationCode)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostCancelReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || session.GetString(ctx, "error") == "" {
+		t.Errorf("PostCancelReservation on the day of arrival returned %d without an error", rr.Code)
+	}
+
+	saved, _ := testDB.GetReservationByID(res.ID)
+	if saved.Status != models.ReservationConfirmed {
+		t.Errorf("the reservation was cancelled on the day of arrival")
+	}
+}
+
+func TestRepository_PayBalance(t *testing.T) {
+	resetMail()
+
+	res := paidTestReservation(t, "2053-08-01", "2053-08-04", "balance@example.com")
+
+	req, _ := guestRequest("GET", "/reservations/"+res.ConfirmationCode+"/pay", res.ConfirmationCode)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PayBalance).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PayBalance returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	saved, _ := testDB.GetReservationByID(res.ID)
+	if saved.BalanceIntentID == "" {
+		t.Fatal("PayBalance did not make a payment for the balance")
+	}
+
+	intent, _ := fakeGateway.Intent(saved.BalanceIntentID)
+	if intent.Amount != res.Balance() {
+		t.Errorf("PayBalance asked for %d, wanted %d", intent.Amount, res.Balance())
+	}
+	if !strings.Contains(rr.Body.String(), "/v1/payment_intents/"+intent.ID+"/confirm") {
+		t.Error("the payment page does not pay the balance")
+	}
+
+	if _, err := fakeGateway.Confirm(intent.ID, payments.TestCardVisa); err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, _ := testDB.PaymentsForReservation(res.ID)
+	if len(ledger) != 2 || ledger[1].Kind != models.PaymentBalance || ledger[1].Amount != res.Balance() {
+		t.Errorf("the ledger has %+v, wanted the deposit and the balance", ledger)
+	}
+
+	// the balance is paid, the guest is sent back to their reservation
+	req, ctx := guestRequest("GET", "/reservations/"+res.ConfirmationCode+"/pay", res.ConfirmationCode)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PayBalance).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || session.GetString(ctx, "error") == "" {
+		t.Errorf("PayBalance of a paid balance returned %d without an error", rr.Code)
+	}
+
+	// cancelling now refunds the whole stay, starting with the balance
+	now, _ := time.Parse("2006-01-02", "2053-01-01")
+	defer withNow(now)()
+
+	refund, err := Repo.cancelReservation(context.Background(), saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund != res.Quote.Total {
+		t.Errorf("refunded %d, wanted %d", refund, res.Quote.Total)
+	}
+
+	intent, _ = fakeGateway.Intent(saved.BalanceIntentID)
+	deposit, _ := fakeGateway.Intent(saved.PaymentIntentID)
+	if intent.Status != payments.StatusSucceeded || deposit.Status != payments.StatusSucceeded {
+		t.Errorf("got intents %+v and %+v", intent, deposit)
+	}
+
+	ledger, _ = testDB.PaymentsForReservation(res.ID)
+	if len(ledger) != 4 || ledger[2].IntentID != saved.BalanceIntentID || ledger[3].IntentID != saved.PaymentIntentID {
+		t.Errorf("the ledger has %+v, wanted the refunds of the balance and the deposit", ledger)
+	}
+}
+
+func TestRepository_CollectBalances(t *testing.T) {
+	resetMail()
+
+	res := paidTestReservation(t, "2053-09-01", "2053-09-03", "due@example.com")
+
+	// room 1 has the moderate policy, the balance is due 14 days before arrival
+	now, _ := time.Parse("2006-01-02", "2053-08-18")
+	defer withNow(now)()
+
+	err := Repo.CollectBalances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := testDB.GetReservationByID(res.ID)
+	if saved.BalanceIntentID == "" {
+		t.Fatal("CollectBalances did not ask for the balance")
+	}
+
+	intent, _ := fakeGateway.Intent(saved.BalanceIntentID)
+	if intent.Amount != res.Balance() || intent.Metadata["purpose"] != models.PaymentBalance {
+		t.Errorf("CollectBalances asked for %+v, wanted %d", intent, res.Balance())
+	}
+
+	msg, ok := mailTo("due@example.com")
+	if !ok || msg.Subject != "Your Balance Is Due" || !strings.Contains(msg.Content, app.BaseURL+"/reservations/"+res.ConfirmationCode+"/pay") {
+		t.Errorf("the guest was not sent a link to pay: got %+v", msg)
+	}
+
+	// the balance is only asked for once
+	err = Repo.CollectBalances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := mailCount("due@example.com"); n != 1 {
+		t.Errorf("the guest got %d emails for the balance, wanted 1", n)
+	}
+
+	// the pay page uses the payment asked for
+	req, _ := guestRequest("GET", "/reservations/"+res.ConfirmationCode+"/pay", res.ConfirmationCode)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PayBalance).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), intent.ClientSecret) {
+		t.Errorf("PayBalance returned %d without the balance payment", rr.Code)
+	}
+}
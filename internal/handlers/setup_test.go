@@ -6,15 +6,21 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/payments"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/dbrepo"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
@@ -23,7 +29,21 @@ import (
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
-var functions = template.FuncMap{}
+var functions = template.FuncMap{
+	"money": pricing.FormatMoney,
+	"amount": pricing.FormatAmount,
+	"shortDate": render.ShortDate,
+	"weekday": render.Weekday,
+	"price": render.Price,
+	"rate": pricing.FormatRate,
+	"baseCurrency": pricing.BaseCurrency,
+}
+
+// testDB is the in-memory database behind Repo, used to seed data and inject failures
+var testDB *dbrepo.MemoryRepo
+
+// fakeGateway is the payment gateway behind Repo, used to pay for reservations
+var fakeGateway *payments.FakeServer
 
 func TestMain(m *testing.M) {
 	//what am i going to put in the session
@@ -46,6 +66,13 @@ func TestMain(m *testing.M) {
 
 	app.Session = session
 
+	mailChan := make(chan models.MailData)
+	app.MailChan = mailChan
+	app.MailFrom = "owner@example.com"
+	app.BaseURL = "http://localhost:8080"
+	app.Company = models.Company{Name: "Fort Smythe Bed and Breakfast", Address: "1 Main Street\nNorthbrook", TaxID: "123-45-6789", Email: app.MailFrom}
+	go listenForMail(mailChan)
+
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
 		log.Fatal("cannot create template cache")
@@ -57,11 +84,111 @@ func TestMain(m *testing.M) {
 
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
+
+	testDB = repo.DB.(*dbrepo.MemoryRepo)
+	app.ExchangeRates = testDB.AllExchangeRates
+	seedTestDB()
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
+
+	// the fake gateway sends its webhooks to the handler, as it does in the app
+	webhooks := httptest.NewServer(http.HandlerFunc(repo.PaymentWebhook))
+	fakeGateway = payments.NewFakeServer(webhooks.URL, "whsec_test")
+	gatewayServer := httptest.NewServer(fakeGateway)
+
+	gateway := payments.NewStripe("sk_test", "whsec_test")
+	gateway.BaseURL = gatewayServer.URL
+	repo.Payments = gateway
+	app.PaymentsCheckoutURL = gatewayServer.URL
+
+	code := m.Run()
+
+	gatewayServer.Close()
+	webhooks.Close()
+	os.Exit(code)
+}
+
 
-	os.Exit(m.Run())
+// sentMail holds the messages handlers have queued since the last resetMail
+var sentMail struct {
+	sync.Mutex
+	messages []models.MailData
 }
 
+// listenForMail stands in for the mail sender, keeping every message
+func listenForMail(mailChan chan models.MailData) {
+	for msg := range mailChan {
+		sentMail.Lock()
+		sentMail.messages = append(sentMail.messages, msg)
+		sentMail.Unlock()
+	}
+}
+
+// resetMail forgets the messages sent so far
+func resetMail() {
+	sentMail.Lock()
+	defer sentMail.Unlock()
+	sentMail.messages = nil
+}
+
+// mailTo waits a little for a message to reach an address and returns it
+func mailTo(to string) (models.MailData, bool) {
+	for i := 0; i < 100; i++ {
+		sentMail.Lock()
+		for _, msg := range sentMail.messages {
+			if msg.To == to {
+				sentMail.Unlock()
+				return msg, true
+			}
+		}
+		sentMail.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return models.MailData{}, false
+}
+
+// seedTestDB books both rooms from 2050-01-01 to 2050-01-02, so searches for
+// those dates find nothing while other dates are free, and adds the admin user
+// admin@example.com with the password "password"
+func seedTestDB() {
+	_, err := testDB.InsertUser(models.User{
+		FirstName: "Admin",
+		Email: "admin@example.com",
+		Password: "password",
+		AccesLevel: 3,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start, _ := time.Parse("2006-01-02", "2050-01-01")
+	end, _ := time.Parse("2006-01-02", "2050-01-02")
+
+	for _, roomID := range []int{1, 2} {
+		id, err := testDB.InsertReservation(models.Reservation{
+			FirstName: "Booked",
+			LastName: "Guest",
+			Email: "booked@example.com",
+			StartDate: start,
+			EndDate: end,
+			RoomID: roomID,
+		}, Repo.Pricing.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = testDB.InsertRoomRestriction(models.RoomRestriction{
+			StartDate: start,
+			EndDate: end,
+			RoomID: roomID,
+			ReservationID: id,
+			RestrictionID: 1,
+		}, Repo.Pricing.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
 
 func getRoutes() http.Handler {
 
@@ -79,13 +206,41 @@ func getRoutes() http.Handler {
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Get("/rooms/{id}/calendar.json", Repo.RoomCalendarJSON)
+	mux.Get("/waitlist", Repo.Waitlist)
+	mux.Post("/waitlist", Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", Repo.WaitlistHold)
 
 	mux.Get("/contact", Repo.Contact)
+	mux.Post("/currency", Repo.PostCurrency)
 
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
+	mux.Get("/reservation-payment", Repo.ReservationPayment)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
 
+	mux.Get("/reservations/{code}", Repo.ShowReservation)
+	mux.Post("/reservations/{code}/cancel", Repo.PostCancelReservation)
+	mux.Get("/reservations/{code}/pay", Repo.PayBalance)
+	mux.Get("/reservations/{code}/invoice.pdf", Repo.GuestInvoice)
+
+	mux.Get("/ical/rooms/{id}.ics", Repo.ICalFeed)
+
+	mux.Post("/webhooks/payments", Repo.PaymentWebhook)
+
+	mux.Get("/api/openapi.json", Repo.APIOpenAPI)
+	mux.Get("/api/docs", Repo.APIDocs)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(Repo.APINotFound)
+		mux.MethodNotAllowed(Repo.APIMethodNotAllowed)
+
+		mux.With(Repo.APIAuth(models.ScopeReadAvailability)).Get("/rooms", Repo.APIRooms)
+		mux.With(Repo.APIAuth(models.ScopeReadAvailability)).Get("/availability", Repo.APIAvailability)
+		mux.With(Repo.APIAuth(models.ScopeCreateReservation)).Post("/reservations", Repo.APICreateReservation)
+		mux.With(Repo.APIAuth(models.ScopeReadReservations)).Get("/reservations/{code}", Repo.APIReservation)
+	})
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
@@ -119,6 +274,12 @@ func CreateTestTemplateCache() (map[string]*template.Template, error) {
 		return myCache, err
 	}
 
+	mails, err := filepath.Glob(fmt.Sprintf("%s/*.mail.tmpl", pathToTemplates))
+	if err != nil {
+		return myCache, err
+	}
+	pages = append(pages, mails...)
+
 	// range through all files ending whit *.page.tmpl
 	for _, page := range pages {
 		name := filepath.Base(page)
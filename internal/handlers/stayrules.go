@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/stayrules"
+)
+
+// checkStay makes sure a stay keeps to the stay rules of its room, returning a
+// *stayrules.Violation when it doesn't
+func (m *Repository) checkStay(roomID int, start, end time.Time) error {
+	rules, err := m.DB.StayRulesForRoom(roomID)
+	if err != nil {
+		return err
+	}
+
+	return stayrules.Check(rules, roomID, start, end, m.Pricing.Now())
+}
+
+// stayRefused sends the guest back to the search page with the reason their
+// stay breaks a stay rule, and reports if it did
+func (m *Repository) stayRefused(w http.ResponseWriter, r *http.Request, err error) bool {
+	var violation *stayrules.Violation
+	if !errors.As(err, &violation) {
+		return false
+	}
+
+	m.App.Session.Put(r.Context(), "error", violation.Reason)
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	return true
+}
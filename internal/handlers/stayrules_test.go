@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// withStayRules adds stay rules for June 2055, and returns a func that
+// removes them again. Every room needs 2 nights and has no arrivals on
+// Saturdays, room 2 needs 4 nights
+func withStayRules(t *testing.T) func() {
+	t.Helper()
+
+	start := time.Date(2055, time.June, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2055, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+	june := models.StayRule{Name: "June", StartDate: start, EndDate: end, MinNights: 2}
+	june.ClosedToArrival[time.Saturday] = true
+
+	var ids []int
+	for _, rule := range []models.StayRule{june, {Name: "Suite", RoomID: 2, StartDate: start, EndDate: end, MinNights: 4}} {
+		id, err := testDB.InsertStayRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	return func() {
+		for _, id := range ids {
+			testDB.DeleteStayRule(id)
+		}
+	}
+}
+
+func TestRepository_PostAvailabilityStayRules(t *testing.T) {
+	defer withStayRules(t)()
+
+	tests := []struct {
+		name string
+		start string
+		end string
+		expectedStatusCode int
+		reason string
+		rooms []string
+	}{
+		{"too short for every room", "2055-06-02", "2055-06-03", http.StatusSeeOther, "at least 2 nights", nil},
+		{"arrives on a Saturday", "2055-06-05", "2055-06-09", http.StatusSeeOther, "no arrivals on Saturdays", nil},
+		{"too short for the suite", "2055-06-02", "2055-06-04", http.StatusOK, "", []string{"/choose-room/1"}},
+		{"long enough for both", "2055-06-02", "2055-06-06", http.StatusOK, "", []string{"/choose-room/1", "/choose-room/2"}},
+	}
+
+	for _, e := range tests {
+		postData := url.Values{}
+		postData.Add("start", e.start)
+		postData.Add("end", e.end)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("PostAvailability for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.reason != "" {
+			if rr.Header().Get("Location") != "/search-availability" {
+				t.Errorf("PostAvailability for %s redirected to %q", e.name, rr.Header().Get("Location"))
+			}
+			if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.reason) {
+				t.Errorf("PostAvailability for %s said %q, wanted it to mention %q", e.name, msg, e.reason)
+			}
+			continue
+		}
+
+		for _, room := range []string{"/choose-room/1", "/choose-room/2"} {
+			offered := strings.Contains(rr.Body.String(), room)
+			wanted := false
+			for _, r := range e.rooms {
+				wanted = wanted || r == room
+			}
+			if offered != wanted {
+				t.Errorf("PostAvailability for %s offered %s: %v, wanted %v", e.name, room, offered, wanted)
+			}
+		}
+	}
+}
+
+func TestRepository_AvailabilityJSONStayRules(t *testing.T) {
+	defer withStayRules(t)()
+
+	postData := url.Values{}
+	postData.Add("start", "2055-06-02")
+	postData.Add("end", "2055-06-04")
+	postData.Add("room_id", "2")
+
+	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(postData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(rr, req)
+
+	var j jsonResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+		t.Fatal("failed to parse json!")
+	}
+
+	if rr.Code != http.StatusOK || j.Ok || !strings.Contains(j.Message, "at least 4 nights") {
+		t.Errorf("AvailabilityJSON returned %d with %+v, wanted the minimum stay of the suite", rr.Code, j)
+	}
+}
+
+func TestRepository_BookRoomStayRules(t *testing.T) {
+	defer withStayRules(t)()
+
+	req, _ := http.NewRequest("GET", "/book-room?id=1&s=2055-06-02&e=2055-06-03", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.BookRoom).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("BookRoom returned %d to %q, wanted a redirect to the search", rr.Code, rr.Header().Get("Location"))
+	}
+	if msg := session.GetString(ctx, "error"); !strings.Contains(msg, "at least 2 nights") {
+		t.Errorf("BookRoom said %q, wanted the minimum stay", msg)
+	}
+}
+
+func TestRepository_PostReservationStayRules(t *testing.T) {
+	defer withStayRules(t)()
+
+	var reqBody reqBody
+	body := reqBody.urlValues("2055-06-02", "2055-06-03", "Johny", "Smith", "too-short@example.com", "123 456", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(body.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("PostReservation returned %d to %q, wanted a redirect to the search", rr.Code, rr.Header().Get("Location"))
+	}
+	if msg := session.GetString(ctx, "error"); !strings.Contains(msg, "at least 2 nights") {
+		t.Errorf("PostReservation said %q, wanted the minimum stay", msg)
+	}
+
+	// a stay that keeps to the rules is booked
+	postTestReservation(t, "2055-06-02", "2055-06-04", "long-enough@example.com")
+}
+
+func TestRepository_StayRulesLeadTime(t *testing.T) {
+	start := time.Date(2055, time.July, 1, 0, 0, 0, 0, time.UTC)
+	id, err := testDB.InsertStayRule(models.StayRule{Name: "Lead time", StartDate: start, EndDate: start.AddDate(0, 0, 30), MinLeadDays: 7, MaxLeadDays: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteStayRule(id)
+
+	tests := []struct {
+		name string
+		now time.Time
+		reason string
+	}{
+		{"too late", time.Date(2055, time.June, 28, 12, 0, 0, 0, time.UTC), "at least 7 days ahead"},
+		{"in time", time.Date(2055, time.June, 1, 12, 0, 0, 0, time.UTC), ""},
+		{"too early", time.Date(2055, time.January, 1, 12, 0, 0, 0, time.UTC), "up to 90 days ahead"},
+	}
+
+	for _, e := range tests {
+		restore := withNow(e.now)
+		err := Repo.checkStay(1, start, start.AddDate(0, 0, 2))
+		restore()
+
+		if e.reason == "" && err != nil {
+			t.Errorf("checkStay %s: got error %v, wanted none", e.name, err)
+		}
+		if e.reason != "" && (err == nil || !strings.Contains(err.Error(), e.reason)) {
+			t.Errorf("checkStay %s: got error %v, wanted it to mention %q", e.name, err, e.reason)
+		}
+	}
+}
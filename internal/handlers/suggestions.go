@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/stayrules"
+)
+
+// suggestionDays is how many days before and after the dates asked about
+// stays of the same length are looked for, maxSuggestions how many of them
+// are suggested
+const (
+	suggestionDays = 14
+	maxSuggestions = 3
+)
+
+// stayOption is a room free for a stay, with its price
+type stayOption struct {
+	Room      models.Room
+	StartDate time.Time
+	EndDate   time.Time
+	Quote     models.Quote
+}
+
+// stayWindow is a stay of the length asked about on other dates, with the
+// rooms free then
+type stayWindow struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Options   []stayOption
+}
+
+// suggestions are what is offered instead when no room is free for a stay
+type suggestions struct {
+	// Windows are the nearest stays of the same length, earliest first
+	Windows []stayWindow
+	// Partial are the rooms free for part of the stay, the longest part of each
+	Partial []stayOption
+}
+
+// empty reports if there is nothing to suggest
+func (s suggestions) empty() bool {
+	return len(s.Windows) == 0 && len(s.Partial) == 0
+}
+
+// suggestStays finds what a guest could book instead of a stay no room is
+// free for: the same number of nights up to suggestionDays earlier or later,
+// nearest first, and the rooms free for some of the nights asked about. Only
+// rooms that sleep the guests and stays their stay rules allow are suggested,
+// nothing starts before today. roomID narrows the suggestions to one room
+func (m *Repository) suggestStays(start, end time.Time, guests, roomID int) (suggestions, error) {
+	var s suggestions
+
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		return s, err
+	}
+
+	now := m.Pricing.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	nights := int(end.Sub(start).Hours() / 24)
+
+	// earlier before later, so a stay a day early comes before one a day late
+	for offset := 1; offset <= suggestionDays && len(s.Windows) < maxSuggestions; offset++ {
+		for _, days := range []int{-offset, offset} {
+			from := start.AddDate(0, 0, days)
+			if from.Before(today) || len(s.Windows) == maxSuggestions {
+				continue
+			}
+			to := from.AddDate(0, 0, nights)
+
+			rooms, err := m.DB.SearchAvailabilityForAllRooms(from, to, guests, now)
+			if err != nil {
+				return s, err
+			}
+
+			options, err := m.stayOptions(rules, rooms, from, to, guests, roomID)
+			if err != nil {
+				return s, err
+			}
+			if len(options) > 0 {
+				s.Windows = append(s.Windows, stayWindow{StartDate: from, EndDate: to, Options: options})
+			}
+		}
+	}
+
+	sort.Slice(s.Windows, func(i, j int) bool {
+		return s.Windows[i].StartDate.Before(s.Windows[j].StartDate)
+	})
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		return s, err
+	}
+
+	for _, room := range rooms {
+		if (roomID != 0 && room.ID != roomID) || room.MaxOccupancy < guests {
+			continue
+		}
+
+		restrictions, err := m.DB.RoomRestrictionsForRoom(room.ID, start, now)
+		if err != nil {
+			return s, err
+		}
+
+		from, to, ok := longestFreeRun(rules, room.ID, restrictions, start, end, today, now)
+		if !ok {
+			continue
+		}
+
+		options, err := m.stayOptions(rules, []models.Room{room}, from, to, guests, roomID)
+		if err != nil {
+			return s, err
+		}
+		s.Partial = append(s.Partial, options...)
+	}
+
+	return s, nil
+}
+
+// stayOptions prices the rooms whose stay rules allow a stay from start to end
+func (m *Repository) stayOptions(rules []models.StayRule, rooms []models.Room, start, end time.Time, guests, roomID int) ([]stayOption, error) {
+	var options []stayOption
+	for _, room := range rooms {
+		if roomID != 0 && room.ID != roomID {
+			continue
+		}
+		if stayrules.Check(rules, room.ID, start, end, m.Pricing.Now()) != nil {
+			continue
+		}
+
+		quote, err := m.Pricing.Quote(room.ID, start, end, guests)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, stayOption{Room: room, StartDate: start, EndDate: end, Quote: quote})
+	}
+	return options, nil
+}
+
+// longestFreeRun is the longest stay within start to end, from today on, that
+// the restrictions of a room leave free and its stay rules allow. Of two as
+// long the earlier wins; ok is false when there is none
+func longestFreeRun(rules []models.StayRule, roomID int, restrictions []models.RoomRestriction, start, end, today, now time.Time) (from, to time.Time, ok bool) {
+	if start.Before(today) {
+		start = today
+	}
+
+	var free []time.Time
+	for night := start; night.Before(end); night = night.AddDate(0, 0, 1) {
+		taken := false
+		for _, rr := range restrictions {
+			if !night.Before(rr.StartDate) && night.Before(rr.EndDate) {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			free = append(free, night)
+		}
+	}
+
+	// of the stays made of consecutive free nights, the longest one allowed
+	best := 0
+	for i := range free {
+		for j := i; j < len(free); j++ {
+			if j > i && !free[j].Equal(free[j-1].AddDate(0, 0, 1)) {
+				break
+			}
+			n := j - i + 1
+			if n <= best {
+				continue
+			}
+			stayEnd := free[j].AddDate(0, 0, 1)
+			if stayrules.Check(rules, roomID, free[i], stayEnd, now) != nil {
+				continue
+			}
+			best, from, to, ok = n, free[i], stayEnd, true
+		}
+	}
+
+	return from, to, ok
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// blockForSuggestions takes room 1 from 2059-05-10 to 2059-05-14 and room 2
+// from 2059-05-12 to 2059-05-14, so nothing is free from 2059-05-10 to
+// 2059-05-13, and pretends it is 2059-05-08. It returns the cleanup
+func blockForSuggestions(t *testing.T) func() {
+	t.Helper()
+
+	may := func(day int) time.Time {
+		return time.Date(2059, time.May, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	restore := withNow(may(8).Add(10 * time.Hour))
+
+	first, err := testDB.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: may(10), EndDate: may(14)}, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := testDB.InsertBlock(models.RoomRestriction{RoomID: 2, StartDate: may(12), EndDate: may(14)}, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		testDB.DeleteBlock(first)
+		testDB.DeleteBlock(second)
+		restore()
+	}
+}
+
+func TestRepository_PostAvailability_Suggestions(t *testing.T) {
+	defer blockForSuggestions(t)()
+
+	postedData := url.Values{}
+	postedData.Add("start", "2059-05-10")
+	postedData.Add("end", "2059-05-13")
+	postedData.Add("adults", "2")
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostAvailability)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PostAvailability with other dates free returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"Other dates",
+		// the stay two days early is over before it starts
+		"/book-room?id=2&s=2059-05-08&e=2059-05-11&adults=2&children=0",
+		"/book-room?id=2&s=2059-05-09&e=2059-05-12&adults=2&children=0",
+		"/book-room?id=1&s=2059-05-14&e=2059-05-17&adults=2&children=0",
+		"Part of your stay",
+		"/book-room?id=2&s=2059-05-10&e=2059-05-12&adults=2&children=0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the search page does not show %q", want)
+		}
+	}
+	if strings.Contains(body, "s=2059-05-07") {
+		t.Error("the search page suggests a stay starting before today")
+	}
+}
+
+func TestRepository_APIAvailability_Suggestions(t *testing.T) {
+	defer blockForSuggestions(t)()
+
+	rr, resp := callAPI(t, "GET", "/api/v1/availability?start_date=2059-05-10&end_date=2059-05-13", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("APIAvailability returned %d", rr.Code)
+	}
+
+	var availability apiAvailability
+	if err := json.Unmarshal(resp.Data, &availability); err != nil {
+		t.Fatal(err)
+	}
+	if len(availability.Rooms) != 0 || availability.Suggestions == nil {
+		t.Fatalf("APIAvailability returned %+v", availability)
+	}
+
+	var dates []string
+	for _, stay := range availability.Suggestions.Dates {
+		dates = append(dates, stay.StartDate+" "+stay.EndDate)
+	}
+	if strings.Join(dates, ", ") != "2059-05-08 2059-05-11, 2059-05-09 2059-05-12, 2059-05-14 2059-05-17" {
+		t.Errorf("APIAvailability suggested the dates %v", dates)
+	}
+
+	last := availability.Suggestions.Dates[len(availability.Suggestions.Dates)-1]
+	if len(last.Rooms) != 2 || len(last.Rooms[0].Quote.Nights) != 3 {
+		t.Errorf("APIAvailability offered %+v from 2059-05-14", last.Rooms)
+	}
+
+	partial := availability.Suggestions.Partial
+	if len(partial) != 1 || partial[0].StartDate != "2059-05-10" || partial[0].EndDate != "2059-05-12" || partial[0].Rooms[0].Room.ID != 2 || len(partial[0].Rooms[0].Quote.Nights) != 2 {
+		t.Errorf("APIAvailability suggested part of the stay %+v", partial)
+	}
+
+	// narrowed to room 1, which is taken for the whole stay
+	_, resp = callAPI(t, "GET", "/api/v1/availability?start_date=2059-05-10&end_date=2059-05-13&room_id=1", "", nil)
+	availability = apiAvailability{}
+	if err := json.Unmarshal(resp.Data, &availability); err != nil {
+		t.Fatal(err)
+	}
+	if availability.Suggestions == nil || len(availability.Suggestions.Partial) != 0 || len(availability.Suggestions.Dates) != 3 || availability.Suggestions.Dates[0].StartDate != "2059-05-14" {
+		t.Errorf("APIAvailability for room 1 suggested %+v", availability.Suggestions)
+	}
+
+	// free rooms need no suggestions
+	_, resp = callAPI(t, "GET", "/api/v1/availability?start_date=2059-05-20&end_date=2059-05-22", "", nil)
+	if strings.Contains(string(resp.Data), "suggestions") {
+		t.Errorf("APIAvailability with free rooms suggested other stays: %s", resp.Data)
+	}
+}
+
+func TestLongestFreeRun(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2059, time.May, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	restrictions := []models.RoomRestriction{
+		{RoomID: 1, StartDate: day(3), EndDate: day(4)},
+		{RoomID: 1, StartDate: day(7), EndDate: day(8)},
+	}
+
+	from, to, ok := longestFreeRun(nil, 1, restrictions, day(1), day(10), day(1), day(1))
+	if !ok || !from.Equal(day(4)) || !to.Equal(day(7)) {
+		t.Errorf("got %v from %s to %s, wanted 2059-05-04 to 2059-05-07", ok, from.Format(apiDate), to.Format(apiDate))
+	}
+
+	// a stay rule wanting four nights leaves nothing long enough
+	rules := []models.StayRule{{RoomID: 1, StartDate: day(1), EndDate: day(10), MinNights: 4}}
+	if _, _, ok := longestFreeRun(rules, 1, restrictions, day(1), day(10), day(1), day(1)); ok {
+		t.Error("got a stay shorter than the stay rule allows")
+	}
+
+	// nights before today can't be booked
+	from, to, ok = longestFreeRun(nil, 1, restrictions, day(1), day(10), day(5), day(5))
+	if !ok || !from.Equal(day(5)) || !to.Equal(day(7)) {
+		t.Errorf("got %v from %s to %s from 2059-05-05 on, wanted 2059-05-05 to 2059-05-07", ok, from.Format(apiDate), to.Format(apiDate))
+	}
+}
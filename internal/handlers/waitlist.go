@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/forms"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/helpers"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/render"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/stayrules"
+	"github.com/go-chi/chi"
+)
+
+// waitlistHold is how long a guest told a room is free has to book it before
+// the next guest waiting is told
+const waitlistHold = 24 * time.Hour
+
+// waitlistRooms are the rooms a guest who found nothing free can wait for:
+// those that sleep the guests and whose stay rules allow the stay
+func (m *Repository) waitlistRooms(start, end time.Time, guests int) ([]models.Room, error) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var fit []models.Room
+	for _, room := range rooms {
+		if room.MaxOccupancy < guests || stayrules.Check(rules, room.ID, start, end, m.Pricing.Now()) != nil {
+			continue
+		}
+		fit = append(fit, room)
+	}
+
+	return fit, nil
+}
+
+// Waitlist shows the form to join the waitlist of a room for a stay it is
+// taken for
+func (m *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	entry, ok := m.waitlistEntry(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	m.renderWaitlist(w, r, entry, forms.New(nil))
+}
+
+// PostWaitlist puts the guest on the waitlist of the room. They are mailed a
+// link to book it if it frees up while they wait
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	entry, ok := m.waitlistEntry(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	entry.FirstName = r.Form.Get("first_name")
+	entry.LastName = r.Form.Get("last_name")
+	entry.Email = r.Form.Get("email")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		m.renderWaitlist(w, r, entry, form)
+		return
+	}
+
+	_, err = m.DB.InsertWaitlistEntry(entry)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("You're on the waitlist for the %s from %s to %s, we'll email you if it frees up",
+		entry.Room.RoomName, entry.StartDate.Format("2006-01-02"), entry.EndDate.Format("2006-01-02")))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// waitlistEntry reads the room, dates and guests of a stay to wait for and
+// makes sure it could be booked if the room were free. A stay that couldn't
+// sends the guest back to the search page, one the room is free for on to
+// booking it, and ok is false
+func (m *Repository) waitlistEntry(w http.ResponseWriter, r *http.Request, values url.Values) (entry models.WaitlistEntry, ok bool) {
+	layout := "2006-01-02"
+
+	roomID, err := strconv.Atoi(values.Get("room_id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return entry, false
+	}
+
+	start, err := time.Parse(layout, values.Get("start_date"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return entry, false
+	}
+
+	end, err := time.Parse(layout, values.Get("end_date"))
+	if err != nil || !end.After(start) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return entry, false
+	}
+
+	adults, children, err := guestCounts(values)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", guestsMessage)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return entry, false
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return entry, false
+	}
+
+	now := m.Pricing.Now()
+	if start.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)) {
+		m.App.Session.Put(r.Context(), "error", "That stay has already started, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return entry, false
+	}
+
+	if reason := roomTooSmall(room, adults+children); reason != "" {
+		m.App.Session.Put(r.Context(), "error", reason)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return entry, false
+	}
+
+	err = m.checkStay(roomID, start, end)
+	if m.stayRefused(w, r, err) {
+		return entry, false
+	}
+	if err != nil {
+		helpers.RepoError(w, err)
+		return entry, false
+	}
+
+	entry = models.WaitlistEntry{
+		RoomID:    roomID,
+		StartDate: start,
+		EndDate:   end,
+		Adults:    adults,
+		Children:  children,
+		Room:      room,
+	}
+
+	// a room that is free needs no waiting for
+	rules, err := m.DB.StayRulesForRoom(roomID)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return entry, false
+	}
+	free, err := m.roomFree(rules, entry)
+	if err != nil {
+		helpers.RepoError(w, err)
+		return entry, false
+	}
+	if free {
+		http.Redirect(w, r, bookRoomURL(roomID, start, end, adults, children), http.StatusSeeOther)
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// renderWaitlist shows the waitlist form for a stay
+func (m *Repository) renderWaitlist(w http.ResponseWriter, r *http.Request, entry models.WaitlistEntry, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["entry"] = entry
+
+	render.Template(w, r, "waitlist.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// WaitlistHold follows the link a guest on the waitlist was mailed, to book
+// the room that freed up for them while their turn lasts
+func (m *Repository) WaitlistHold(w http.ResponseWriter, r *http.Request) {
+	entry, err := m.DB.GetWaitlistEntryByToken(chi.URLParam(r, "token"))
+	if err != nil {
+		helpers.RepoError(w, err)
+		return
+	}
+
+	if entry.Status != models.WaitlistNotified || !m.Pricing.Now().Before(entry.HoldExpiresAt) {
+		m.App.Session.Put(r.Context(), "error", "This waitlist link has expired, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// the reservation form takes over the hold on the room the guest has
+	// while their turn lasts
+	m.App.Session.Put(r.Context(), "reservation", models.Reservation{
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		Email:     entry.Email,
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		RoomID:    entry.RoomID,
+		Adults:    entry.Adults,
+		Children:  entry.Children,
+		HoldID:    entry.HoldID,
+		HoldUntil: entry.HoldExpiresAt,
+		Room:      entry.Room,
+	})
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// bookRoomURL is the link that starts booking a room for a stay
+func bookRoomURL(roomID int, start, end time.Time, adults, children int) string {
+	values := url.Values{}
+	values.Set("id", strconv.Itoa(roomID))
+	values.Set("s", start.Format("2006-01-02"))
+	values.Set("e", end.Format("2006-01-02"))
+	values.Set("adults", strconv.Itoa(adults))
+	values.Set("children", strconv.Itoa(children))
+	return "/book-room?" + values.Encode()
+}
+
+// NotifyWaitlist tells the guests waiting for a room that it is free for
+// their stay, which happens when a reservation is cancelled or a block
+// removed. Guests are told in the order they joined, one at a time for the
+// same nights: each gets a link, and the room is held for them, for
+// waitlistHold. When it runs out the hold is let go of and the next guest
+// waiting is told, if the room is still free. Entries for stays that have
+// started are closed. It is run in the background every minute
+func (m *Repository) NotifyWaitlist(ctx context.Context) error {
+	entries, err := m.DB.OpenWaitlistEntries()
+	if err != nil {
+		return err
+	}
+
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		return err
+	}
+
+	now := m.Pricing.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var held []models.WaitlistEntry
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if e.Status == models.WaitlistNotified && now.Before(e.HoldExpiresAt) {
+			held = append(held, e)
+			continue
+		}
+
+		if e.Status == models.WaitlistNotified || e.StartDate.Before(today) {
+			// a guest who started booking has moved the hold to their
+			// reservation form, where it lapses by itself
+			if e.HoldID != 0 {
+				err := m.DB.DeleteHold(e.HoldID)
+				if err != nil && !errors.Is(err, repository.ErrNotFound) {
+					return err
+				}
+				e.HoldID = 0
+			}
+			e.Status = models.WaitlistExpired
+			if err := m.DB.UpdateWaitlistEntry(e); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if heldFor(held, e) {
+			continue
+		}
+
+		free, err := m.roomFree(rules, e)
+		if err != nil {
+			return err
+		}
+		if !free {
+			continue
+		}
+
+		e.HoldExpiresAt = now.Add(waitlistHold)
+		hold, err := m.DB.PlaceHold(models.RoomRestriction{
+			RoomID:    e.RoomID,
+			StartDate: e.StartDate,
+			EndDate:   e.EndDate,
+			ExpiresAt: e.HoldExpiresAt,
+		}, now)
+		if errors.Is(err, repository.ErrConflict) {
+			// booked or held since the room was found free
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		e.Status = models.WaitlistNotified
+		e.NotifiedAt = now
+		e.HoldID = hold
+		if err := m.DB.UpdateWaitlistEntry(e); err != nil {
+			return err
+		}
+		held = append(held, e)
+
+		m.sendWaitlistMail(e)
+	}
+
+	return nil
+}
+
+// heldFor reports if a guest told before e holds their turn for any of its nights
+func heldFor(held []models.WaitlistEntry, e models.WaitlistEntry) bool {
+	for _, h := range held {
+		if h.RoomID == e.RoomID && h.StartDate.Before(e.EndDate) && e.StartDate.Before(h.EndDate) {
+			return true
+		}
+	}
+	return false
+}
+
+// roomFree reports if the room of a waitlist entry can be booked for its stay
+func (m *Repository) roomFree(rules []models.StayRule, e models.WaitlistEntry) (bool, error) {
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(e.StartDate, e.EndDate, e.Guests(), m.Pricing.Now())
+	if err != nil {
+		return false, err
+	}
+
+	for _, room := range rooms {
+		if room.ID == e.RoomID {
+			return stayrules.Check(rules, room.ID, e.StartDate, e.EndDate, m.Pricing.Now()) == nil, nil
+		}
+	}
+	return false, nil
+}
+
+// sendWaitlistMail tells a guest on the waitlist the room they wait for is
+// free, with the link to book it while their turn lasts
+func (m *Repository) sendWaitlistMail(e models.WaitlistEntry) {
+	data := make(map[string]interface{})
+	data["entry"] = e
+	data["book_url"] = m.App.BaseURL + "/waitlist/" + e.Token
+
+	m.sendMail(e.Email, "A Room You Wait For Is Free", "waitlist-free.mail.tmpl", data)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/go-chi/chi"
+)
+
+// postWaitlist posts the waitlist form for room 2 from 2059-07-10 to
+// 2059-07-12 for three adults
+func postWaitlist(t *testing.T, firstName, email string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	postedData := url.Values{}
+	postedData.Add("room_id", "2")
+	postedData.Add("start_date", "2059-07-10")
+	postedData.Add("end_date", "2059-07-12")
+	postedData.Add("adults", "3")
+	postedData.Add("children", "0")
+	postedData.Add("first_name", firstName)
+	postedData.Add("last_name", "Waiting")
+	postedData.Add("email", email)
+
+	req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostWaitlist).ServeHTTP(rr, req)
+
+	return rr
+}
+
+// getWaitlist sends a GET through the routes
+func getWaitlist(target string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", target, nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	return rr
+}
+
+// followWaitlistLink follows the link mailed to a guest on the waitlist and
+// returns the session it put the stay in
+func followWaitlistLink(token string) (*httptest.ResponseRecorder, context.Context) {
+	req, _ := http.NewRequest("GET", "/waitlist/"+token, nil)
+	ctx := getCtx(req)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("token", token)
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.WaitlistHold).ServeHTTP(rr, req)
+
+	return rr, ctx
+}
+
+// roomTwoHolds gives the holds on room 2 in July 2059
+func roomTwoHolds(t *testing.T) []models.RoomRestriction {
+	t.Helper()
+
+	restrictions, err := testDB.RoomRestrictionsForRoom(2, time.Date(2059, time.July, 1, 0, 0, 0, 0, time.UTC), Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var holds []models.RoomRestriction
+	for _, rr := range restrictions {
+		if !rr.ExpiresAt.IsZero() {
+			holds = append(holds, rr)
+		}
+	}
+	return holds
+}
+
+// waitlistStatuses gives the status of each open waitlist entry by email
+func waitlistStatuses(t *testing.T) map[string]models.WaitlistEntry {
+	t.Helper()
+
+	entries, err := testDB.OpenWaitlistEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byEmail := make(map[string]models.WaitlistEntry)
+	for _, e := range entries {
+		byEmail[e.Email] = e
+	}
+	return byEmail
+}
+
+func TestRepository_Waitlist(t *testing.T) {
+	july := func(day int) time.Time {
+		return time.Date(2059, time.July, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	restore := withNow(july(1).Add(10 * time.Hour))
+	defer func() { restore() }()
+
+	// room 2 is the only one that sleeps three, and it is taken for weeks
+	block, err := testDB.InsertBlock(models.RoomRestriction{RoomID: 2, StartDate: july(1).AddDate(0, 0, -20), EndDate: july(31)}, Repo.Pricing.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postedData := url.Values{}
+	postedData.Add("start", "2059-07-10")
+	postedData.Add("end", "2059-07-12")
+	postedData.Add("adults", "3")
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostAvailability).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PostAvailability with only the waitlist to offer returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	join := "/waitlist?room_id=2&start_date=2059-07-10&end_date=2059-07-12&adults=3&children=0"
+	if body := rr.Body.String(); !strings.Contains(body, join) || strings.Contains(body, "room_id=1") || strings.Contains(body, "Other dates") {
+		t.Errorf("the search page does not offer only the waitlist of room 2")
+	}
+
+	rr = getWaitlist(join)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Join the Waitlist") {
+		t.Errorf("Waitlist returned %d", rr.Code)
+	}
+
+	// a room too small for the guests has no waitlist to join
+	rr = getWaitlist(strings.Replace(join, "room_id=2", "room_id=1", 1))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("Waitlist for a room too small returned %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// a room that is free is booked rather than waited for
+	rr = getWaitlist("/waitlist?room_id=2&start_date=2059-08-10&end_date=2059-08-12&adults=3&children=0")
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), "/book-room?") {
+		t.Errorf("Waitlist for a free room returned %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = postWaitlist(t, "First", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "This field cannot be blank") {
+		t.Errorf("PostWaitlist without an email returned %d", rr.Code)
+	}
+
+	for _, email := range []string{"first@example.com", "second@example.com"} {
+		rr = postWaitlist(t, "Guest", email)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+			t.Fatalf("PostWaitlist returned %d to %s", rr.Code, rr.Header().Get("Location"))
+		}
+	}
+
+	// nobody is told while the room is taken
+	if err := Repo.NotifyWaitlist(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := waitlistStatuses(t); s["first@example.com"].Status != models.WaitlistWaiting || s["second@example.com"].Status != models.WaitlistWaiting {
+		t.Fatalf("got %+v while the room is taken", s)
+	}
+
+	if err := testDB.DeleteBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first guest to join is told first, the second waits for their turn
+	if err := Repo.NotifyWaitlist(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s := waitlistStatuses(t)
+	first := s["first@example.com"]
+	if first.Status != models.WaitlistNotified || !first.HoldExpiresAt.Equal(july(2).Add(10*time.Hour)) || s["second@example.com"].Status != models.WaitlistWaiting {
+		t.Fatalf("got %+v after the room freed up", s)
+	}
+
+	msg, ok := mailTo("first@example.com")
+	if !ok || !strings.Contains(msg.Content, "/waitlist/"+first.Token) {
+		t.Errorf("the first guest was not mailed their link: %+v", msg)
+	}
+
+	// the room is held for the first guest while their link works
+	holds := roomTwoHolds(t)
+	if len(holds) != 1 || holds[0].ID != first.HoldID || !holds[0].ExpiresAt.Equal(first.HoldExpiresAt) {
+		t.Fatalf("got holds %+v for the first guest's hold %d", holds, first.HoldID)
+	}
+	if ok, _ := testDB.SerachAvailabilityByDatesByRoomID(july(10), july(12), 2, Repo.Pricing.Now()); ok {
+		t.Error("room 2 is available while it is held for the first guest")
+	}
+
+	rr, ctx = followWaitlistLink(first.Token)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/make-reservation" {
+		t.Errorf("WaitlistHold returned %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+	res, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if res.RoomID != 2 || !res.StartDate.Equal(july(10)) || !res.EndDate.Equal(july(12)) || res.Adults != 3 ||
+		res.Email != "first@example.com" || res.HoldID != first.HoldID || !res.HoldUntil.Equal(first.HoldExpiresAt) {
+		t.Errorf("got %+v in the session from the waitlist link", res)
+	}
+
+	// when the first guest's turn runs out the second is told
+	restore()
+	restore = withNow(july(2).Add(11 * time.Hour))
+
+	if err := Repo.NotifyWaitlist(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s = waitlistStatuses(t)
+	second := s["second@example.com"]
+	if _, open := s["first@example.com"]; open || second.Status != models.WaitlistNotified {
+		t.Fatalf("got %+v after the first guest's turn", s)
+	}
+	if _, ok := mailTo("second@example.com"); !ok {
+		t.Error("the second guest was not mailed their link")
+	}
+
+	// the first guest's hold is let go of and the room held for the second
+	if holds = roomTwoHolds(t); len(holds) != 1 || holds[0].ID != second.HoldID || !holds[0].ExpiresAt.Equal(second.HoldExpiresAt) {
+		t.Fatalf("got holds %+v for the second guest's hold %d", holds, second.HoldID)
+	}
+
+	// the reservation form takes the hold over for as long as the link works
+	_, ctx = followWaitlistLink(second.Token)
+	if rr = showReservationForm(ctx); rr.Code != http.StatusOK {
+		t.Fatalf("Reservation from the waitlist link returned %d", rr.Code)
+	}
+	res, _ = session.Get(ctx, "reservation").(models.Reservation)
+	if holds = roomTwoHolds(t); len(holds) != 1 || holds[0].ID != res.HoldID || !holds[0].ExpiresAt.Equal(second.HoldExpiresAt) {
+		t.Fatalf("got holds %+v for the second guest's form, hold %d", holds, res.HoldID)
+	}
+
+	rr = getWaitlist("/waitlist/" + first.Token)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("WaitlistHold for a turn that ran out returned %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = getWaitlist("/waitlist/no-such-token")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("WaitlistHold for an unknown token returned %d, wanted %d", rr.Code, http.StatusNotFound)
+	}
+
+	// the waitlist of a stay that has started is closed
+	restore()
+	restore = withNow(july(11).Add(10 * time.Hour))
+
+	if err := Repo.NotifyWaitlist(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := waitlistStatuses(t); len(s) != 0 {
+		t.Errorf("got %+v after the stay started", s)
+	}
+
+	if err := Repo.ReapHolds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if holds = roomTwoHolds(t); len(holds) != 0 {
+		t.Errorf("got holds %+v after the second guest's turn", holds)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/webhooks"
+)
+
+// apiBlock is a block as webhooks are told about it
+type apiBlock struct {
+	ID        int    `json:"id"`
+	RoomID    int    `json:"room_id"`
+	RoomName  string `json:"room_name"`
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+	Reason    string `json:"reason"`
+}
+
+func toAPIBlock(block models.RoomRestriction) apiBlock {
+	return apiBlock{
+		ID:        block.ID,
+		RoomID:    block.RoomID,
+		RoomName:  block.Room.RoomName,
+		StartDate: block.StartDate.Format(apiDate),
+		EndDate:   block.EndDate.Format(apiDate),
+		Reason:    block.Restriction.RestrictionName,
+	}
+}
+
+// reservationEvent tells the webhooks subscribed to event about a reservation
+func (m *Repository) reservationEvent(event string, res models.Reservation) {
+	m.fireWebhooks(event, toAPIReservation(res))
+}
+
+// blockEvent tells the webhooks subscribed to event about a block
+func (m *Repository) blockEvent(event string, block models.RoomRestriction) {
+	m.fireWebhooks(event, toAPIBlock(block))
+}
+
+// fireWebhooks queues a delivery of the event for every active webhook
+// subscribed to it, DeliverWebhooks sends them. The event has happened
+// whatever becomes of its webhooks, so errors are only logged
+func (m *Repository) fireWebhooks(event string, data interface{}) {
+	hooks, err := m.DB.WebhooksForEvent(event)
+	if err != nil {
+		m.App.ErrorLog.Printf("webhooks for %s: %v", event, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	now := m.Pricing.Now()
+
+	payload, err := webhooks.Payload(event, data, now)
+	if err != nil {
+		m.App.ErrorLog.Printf("payload of %s: %v", event, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		_, err := m.DB.InsertWebhookDelivery(models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+		})
+		if err != nil {
+			m.App.ErrorLog.Printf("%s for webhook %d: %v", event, hook.ID, err)
+		}
+	}
+}
+
+// DeliverWebhooks sends the deliveries that are due. One the webhook takes
+// is marked delivered; one it doesn't is tried again after webhooks.Backoff,
+// and marked failed after webhooks.MaxAttempts. It is run in the background
+// every few seconds
+func (m *Repository) DeliverWebhooks(ctx context.Context) error {
+	due, err := m.DB.DueWebhookDeliveries(m.Pricing.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		if err := m.deliverWebhook(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliverWebhook makes one attempt at a delivery and saves how it went
+func (m *Repository) deliverWebhook(ctx context.Context, d models.WebhookDelivery) error {
+	// the signature is checked against the receiver's clock, the schedule
+	// follows ours
+	code, err := m.Webhooks.Send(ctx, d.Webhook.URL, d.Webhook.Secret, d.Event, d.ID, []byte(d.Payload), time.Now())
+	now := m.Pricing.Now()
+
+	d.Attempts++
+	d.ResponseCode = code
+
+	switch {
+	case err == nil:
+		d.Status = models.DeliveryDelivered
+		d.DeliveredAt = now
+		d.LastError = ""
+	case d.Attempts >= webhooks.MaxAttempts:
+		m.App.InfoLog.Printf("webhook delivery %d failed for good: %v", d.ID, err)
+		d.Status = models.DeliveryFailed
+		d.LastError = err.Error()
+	default:
+		d.NextAttemptAt = now.Add(webhooks.Backoff(d.Attempts))
+		d.LastError = err.Error()
+	}
+
+	return m.DB.UpdateWebhookDelivery(d)
+}
+
+// retryWebhookDelivery sends a delivery again on the next run of DeliverWebhooks
+func (m *Repository) retryWebhookDelivery(id int) error {
+	d, err := m.DB.GetWebhookDeliveryByID(id)
+	if err != nil {
+		return err
+	}
+
+	d.Status = models.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = m.Pricing.Now()
+
+	return m.DB.UpdateWebhookDelivery(d)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/webhooks"
+)
+
+// webhookReceiver is a webhook that keeps the events it is sent and answers
+// with status
+type webhookReceiver struct {
+	sync.Mutex
+	server *httptest.Server
+	status int
+	events []webhooks.Envelope
+}
+
+// newWebhookReceiver starts a receiver checking the signatures made with
+// secret, and saves a webhook sending it events
+func newWebhookReceiver(t *testing.T, secret string, events ...string) (*webhookReceiver, models.Webhook) {
+	t.Helper()
+
+	recv := &webhookReceiver{status: http.StatusOK}
+	recv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhooks.Verify(secret, body, r.Header.Get(webhooks.SignatureHeader), time.Now()); err != nil {
+			t.Errorf("the webhook got an event it can't verify: %v", err)
+		}
+
+		var env webhooks.Envelope
+		if err := json.Unmarshal(body, &env); err != nil || env.Event != r.Header.Get(webhooks.EventHeader) {
+			t.Errorf("the webhook got %s as %q", body, r.Header.Get(webhooks.EventHeader))
+		}
+
+		recv.Lock()
+		defer recv.Unlock()
+		recv.events = append(recv.events, env)
+		w.WriteHeader(recv.status)
+	}))
+	t.Cleanup(recv.server.Close)
+
+	hook := models.Webhook{URL: recv.server.URL, Secret: secret, Events: events, Active: true}
+
+	var err error
+	hook.ID, err = testDB.InsertWebhook(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testDB.DeleteWebhook(hook.ID) })
+
+	return recv, hook
+}
+
+// received lists the events the receiver was sent
+func (recv *webhookReceiver) received() []string {
+	recv.Lock()
+	defer recv.Unlock()
+
+	var events []string
+	for _, env := range recv.events {
+		events = append(events, env.Event)
+	}
+	return events
+}
+
+func TestRepository_WebhookReservationEvents(t *testing.T) {
+	recv, hook := newWebhookReceiver(t, "s3cret", models.EventReservationCreated, models.EventReservationModified, models.EventReservationCancelled)
+
+	// a deposit is paid, then the guest cancels
+	res := paidTestReservation(t, "2055-03-01", "2055-03-03", "hooked@example.com")
+
+	req, _ := guestRequest("POST", "/reservations/"+res.ConfirmationCode+"/cancel", res.ConfirmationCode)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostCancelReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostCancelReservation returned %d", rr.Code)
+	}
+
+	queued, _ := testDB.WebhookDeliveries(hook.ID, 0)
+	if len(queued) != 3 {
+		t.Fatalf("the reservation queued %d deliveries, wanted 3", len(queued))
+	}
+
+	if err := Repo.DeliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := recv.received()
+	wanted := []string{models.EventReservationCreated, models.EventReservationModified, models.EventReservationCancelled}
+	if len(got) != len(wanted) {
+		t.Fatalf("the webhook was sent %v, wanted %v", got, wanted)
+	}
+	for i := range wanted {
+		if got[i] != wanted[i] {
+			t.Errorf("event %d was %q, wanted %q", i, got[i], wanted[i])
+		}
+	}
+
+	data, _ := recv.events[2].Data.(map[string]interface{})
+	if data["confirmation_code"] != res.ConfirmationCode || data["status"] != models.ReservationCancelled {
+		t.Errorf("the cancellation was sent %v", data)
+	}
+
+	delivered, _ := testDB.WebhookDeliveries(hook.ID, 0)
+	for _, d := range delivered {
+		if d.Status != models.DeliveryDelivered || d.Attempts != 1 || d.ResponseCode != http.StatusOK || d.DeliveredAt.IsZero() {
+			t.Errorf("delivery %d was saved as %+v", d.ID, d)
+		}
+	}
+
+	// delivered events are not sent again
+	if err := Repo.DeliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(recv.received()) != 3 {
+		t.Errorf("the webhook was sent %v", recv.received())
+	}
+}
+
+func TestRepository_DeliverWebhooksRetry(t *testing.T) {
+	recv, hook := newWebhookReceiver(t, "s3cret", models.EventBlockAdded)
+	recv.status = http.StatusInternalServerError
+
+	now := time.Now().Truncate(time.Second)
+	restore := withNow(now)
+	defer restore()
+
+	Repo.blockEvent(models.EventBlockAdded, models.RoomRestriction{ID: 1, RoomID: 1, StartDate: now, EndDate: now.AddDate(0, 0, 2)})
+	// events nobody subscribed to are not queued
+	Repo.blockEvent(models.EventBlockRemoved, models.RoomRestriction{ID: 1, RoomID: 1, StartDate: now, EndDate: now.AddDate(0, 0, 2)})
+
+	queued, _ := testDB.WebhookDeliveries(hook.ID, 0)
+	if len(queued) != 1 {
+		t.Fatalf("the block queued %d deliveries, wanted 1", len(queued))
+	}
+	id := queued[0].ID
+
+	if err := Repo.DeliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := testDB.GetWebhookDeliveryByID(id)
+	if d.Status != models.DeliveryPending || d.Attempts != 1 || d.ResponseCode != http.StatusInternalServerError || d.LastError == "" || !d.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("a failed attempt saved %+v, wanted it tried again in a minute", d)
+	}
+
+	// it isn't sent again before the backoff is up
+	if err := Repo.DeliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(recv.received()) != 1 {
+		t.Fatalf("the webhook was sent %d events before the backoff was up", len(recv.received()))
+	}
+
+	// the last attempt fails it for good
+	d.Attempts = webhooks.MaxAttempts - 1
+	if err := testDB.UpdateWebhookDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+	Repo.Pricing.Now = func() time.Time { return now.Add(time.Hour) }
+
+	if err := Repo.DeliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ = testDB.GetWebhookDeliveryByID(id)
+	if d.Status != models.DeliveryFailed || d.Attempts != webhooks.MaxAttempts {
+		t.Fatalf("the last attempt saved %+v, wanted it failed", d)
+	}
+
+	// the admin sends it again once the webhook is fixed
+	recv.Lock()
+	recv.status = http.StatusNoContent
+	recv.Unlock()
+
+	req, _ := adminRequest("POST", "/admin/webhooks/deliveries/"+strconv.Itoa(id)+"/retry", strconv.Itoa(id), nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRetryWebhookDelivery).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("AdminRetryWebhookDelivery returned %d", rr.Code)
+	}
+
+	if err := Repo.DeliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ = testDB.GetWebhookDeliveryByID(id)
+	if d.Status != models.DeliveryDelivered || d.Attempts != 1 || d.ResponseCode != http.StatusNoContent || d.LastError != "" {
+		t.Errorf("the retried delivery saved %+v", d)
+	}
+
+	req, _ = adminRequest("POST", "/admin/webhooks/deliveries/100000/retry", "100000", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminRetryWebhookDelivery).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("AdminRetryWebhookDelivery of a missing delivery returned %d", rr.Code)
+	}
+}
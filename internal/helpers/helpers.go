@@ -1,11 +1,13 @@
 package helpers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
 )
 
 var app *config.AppConfig
@@ -23,7 +25,37 @@ func ClientError(w http.ResponseWriter, status int) {
 
 func ServerError(w http.ResponseWriter, err error) {
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Panicln(trace)
+	app.ErrorLog.Println(trace)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// ErrorStatus returns the http status for an error from the repository
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrInvalid):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// RepoError sends the response for an error from the repository: 404, 409 or
+// 400 for the repository errors, and a server error for anything else
+func RepoError(w http.ResponseWriter, err error) {
+	status := ErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		ServerError(w, err)
+		return
+	}
+
+	app.InfoLog.Println(err)
+	ClientError(w, status)
+}
+
+// IsAuthenticated reports if a user is logged in
+func IsAuthenticated(r *http.Request) bool {
+	return app.Session.Exists(r.Context(), "user_id")
+}
@@ -0,0 +1,134 @@
+// Package ical reads and writes calendars in the iCalendar format (RFC 5545)
+// that booking platforms and calendar apps exchange
+package ical
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of calendars
+const ContentType = "text/calendar; charset=utf-8"
+
+// prodID names the program that made a calendar
+const prodID = "-//Bookings//Bookings 1.0//EN"
+
+// maxLine is the longest a line may be, in bytes without the line break
+const maxLine = 75
+
+// Event is a stay or a closure of a room. Events last whole days, from the
+// Start date up to but not including the End date, like the nights of a stay
+type Event struct {
+	// UID stays the same every time the event is written, so importers can
+	// tell a changed event from a new one
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	// Stamp is when the event was last changed
+	Stamp time.Time
+}
+
+// Calendar is a named list of events
+type Calendar struct {
+	Name   string
+	Events []Event
+	// Method is the iTIP method, PUBLISH when it is empty
+	Method string
+}
+
+// Write writes the calendar in the iCalendar format
+func (c Calendar) Write(w io.Writer) error {
+	method := c.Method
+	if method == "" {
+		method = "PUBLISH"
+	}
+
+	var b bytes.Buffer
+	line(&b, "BEGIN:VCALENDAR")
+	line(&b, "VERSION:2.0")
+	line(&b, "PRODID:"+prodID)
+	line(&b, "CALSCALE:GREGORIAN")
+	line(&b, "METHOD:"+method)
+	if c.Name != "" {
+		line(&b, "X-WR-CALNAME:"+Escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line(&b, "BEGIN:VEVENT")
+		line(&b, "UID:"+Escape(e.UID))
+		line(&b, "DTSTAMP:"+e.Stamp.UTC().Format("20060102T150405Z"))
+		line(&b, "DTSTART;VALUE=DATE:"+e.Start.Format("20060102"))
+		line(&b, "DTEND;VALUE=DATE:"+e.End.Format("20060102"))
+		line(&b, "SUMMARY:"+Escape(e.Summary))
+		if e.Description != "" {
+			line(&b, "DESCRIPTION:"+Escape(e.Description))
+		}
+		if e.Location != "" {
+			line(&b, "LOCATION:"+Escape(e.Location))
+		}
+		if e.URL != "" {
+			line(&b, "URL:"+e.URL)
+		}
+		line(&b, "TRANSP:OPAQUE")
+		line(&b, "END:VEVENT")
+	}
+
+	line(&b, "END:VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Bytes returns the calendar in the iCalendar format
+func (c Calendar) Bytes() []byte {
+	var b bytes.Buffer
+	c.Write(&b)
+	return b.Bytes()
+}
+
+// Escape escapes the characters that have a meaning in text values
+func Escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// line writes a content line ended with CRLF, folded so no line is longer
+// than maxLine bytes; a fold never splits a UTF-8 character
+func line(b *bytes.Buffer, s string) {
+	limit := maxLine
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !startsRune(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// the space starting a continuation line counts against it
+		limit = maxLine - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
+
+// startsRune tells whether a byte starts a UTF-8 character
+func startsRune(c byte) bool {
+	return c&0xC0 != 0x80
+}
+
+// GenerateToken makes a token for the URL of a calendar feed
+func GenerateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,78 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCalendar_Write(t *testing.T) {
+	start := time.Date(2050, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cal := Calendar{
+		Name: "General's Quarters",
+		Events: []Event{{
+			UID:         "restriction-7@bookings.example.com",
+			Summary:     "Reserved",
+			Description: "Confirmation code ABC123, see you soon; bring boots\nand a hat",
+			Start:       start,
+			End:         start.AddDate(0, 0, 3),
+			Stamp:       time.Date(2049, time.December, 24, 18, 30, 5, 0, time.FixedZone("CET", 3600)),
+		}},
+	}
+
+	out := string(cal.Bytes())
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"METHOD:PUBLISH\r\n",
+		"X-WR-CALNAME:General's Quarters\r\n",
+		"UID:restriction-7@bookings.example.com\r\n",
+		"DTSTAMP:20491224T173005Z\r\n",
+		"DTSTART;VALUE=DATE:20500301\r\n",
+		"DTEND;VALUE=DATE:20500304\r\n",
+		`DESCRIPTION:Confirmation code ABC123\, see you soon\; bring boots\nand a h`,
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the calendar does not have %q:\n%s", want, out)
+		}
+	}
+
+	if strings.Count(out, "\n") != strings.Count(out, "\r\n") {
+		t.Error("the calendar has lines not ended with CRLF")
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	long := strings.Repeat("żółw ", 40)
+	cal := Calendar{Events: []Event{{UID: "1", Summary: long}}}
+
+	out := string(cal.Bytes())
+	for _, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(l) > maxLine {
+			t.Errorf("line of %d bytes: %q", len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("a fold split a character: %q", l)
+		}
+	}
+
+	// unfolding gives back the line
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, "SUMMARY:"+long+"\r\n") {
+		t.Error("the folded summary does not unfold to the summary")
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	a, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateToken()
+
+	if len(a) != 32 || a == b {
+		t.Errorf("GenerateToken gave %q and %q", a, b)
+	}
+}
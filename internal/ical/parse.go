@@ -0,0 +1,307 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned for input that is not an iCalendar file, like
+// the login page of a platform whose feed URL has expired
+var ErrNotCalendar = errors.New("ical: not a calendar")
+
+// maxContentLine is the longest unfolded line Parse reads
+const maxContentLine = 1 << 20
+
+// property is a content line: NAME;PARAM=value:VALUE
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of a calendar, as whole days like the events it
+// writes. A timed event covers the days from its start up to the day it ends,
+// so a stay checking out at 11:00 does not take that night; an event without
+// an end, or ending the day it starts, takes one day. Cancelled events are
+// left out and recurring events count once. Events without a UID get one
+// made from their dates, and the UID of a changed occurrence of a recurring
+// event gets its RECURRENCE-ID, so every event has its own
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	var events []Event
+	var components []string
+	var props []property
+
+	for _, l := range lines {
+		p, ok := parseLine(l)
+		if !ok {
+			continue
+		}
+
+		switch p.name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(p.value))
+			if strings.EqualFold(p.value, "VEVENT") {
+				props = nil
+			}
+			continue
+		case "END":
+			if len(components) == 0 {
+				continue
+			}
+			if components[len(components)-1] == "VEVENT" {
+				e, keep, err := toEvent(props)
+				if err != nil {
+					return nil, err
+				}
+				if keep {
+					events = append(events, e)
+				}
+			}
+			components = components[:len(components)-1]
+			continue
+		}
+
+		// properties of an alarm inside the event are not the event's
+		if len(components) > 0 && components[len(components)-1] == "VEVENT" {
+			props = append(props, p)
+		}
+	}
+
+	return events, nil
+}
+
+// unfold reads the content lines, joining the continuation lines folded off them
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxContentLine)
+
+	var lines []string
+	for scanner.Scan() {
+		l := strings.TrimRight(scanner.Text(), "\r")
+		if l == "" {
+			continue
+		}
+		if (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ical: %w", err)
+	}
+
+	// a byte order mark would hide the first line
+	if len(lines) > 0 {
+		lines[0] = strings.TrimPrefix(lines[0], "\ufeff")
+	}
+
+	return lines, nil
+}
+
+// parseLine splits a content line into its name, parameters and value. The
+// value starts at the first colon that is not inside a quoted parameter
+func parseLine(l string) (property, bool) {
+	quoted := false
+	colon := -1
+	for i := 0; i < len(l) && colon < 0; i++ {
+		switch l[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return property{}, false
+	}
+
+	p := property{params: make(map[string]string), value: l[colon+1:]}
+
+	parts := strings.Split(l[:colon], ";")
+	p.name = strings.ToUpper(strings.TrimSpace(parts[0]))
+	for _, param := range parts[1:] {
+		k, v, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return p, p.name != ""
+}
+
+// toEvent makes an event of the properties of a VEVENT, keep is false for
+// events that are left out
+func toEvent(props []property) (e Event, keep bool, err error) {
+	var uid, recurrence string
+	var start, end property
+	var duration string
+
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			uid = Unescape(p.value)
+		case "RECURRENCE-ID":
+			recurrence = p.value
+		case "DTSTART":
+			start = p
+		case "DTEND":
+			end = p
+		case "DURATION":
+			duration = p.value
+		case "SUMMARY":
+			e.Summary = Unescape(p.value)
+		case "DESCRIPTION":
+			e.Description = Unescape(p.value)
+		case "LOCATION":
+			e.Location = Unescape(p.value)
+		case "URL":
+			e.URL = p.value
+		case "DTSTAMP":
+			if e.Stamp.IsZero() {
+				e.Stamp, _ = parseTime(p)
+			}
+		case "LAST-MODIFIED":
+			e.Stamp, _ = parseTime(p)
+		case "STATUS":
+			if strings.EqualFold(p.value, "CANCELLED") {
+				return e, false, nil
+			}
+		}
+	}
+
+	if start.name == "" {
+		return e, false, fmt.Errorf("ical: event %q has no start", uid)
+	}
+
+	startTime, err := parseTime(start)
+	if err != nil {
+		return e, false, fmt.Errorf("ical: start of event %q: %w", uid, err)
+	}
+	e.Start = day(startTime)
+
+	switch {
+	case end.name != "":
+		endTime, err := parseTime(end)
+		if err != nil {
+			return e, false, fmt.Errorf("ical: end of event %q: %w", uid, err)
+		}
+		e.End = day(endTime)
+	case duration != "":
+		if endTime, ok := addDuration(startTime, duration); ok {
+			e.End = day(endTime)
+		}
+	}
+	if !e.End.After(e.Start) {
+		e.End = e.Start.AddDate(0, 0, 1)
+	}
+
+	if uid == "" {
+		uid = e.Start.Format("20060102") + "-" + e.End.Format("20060102")
+	}
+	if recurrence != "" {
+		uid += "#" + recurrence
+	}
+	e.UID = uid
+
+	return e, true, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value, a date-time in the time zone
+// its TZID names or in UTC
+func parseTime(p property) (time.Time, error) {
+	v := strings.TrimSpace(p.value)
+
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(v) == len("20060102") {
+		return time.Parse("20060102", v)
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		return time.Parse("20060102T150405Z", v)
+	}
+
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+
+	return time.ParseInLocation("20060102T150405", v, loc)
+}
+
+// addDuration adds a DURATION, like P3D, P1W or PT2H30M, to t
+func addDuration(t time.Time, s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.ToUpper(s), "+")
+	if !strings.HasPrefix(s, "P") {
+		return t, false
+	}
+
+	n := 0
+	for _, c := range s[1:] {
+		switch c {
+		case 'W':
+			t = t.AddDate(0, 0, 7*n)
+		case 'D':
+			t = t.AddDate(0, 0, n)
+		case 'H':
+			t = t.Add(time.Duration(n) * time.Hour)
+		case 'M':
+			t = t.Add(time.Duration(n) * time.Minute)
+		case 'S':
+			t = t.Add(time.Duration(n) * time.Second)
+		case 'T':
+		default:
+			if c < '0' || c > '9' {
+				return t, false
+			}
+			n = n*10 + int(c-'0')
+			continue
+		}
+		n = 0
+	}
+
+	return t, true
+}
+
+// day is the date of t, at midnight UTC like the dates of stays
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Unescape reverses Escape
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Airbnb Inc//Hosting Calendar 1.0//EN",
+		"BEGIN:VEVENT",
+		"DTSTAMP:20500101T120000Z",
+		"DTSTART;VALUE=DATE:20500302",
+		"DTEND;VALUE=DATE:20500305",
+		"SUMMARY:Reserved",
+		"UID:1418fb94e984-7e1a1d4d0a8a0c0a4c1e2c6f8b2ad1ba@air",
+		" bnb.com",
+		"DESCRIPTION:Reservation URL: https://www.airbnb.com/hosting/reservations/\\n",
+		" Phone: 1234\\, ext. 5",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"DESCRIPTION:Not the event's",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:timed@example.com",
+		"DTSTART;TZID=Europe/Warsaw:20500310T150000",
+		"DTEND;TZID=\"Europe/Warsaw\":20500312T110000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled@example.com",
+		"STATUS:CANCELLED",
+		"DTSTART;VALUE=DATE:20500315",
+		"DTEND;VALUE=DATE:20500316",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:duration@example.com",
+		"DTSTART:20500320T220000Z",
+		"DURATION:P1DT3H",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20500325",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"RECURRENCE-ID;VALUE=DATE:20500401",
+		"DTSTART;VALUE=DATE:20500402",
+		"DTEND;VALUE=DATE:20500403",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := Parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2050, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	wanted := []Event{
+		{UID: "1418fb94e984-7e1a1d4d0a8a0c0a4c1e2c6f8b2ad1ba@airbnb.com", Start: date(time.March, 2), End: date(time.March, 5)},
+		{UID: "timed@example.com", Start: date(time.March, 10), End: date(time.March, 12)},
+		{UID: "duration@example.com", Start: date(time.March, 20), End: date(time.March, 22)},
+		{UID: "20500325-20500326", Start: date(time.March, 25), End: date(time.March, 26)},
+		{UID: "weekly@example.com#20500401", Start: date(time.April, 2), End: date(time.April, 3)},
+	}
+
+	if len(events) != len(wanted) {
+		t.Fatalf("got %d events, wanted %d: %+v", len(events), len(wanted), events)
+	}
+	for i, w := range wanted {
+		e := events[i]
+		if e.UID != w.UID || !e.Start.Equal(w.Start) || !e.End.Equal(w.End) {
+			t.Errorf("event %d is %s from %s to %s, wanted %s from %s to %s", i,
+				e.UID, e.Start.Format("2006-01-02"), e.End.Format("2006-01-02"),
+				w.UID, w.Start.Format("2006-01-02"), w.End.Format("2006-01-02"))
+		}
+	}
+
+	first := events[0]
+	if first.Summary != "Reserved" || first.Description != "Reservation URL: https://www.airbnb.com/hosting/reservations/\nPhone: 1234, ext. 5" {
+		t.Errorf("got summary %q and description %q", first.Summary, first.Description)
+	}
+	if !first.Stamp.Equal(time.Date(2050, time.January, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("got stamp %s", first.Stamp)
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	start := time.Date(2050, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cal := Calendar{Events: []Event{{
+		UID:     "restriction-7@example.com",
+		Summary: "Blocked; for painting, again",
+		Start:   start,
+		End:     start.AddDate(0, 0, 4),
+		Stamp:   start,
+	}}}
+
+	events, err := Parse(strings.NewReader(string(cal.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("got %+v", events)
+	}
+	e := events[0]
+	if e.UID != "restriction-7@example.com" || e.Summary != "Blocked; for painting, again" || !e.Start.Equal(start) || !e.End.Equal(start.AddDate(0, 0, 4)) {
+		t.Errorf("got %+v back", e)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := Parse(strings.NewReader("<!DOCTYPE html><html>Log in</html>")); !errors.Is(err, ErrNotCalendar) {
+		t.Errorf("got error %v for a web page, wanted ErrNotCalendar", err)
+	}
+	if _, err := Parse(strings.NewReader("")); !errors.Is(err, ErrNotCalendar) {
+		t.Errorf("got error %v for nothing, wanted ErrNotCalendar", err)
+	}
+
+	bad := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:x\nDTSTART:yesterday\nEND:VEVENT\nEND:VCALENDAR\n"
+	if _, err := Parse(strings.NewReader(bad)); err == nil {
+		t.Error("got no error for a start that is not a date")
+	}
+
+	// a byte order mark and bare line feeds are fine
+	events, err := Parse(strings.NewReader("\ufeffBEGIN:VCALENDAR\nEND:VCALENDAR\n"))
+	if err != nil || len(events) != 0 {
+		t.Errorf("got %+v, %v for an empty calendar", events, err)
+	}
+}
@@ -0,0 +1,162 @@
+// Package invoices renders the invoice of a reservation as a PDF, with the
+// line items and taxes of its price quote
+package invoices
+
+import (
+	"io"
+	"strings"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ContentType is the media type of rendered invoices
+const ContentType = "application/pdf"
+
+// page layout, in millimetres
+const (
+	margin     = 20
+	width      = 170
+	lineHeight = 6
+	amountCol  = 40
+)
+
+// Filename is the name an invoice is downloaded and attached as
+func Filename(inv models.Invoice) string {
+	return inv.Code() + ".pdf"
+}
+
+// Render writes the invoice of a reservation as a PDF
+func Render(w io.Writer, inv models.Invoice, res models.Reservation) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetTitle("Invoice "+inv.Code(), false)
+	pdf.SetAuthor(inv.Seller.Name, true)
+	pdf.SetCreationDate(inv.IssuedAt)
+	pdf.SetModificationDate(inv.IssuedAt)
+
+	// the core fonts are not Unicode, names are written in cp1252
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.AddPage()
+
+	// the seller and the invoice number side by side
+	top := pdf.GetY()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(width/2, 8, tr(inv.Seller.Name), "", 2, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range sellerLines(inv.Seller) {
+		pdf.CellFormat(width/2, 5, tr(line), "", 2, "L", false, 0, "")
+	}
+	bottom := pdf.GetY()
+
+	pdf.SetXY(margin+width/2, top)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(width/2, 8, "INVOICE", "", 2, "R", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(width/2, 5, "Number: "+inv.Code(), "", 2, "R", false, 0, "")
+	pdf.CellFormat(width/2, 5, "Date: "+inv.IssuedAt.Format("2006-01-02"), "", 2, "R", false, 0, "")
+	if res.ConfirmationCode != "" {
+		pdf.CellFormat(width/2, 5, "Reservation: "+res.ConfirmationCode, "", 2, "R", false, 0, "")
+	}
+	if pdf.GetY() > bottom {
+		bottom = pdf.GetY()
+	}
+
+	// the guest
+	pdf.SetXY(margin, bottom+10)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(width, 5, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(width, 5, tr(res.FirstName+" "+res.LastName), "", 1, "L", false, 0, "")
+	pdf.CellFormat(width, 5, tr(res.Email), "", 1, "L", false, 0, "")
+	pdf.CellFormat(width, 5, tr("Stay: "+res.Room.RoomName+", "+res.StartDate.Format("2006-01-02")+" to "+res.EndDate.Format("2006-01-02")), "", 1, "L", false, 0, "")
+	pdf.Ln(8)
+
+	// the line items
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	pdf.CellFormat(width-amountCol, lineHeight+1, "Description", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(amountCol, lineHeight+1, "Amount", "B", 1, "R", true, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, item := range Lines(res.Quote, res.Room.RoomName) {
+		pdf.CellFormat(width-amountCol, lineHeight, tr(item.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(amountCol, lineHeight, pricing.FormatMoney(item.Amount), "", 1, "R", false, 0, "")
+	}
+
+	// the totals
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(width-amountCol, lineHeight+2, "Total", "T", 0, "L", false, 0, "")
+	pdf.CellFormat(amountCol, lineHeight+2, pricing.FormatMoney(res.Quote.Total), "T", 1, "R", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	if res.Quote.TaxTotal != 0 {
+		pdf.CellFormat(width-amountCol, lineHeight, "Of which taxes", "", 0, "L", false, 0, "")
+		pdf.CellFormat(amountCol, lineHeight, pricing.FormatMoney(res.Quote.TaxTotal), "", 1, "R", false, 0, "")
+	}
+
+	pdf.Ln(10)
+	pdf.SetFont("Helvetica", "I", 9)
+	pdf.MultiCell(width, 5, tr("Amounts are in "+strings.ToUpper(pricing.Currency)+". Thank you for staying with "+inv.Seller.Name+"."), "", "L", false)
+
+	return pdf.Output(w)
+}
+
+// Line is one line item of an invoice, in cents
+type Line struct {
+	Description string
+	Amount      int
+}
+
+// Lines itemizes a quote the way invoices print it: every night, then the
+// discount, then the fees and taxes
+func Lines(quote models.Quote, roomName string) []Line {
+	var lines []Line
+
+	for _, night := range quote.Nights {
+		lines = append(lines, Line{
+			Description: roomName + ", night of " + night.Date.Format("2006-01-02"),
+			Amount:      night.Amount,
+		})
+	}
+
+	if quote.Discount != 0 {
+		lines = append(lines, Line{Description: "Promo code " + quote.PromoCode, Amount: -quote.Discount})
+	}
+
+	for _, fee := range quote.Fees {
+		description := fee.Name
+		if fee.Tax {
+			description += " (tax)"
+		}
+		lines = append(lines, Line{Description: description, Amount: fee.Amount})
+	}
+
+	return lines
+}
+
+// sellerLines are the details printed under the seller's name
+func sellerLines(c models.Company) []string {
+	var lines []string
+
+	for _, line := range strings.Split(c.Address, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if c.TaxID != "" {
+		lines = append(lines, "Tax ID: "+c.TaxID)
+	}
+
+	if c.Email != "" {
+		lines = append(lines, c.Email)
+	}
+
+	return lines
+}
@@ -0,0 +1,99 @@
+package invoices
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+func date(day int) time.Time {
+	return time.Date(2050, time.January, day, 0, 0, 0, 0, time.UTC)
+}
+
+func testQuote() models.Quote {
+	return models.Quote{
+		Nights: []models.NightPrice{
+			{Date: date(1), Amount: 10000},
+			{Date: date(2), Amount: 12000},
+		},
+		Subtotal:  22000,
+		PromoCode: "SPRING",
+		Discount:  2000,
+		Fees: []models.Fee{
+			{Name: "Cleaning", Amount: 3000},
+			{Name: "City tax", Tax: true, Amount: 400},
+		},
+		FeesTotal: 3000,
+		TaxTotal:  400,
+		Total:     23400,
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines(testQuote(), "General's Quarters")
+
+	var tests = []struct {
+		description string
+		amount      int
+	}{
+		{"General's Quarters, night of 2050-01-01", 10000},
+		{"General's Quarters, night of 2050-01-02", 12000},
+		{"Promo code SPRING", -2000},
+		{"Cleaning", 3000},
+		{"City tax (tax)", 400},
+	}
+
+	if len(lines) != len(tests) {
+		t.Fatalf("got %d lines, wanted %d: %+v", len(lines), len(tests), lines)
+	}
+
+	sum := 0
+	for i, e := range tests {
+		if lines[i].Description != e.description || lines[i].Amount != e.amount {
+			t.Errorf("line %d: got %+v, wanted %q for %d", i, lines[i], e.description, e.amount)
+		}
+		sum += lines[i].Amount
+	}
+
+	if sum != testQuote().Total {
+		t.Errorf("the lines add up to %d, the total is %d", sum, testQuote().Total)
+	}
+}
+
+func TestRender(t *testing.T) {
+	inv := models.Invoice{
+		Number:   42,
+		Seller:   models.Company{Name: "Fort Smythe Bed & Breakfast", Address: "1 Main St\nNorthbrook", TaxID: "PL1234567890", Email: "me@here.com"},
+		IssuedAt: date(3),
+	}
+	res := models.Reservation{
+		FirstName:        "Zoë",
+		LastName:         "Smith",
+		Email:            "zoe@example.com",
+		ConfirmationCode: "ABCD1234",
+		StartDate:        date(1),
+		EndDate:          date(3),
+		Room:             models.Room{RoomName: "General's Quarters"},
+		Quote:            testQuote(),
+	}
+
+	var buf bytes.Buffer
+	err := Render(&buf, inv, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "%PDF-") {
+		t.Errorf("the invoice is not a PDF: %q", buf.String()[:16])
+	}
+	if !strings.Contains(buf.String(), "Invoice INV-000042") {
+		t.Error("the PDF is not titled with the invoice number")
+	}
+
+	if Filename(inv) != "INV-000042.pdf" {
+		t.Errorf("got filename %q", Filename(inv))
+	}
+}
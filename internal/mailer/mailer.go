@@ -0,0 +1,98 @@
+// Package mailer builds email messages and sends them over SMTP
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// Send sends a message through the SMTP server at addr, e.g. "localhost:1025"
+func Send(addr string, msg models.MailData) error {
+	data, err := Build(msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(addr, nil, msg.From, []string{msg.To}, data)
+}
+
+// Build writes a message in MIME format: the content as html, followed by
+// any attachments
+func Build(msg models.MailData) ([]byte, error) {
+	if msg.To == "" || msg.From == "" {
+		return nil, errors.New("a message needs a sender and a recipient")
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	body, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(body, []byte(msg.Content)); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		// the content type may carry parameters of its own, like a charset
+		contentType, params, err := mime.ParseMediaType(a.ContentType)
+		if err != nil {
+			contentType, params = "application/octet-stream", map[string]string{}
+		}
+		params["name"] = a.Name
+
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, params)},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, a.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters, as MIME wants
+func writeBase64(w interface{ Write([]byte) (int, error) }, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var lines []string
+	for len(encoded) > 76 {
+		lines = append(lines, encoded[:76])
+		encoded = encoded[76:]
+	}
+	lines = append(lines, encoded)
+
+	_, err := w.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	return err
+}
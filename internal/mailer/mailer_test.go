@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+func TestBuild(t *testing.T) {
+	msg := models.MailData{
+		To:      "guest@example.com",
+		From:    "bookings@example.com",
+		Subject: "Réservation confirmed",
+		Content: "<p>" + strings.Repeat("See you soon! ", 20) + "</p>",
+		Attachments: []models.Attachment{
+			{Name: "invoice.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4 test")},
+			{Name: "stay.ics", ContentType: "text/calendar; charset=utf-8", Data: []byte("BEGIN:VCALENDAR")},
+		},
+	}
+
+	data, err := Build(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if m.Header.Get("To") != msg.To || m.Header.Get("From") != msg.From || subject != msg.Subject {
+		t.Errorf("got headers %v", m.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("got content type %q", m.Header.Get("Content-Type"))
+	}
+
+	r := multipart.NewReader(m.Body, params["boundary"])
+
+	var parts []*multipart.Part
+	var bodies [][]byte
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, _ := io.ReadAll(p)
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts = append(parts, p)
+		bodies = append(bodies, decoded)
+	}
+
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, wanted 3", len(parts))
+	}
+	if string(bodies[0]) != msg.Content {
+		t.Errorf("got content %q", bodies[0])
+	}
+	if parts[1].FileName() != "invoice.pdf" || string(bodies[1]) != "%PDF-1.4 test" {
+		t.Errorf("got attachment %q with %q", parts[1].FileName(), bodies[1])
+	}
+
+	// the charset of the calendar is kept with the name
+	if ct := parts[2].Header.Get("Content-Type"); ct != `text/calendar; charset=utf-8; name=stay.ics` {
+		t.Errorf("got content type %q for the calendar", ct)
+	}
+
+	if _, err := Build(models.MailData{From: "bookings@example.com"}); err == nil {
+		t.Error("got no error for a message without a recipient")
+	}
+}
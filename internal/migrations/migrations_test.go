@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/driver"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("no embedded postgres migrations found")
+	}
+
+	for i, m := range migrations {
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("migration %04d_%s is missing its up or down sql", m.Version, m.Name)
+		}
+
+		if i > 0 && migrations[i-1].Version >= m.Version {
+			t.Errorf("migrations are not ordered: %d before %d", migrations[i-1].Version, m.Version)
+		}
+	}
+
+	_, err = Load("oracle")
+	if err == nil {
+		t.Error("loaded migrations for a dialect that does not exist")
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	db, err := driver.ConnectSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	m, err := New(db.SQL, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(m.Migrations) {
+		t.Errorf("applied %d migrations, wanted %d", len(done), len(m.Migrations))
+	}
+
+	var rooms int
+	err = db.SQL.QueryRow("select count(id) from rooms").Scan(&rooms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rooms != 2 {
+		t.Errorf("got %d seeded rooms, wanted 2", rooms)
+	}
+
+	// running up again is a no-op
+	done, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 0 {
+		t.Errorf("applied %d migrations on an up to date database", len(done))
+	}
+
+	done, err = m.Down(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Errorf("reverted %d migrations, wanted 2", len(done))
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range statuses {
+		wantApplied := i < len(statuses)-2
+		if s.Applied != wantApplied {
+			t.Errorf("migration %04d_%s applied = %t, wanted %t", s.Version, s.Name, s.Applied, wantApplied)
+		}
+	}
+}
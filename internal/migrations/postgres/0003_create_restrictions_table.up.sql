@@ -0,0 +1,6 @@
+create table if not exists restrictions (
+    id serial primary key,
+    restriction_name varchar(255) not null default '',
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
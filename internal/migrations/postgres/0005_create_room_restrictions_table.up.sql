@@ -0,0 +1,20 @@
+create table if not exists room_restrictions (
+    id serial primary key,
+    start_date date not null,
+    end_date date not null,
+    room_id integer not null
+        constraint room_restrictions_rooms_id_fk references rooms (id)
+        on update cascade on delete cascade,
+    reservation_id integer
+        constraint room_restrictions_reservation_id_fk references reservation (id)
+        on update cascade on delete cascade,
+    restriction_id integer not null
+        constraint room_restrictions_restrictions_id_fk references restrictions (id)
+        on update cascade on delete cascade,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+create index if not exists room_restrictions_start_date_end_date_idx on room_restrictions (start_date, end_date);
+create index if not exists room_restrictions_room_id_idx on room_restrictions (room_id);
+create index if not exists room_restrictions_reservation_id_idx on room_restrictions (reservation_id);
@@ -0,0 +1,9 @@
+insert into rooms (id, room_name, created_at, updated_at)
+select 1, 'General''s Quarters', now(), now()
+where not exists (select 1 from rooms where id = 1);
+
+insert into rooms (id, room_name, created_at, updated_at)
+select 2, 'Major''s Suite', now(), now()
+where not exists (select 1 from rooms where id = 2);
+
+select setval(pg_get_serial_sequence('rooms', 'id'), (select max(id) from rooms));
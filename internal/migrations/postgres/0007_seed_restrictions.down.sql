@@ -0,0 +1 @@
+delete from restrictions where id in (1, 2);
@@ -0,0 +1,9 @@
+insert into restrictions (id, restriction_name, created_at, updated_at)
+select 1, 'Reservation', now(), now()
+where not exists (select 1 from restrictions where id = 1);
+
+insert into restrictions (id, restriction_name, created_at, updated_at)
+select 2, 'Owner Block', now(), now()
+where not exists (select 1 from restrictions where id = 2);
+
+select setval(pg_get_serial_sequence('restrictions', 'id'), (select max(id) from restrictions));
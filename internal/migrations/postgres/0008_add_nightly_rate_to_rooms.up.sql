@@ -0,0 +1,4 @@
+alter table rooms add column nightly_rate integer not null default 0;
+
+update rooms set nightly_rate = 9900 where id = 1;
+update rooms set nightly_rate = 12900 where id = 2;
@@ -0,0 +1,3 @@
+alter table reservation drop column price_quote;
+alter table reservation drop column total;
+alter table reservation drop column subtotal;
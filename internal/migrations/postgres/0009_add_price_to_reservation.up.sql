@@ -0,0 +1,3 @@
+alter table reservation add column subtotal integer not null default 0;
+alter table reservation add column total integer not null default 0;
+alter table reservation add column price_quote text not null default '';
@@ -0,0 +1,18 @@
+create table if not exists rate_plans (
+    id serial primary key,
+    name varchar(255) not null,
+    room_id integer
+        constraint rate_plans_rooms_id_fk references rooms (id)
+        on update cascade on delete cascade,
+    start_date date not null,
+    end_date date not null,
+    nightly_rate integer not null default 0,
+    weekday_modifiers varchar(255) not null default '0,0,0,0,0,0,0',
+    priority integer not null default 0,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint rate_plans_dates_check check (end_date >= start_date)
+);
+
+create index if not exists rate_plans_start_date_end_date_idx on rate_plans (start_date, end_date);
+create index if not exists rate_plans_room_id_idx on rate_plans (room_id);
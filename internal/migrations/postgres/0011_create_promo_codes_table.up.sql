@@ -0,0 +1,19 @@
+create table if not exists promo_codes (
+    id serial primary key,
+    code varchar(32) not null,
+    kind varchar(16) not null,
+    amount integer not null,
+    valid_from date not null,
+    valid_to date not null,
+    max_uses integer not null default 0,
+    uses integer not null default 0,
+    min_nights integer not null default 0,
+    room_ids varchar(255) not null default '',
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint promo_codes_kind_check check (kind in ('percent', 'fixed')),
+    constraint promo_codes_dates_check check (valid_to >= valid_from),
+    constraint promo_codes_uses_check check (max_uses = 0 or uses <= max_uses)
+);
+
+create unique index if not exists promo_codes_code_idx on promo_codes (code);
@@ -0,0 +1,2 @@
+alter table reservation drop column discount;
+alter table reservation drop column promo_code;
@@ -0,0 +1,2 @@
+alter table reservation add column promo_code varchar(32) not null default '';
+alter table reservation add column discount integer not null default 0;
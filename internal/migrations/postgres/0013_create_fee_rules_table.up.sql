@@ -0,0 +1,16 @@
+create table if not exists fee_rules (
+    id serial primary key,
+    name varchar(255) not null,
+    kind varchar(16) not null,
+    amount integer not null,
+    tax boolean not null default false,
+    room_id integer
+        constraint fee_rules_rooms_id_fk references rooms (id)
+        on update cascade on delete cascade,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint fee_rules_kind_check check (kind in ('per_stay', 'per_night', 'per_guest', 'percent')),
+    constraint fee_rules_amount_check check (amount >= 0)
+);
+
+create index if not exists fee_rules_room_id_idx on fee_rules (room_id);
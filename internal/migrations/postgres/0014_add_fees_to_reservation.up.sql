@@ -0,0 +1,2 @@
+alter table reservation add column fees integer not null default 0;
+alter table reservation add column taxes integer not null default 0;
@@ -0,0 +1,4 @@
+drop index if exists reservation_payment_intent_id_idx;
+
+alter table reservation drop column payment_intent_id;
+alter table reservation drop column status;
@@ -0,0 +1,3 @@
+alter table rooms drop column cancellation_policy_id;
+
+drop table if exists cancellation_policies;
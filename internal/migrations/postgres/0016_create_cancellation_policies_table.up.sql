@@ -0,0 +1,36 @@
+create table if not exists cancellation_policies (
+    id serial primary key,
+    name varchar(255) not null,
+    deposit_percent integer not null,
+    balance_days integer not null,
+    full_refund_days integer not null,
+    partial_refund_days integer not null,
+    partial_refund_percent integer not null,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint cancellation_policies_percent_check
+        check (deposit_percent between 0 and 100 and partial_refund_percent between 0 and 100),
+    constraint cancellation_policies_days_check
+        check (balance_days >= 0 and partial_refund_days >= 0 and full_refund_days >= partial_refund_days)
+);
+
+insert into cancellation_policies (id, name, deposit_percent, balance_days, full_refund_days,
+    partial_refund_days, partial_refund_percent)
+select 1, 'Flexible', 20, 3, 1, 0, 0
+where not exists (select 1 from cancellation_policies where id = 1);
+
+insert into cancellation_policies (id, name, deposit_percent, balance_days, full_refund_days,
+    partial_refund_days, partial_refund_percent)
+select 2, 'Moderate', 30, 14, 5, 1, 50
+where not exists (select 1 from cancellation_policies where id = 2);
+
+insert into cancellation_policies (id, name, deposit_percent, balance_days, full_refund_days,
+    partial_refund_days, partial_refund_percent)
+select 3, 'Strict', 50, 30, 14, 7, 50
+where not exists (select 1 from cancellation_policies where id = 3);
+
+select setval(pg_get_serial_sequence('cancellation_policies', 'id'), (select max(id) from cancellation_policies));
+
+alter table rooms add column cancellation_policy_id integer not null default 2
+    constraint rooms_cancellation_policies_id_fk references cancellation_policies (id)
+    on update cascade on delete restrict;
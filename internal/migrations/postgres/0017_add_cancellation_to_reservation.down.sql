@@ -0,0 +1,13 @@
+drop index if exists reservation_balance_intent_id_idx;
+drop index if exists reservation_confirmation_code_idx;
+
+alter table reservation drop column balance_intent_id;
+alter table reservation drop column balance_due_date;
+alter table reservation drop column deposit;
+alter table reservation drop column cancellation_policy;
+alter table reservation drop column confirmation_code;
+
+delete from reservation where status = 'cancelled';
+alter table reservation drop constraint reservation_status_check;
+alter table reservation add constraint reservation_status_check
+    check (status in ('pending_payment', 'confirmed'));
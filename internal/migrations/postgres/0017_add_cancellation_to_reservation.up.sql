@@ -0,0 +1,16 @@
+alter table reservation drop constraint reservation_status_check;
+alter table reservation add constraint reservation_status_check
+    check (status in ('pending_payment', 'confirmed', 'cancelled'));
+
+alter table reservation add column confirmation_code varchar(16) not null default '';
+alter table reservation add column cancellation_policy text not null default '';
+alter table reservation add column deposit integer not null default 0;
+alter table reservation add column balance_due_date date not null default '1970-01-01';
+alter table reservation add column balance_intent_id varchar(255) not null default '';
+
+-- reservations made before deposits were paid in full at booking
+update reservation set deposit = total, balance_due_date = start_date;
+
+create unique index if not exists reservation_confirmation_code_idx on reservation (confirmation_code)
+    where confirmation_code <> '';
+create index if not exists reservation_balance_intent_id_idx on reservation (balance_intent_id);
@@ -0,0 +1,16 @@
+create table if not exists payments (
+    id serial primary key,
+    reservation_id integer not null
+        constraint payments_reservation_id_fk references reservation (id)
+        on update cascade on delete cascade,
+    kind varchar(16) not null,
+    amount integer not null,
+    intent_id varchar(255) not null default '',
+    reference varchar(255) not null,
+    created_at timestamp not null default now(),
+    constraint payments_kind_check check (kind in ('deposit', 'balance', 'refund', 'failed')),
+    constraint payments_amount_check check (amount >= 0)
+);
+
+create index if not exists payments_reservation_id_idx on payments (reservation_id);
+create unique index if not exists payments_kind_reference_idx on payments (kind, reference);
@@ -0,0 +1,15 @@
+create table if not exists invoices (
+    id serial primary key,
+    number integer not null,
+    reservation_id integer not null
+        constraint invoices_reservation_id_fk references reservation (id)
+        on update cascade on delete restrict,
+    seller text not null default '{}',
+    issued_at timestamp not null,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint invoices_number_check check (number > 0)
+);
+
+create unique index if not exists invoices_number_idx on invoices (number);
+create unique index if not exists invoices_reservation_id_idx on invoices (reservation_id);
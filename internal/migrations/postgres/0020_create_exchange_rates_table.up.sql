@@ -0,0 +1,11 @@
+create table if not exists exchange_rates (
+    id serial primary key,
+    code varchar(3) not null,
+    symbol varchar(8) not null default '',
+    rate integer not null,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint exchange_rates_rate_check check (rate > 0)
+);
+
+create unique index if not exists exchange_rates_code_idx on exchange_rates (code);
@@ -0,0 +1,22 @@
+create table if not exists stay_rules (
+    id serial primary key,
+    name varchar(255) not null,
+    room_id integer
+        constraint stay_rules_rooms_id_fk references rooms (id)
+        on update cascade on delete cascade,
+    start_date date not null,
+    end_date date not null,
+    min_nights integer not null default 0,
+    max_nights integer not null default 0,
+    closed_to_arrival varchar(32) not null default '',
+    closed_to_departure varchar(32) not null default '',
+    min_lead_days integer not null default 0,
+    max_lead_days integer not null default 0,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint stay_rules_dates_check check (end_date >= start_date),
+    constraint stay_rules_nights_check check (min_nights >= 0 and max_nights >= 0),
+    constraint stay_rules_lead_days_check check (min_lead_days >= 0 and max_lead_days >= 0)
+);
+
+create index if not exists stay_rules_room_id_idx on stay_rules (room_id);
@@ -0,0 +1,14 @@
+create table if not exists api_keys (
+    id serial primary key,
+    name varchar(255) not null,
+    prefix varchar(16) not null,
+    key_hash varchar(64) not null,
+    scopes varchar(255) not null default '',
+    rate_limit integer not null default 60,
+    expires_on date not null,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint api_keys_rate_limit_check check (rate_limit > 0)
+);
+
+create unique index if not exists api_keys_prefix_idx on api_keys (prefix);
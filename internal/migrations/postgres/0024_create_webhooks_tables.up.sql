@@ -0,0 +1,31 @@
+create table if not exists webhooks (
+    id serial primary key,
+    url varchar(2048) not null,
+    secret varchar(64) not null,
+    events varchar(255) not null default '',
+    active boolean not null default true,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+create table if not exists webhook_deliveries (
+    id serial primary key,
+    webhook_id integer not null
+        constraint webhook_deliveries_webhook_id_fk references webhooks (id)
+        on update cascade on delete cascade,
+    event varchar(64) not null,
+    payload text not null,
+    status varchar(16) not null default 'pending',
+    attempts integer not null default 0,
+    response_code integer not null default 0,
+    last_error varchar(1024) not null default '',
+    next_attempt_at timestamp not null,
+    delivered_at timestamp,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    constraint webhook_deliveries_status_check check (status in ('pending', 'delivered', 'failed')),
+    constraint webhook_deliveries_attempts_check check (attempts >= 0)
+);
+
+create index if not exists webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id);
+create index if not exists webhook_deliveries_status_next_attempt_at_idx on webhook_deliveries (status, next_attempt_at);
@@ -0,0 +1,11 @@
+drop index if exists room_restrictions_ical_feed_id_external_uid_idx;
+
+delete from room_restrictions where ical_feed_id is not null;
+
+alter table room_restrictions drop column external_uid;
+alter table room_restrictions drop column ical_feed_id;
+
+drop table if exists ical_feeds;
+
+delete from room_restrictions where restriction_id = 3;
+delete from restrictions where id = 3;
@@ -0,0 +1,28 @@
+insert into restrictions (id, restriction_name, created_at, updated_at)
+select 3, 'External', now(), now()
+where not exists (select 1 from restrictions where id = 3);
+
+select setval(pg_get_serial_sequence('restrictions', 'id'), (select max(id) from restrictions));
+
+create table if not exists ical_feeds (
+    id serial primary key,
+    room_id integer not null
+        constraint ical_feeds_rooms_id_fk references rooms (id)
+        on update cascade on delete cascade,
+    name varchar(255) not null default '',
+    url varchar(2048) not null,
+    last_synced_at timestamp,
+    last_error varchar(1024) not null default '',
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+create index if not exists ical_feeds_room_id_idx on ical_feeds (room_id);
+
+alter table room_restrictions add column ical_feed_id integer
+    constraint room_restrictions_ical_feeds_id_fk references ical_feeds (id)
+    on update cascade on delete cascade;
+alter table room_restrictions add column external_uid varchar(255) not null default '';
+
+create unique index if not exists room_restrictions_ical_feed_id_external_uid_idx
+    on room_restrictions (ical_feed_id, external_uid);
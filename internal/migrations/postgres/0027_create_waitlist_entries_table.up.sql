@@ -0,0 +1,22 @@
+create table if not exists waitlist_entries (
+    id serial primary key,
+    room_id integer not null
+        constraint waitlist_entries_rooms_id_fk references rooms (id)
+        on update cascade on delete cascade,
+    start_date date not null,
+    end_date date not null,
+    adults integer not null default 1,
+    children integer not null default 0,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    email varchar(255) not null,
+    token varchar(64) not null,
+    status varchar(16) not null default 'waiting',
+    notified_at timestamp,
+    hold_expires_at timestamp,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+create unique index if not exists waitlist_entries_token_idx on waitlist_entries (token);
+create index if not exists waitlist_entries_status_idx on waitlist_entries (status);
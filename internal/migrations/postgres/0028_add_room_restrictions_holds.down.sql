@@ -0,0 +1,7 @@
+drop index if exists room_restrictions_expires_at_idx;
+
+delete from room_restrictions where restriction_id = 4;
+
+alter table room_restrictions drop column expires_at;
+
+delete from restrictions where id = 4;
@@ -0,0 +1,9 @@
+insert into restrictions (id, restriction_name, created_at, updated_at)
+select 4, 'Hold', now(), now()
+where not exists (select 1 from restrictions where id = 4);
+
+select setval(pg_get_serial_sequence('restrictions', 'id'), (select max(id) from restrictions));
+
+alter table room_restrictions add column expires_at timestamp;
+
+create index if not exists room_restrictions_expires_at_idx on room_restrictions (expires_at);
@@ -0,0 +1,3 @@
+drop index if exists reservation_payment_expires_at_idx;
+
+alter table reservation drop column payment_expires_at;
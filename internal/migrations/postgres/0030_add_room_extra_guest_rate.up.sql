@@ -0,0 +1,4 @@
+alter table rooms add column included_guests integer not null default 2
+    constraint rooms_included_guests_check check (included_guests > 0);
+alter table rooms add column extra_guest_rate integer not null default 0
+    constraint rooms_extra_guest_rate_check check (extra_guest_rate >= 0);
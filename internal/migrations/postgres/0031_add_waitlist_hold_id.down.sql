@@ -0,0 +1 @@
+alter table waitlist_entries drop column hold_id;
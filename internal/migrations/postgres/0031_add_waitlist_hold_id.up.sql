@@ -0,0 +1,3 @@
+alter table waitlist_entries add column hold_id integer
+    constraint waitlist_entries_room_restrictions_id_fk references room_restrictions (id)
+    on update cascade on delete set null;
@@ -0,0 +1,12 @@
+create table if not exists users (
+    id integer primary key autoincrement,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    email varchar(255) not null,
+    password varchar(60) not null,
+    access_level integer not null default 1,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create unique index if not exists users_email_idx on users (email);
@@ -0,0 +1,6 @@
+create table if not exists restrictions (
+    id integer primary key autoincrement,
+    restriction_name varchar(255) not null default '',
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
@@ -0,0 +1,15 @@
+create table if not exists reservation (
+    id integer primary key autoincrement,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    email varchar(255) not null,
+    phone varchar(255) not null default '',
+    start_date date not null,
+    end_date date not null,
+    room_id integer not null references rooms (id) on update cascade on delete cascade,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create index if not exists reservation_email_idx on reservation (email);
+create index if not exists reservation_last_name_idx on reservation (last_name);
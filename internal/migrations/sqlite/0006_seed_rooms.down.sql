@@ -0,0 +1 @@
+delete from rooms where id in (1, 2);
@@ -0,0 +1,3 @@
+insert or ignore into rooms (id, room_name) values
+    (1, 'General''s Quarters'),
+    (2, 'Major''s Suite');
@@ -0,0 +1,3 @@
+insert or ignore into restrictions (id, restriction_name) values
+    (1, 'Reservation'),
+    (2, 'Owner Block');
@@ -0,0 +1,18 @@
+create table if not exists promo_codes (
+    id integer primary key autoincrement,
+    code varchar(32) not null,
+    kind varchar(16) not null check (kind in ('percent', 'fixed')),
+    amount integer not null,
+    valid_from date not null,
+    valid_to date not null,
+    max_uses integer not null default 0,
+    uses integer not null default 0,
+    min_nights integer not null default 0,
+    room_ids varchar(255) not null default '',
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp,
+    check (valid_to >= valid_from),
+    check (max_uses = 0 or uses <= max_uses)
+);
+
+create unique index if not exists promo_codes_code_idx on promo_codes (code);
@@ -0,0 +1,12 @@
+create table if not exists fee_rules (
+    id integer primary key autoincrement,
+    name varchar(255) not null,
+    kind varchar(16) not null check (kind in ('per_stay', 'per_night', 'per_guest', 'percent')),
+    amount integer not null check (amount >= 0),
+    tax boolean not null default false,
+    room_id integer references rooms (id) on update cascade on delete cascade,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create index if not exists fee_rules_room_id_idx on fee_rules (room_id);
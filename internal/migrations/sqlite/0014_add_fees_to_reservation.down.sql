@@ -0,0 +1,2 @@
+alter table reservation drop column taxes;
+alter table reservation drop column fees;
@@ -0,0 +1,5 @@
+alter table reservation add column status varchar(20) not null default 'confirmed'
+    constraint reservation_status_check check (status in ('pending_payment', 'confirmed'));
+alter table reservation add column payment_intent_id varchar(255) not null default '';
+
+create index if not exists reservation_payment_intent_id_idx on reservation (payment_intent_id);
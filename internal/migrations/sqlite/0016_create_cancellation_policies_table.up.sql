@@ -0,0 +1,22 @@
+create table if not exists cancellation_policies (
+    id integer primary key autoincrement,
+    name varchar(255) not null,
+    deposit_percent integer not null check (deposit_percent between 0 and 100),
+    balance_days integer not null check (balance_days >= 0),
+    full_refund_days integer not null,
+    partial_refund_days integer not null check (partial_refund_days >= 0),
+    partial_refund_percent integer not null check (partial_refund_percent between 0 and 100),
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp,
+    check (full_refund_days >= partial_refund_days)
+);
+
+insert or ignore into cancellation_policies (id, name, deposit_percent, balance_days, full_refund_days,
+    partial_refund_days, partial_refund_percent) values
+    (1, 'Flexible', 20, 3, 1, 0, 0),
+    (2, 'Moderate', 30, 14, 5, 1, 50),
+    (3, 'Strict', 50, 30, 14, 7, 50);
+
+-- SQLite can not add a column with both a foreign key and a default, the
+-- repository checks the policy exists instead
+alter table rooms add column cancellation_policy_id integer not null default 2;
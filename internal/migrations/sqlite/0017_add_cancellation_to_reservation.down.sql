@@ -0,0 +1,15 @@
+drop index if exists reservation_balance_intent_id_idx;
+drop index if exists reservation_confirmation_code_idx;
+
+alter table reservation drop column balance_intent_id;
+alter table reservation drop column balance_due_date;
+alter table reservation drop column deposit;
+alter table reservation drop column cancellation_policy;
+alter table reservation drop column confirmation_code;
+
+delete from reservation where status = 'cancelled';
+alter table reservation add column old_status varchar(20) not null default 'confirmed'
+    check (old_status in ('pending_payment', 'confirmed'));
+update reservation set old_status = status;
+alter table reservation drop column status;
+alter table reservation rename column old_status to status;
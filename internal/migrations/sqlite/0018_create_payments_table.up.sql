@@ -0,0 +1,12 @@
+create table if not exists payments (
+    id integer primary key autoincrement,
+    reservation_id integer not null references reservation (id) on update cascade on delete cascade,
+    kind varchar(16) not null check (kind in ('deposit', 'balance', 'refund', 'failed')),
+    amount integer not null check (amount >= 0),
+    intent_id varchar(255) not null default '',
+    reference varchar(255) not null,
+    created_at timestamp not null default current_timestamp
+);
+
+create index if not exists payments_reservation_id_idx on payments (reservation_id);
+create unique index if not exists payments_kind_reference_idx on payments (kind, reference);
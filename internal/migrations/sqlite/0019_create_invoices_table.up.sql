@@ -0,0 +1,12 @@
+create table if not exists invoices (
+    id integer primary key autoincrement,
+    number integer not null check (number > 0),
+    reservation_id integer not null references reservation (id) on update cascade on delete restrict,
+    seller text not null default '{}',
+    issued_at timestamp not null,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create unique index if not exists invoices_number_idx on invoices (number);
+create unique index if not exists invoices_reservation_id_idx on invoices (reservation_id);
@@ -0,0 +1,10 @@
+create table if not exists exchange_rates (
+    id integer primary key autoincrement,
+    code varchar(3) not null,
+    symbol varchar(8) not null default '',
+    rate integer not null check (rate > 0),
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create unique index if not exists exchange_rates_code_idx on exchange_rates (code);
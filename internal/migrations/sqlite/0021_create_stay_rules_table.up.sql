@@ -0,0 +1,18 @@
+create table if not exists stay_rules (
+    id integer primary key autoincrement,
+    name varchar(255) not null,
+    room_id integer references rooms (id) on update cascade on delete cascade,
+    start_date date not null,
+    end_date date not null,
+    min_nights integer not null default 0 check (min_nights >= 0),
+    max_nights integer not null default 0 check (max_nights >= 0),
+    closed_to_arrival varchar(32) not null default '',
+    closed_to_departure varchar(32) not null default '',
+    min_lead_days integer not null default 0 check (min_lead_days >= 0),
+    max_lead_days integer not null default 0 check (max_lead_days >= 0),
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp,
+    check (end_date >= start_date)
+);
+
+create index if not exists stay_rules_room_id_idx on stay_rules (room_id);
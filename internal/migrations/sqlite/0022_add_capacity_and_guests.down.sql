@@ -0,0 +1,5 @@
+alter table reservation drop column children;
+alter table reservation drop column adults;
+
+alter table rooms drop column beds;
+alter table rooms drop column max_occupancy;
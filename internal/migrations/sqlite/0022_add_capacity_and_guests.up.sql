@@ -0,0 +1,8 @@
+alter table rooms add column max_occupancy integer not null default 2 check (max_occupancy > 0);
+alter table rooms add column beds integer not null default 1 check (beds > 0);
+
+update rooms set max_occupancy = 2, beds = 1 where id = 1;
+update rooms set max_occupancy = 4, beds = 2 where id = 2;
+
+alter table reservation add column adults integer not null default 1 check (adults > 0);
+alter table reservation add column children integer not null default 0 check (children >= 0);
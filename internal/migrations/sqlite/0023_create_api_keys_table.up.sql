@@ -0,0 +1,13 @@
+create table if not exists api_keys (
+    id integer primary key autoincrement,
+    name varchar(255) not null,
+    prefix varchar(16) not null,
+    key_hash varchar(64) not null,
+    scopes varchar(255) not null default '',
+    rate_limit integer not null default 60 check (rate_limit > 0),
+    expires_on date not null,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create unique index if not exists api_keys_prefix_idx on api_keys (prefix);
@@ -0,0 +1,27 @@
+create table if not exists webhooks (
+    id integer primary key autoincrement,
+    url varchar(2048) not null,
+    secret varchar(64) not null,
+    events varchar(255) not null default '',
+    active boolean not null default true,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create table if not exists webhook_deliveries (
+    id integer primary key autoincrement,
+    webhook_id integer not null references webhooks (id) on update cascade on delete cascade,
+    event varchar(64) not null,
+    payload text not null,
+    status varchar(16) not null default 'pending' check (status in ('pending', 'delivered', 'failed')),
+    attempts integer not null default 0 check (attempts >= 0),
+    response_code integer not null default 0,
+    last_error varchar(1024) not null default '',
+    next_attempt_at timestamp not null,
+    delivered_at timestamp,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create index if not exists webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id);
+create index if not exists webhook_deliveries_status_next_attempt_at_idx on webhook_deliveries (status, next_attempt_at);
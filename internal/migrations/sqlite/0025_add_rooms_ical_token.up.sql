@@ -0,0 +1,3 @@
+alter table rooms add column ical_token varchar(64) not null default '';
+
+update rooms set ical_token = lower(hex(randomblob(16)));
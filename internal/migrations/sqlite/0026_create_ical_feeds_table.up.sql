@@ -0,0 +1,23 @@
+insert or ignore into restrictions (id, restriction_name) values
+    (3, 'External');
+
+create table if not exists ical_feeds (
+    id integer primary key autoincrement,
+    room_id integer not null references rooms (id) on update cascade on delete cascade,
+    name varchar(255) not null default '',
+    url varchar(2048) not null,
+    last_synced_at timestamp,
+    last_error varchar(1024) not null default '',
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+create index if not exists ical_feeds_room_id_idx on ical_feeds (room_id);
+
+-- sqlite can't drop a column that is in a foreign key, so ical_feed_id has
+-- none here; the repository deletes the blocks of a feed with it
+alter table room_restrictions add column ical_feed_id integer;
+alter table room_restrictions add column external_uid varchar(255) not null default '';
+
+create unique index if not exists room_restrictions_ical_feed_id_external_uid_idx
+    on room_restrictions (ical_feed_id, external_uid);
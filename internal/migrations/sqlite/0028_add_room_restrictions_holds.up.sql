@@ -0,0 +1,6 @@
+insert or ignore into restrictions (id, restriction_name) values
+    (4, 'Hold');
+
+alter table room_restrictions add column expires_at timestamp;
+
+create index if not exists room_restrictions_expires_at_idx on room_restrictions (expires_at);
@@ -0,0 +1,3 @@
+alter table reservation add column payment_expires_at timestamp;
+
+create index if not exists reservation_payment_expires_at_idx on reservation (payment_expires_at);
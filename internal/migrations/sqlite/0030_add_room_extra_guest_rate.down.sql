@@ -0,0 +1,2 @@
+alter table rooms drop column extra_guest_rate;
+alter table rooms drop column included_guests;
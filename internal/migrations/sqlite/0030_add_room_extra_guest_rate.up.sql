@@ -0,0 +1,2 @@
+alter table rooms add column included_guests integer not null default 2 check (included_guests > 0);
+alter table rooms add column extra_guest_rate integer not null default 0 check (extra_guest_rate >= 0);
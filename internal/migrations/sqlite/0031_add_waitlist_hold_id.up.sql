@@ -0,0 +1,3 @@
+-- sqlite can't drop a column that is in a foreign key, so hold_id has none
+-- here; a hold that is gone is skipped when the guest's turn ends
+alter table waitlist_entries add column hold_id integer;
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 )
@@ -22,6 +23,19 @@ type User struct {
 type Room struct {
 	ID int
 	RoomName string
+	// NightlyRate is the base price of one night, in cents
+	NightlyRate int
+	CancellationPolicyID int
+	// MaxOccupancy is how many guests, adults and children, can stay in the
+	// room, and Beds how many beds it has
+	MaxOccupancy int
+	Beds int
+	// IncludedGuests is how many guests the nightly rate is for, every guest
+	// above them pays ExtraGuestRate cents a night
+	IncludedGuests int
+	ExtraGuestRate int
+	// ICalToken is the secret in the URL of the room's calendar feed
+	ICalToken string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -44,11 +58,134 @@ type Reservation struct {
 	StartDate time.Time
 	EndDate time.Time
 	RoomID int
+	// Adults and Children are how many guests stay
+	Adults int
+	Children int
+	// Quote is the price agreed at booking time, kept so later rate
+	// changes don't alter the booking
+	Quote Quote
+	// Status is ReservationPendingPayment until the guest has paid
+	Status string
+	// PaymentIntentID is the gateway intent the guest pays the deposit with
+	PaymentIntentID string
+	// ConfirmationCode lets the guest find their reservation
+	ConfirmationCode string
+	// Policy is the cancellation policy agreed at booking time
+	Policy CancellationPolicy
+	// Deposit is paid at booking, the rest of the total on BalanceDueDate
+	Deposit int
+	BalanceDueDate time.Time
+	// BalanceIntentID is the gateway intent the guest pays the balance with
+	BalanceIntentID string
+	// PaymentExpiresAt is when a reservation still waiting for its deposit
+	// is cancelled and its room let go of, zero for reservations paid at once
+	PaymentExpiresAt time.Time
+	// HoldID is the hold on the room the booking takes over, it is not saved
+	HoldID int
+	// HoldUntil is the earliest the hold may expire, a waitlisted guest keeps
+	// the room until their link stops working. It is not saved
+	HoldUntil time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room Room
 }
 
+// Reservation statuses. Reservations stored without a status are confirmed
+const (
+	ReservationPendingPayment = "pending_payment"
+	ReservationConfirmed = "confirmed"
+	ReservationCancelled = "cancelled"
+)
+
+// Guests is how many people stay, adults and children
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+// Balance is what is left to pay after the deposit
+func (r Reservation) Balance() int {
+	return r.Quote.Total - r.Deposit
+}
+
+// CancellationPolicy says when a stay is paid and how much is refunded when
+// the reservation is cancelled. Days count back from the arrival date
+type CancellationPolicy struct {
+	ID int
+	Name string
+	// DepositPercent of the total is paid at booking
+	DepositPercent int
+	// BalanceDays before arrival the rest of the total is due
+	BalanceDays int
+	// FullRefundDays or more before arrival everything paid is refunded
+	FullRefundDays int
+	// PartialRefundDays or more before arrival PartialRefundPercent of it is
+	PartialRefundDays int
+	PartialRefundPercent int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Payment kinds recorded in the payments ledger
+const (
+	PaymentDeposit = "deposit"
+	PaymentBalance = "balance"
+	PaymentRefund = "refund"
+	PaymentFailed = "failed"
+)
+
+// Payment is an entry of the payments ledger of a reservation, in cents
+type Payment struct {
+	ID int
+	ReservationID int
+	Kind string
+	Amount int
+	// IntentID is the gateway intent the money moved on
+	IntentID string
+	// Reference identifies the entry at the gateway, so it is recorded once
+	Reference string
+	CreatedAt time.Time
+}
+
+// Company is the business invoices are issued by
+type Company struct {
+	Name string
+	Address string
+	TaxID string
+	Email string
+}
+
+// Invoice is the bill for a reservation. Numbers run without gaps in the
+// order invoices are issued, and the seller is kept as it was on issue
+type Invoice struct {
+	ID int
+	Number int
+	ReservationID int
+	Seller Company
+	IssuedAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Code is the invoice number as printed, e.g. INV-000042
+func (i Invoice) Code() string {
+	return fmt.Sprintf("INV-%06d", i.Number)
+}
+
+// ExchangeRate converts prices shown to guests from the base currency into
+// another currency. Rate is how many units of the currency one unit of the
+// base currency buys, in millionths, e.g. 920000 for 0.92
+type ExchangeRate struct {
+	ID int
+	// Code is the ISO 4217 code of the currency, in upper case, e.g. EUR
+	Code string
+	// Symbol is printed before converted amounts, e.g. €; the code is
+	// printed after them when there is none
+	Symbol string
+	Rate int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 //RoomRestion is the roomrestition model
 type RoomRestriction struct {
 	ID int
@@ -57,9 +194,369 @@ type RoomRestriction struct {
 	RoomID int
 	ReservationID int
 	RestrictionID int
+	// ICalFeedID is the calendar feed an external block was imported from,
+	// 0 for the blocks and reservations made here
+	ICalFeedID int
+	// ExternalUID is the UID of the event the block was imported from
+	ExternalUID string
+	// ExpiresAt is when a hold lets go of the room, zero for everything else
+	ExpiresAt time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room Room
 	Reservation Reservation
-	Restriction Reservation
+	Restriction Restriction
+}
+
+// NightPrice is the price of one night of a stay, in cents
+type NightPrice struct {
+	Date time.Time
+	Amount int
+	// RatePlan is the name of the rate plan that priced the night, if any
+	RatePlan string
+	// ExtraGuests is the part of Amount charged for guests above those the
+	// room rate is for
+	ExtraGuests int
+}
+
+// Quote is the price of a stay night by night; amounts are in cents
+type Quote struct {
+	RoomID int
+	StartDate time.Time
+	EndDate time.Time
+	Nights []NightPrice
+	Subtotal int
+	// PromoCode is the code the guest used, if any, and Discount what it took off
+	PromoCode string
+	Discount int
+	// Guests is how many people stay, per guest fees are charged for each
+	Guests int
+	// Fees are the fees and taxes added to the stay; FeesTotal sums up the
+	// fees and TaxTotal the taxes
+	Fees []Fee
+	FeesTotal int
+	TaxTotal int
+	Total int
+}
+
+// Fee is one fee or tax line on a quote, in cents
+type Fee struct {
+	Name string
+	Tax bool
+	Amount int
+}
+
+// RatePlan changes the price of the nights from StartDate to EndDate, both included
+type RatePlan struct {
+	ID int
+	Name string
+	// RoomID is the room the plan is for, or 0 for every room
+	RoomID int
+	StartDate time.Time
+	EndDate time.Time
+	// NightlyRate replaces the room rate when it is not 0, in cents
+	NightlyRate int
+	// WeekdayModifiers are percentage changes indexed by time.Weekday,
+	// e.g. 20 on time.Saturday makes Saturday nights 20% dearer
+	WeekdayModifiers [7]int
+	// Priority decides between plans covering the same night, highest wins
+	Priority int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room Room
+}
+
+// Covers reports if the plan prices the night starting on the given date
+func (p RatePlan) Covers(roomID int, night time.Time) bool {
+	if p.RoomID != 0 && p.RoomID != roomID {
+		return false
+	}
+	return !night.Before(p.StartDate) && !night.After(p.EndDate)
+}
+
+// StayRule limits the stays guests can book in a room, or in every room when
+// RoomID is 0. A rule applies to stays arriving from StartDate to EndDate,
+// both included, except ClosedToDeparture, which applies to stays leaving
+// in that range. Limits that are 0 are not checked
+type StayRule struct {
+	ID int
+	Name string
+	RoomID int
+	StartDate time.Time
+	EndDate time.Time
+	MinNights int
+	MaxNights int
+	// ClosedToArrival and ClosedToDeparture are indexed by time.Weekday,
+	// true on the days guests can't arrive or leave
+	ClosedToArrival [7]bool
+	ClosedToDeparture [7]bool
+	// MinLeadDays is how many days before arrival a stay must be booked at
+	// least, MaxLeadDays how far ahead it can be booked at most
+	MinLeadDays int
+	MaxLeadDays int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room Room
+}
+
+// Covers reports if the rule applies to a room on the given day
+func (s StayRule) Covers(roomID int, day time.Time) bool {
+	if s.RoomID != 0 && s.RoomID != roomID {
+		return false
+	}
+	return !day.Before(s.StartDate) && !day.After(s.EndDate)
+}
+
+// Promo code kinds
+const (
+	PromoPercent = "percent"
+	PromoFixed = "fixed"
+)
+
+// PromoCode takes money off a stay. It can be redeemed from ValidFrom to
+// ValidTo, both included
+type PromoCode struct {
+	ID int
+	Code string
+	// Kind is PromoPercent, where Amount is a percentage, or PromoFixed,
+	// where Amount is in cents
+	Kind string
+	Amount int
+	ValidFrom time.Time
+	ValidTo time.Time
+	// MaxUses is how many bookings may use the code, 0 for no limit
+	MaxUses int
+	Uses int
+	// MinNights is the shortest stay the code is good for, 0 for any
+	MinNights int
+	// RoomIDs are the rooms the code is good for, empty for every room
+	RoomIDs []int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Fee rule kinds
+const (
+	FeePerStay = "per_stay"
+	FeePerNight = "per_night"
+	FeePerGuest = "per_guest"
+	FeePercent = "percent"
+)
+
+// FeeRule adds a fee or a tax, such as cleaning, city tax or VAT, on top of
+// the price of a stay
+type FeeRule struct {
+	ID int
+	Name string
+	// Kind is FeePerStay, FeePerNight or FeePerGuest, charged once, every
+	// night or every night for every guest, where Amount is in cents; or
+	// FeePercent, where Amount is hundredths of a percent of the room price
+	// after any discount, e.g. 2300 for 23%
+	Kind string
+	Amount int
+	// Tax marks taxes, which are totalled apart from other fees
+	Tax bool
+	// RoomID is the room the rule is for, or 0 for every room
+	RoomID int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room Room
+}
+
+// API key scopes, what a key may do with the JSON API
+const (
+	ScopeReadAvailability = "read-availability"
+	ScopeCreateReservation = "create-reservation"
+	ScopeReadReservations = "read-reservations"
+)
+
+// APIScopes are the scopes a key can have, in the order they are shown
+var APIScopes = []string{ScopeReadAvailability, ScopeCreateReservation, ScopeReadReservations}
+
+// APIKey lets a partner use the JSON API. Only the hash of the key is kept,
+// the key itself is shown once when it is made
+type APIKey struct {
+	ID int
+	Name string
+	// Prefix is the start of the key, kept in clear to find the key by
+	Prefix string
+	// Hash is the SHA-256 of the key, in hex
+	Hash string
+	// Scopes are what the key may do, like ScopeReadAvailability
+	Scopes []string
+	// RateLimit is how many requests the key may make a minute
+	RateLimit int
+	// ExpiresOn is the last day the key works
+	ExpiresOn time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// HasScope reports if the key may do what scope allows
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports if the key no longer works at now
+func (k APIKey) Expired(now time.Time) bool {
+	return !now.Before(k.ExpiresOn.AddDate(0, 0, 1))
+}
+
+// Webhook events, what a subscription can be told about
+const (
+	EventReservationCreated = "reservation.created"
+	EventReservationModified = "reservation.modified"
+	EventReservationCancelled = "reservation.cancelled"
+	EventBlockAdded = "block.added"
+	EventBlockRemoved = "block.removed"
+)
+
+// WebhookEvents are the events a webhook can subscribe to, in the order they are shown
+var WebhookEvents = []string{EventReservationCreated, EventReservationModified, EventReservationCancelled, EventBlockAdded, EventBlockRemoved}
+
+// Webhook is a URL told about events as they happen. Each request is signed
+// with the secret, so the receiver knows it came from us
+type Webhook struct {
+	ID int
+	URL string
+	Secret string
+	// Events are the events the URL is told about
+	Events []string
+	// Active webhooks are sent events, inactive ones are kept but skipped
+	Active bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Subscribes reports if the webhook is told about event
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed = "failed"
+)
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook, with how
+// its last attempt went
+type WebhookDelivery struct {
+	ID int
+	WebhookID int
+	Event string
+	// Payload is the JSON body sent
+	Payload string
+	// Status is DeliveryPending until the webhook answers with a 2xx, or
+	// DeliveryFailed when it ran out of attempts
+	Status string
+	Attempts int
+	// ResponseCode is the status the webhook last answered with, 0 if it didn't
+	ResponseCode int
+	// LastError says why the last attempt failed
+	LastError string
+	// NextAttemptAt is when a pending delivery is tried next
+	NextAttemptAt time.Time
+	// DeliveredAt is when the webhook took the event, zero until then
+	DeliveredAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Webhook Webhook
+}
+
+// ICalFeed is the calendar of a room on another platform. Its events are
+// imported as external blocks, so the room can't be booked here on nights
+// it was booked there
+type ICalFeed struct {
+	ID int
+	RoomID int
+	// Name says where the calendar comes from, like the platform's name
+	Name string
+	URL string
+	// LastSyncedAt is when the feed was last fetched, zero before the first time
+	LastSyncedAt time.Time
+	// LastError says what went wrong in the last sync, like a calendar that
+	// couldn't be fetched or events on nights already taken here; empty if
+	// nothing did
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room Room
+}
+
+// ICalSync is what syncing a calendar feed changed
+type ICalSync struct {
+	// Added and Removed are the external blocks made and deleted
+	Added []RoomRestriction
+	Removed []RoomRestriction
+	// Conflicts are the events that were not imported because the room is
+	// already taken on some of their nights
+	Conflicts []RoomRestriction
+}
+
+// MailData holds an email message
+type MailData struct {
+	To string
+	From string
+	Subject string
+	Content string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with an email
+type Attachment struct {
+	Name string
+	ContentType string
+	Data []byte
+}
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistNotified = "notified"
+	WaitlistExpired = "expired"
+)
+
+// WaitlistEntry is a guest waiting for a room to free up for a stay. When
+// it does, the guests waiting for it are told in the order they joined
+type WaitlistEntry struct {
+	ID int
+	RoomID int
+	StartDate time.Time
+	EndDate time.Time
+	Adults int
+	Children int
+	FirstName string
+	LastName string
+	Email string
+	// Token is the secret in the link the guest is mailed when the room frees up
+	Token string
+	// Status is WaitlistWaiting until the guest is told, WaitlistNotified
+	// while their link holds their turn and WaitlistExpired after
+	Status string
+	NotifiedAt time.Time
+	// HoldExpiresAt is when the link stops working and the next guest
+	// waiting gets their turn
+	HoldExpiresAt time.Time
+	// HoldID is the hold on the room while the link works
+	HoldID int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room Room
+}
+
+// Guests is how many people are waiting to stay
+func (e WaitlistEntry) Guests() int {
+	return e.Adults + e.Children
 }
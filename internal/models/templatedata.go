@@ -13,4 +13,9 @@ type TemplateData struct {
 	Warning string
 	Error string
 	Form *forms.Form
+	IsAuthenticated int
+	// Currency is the currency the guest picked to see prices in, the zero
+	// rate for the base currency; Currencies are the ones they can pick
+	Currency ExchangeRate
+	Currencies []ExchangeRate
 }
\ No newline at end of file
@@ -0,0 +1,400 @@
+package payments
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Test payment methods understood by FakeServer
+const (
+	TestCardVisa     = "pm_card_visa"
+	TestCardDeclined = "pm_card_chargeDeclined"
+)
+
+// FakeServer speaks enough of the Stripe API to take payments in tests and
+// development: intents are created, confirmed with a test card, captured or
+// cancelled and refunded, and every change is sent to WebhookURL as a signed
+// event.
+//
+// Intents are confirmed with a POST to /v1/payment_intents/{id}/confirm,
+// either through the API or from a browser form with the client secret; a
+// browser is sent on to the return_url it gives
+type FakeServer struct {
+	// WebhookURL gets the events, none are sent when it is empty
+	WebhookURL    string
+	WebhookSecret string
+	Client        *http.Client
+
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	events  []Event
+	lastID  int
+}
+
+// fakeIntent is an intent and what has been refunded on it
+type fakeIntent struct {
+	Intent
+	refunded int
+}
+
+// NewFakeServer creates a fake gateway sending its events to webhookURL
+func NewFakeServer(webhookURL, webhookSecret string) *FakeServer {
+	return &FakeServer{
+		WebhookURL:    webhookURL,
+		WebhookSecret: webhookSecret,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		intents:       make(map[string]*fakeIntent),
+	}
+}
+
+// Events returns the events sent so far
+func (f *FakeServer) Events() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Event(nil), f.events...)
+}
+
+// Intent returns an intent as the gateway sees it
+func (f *FakeServer) Intent(id string) (Intent, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		return Intent{}, false
+	}
+	return intent.Intent, true
+}
+
+// Confirm pays an intent with one of the test payment methods, as the guest
+// does at checkout
+func (f *FakeServer) Confirm(id, paymentMethod string) (Intent, error) {
+	f.mu.Lock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		f.mu.Unlock()
+		return Intent{}, &Error{Status: http.StatusNotFound, Type: "invalid_request_error", Code: "resource_missing", Message: "no such payment_intent: " + id}
+	}
+
+	if intent.Status != StatusRequiresPaymentMethod {
+		f.mu.Unlock()
+		return intent.Intent, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "payment_intent_unexpected_state", Message: "this payment intent can not be confirmed, it is " + intent.Status}
+	}
+
+	if paymentMethod == TestCardDeclined {
+		event := f.event(EventPaymentFailed, intent.Intent)
+		f.mu.Unlock()
+		f.send(event)
+		return event.Intent(), &Error{Status: http.StatusPaymentRequired, Type: "card_error", Code: "card_declined", Message: "your card was declined"}
+	}
+
+	intent.Status = StatusRequiresCapture
+	intent.AmountCapturable = intent.Amount
+	event := f.event(EventAmountCapturable, intent.Intent)
+	f.mu.Unlock()
+
+	f.send(event)
+	return event.Intent(), nil
+}
+
+func (f *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		fakeError(w, &Error{Status: http.StatusMethodNotAllowed, Type: "invalid_request_error", Message: "method not allowed"})
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Message: err.Error()})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// a browser confirms with the client secret instead of the secret key
+	if len(parts) == 4 && parts[1] == "payment_intents" && parts[3] == "confirm" && r.Method == http.MethodPost {
+		f.serveConfirm(w, r, parts[2])
+		return
+	}
+
+	key, _, ok := r.BasicAuth()
+	if !ok || !strings.HasPrefix(key, "sk_") {
+		fakeError(w, &Error{Status: http.StatusUnauthorized, Type: "invalid_request_error", Message: "invalid API key"})
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "payment_intents" && r.Method == http.MethodPost:
+		f.serveCreate(w, r)
+	case len(parts) == 3 && parts[1] == "payment_intents" && r.Method == http.MethodGet:
+		intent, ok := f.Intent(parts[2])
+		if !ok {
+			fakeError(w, &Error{Status: http.StatusNotFound, Type: "invalid_request_error", Code: "resource_missing", Message: "no such payment_intent: " + parts[2]})
+			return
+		}
+		fakeJSON(w, intent)
+	case len(parts) == 4 && parts[1] == "payment_intents" && parts[3] == "capture" && r.Method == http.MethodPost:
+		f.serveCapture(w, parts[2])
+	case len(parts) == 4 && parts[1] == "payment_intents" && parts[3] == "cancel" && r.Method == http.MethodPost:
+		f.serveCancel(w, parts[2])
+	case len(parts) == 2 && parts[1] == "refunds" && r.Method == http.MethodPost:
+		f.serveRefund(w, r)
+	default:
+		fakeError(w, &Error{Status: http.StatusNotFound, Type: "invalid_request_error", Message: "unknown endpoint " + r.URL.Path})
+	}
+}
+
+// serveCreate creates an intent waiting for a payment method
+func (f *FakeServer) serveCreate(w http.ResponseWriter, r *http.Request) {
+	amount, err := strconv.Atoi(r.Form.Get("amount"))
+	if err != nil || amount <= 0 {
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "parameter_invalid_integer", Message: "invalid amount"})
+		return
+	}
+
+	currency := r.Form.Get("currency")
+	if currency == "" {
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "parameter_missing", Message: "missing currency"})
+		return
+	}
+
+	metadata := make(map[string]string)
+	for k, v := range r.Form {
+		if strings.HasPrefix(k, "metadata[") && strings.HasSuffix(k, "]") {
+			metadata[k[len("metadata["):len(k)-1]] = v[0]
+		}
+	}
+
+	f.mu.Lock()
+	f.lastID++
+	id := fmt.Sprintf("pi_fake_%d", f.lastID)
+	intent := &fakeIntent{Intent: Intent{
+		ID:           id,
+		Amount:       amount,
+		Currency:     currency,
+		Status:       StatusRequiresPaymentMethod,
+		ClientSecret: id + "_secret_" + randomHex(),
+		Metadata:     metadata,
+	}}
+	f.intents[id] = intent
+	created := intent.Intent
+	f.mu.Unlock()
+
+	fakeJSON(w, created)
+}
+
+// serveConfirm pays an intent, answering with JSON or, when a return_url is
+// given, sending the browser on with redirect_status set
+func (f *FakeServer) serveConfirm(w http.ResponseWriter, r *http.Request, id string) {
+	key, _, hasKey := r.BasicAuth()
+	if !hasKey || !strings.HasPrefix(key, "sk_") {
+		intent, ok := f.Intent(id)
+		if !ok || r.Form.Get("client_secret") != intent.ClientSecret {
+			fakeError(w, &Error{Status: http.StatusUnauthorized, Type: "invalid_request_error", Message: "invalid client secret"})
+			return
+		}
+	}
+
+	paymentMethod := r.Form.Get("payment_method")
+	if paymentMethod == "" {
+		paymentMethod = TestCardVisa
+	}
+
+	intent, err := f.Confirm(id, paymentMethod)
+
+	if returnURL := r.Form.Get("return_url"); returnURL != "" {
+		status := "succeeded"
+		if err != nil {
+			status = "failed"
+		}
+
+		u, parseErr := url.Parse(returnURL)
+		if parseErr != nil {
+			fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Message: "invalid return_url"})
+			return
+		}
+		q := u.Query()
+		q.Set("payment_intent", id)
+		q.Set("redirect_status", status)
+		u.RawQuery = q.Encode()
+
+		http.Redirect(w, r, u.String(), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		fakeError(w, err.(*Error))
+		return
+	}
+	fakeJSON(w, intent)
+}
+
+// serveCapture takes the money of an authorized intent
+func (f *FakeServer) serveCapture(w http.ResponseWriter, id string) {
+	f.mu.Lock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		f.mu.Unlock()
+		fakeError(w, &Error{Status: http.StatusNotFound, Type: "invalid_request_error", Code: "resource_missing", Message: "no such payment_intent: " + id})
+		return
+	}
+
+	if intent.Status != StatusRequiresCapture {
+		f.mu.Unlock()
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "payment_intent_unexpected_state", Message: "this payment intent can not be captured, it is " + intent.Status})
+		return
+	}
+
+	intent.Status = StatusSucceeded
+	intent.AmountReceived = intent.AmountCapturable
+	intent.AmountCapturable = 0
+	event := f.event(EventSucceeded, intent.Intent)
+	f.mu.Unlock()
+
+	f.send(event)
+	fakeJSON(w, event.Intent())
+}
+
+// serveCancel drops an intent that hasn't been captured
+func (f *FakeServer) serveCancel(w http.ResponseWriter, id string) {
+	f.mu.Lock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		f.mu.Unlock()
+		fakeError(w, &Error{Status: http.StatusNotFound, Type: "invalid_request_error", Code: "resource_missing", Message: "no such payment_intent: " + id})
+		return
+	}
+
+	if intent.Status != StatusRequiresPaymentMethod && intent.Status != StatusRequiresCapture {
+		f.mu.Unlock()
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "payment_intent_unexpected_state", Message: "this payment intent can not be canceled, it is " + intent.Status})
+		return
+	}
+
+	intent.Status = StatusCanceled
+	intent.AmountCapturable = 0
+	event := f.event(EventCanceled, intent.Intent)
+	f.mu.Unlock()
+
+	f.send(event)
+	fakeJSON(w, event.Intent())
+}
+
+// serveRefund pays back part or all of a captured intent
+func (f *FakeServer) serveRefund(w http.ResponseWriter, r *http.Request) {
+	id := r.Form.Get("payment_intent")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		fakeError(w, &Error{Status: http.StatusNotFound, Type: "invalid_request_error", Code: "resource_missing", Message: "no such payment_intent: " + id})
+		return
+	}
+
+	if intent.Status != StatusSucceeded {
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "charge_not_captured", Message: "only captured payments can be refunded"})
+		return
+	}
+
+	left := intent.AmountReceived - intent.refunded
+
+	amount := left
+	if r.Form.Get("amount") != "" {
+		var err error
+		amount, err = strconv.Atoi(r.Form.Get("amount"))
+		if err != nil || amount <= 0 {
+			fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "parameter_invalid_integer", Message: "invalid amount"})
+			return
+		}
+	}
+
+	if amount > left {
+		fakeError(w, &Error{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: "amount_too_large", Message: fmt.Sprintf("only %d can be refunded", left)})
+		return
+	}
+
+	intent.refunded += amount
+	f.lastID++
+
+	fakeJSON(w, Refund{
+		ID:       fmt.Sprintf("re_fake_%d", f.lastID),
+		IntentID: id,
+		Amount:   amount,
+		Status:   StatusSucceeded,
+	})
+}
+
+// event records an event about an intent; callers hold the lock
+func (f *FakeServer) event(eventType string, intent Intent) Event {
+	f.lastID++
+
+	event := Event{
+		ID:      fmt.Sprintf("evt_fake_%d", f.lastID),
+		Type:    eventType,
+		Created: time.Now().Unix(),
+	}
+	event.Data.Object = intent
+
+	f.events = append(f.events, event)
+	return event
+}
+
+// send posts a signed event to the webhook url. It waits for the answer, so
+// the app has seen the event by the time the call that caused it returns
+func (f *FakeServer) send(event Event) {
+	if f.WebhookURL == "" {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, SignWebhook(f.WebhookSecret, payload, time.Now()))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// fakeJSON writes an API answer
+func fakeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fakeError writes an API error the way Stripe does
+func fakeError(w http.ResponseWriter, err *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(map[string]*Error{"error": err})
+}
+
+// randomHex returns 16 random hex digits
+func randomHex() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,126 @@
+// Package payments takes payments for bookings through a payment gateway.
+// Gateway is implemented by Stripe, and FakeServer stands in for Stripe in
+// tests and development
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/signing"
+)
+
+// Gateway takes payments. Intents are created with manual capture: the guest
+// authorizes the payment, and the money is taken when the intent is captured
+type Gateway interface {
+	// CreateIntent asks for a payment of amount cents
+	CreateIntent(ctx context.Context, amount int, currency string, metadata map[string]string) (Intent, error)
+	// GetIntent reads an intent
+	GetIntent(ctx context.Context, id string) (Intent, error)
+	// CaptureIntent takes the money of an authorized intent
+	CaptureIntent(ctx context.Context, id string) (Intent, error)
+	// CancelIntent drops an intent that hasn't been captured, so it can't be paid
+	CancelIntent(ctx context.Context, id string) (Intent, error)
+	// Refund pays back amount cents of a captured intent
+	Refund(ctx context.Context, intentID string, amount int) (Refund, error)
+	// VerifyWebhook checks the signature of a webhook and reads its event
+	VerifyWebhook(payload []byte, signature string) (Event, error)
+}
+
+// Intent statuses
+const (
+	StatusRequiresPaymentMethod = "requires_payment_method"
+	StatusRequiresCapture       = "requires_capture"
+	StatusSucceeded             = "succeeded"
+	StatusCanceled              = "canceled"
+)
+
+// Event types
+const (
+	EventAmountCapturable = "payment_intent.amount_capturable_updated"
+	EventSucceeded        = "payment_intent.succeeded"
+	EventPaymentFailed    = "payment_intent.payment_failed"
+	EventCanceled         = "payment_intent.canceled"
+)
+
+// SignatureHeader is the header webhooks carry their signature in
+const SignatureHeader = "Stripe-Signature"
+
+// WebhookTolerance is how old a webhook may be before it is refused
+const WebhookTolerance = 5 * time.Minute
+
+// ErrInvalidSignature is returned for webhooks that were not signed with the
+// webhook secret, or were signed too long ago
+var ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+
+// Intent is a payment the guest is asked to make, amounts are in cents
+type Intent struct {
+	ID               string            `json:"id"`
+	Amount           int               `json:"amount"`
+	AmountCapturable int               `json:"amount_capturable"`
+	AmountReceived   int               `json:"amount_received"`
+	Currency         string            `json:"currency"`
+	Status           string            `json:"status"`
+	ClientSecret     string            `json:"client_secret"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// Refund is money paid back on an intent, in cents
+type Refund struct {
+	ID       string `json:"id"`
+	IntentID string `json:"payment_intent"`
+	Amount   int    `json:"amount"`
+	Status   string `json:"status"`
+}
+
+// Event is a webhook sent by the gateway when an intent changes
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object Intent `json:"object"`
+	} `json:"data"`
+}
+
+// Intent returns the intent the event is about
+func (e Event) Intent() Intent {
+	return e.Data.Object
+}
+
+// Error is an error answered by the gateway
+type Error struct {
+	Status  int    `json:"-"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("payments: %s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+// SignWebhook signs a webhook payload the way Stripe does, giving the value
+// of the SignatureHeader
+func SignWebhook(secret string, payload []byte, t time.Time) string {
+	return signing.Sign(secret, payload, t)
+}
+
+// verifyWebhook checks a payload against a signature made by SignWebhook at
+// most WebhookTolerance before now, and reads the event
+func verifyWebhook(secret string, payload []byte, header string, now time.Time) (Event, error) {
+	var event Event
+
+	if err := signing.Verify(secret, payload, header, now, WebhookTolerance); err != nil {
+		return event, ErrInvalidSignature
+	}
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return event, fmt.Errorf("payments: invalid webhook payload: %w", err)
+	}
+
+	return event, nil
+}
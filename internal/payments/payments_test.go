@@ -0,0 +1,284 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/signing"
+)
+
+// webhookRecorder collects the events a FakeServer sends
+type webhookRecorder struct {
+	gateway *Stripe
+
+	mu     sync.Mutex
+	events []Event
+	errs   []error
+}
+
+func (rec *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, _ := io.ReadAll(r.Body)
+
+	event, err := rec.gateway.VerifyWebhook(payload, r.Header.Get(SignatureHeader))
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if err != nil {
+		rec.errs = append(rec.errs, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rec.events = append(rec.events, event)
+}
+
+func (rec *webhookRecorder) types() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var types []string
+	for _, e := range rec.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// setup starts a fake gateway and a Stripe client talking to it
+func setup(t *testing.T) (*Stripe, *FakeServer, *webhookRecorder) {
+	t.Helper()
+
+	rec := &webhookRecorder{}
+	hooks := httptest.NewServer(rec)
+	t.Cleanup(hooks.Close)
+
+	fake := NewFakeServer(hooks.URL, "whsec_test")
+	api := httptest.NewServer(fake)
+	t.Cleanup(api.Close)
+
+	gateway := NewStripe("sk_test", "whsec_test")
+	gateway.BaseURL = api.URL
+	rec.gateway = gateway
+
+	return gateway, fake, rec
+}
+
+func TestStripe_PaymentFlow(t *testing.T) {
+	gateway, fake, rec := setup(t)
+	ctx := context.Background()
+
+	intent, err := gateway.CreateIntent(ctx, 25000, "usd", map[string]string{"reservation_id": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.ID == "" || intent.ClientSecret == "" || intent.Status != StatusRequiresPaymentMethod || intent.Amount != 25000 {
+		t.Fatalf("got intent %+v", intent)
+	}
+	if intent.Metadata["reservation_id"] != "7" {
+		t.Errorf("got metadata %v", intent.Metadata)
+	}
+
+	// capturing before the guest paid fails
+	_, err = gateway.CaptureIntent(ctx, intent.ID)
+	var gatewayErr *Error
+	if !errors.As(err, &gatewayErr) || gatewayErr.Code != "payment_intent_unexpected_state" {
+		t.Errorf("capture before confirm: got %v", err)
+	}
+
+	intent, err = fake.Confirm(intent.ID, TestCardVisa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != StatusRequiresCapture || intent.AmountCapturable != 25000 {
+		t.Errorf("after confirm got %+v", intent)
+	}
+
+	intent, err = gateway.CaptureIntent(ctx, intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != StatusSucceeded || intent.AmountReceived != 25000 {
+		t.Errorf("after capture got %+v", intent)
+	}
+
+	read, err := gateway.GetIntent(ctx, intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Status != StatusSucceeded || read.AmountReceived != 25000 || read.ClientSecret != intent.ClientSecret {
+		t.Errorf("got intent %+v", read)
+	}
+
+	_, err = gateway.GetIntent(ctx, "pi_missing")
+	if !errors.As(err, &gatewayErr) || gatewayErr.Status != http.StatusNotFound {
+		t.Errorf("missing intent: got %v", err)
+	}
+
+	refund, err := gateway.Refund(ctx, intent.ID, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Amount != 10000 || refund.IntentID != intent.ID || refund.Status != StatusSucceeded {
+		t.Errorf("got refund %+v", refund)
+	}
+
+	_, err = gateway.Refund(ctx, intent.ID, 15001)
+	if !errors.As(err, &gatewayErr) || gatewayErr.Code != "amount_too_large" {
+		t.Errorf("refund above what is left: got %v", err)
+	}
+
+	got := strings.Join(rec.types(), " ")
+	want := EventAmountCapturable + " " + EventSucceeded
+	if got != want {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+}
+
+func TestStripe_DeclinedCard(t *testing.T) {
+	gateway, fake, rec := setup(t)
+
+	intent, err := gateway.CreateIntent(context.Background(), 1000, "usd", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fake.Confirm(intent.ID, TestCardDeclined)
+	var gatewayErr *Error
+	if !errors.As(err, &gatewayErr) || gatewayErr.Code != "card_declined" {
+		t.Errorf("got %v", err)
+	}
+
+	if got := rec.types(); len(got) != 1 || got[0] != EventPaymentFailed {
+		t.Errorf("got events %v", got)
+	}
+
+	// the guest may try again with another card
+	if _, err := fake.Confirm(intent.ID, TestCardVisa); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStripe_CancelIntent(t *testing.T) {
+	gateway, fake, rec := setup(t)
+
+	intent, err := gateway.CreateIntent(context.Background(), 1000, "usd", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intent, err = gateway.CancelIntent(context.Background(), intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != StatusCanceled {
+		t.Errorf("got status %q after cancelling", intent.Status)
+	}
+	if got := rec.types(); len(got) != 1 || got[0] != EventCanceled {
+		t.Errorf("got events %v", got)
+	}
+
+	// a cancelled intent can't be paid or cancelled again
+	if _, err := fake.Confirm(intent.ID, TestCardVisa); err == nil {
+		t.Error("a cancelled intent was paid")
+	}
+	_, err = gateway.CancelIntent(context.Background(), intent.ID)
+	var gatewayErr *Error
+	if !errors.As(err, &gatewayErr) || gatewayErr.Code != "payment_intent_unexpected_state" {
+		t.Errorf("got %v cancelling twice", err)
+	}
+}
+
+func TestFakeServer_BrowserConfirm(t *testing.T) {
+	gateway, _, _ := setup(t)
+
+	intent, err := gateway.CreateIntent(context.Background(), 1000, "usd", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	confirm := gateway.BaseURL + "/v1/payment_intents/" + intent.ID + "/confirm"
+
+	resp, err := client.PostForm(confirm, url.Values{
+		"client_secret":  {"wrong"},
+		"payment_method": {TestCardVisa},
+		"return_url":     {"http://app.test/done"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong client secret: got status %d", resp.StatusCode)
+	}
+
+	resp, err = client.PostForm(confirm, url.Values{
+		"client_secret":  {intent.ClientSecret},
+		"payment_method": {TestCardVisa},
+		"return_url":     {"http://app.test/done"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want := "http://app.test/done?payment_intent=" + intent.ID + "&redirect_status=succeeded"
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != want {
+		t.Errorf("got %d to %q, want redirect to %q", resp.StatusCode, resp.Header.Get("Location"), want)
+	}
+}
+
+func TestStripe_BadKey(t *testing.T) {
+	gateway, _, _ := setup(t)
+	gateway.Key = "pk_public"
+
+	_, err := gateway.CreateIntent(context.Background(), 1000, "usd", nil)
+	var gatewayErr *Error
+	if !errors.As(err, &gatewayErr) || gatewayErr.Status != http.StatusUnauthorized {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":500}}}`)
+
+	gateway := NewStripe("sk_test", "whsec_test")
+	gateway.Now = func() time.Time { return now }
+
+	event, err := gateway.VerifyWebhook(payload, SignWebhook("whsec_test", payload, now.Add(-time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventSucceeded || event.Intent().ID != "pi_1" || event.Intent().Amount != 500 {
+		t.Errorf("got event %+v", event)
+	}
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+	}{
+		{"other secret", payload, SignWebhook("whsec_other", payload, now)},
+		{"changed payload", []byte(strings.Replace(string(payload), "500", "5", 1)), SignWebhook("whsec_test", payload, now)},
+		{"too old", payload, SignWebhook("whsec_test", payload, now.Add(-WebhookTolerance-time.Second))},
+		{"no signature", payload, ""},
+		{"no timestamp", payload, "v1=" + signing.Signature("whsec_test", "", payload)},
+	}
+
+	for _, e := range tests {
+		if _, err := gateway.VerifyWebhook(e.payload, e.signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want ErrInvalidSignature", e.name, err)
+		}
+	}
+}
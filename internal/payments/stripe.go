@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stripe is a Gateway using the Stripe API, or anything that speaks it such
+// as FakeServer
+type Stripe struct {
+	// Key is the secret API key
+	Key string
+	// WebhookSecret signs the webhooks sent to the app
+	WebhookSecret string
+	// BaseURL is where the API is, https://api.stripe.com unless testing
+	BaseURL string
+	Client  *http.Client
+	Now     func() time.Time
+}
+
+// NewStripe creates a Stripe gateway for the real Stripe API
+func NewStripe(key, webhookSecret string) *Stripe {
+	return &Stripe{
+		Key:           key,
+		WebhookSecret: webhookSecret,
+		BaseURL:       "https://api.stripe.com",
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		Now:           time.Now,
+	}
+}
+
+// CreateIntent asks for a payment of amount cents, captured later
+func (s *Stripe) CreateIntent(ctx context.Context, amount int, currency string, metadata map[string]string) (Intent, error) {
+	var intent Intent
+
+	form := url.Values{}
+	form.Set("amount", strconv.Itoa(amount))
+	form.Set("currency", currency)
+	form.Set("capture_method", "manual")
+	for k, v := range metadata {
+		form.Set("metadata["+k+"]", v)
+	}
+
+	err := s.post(ctx, "/v1/payment_intents", form, &intent)
+	return intent, err
+}
+
+// GetIntent reads an intent
+func (s *Stripe) GetIntent(ctx context.Context, id string) (Intent, error) {
+	var intent Intent
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/v1/payment_intents/"+url.PathEscape(id), nil)
+	if err != nil {
+		return intent, err
+	}
+
+	err = s.do(req, &intent)
+	return intent, err
+}
+
+// CaptureIntent takes the money of an authorized intent
+func (s *Stripe) CaptureIntent(ctx context.Context, id string) (Intent, error) {
+	var intent Intent
+	err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(id)+"/capture", url.Values{}, &intent)
+	return intent, err
+}
+
+// CancelIntent drops an intent that hasn't been captured, so it can't be paid
+func (s *Stripe) CancelIntent(ctx context.Context, id string) (Intent, error) {
+	var intent Intent
+	err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(id)+"/cancel", url.Values{}, &intent)
+	return intent, err
+}
+
+// Refund pays back amount cents of a captured intent
+func (s *Stripe) Refund(ctx context.Context, intentID string, amount int) (Refund, error) {
+	var refund Refund
+
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	form.Set("amount", strconv.Itoa(amount))
+
+	err := s.post(ctx, "/v1/refunds", form, &refund)
+	return refund, err
+}
+
+// VerifyWebhook checks the Stripe-Signature of a webhook and reads its event
+func (s *Stripe) VerifyWebhook(payload []byte, signature string) (Event, error) {
+	return verifyWebhook(s.WebhookSecret, payload, signature, s.Now())
+}
+
+// post sends a form to the API and reads the answer into out
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return s.do(req, out)
+}
+
+// do sends a request with the API key and reads the answer into out
+func (s *Stripe) do(req *http.Request, out interface{}) error {
+	req.SetBasicAuth(s.Key, "")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payments: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("payments: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var answer struct {
+			Error Error `json:"error"`
+		}
+		if err := json.Unmarshal(body, &answer); err != nil || answer.Error.Message == "" {
+			answer.Error.Message = http.StatusText(resp.StatusCode)
+		}
+		answer.Error.Status = resp.StatusCode
+		return &answer.Error
+	}
+
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,68 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// RateScale is what exchange rates are multiplied by to store them as whole
+// numbers, so a rate of 920000 is 0.92
+const RateScale = 1000000
+
+// BaseCurrency is the code of the currency prices are kept and charged in,
+// in the upper case guests read
+func BaseCurrency() string {
+	return strings.ToUpper(Currency)
+}
+
+// Convert turns an amount in cents of the base currency into cents of
+// another currency, rounding to the nearest cent
+func Convert(cents, rate int) int {
+	n := int64(cents) * int64(rate)
+	if n < 0 {
+		return -int((-n + RateScale/2) / RateScale)
+	}
+	return int((n + RateScale/2) / RateScale)
+}
+
+// FormatIn formats an amount in cents of the base currency in the currency
+// of an exchange rate, e.g. 12950 at 0.92 euro becomes "€119.14". The zero
+// rate stands for the base currency and formats like FormatMoney
+func FormatIn(cents int, r models.ExchangeRate) string {
+	if r.Rate == 0 {
+		return FormatMoney(cents)
+	}
+
+	converted := Convert(cents, r.Rate)
+
+	sign := ""
+	if converted < 0 {
+		sign = "-"
+		converted = -converted
+	}
+
+	if r.Symbol == "" {
+		return sign + FormatAmount(converted) + " " + r.Code
+	}
+	return sign + r.Symbol + FormatAmount(converted)
+}
+
+// FormatRate formats an exchange rate without trailing zeros, e.g. 920000
+// becomes "0.92"; it is the format ParseRate reads
+func FormatRate(rate int) string {
+	s := fmt.Sprintf("%d.%06d", rate/RateScale, rate%RateScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// ParseRate reads an exchange rate such as "0.92" or "4.012345", which can
+// have up to six decimals
+func ParseRate(s string) (int, error) {
+	rate, err := parseFixed(s, 6)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return rate, nil
+}
@@ -0,0 +1,404 @@
+// Package pricing works out what a stay costs
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// Currency is the ISO 4217 code of the currency every price is in, in the
+// lower case payment gateways use
+const Currency = "usd"
+
+// Service prices stays using the rates stored in the repository
+type Service struct {
+	DB repository.DatabaseRepo
+	// Now tells the time promo codes are checked against
+	Now func() time.Time
+}
+
+// NewService creates a pricing service
+func NewService(db repository.DatabaseRepo) *Service {
+	return &Service{
+		DB:  db,
+		Now: time.Now,
+	}
+}
+
+// PromoError tells the guest why a promo code can not be used. It is a
+// repository.ErrInvalid, so handlers that don't look closer answer 400
+type PromoError struct {
+	Reason string
+}
+
+func (e *PromoError) Error() string {
+	return "promo code: " + e.Reason
+}
+
+func (e *PromoError) Unwrap() error {
+	return repository.ErrInvalid
+}
+
+// Quote prices every night from start up to, but not including, end, using
+// the room rate and the rate plans that cover each night plus the extra guest
+// rate of the room for every guest above those its rate is for, and adds the
+// fees and taxes for the room. Per guest fees are charged for guests people,
+// and for one when guests is below one
+func (s *Service) Quote(roomID int, start, end time.Time, guests int) (models.Quote, error) {
+	quote, err := s.nightly(roomID, start, end, guests)
+	if err != nil {
+		return quote, err
+	}
+
+	err = s.addFees(&quote)
+	return quote, err
+}
+
+// QuoteWithPromo prices a stay like Quote and takes off the discount of a
+// promo code before fees are added. A code that can not be used gives a
+// *PromoError
+func (s *Service) QuoteWithPromo(roomID int, start, end time.Time, guests int, code string) (models.Quote, error) {
+	if strings.TrimSpace(code) == "" {
+		return s.Quote(roomID, start, end, guests)
+	}
+
+	quote, err := s.nightly(roomID, start, end, guests)
+	if err != nil {
+		return quote, err
+	}
+
+	promo, err := s.DB.GetPromoCodeByCode(code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return quote, &PromoError{Reason: "this code does not exist"}
+	}
+	if err != nil {
+		return quote, err
+	}
+
+	if err := CheckPromo(promo, roomID, len(quote.Nights), s.Now()); err != nil {
+		return quote, err
+	}
+
+	quote.PromoCode = promo.Code
+	quote.Discount = Discount(promo, quote.Subtotal)
+
+	err = s.addFees(&quote)
+	return quote, err
+}
+
+// nightly prices the nights of a stay for its guests, without any discount
+// or fees
+func (s *Service) nightly(roomID int, start, end time.Time, guests int) (models.Quote, error) {
+	quote := models.Quote{
+		RoomID:    roomID,
+		StartDate: start,
+		EndDate:   end,
+		Guests:    guests,
+	}
+
+	if quote.Guests < 1 {
+		quote.Guests = 1
+	}
+
+	if !end.After(start) {
+		return quote, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	room, err := s.DB.GetRoomByID(roomID)
+	if err != nil {
+		return quote, err
+	}
+
+	plans, err := s.DB.RatePlansForRoom(roomID, start, end)
+	if err != nil {
+		return quote, err
+	}
+
+	extra := 0
+	if quote.Guests > room.IncludedGuests {
+		extra = (quote.Guests - room.IncludedGuests) * room.ExtraGuestRate
+	}
+
+	for night := start; night.Before(end); night = night.AddDate(0, 0, 1) {
+		price := NightPrice(room, plans, night)
+		price.ExtraGuests = extra
+		price.Amount += extra
+		quote.Nights = append(quote.Nights, price)
+		quote.Subtotal += price.Amount
+	}
+
+	quote.Total = quote.Subtotal
+
+	return quote, nil
+}
+
+// addFees adds the fee rules of the room to a quote and works out its total
+func (s *Service) addFees(quote *models.Quote) error {
+	rules, err := s.DB.FeeRulesForRoom(quote.RoomID)
+	if err != nil {
+		return err
+	}
+
+	ApplyFees(quote, rules)
+
+	return nil
+}
+
+// ApplyFees puts a line on the quote for every fee rule and works out the
+// total: the nights, less the discount, plus fees and taxes. Percentage
+// rules are worked out on the nights less the discount
+func ApplyFees(quote *models.Quote, rules []models.FeeRule) {
+	quote.Fees = nil
+	quote.FeesTotal = 0
+	quote.TaxTotal = 0
+
+	stay := quote.Subtotal - quote.Discount
+	nights := len(quote.Nights)
+
+	for _, rule := range rules {
+		fee := models.Fee{
+			Name: rule.Name,
+			Tax:  rule.Tax,
+		}
+
+		switch rule.Kind {
+		case models.FeePerStay:
+			fee.Amount = rule.Amount
+		case models.FeePerNight:
+			fee.Amount = rule.Amount * nights
+		case models.FeePerGuest:
+			fee.Amount = rule.Amount * nights * quote.Guests
+		case models.FeePercent:
+			fee.Amount = (stay*rule.Amount + 5000) / 10000
+		}
+
+		if fee.Amount == 0 {
+			continue
+		}
+
+		quote.Fees = append(quote.Fees, fee)
+		if fee.Tax {
+			quote.TaxTotal += fee.Amount
+		} else {
+			quote.FeesTotal += fee.Amount
+		}
+	}
+
+	quote.Total = stay + quote.FeesTotal + quote.TaxTotal
+}
+
+// CheckPromo makes sure a promo code can be used on the given day for a stay
+// of nights nights in a room
+func CheckPromo(promo models.PromoCode, roomID, nights int, now time.Time) error {
+	today := day(now)
+
+	if today.Before(promo.ValidFrom) {
+		return &PromoError{Reason: "this code can't be used yet"}
+	}
+
+	if today.After(promo.ValidTo) {
+		return &PromoError{Reason: "this code has expired"}
+	}
+
+	if promo.MaxUses > 0 && promo.Uses >= promo.MaxUses {
+		return &PromoError{Reason: "this code has been used up"}
+	}
+
+	if nights < promo.MinNights {
+		return &PromoError{Reason: fmt.Sprintf("this code needs a stay of at least %d nights", promo.MinNights)}
+	}
+
+	if len(promo.RoomIDs) > 0 {
+		for _, id := range promo.RoomIDs {
+			if id == roomID {
+				return nil
+			}
+		}
+		return &PromoError{Reason: "this code can't be used for this room"}
+	}
+
+	return nil
+}
+
+// Discount works out what a promo code takes off a subtotal, never more
+// than the subtotal itself
+func Discount(promo models.PromoCode, subtotal int) int {
+	discount := promo.Amount
+	if promo.Kind == models.PromoPercent {
+		discount = subtotal - applyPercent(subtotal, -promo.Amount)
+	}
+
+	if discount > subtotal {
+		return subtotal
+	}
+
+	return discount
+}
+
+// day is the calendar day of now as midnight UTC, the way stay dates are kept
+func day(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Schedule splits the total of a stay starting on start into the deposit paid
+// at booking and the balance due policy.BalanceDays before arrival. When the
+// balance would already be due at now, everything is paid at booking
+func Schedule(policy models.CancellationPolicy, total int, start, now time.Time) (int, time.Time) {
+	due := start.AddDate(0, 0, -policy.BalanceDays)
+	if !day(now).Before(due) {
+		return total, due
+	}
+
+	return (total*policy.DepositPercent + 50) / 100, due
+}
+
+// Refund works out how much of what the guest paid is given back when a stay
+// starting on start is cancelled at now
+func Refund(policy models.CancellationPolicy, paid int, start, now time.Time) int {
+	if paid <= 0 {
+		return 0
+	}
+
+	days := int(start.Sub(day(now)).Hours() / 24)
+
+	switch {
+	case days >= policy.FullRefundDays:
+		return paid
+	case days >= policy.PartialRefundDays:
+		return (paid*policy.PartialRefundPercent + 50) / 100
+	}
+
+	return 0
+}
+
+// Paid adds up a payments ledger: what was charged less what was refunded
+func Paid(ledger []models.Payment) int {
+	paid := 0
+	for _, p := range ledger {
+		switch p.Kind {
+		case models.PaymentDeposit, models.PaymentBalance:
+			paid += p.Amount
+		case models.PaymentRefund:
+			paid -= p.Amount
+		}
+	}
+	return paid
+}
+
+// NightPrice prices one night. The plan with the highest priority that covers
+// the night wins, and on equal priority the newest plan wins. Its nightly rate,
+// or the room rate when it has none, is then changed by its modifier for the
+// weekday of the night
+func NightPrice(room models.Room, plans []models.RatePlan, night time.Time) models.NightPrice {
+	price := models.NightPrice{
+		Date:   night,
+		Amount: room.NightlyRate,
+	}
+
+	var best *models.RatePlan
+	for i := range plans {
+		p := &plans[i]
+		if !p.Covers(room.ID, night) {
+			continue
+		}
+		if best == nil || p.Priority > best.Priority || (p.Priority == best.Priority && p.ID > best.ID) {
+			best = p
+		}
+	}
+
+	if best == nil {
+		return price
+	}
+
+	if best.NightlyRate > 0 {
+		price.Amount = best.NightlyRate
+	}
+	price.Amount = applyPercent(price.Amount, best.WeekdayModifiers[night.Weekday()])
+	price.RatePlan = best.Name
+
+	return price
+}
+
+// applyPercent changes an amount by a percentage, rounding to the nearest cent
+func applyPercent(amount, percent int) int {
+	return (amount*(100+percent) + 50) / 100
+}
+
+// FormatMoney formats an amount in cents, e.g. 12950 becomes "$129.50"
+func FormatMoney(cents int) string {
+	if cents < 0 {
+		return "-$" + FormatAmount(-cents)
+	}
+	return "$" + FormatAmount(cents)
+}
+
+// FormatAmount formats an amount in cents without a currency, e.g. 12950
+// becomes "129.50"; it is the format ParseAmount reads
+func FormatAmount(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// ParseAmount reads an amount such as "129.5" or "129.50" into cents
+func ParseAmount(s string) (int, error) {
+	cents, err := parseFixed(s, 2)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return cents, nil
+}
+
+// parseFixed reads a decimal number with at most places digits after the
+// point into an integer of that many decimal places
+func parseFixed(s string, places int) (int, error) {
+	s = strings.TrimSpace(s)
+
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+
+	whole, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+
+	if whole == "" || len(fraction) > places || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+
+	for len(fraction) < places {
+		fraction += "0"
+	}
+
+	n, err := strconv.Atoi(whole + fraction)
+	if err != nil {
+		return 0, err
+	}
+
+	if negative {
+		n = -n
+	}
+
+	return n, nil
+}
+
+// isDigits reports if s holds only the digits 0 to 9
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
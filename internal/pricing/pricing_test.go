@@ -0,0 +1,477 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/dbrepo"
+)
+
+func date(month time.Month, day int) time.Time {
+	return time.Date(2050, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestService_Quote(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	db.AddRoom(models.Room{ID: 3, RoomName: "Test Room", NightlyRate: 10050})
+	s := NewService(db)
+
+	quote, err := s.Quote(3, date(time.February, 27), date(time.March, 2), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quote.Nights) != 3 {
+		t.Fatalf("got %d nights, wanted 3", len(quote.Nights))
+	}
+	if !quote.Nights[2].Date.Equal(date(time.March, 1)) {
+		t.Errorf("got last night %s, wanted %s", quote.Nights[2].Date, date(time.March, 1))
+	}
+	if quote.Subtotal != 30150 || quote.Total != 30150 {
+		t.Errorf("got subtotal %d and total %d, wanted 30150", quote.Subtotal, quote.Total)
+	}
+
+	_, err = s.Quote(3, date(time.March, 2), date(time.March, 2), 1)
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for an empty stay, wanted ErrInvalid", err)
+	}
+
+	_, err = s.Quote(100, date(time.March, 1), date(time.March, 2), 1)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a missing room, wanted ErrNotFound", err)
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		cents int
+		want  string
+	}{
+		{0, "$0.00"},
+		{5, "$0.05"},
+		{9900, "$99.00"},
+		{12950, "$129.50"},
+		{-1250, "-$12.50"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatMoney(tt.cents); got != tt.want {
+			t.Errorf("FormatMoney(%d) = %q, wanted %q", tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestNightPrice_OverlappingSeasons(t *testing.T) {
+	room := models.Room{ID: 1, NightlyRate: 10000}
+
+	weekend := [7]int{}
+	weekend[time.Friday] = 20
+	weekend[time.Saturday] = 20
+
+	plans := []models.RatePlan{
+		// all summer, every room, dearer at the weekend
+		{ID: 1, Name: "Summer", StartDate: date(time.June, 1), EndDate: date(time.August, 31), NightlyRate: 15000, WeekdayModifiers: weekend, Priority: 1},
+		// a festival week inside the summer for room 1 only
+		{ID: 2, Name: "Festival", RoomID: 1, StartDate: date(time.July, 10), EndDate: date(time.July, 16), NightlyRate: 25000, Priority: 5},
+		// a discount on the same priority as the festival, added later
+		{ID: 3, Name: "Last minute", RoomID: 1, StartDate: date(time.July, 16), EndDate: date(time.July, 20), WeekdayModifiers: [7]int{-10, -10, -10, -10, -10, -10, -10}, Priority: 5},
+		// a plan for another room never applies
+		{ID: 4, Name: "Other room", RoomID: 2, StartDate: date(time.January, 1), EndDate: date(time.December, 31), NightlyRate: 1, Priority: 100},
+	}
+
+	tests := []struct {
+		name   string
+		night  time.Time
+		amount int
+		plan   string
+	}{
+		{"no plan", date(time.May, 31), 10000, ""},
+		{"first day of season", date(time.June, 1), 15000, "Summer"},
+		{"season weekend", date(time.June, 3), 18000, "Summer"},
+		{"higher priority wins", date(time.July, 10), 25000, "Festival"},
+		{"higher priority ignores lower weekend", date(time.July, 15), 25000, "Festival"},
+		{"newest wins on equal priority", date(time.July, 16), 9000, "Last minute"},
+		{"last day of season", date(time.August, 31), 15000, "Summer"},
+		{"after season", date(time.September, 1), 10000, ""},
+	}
+
+	for _, tt := range tests {
+		got := NightPrice(room, plans, tt.night)
+		if got.Amount != tt.amount || got.RatePlan != tt.plan {
+			t.Errorf("%s: got %d from %q, wanted %d from %q", tt.name, got.Amount, got.RatePlan, tt.amount, tt.plan)
+		}
+	}
+}
+
+func TestService_QuoteWithRatePlans(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	db.AddRoom(models.Room{ID: 3, RoomName: "Test Room", NightlyRate: 10000})
+	s := NewService(db)
+
+	_, err := db.InsertRatePlan(models.RatePlan{
+		Name:        "Peak",
+		RoomID:      3,
+		StartDate:   date(time.March, 2),
+		EndDate:     date(time.March, 2),
+		NightlyRate: 20000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := s.Quote(3, date(time.March, 1), date(time.March, 4), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quote.Total != 40000 {
+		t.Errorf("got total %d, wanted 40000", quote.Total)
+	}
+	if quote.Nights[1].RatePlan != "Peak" || quote.Nights[1].Amount != 20000 {
+		t.Errorf("got second night %+v, wanted the peak rate", quote.Nights[1])
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  int
+		valid bool
+	}{
+		{"129.50", 12950, true},
+		{"129.5", 12950, true},
+		{"129", 12900, true},
+		{" 0.05 ", 5, true},
+		{"-12.50", -1250, true},
+		{"", 0, false},
+		{".50", 0, false},
+		{"1.234", 0, false},
+		{"12,50", 0, false},
+		{"abc", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseAmount(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, wanted %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestService_QuoteWithPromo(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	db.AddRoom(models.Room{ID: 3, RoomName: "Test Room", NightlyRate: 10000})
+	s := NewService(db)
+	s.Now = func() time.Time { return date(time.March, 1).Add(15 * time.Hour) }
+
+	codes := []models.PromoCode{
+		{Code: "TENOFF", Kind: models.PromoPercent, Amount: 10, ValidFrom: date(time.January, 1), ValidTo: date(time.March, 1)},
+		{Code: "FIFTY", Kind: models.PromoFixed, Amount: 5000, ValidFrom: date(time.January, 1), ValidTo: date(time.December, 31)},
+		{Code: "HUGE", Kind: models.PromoFixed, Amount: 1000000, ValidFrom: date(time.January, 1), ValidTo: date(time.December, 31)},
+		{Code: "LATER", Kind: models.PromoFixed, Amount: 100, ValidFrom: date(time.March, 2), ValidTo: date(time.December, 31)},
+		{Code: "OLD", Kind: models.PromoFixed, Amount: 100, ValidFrom: date(time.January, 1), ValidTo: date(time.February, 28)},
+		{Code: "LONG", Kind: models.PromoFixed, Amount: 100, ValidFrom: date(time.January, 1), ValidTo: date(time.December, 31), MinNights: 7},
+		{Code: "SUITE", Kind: models.PromoFixed, Amount: 100, ValidFrom: date(time.January, 1), ValidTo: date(time.December, 31), RoomIDs: []int{2}},
+		{Code: "GONE", Kind: models.PromoFixed, Amount: 100, ValidFrom: date(time.January, 1), ValidTo: date(time.December, 31), MaxUses: 1, Uses: 1},
+	}
+	for _, p := range codes {
+		if _, err := db.InsertPromoCode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		code     string
+		discount int
+		reason   string
+	}{
+		{"", 0, ""},
+		{"tenoff", 3000, ""},
+		{"FIFTY", 5000, ""},
+		{"HUGE", 30000, ""},
+		{"NOPE", 0, "this code does not exist"},
+		{"LATER", 0, "this code can't be used yet"},
+		{"OLD", 0, "this code has expired"},
+		{"LONG", 0, "this code needs a stay of at least 7 nights"},
+		{"SUITE", 0, "this code can't be used for this room"},
+		{"GONE", 0, "this code has been used up"},
+	}
+
+	for _, tt := range tests {
+		quote, err := s.QuoteWithPromo(3, date(time.April, 1), date(time.April, 4), 1, tt.code)
+
+		var promoErr *PromoError
+		if tt.reason != "" {
+			if !errors.As(err, &promoErr) || promoErr.Reason != tt.reason {
+				t.Errorf("%q: got error %v, wanted %q", tt.code, err, tt.reason)
+			}
+			if !errors.Is(err, repository.ErrInvalid) {
+				t.Errorf("%q: a promo error is not ErrInvalid", tt.code)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %s", tt.code, err)
+			continue
+		}
+		if quote.Discount != tt.discount || quote.Total != quote.Subtotal-tt.discount {
+			t.Errorf("%q: got discount %d and total %d, wanted discount %d", tt.code, quote.Discount, quote.Total, tt.discount)
+		}
+	}
+}
+
+func TestApplyFees(t *testing.T) {
+	rules := []models.FeeRule{
+		{Name: "Cleaning", Kind: models.FeePerStay, Amount: 3000},
+		{Name: "Linen", Kind: models.FeePerNight, Amount: 500},
+		{Name: "City tax", Kind: models.FeePerGuest, Amount: 250, Tax: true},
+		{Name: "VAT", Kind: models.FeePercent, Amount: 800, Tax: true},
+		{Name: "Nothing", Kind: models.FeePerStay, Amount: 0},
+	}
+
+	quote := models.Quote{
+		Nights:   make([]models.NightPrice, 3),
+		Subtotal: 30000,
+		Discount: 5000,
+		Guests:   2,
+	}
+
+	ApplyFees(&quote, rules)
+
+	want := []models.Fee{
+		{Name: "Cleaning", Amount: 3000},
+		{Name: "Linen", Amount: 1500},
+		{Name: "City tax", Tax: true, Amount: 1500},
+		{Name: "VAT", Tax: true, Amount: 2000},
+	}
+	if len(quote.Fees) != len(want) {
+		t.Fatalf("got fees %+v, wanted %+v", quote.Fees, want)
+	}
+	for i := range want {
+		if quote.Fees[i] != want[i] {
+			t.Errorf("got fee %+v, wanted %+v", quote.Fees[i], want[i])
+		}
+	}
+
+	if quote.FeesTotal != 4500 || quote.TaxTotal != 3500 || quote.Total != 33000 {
+		t.Errorf("got fees %d, taxes %d and total %d, wanted 4500, 3500 and 33000", quote.FeesTotal, quote.TaxTotal, quote.Total)
+	}
+
+	// applying the rules again replaces the lines instead of adding to them
+	ApplyFees(&quote, rules[:1])
+	if len(quote.Fees) != 1 || quote.TaxTotal != 0 || quote.Total != 28000 {
+		t.Errorf("got %+v after applying the fees again", quote)
+	}
+}
+
+func TestService_QuoteWithFees(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	db.AddRoom(models.Room{ID: 3, RoomName: "Test Room", NightlyRate: 10000})
+	s := NewService(db)
+	s.Now = func() time.Time { return date(time.March, 1) }
+
+	rules := []models.FeeRule{
+		{Name: "Cleaning", Kind: models.FeePerStay, Amount: 3000, RoomID: 3},
+		{Name: "Suite cleaning", Kind: models.FeePerStay, Amount: 9000, RoomID: 2},
+		{Name: "VAT", Kind: models.FeePercent, Amount: 1000, Tax: true},
+	}
+	for _, f := range rules {
+		if _, err := db.InsertFeeRule(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := db.InsertPromoCode(models.PromoCode{Code: "FIFTY", Kind: models.PromoFixed, Amount: 5000, ValidFrom: date(time.January, 1), ValidTo: date(time.December, 31)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := s.Quote(3, date(time.April, 1), date(time.April, 3), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quote.Fees) != 2 || quote.FeesTotal != 3000 || quote.TaxTotal != 2000 || quote.Total != 25000 {
+		t.Errorf("got quote %+v, wanted cleaning and VAT for a total of 25000", quote)
+	}
+
+	// VAT is worked out after the discount
+	quote, err = s.QuoteWithPromo(3, date(time.April, 1), date(time.April, 3), 1, "FIFTY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Discount != 5000 || quote.TaxTotal != 1500 || quote.Total != 19500 {
+		t.Errorf("got discount %d, taxes %d and total %d, wanted 5000, 1500 and 19500", quote.Discount, quote.TaxTotal, quote.Total)
+	}
+
+	db.SetFault("FeeRulesForRoom", func(args ...interface{}) error {
+		return errors.New("some error")
+	})
+	if _, err := s.Quote(3, date(time.April, 1), date(time.April, 3), 1); err == nil {
+		t.Error("got no error when the fee rules could not be read")
+	}
+}
+
+func TestService_QuoteGuests(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	db.AddRoom(models.Room{ID: 3, RoomName: "Test Room", NightlyRate: 10000, MaxOccupancy: 4, IncludedGuests: 2, ExtraGuestRate: 3000})
+	s := NewService(db)
+
+	if _, err := db.InsertFeeRule(models.FeeRule{Name: "City tax", Kind: models.FeePerGuest, Amount: 250, Tax: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rate is for two guests, every other guest pays 30.00 a night
+	tests := []struct {
+		guests   int
+		wanted   int
+		subtotal int
+		total    int
+	}{
+		{4, 4, 20000 + 2*2*3000, 20000 + 2*2*3000 + 4*2*250},
+		{3, 3, 20000 + 2*3000, 20000 + 2*3000 + 3*2*250},
+		{2, 2, 20000, 20000 + 2*2*250},
+		{1, 1, 20000, 20000 + 2*250},
+		{0, 1, 20000, 20000 + 2*250},
+	}
+
+	for _, tt := range tests {
+		quote, err := s.Quote(3, date(time.May, 1), date(time.May, 3), tt.guests)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quote.Guests != tt.wanted || quote.Subtotal != tt.subtotal || quote.TaxTotal != tt.total-tt.subtotal || quote.Total != tt.total {
+			t.Errorf("Quote for %d guests: got %d guests, subtotal %d, taxes %d and total %d, wanted %d guests, subtotal %d and total %d",
+				tt.guests, quote.Guests, quote.Subtotal, quote.TaxTotal, quote.Total, tt.wanted, tt.subtotal, tt.total)
+		}
+		extra := tt.subtotal/2 - 10000
+		if quote.Nights[0].ExtraGuests != extra || quote.Nights[0].Amount != 10000+extra {
+			t.Errorf("Quote for %d guests priced the first night %+v, wanted %d for extra guests", tt.guests, quote.Nights[0], extra)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	moderate := models.CancellationPolicy{Name: "Moderate", DepositPercent: 30, BalanceDays: 14}
+	arrival := date(time.June, 20)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		deposit int
+	}{
+		{"months ahead", date(time.March, 1).Add(15 * time.Hour), 7500},
+		{"the day before the balance is due", date(time.June, 5).Add(23 * time.Hour), 7500},
+		{"the day the balance is due", date(time.June, 6), 25001},
+		{"last minute", date(time.June, 19), 25001},
+	}
+
+	for _, tt := range tests {
+		deposit, due := Schedule(moderate, 25001, arrival, tt.now)
+		if deposit != tt.deposit || !due.Equal(date(time.June, 6)) {
+			t.Errorf("%s: got deposit %d due %s, wanted %d due %s", tt.name, deposit, due, tt.deposit, date(time.June, 6))
+		}
+	}
+
+	// a policy without a deposit asks for nothing at booking
+	deposit, _ := Schedule(models.CancellationPolicy{BalanceDays: 7}, 25000, arrival, date(time.March, 1))
+	if deposit != 0 {
+		t.Errorf("got deposit %d without a deposit percent, wanted 0", deposit)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	strict := models.CancellationPolicy{Name: "Strict", FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50}
+	arrival := date(time.June, 20)
+
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{date(time.May, 1), 30001},
+		{date(time.June, 6).Add(20 * time.Hour), 30001},
+		{date(time.June, 7), 15001},
+		{date(time.June, 13), 15001},
+		{date(time.June, 14), 0},
+		{date(time.June, 25), 0},
+	}
+
+	for _, tt := range tests {
+		if got := Refund(strict, 30001, arrival, tt.now); got != tt.want {
+			t.Errorf("Refund on %s = %d, wanted %d", tt.now.Format("2006-01-02"), got, tt.want)
+		}
+	}
+
+	if got := Refund(strict, 0, arrival, date(time.May, 1)); got != 0 {
+		t.Errorf("Refund of nothing paid = %d, wanted 0", got)
+	}
+}
+
+func TestPaid(t *testing.T) {
+	ledger := []models.Payment{
+		{Kind: models.PaymentDeposit, Amount: 9000},
+		{Kind: models.PaymentFailed, Amount: 21000},
+		{Kind: models.PaymentBalance, Amount: 21000},
+		{Kind: models.PaymentRefund, Amount: 5000},
+	}
+
+	if got := Paid(ledger); got != 25000 {
+		t.Errorf("Paid = %d, wanted 25000", got)
+	}
+}
+
+func TestFormatIn(t *testing.T) {
+	eur := models.ExchangeRate{Code: "EUR", Symbol: "€", Rate: 920000}
+	pln := models.ExchangeRate{Code: "PLN", Rate: 4012345}
+
+	var tests = []struct {
+		cents int
+		rate models.ExchangeRate
+		want string
+	}{
+		{12950, models.ExchangeRate{}, "$129.50"},
+		{12950, eur, "€119.14"},
+		{-2000, eur, "-€18.40"},
+		{10000, pln, "401.23 PLN"},
+		{1, eur, "€0.01"},
+	}
+
+	for _, e := range tests {
+		if got := FormatIn(e.cents, e.rate); got != e.want {
+			t.Errorf("FormatIn(%d, %s) = %q, wanted %q", e.cents, e.rate.Code, got, e.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	var tests = []struct {
+		s string
+		rate int
+		valid bool
+	}{
+		{"0.92", 920000, true},
+		{"4.012345", 4012345, true},
+		{"150", 150000000, true},
+		{"0.0000001", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"1,5", 0, false},
+	}
+
+	for _, e := range tests {
+		rate, err := ParseRate(e.s)
+		if (err == nil) != e.valid || rate != e.rate {
+			t.Errorf("ParseRate(%q) = %d, %v", e.s, rate, err)
+		}
+		if e.valid && FormatRate(rate) != e.s {
+			t.Errorf("FormatRate(%d) = %q, wanted %q", rate, FormatRate(rate), e.s)
+		}
+	}
+}
@@ -8,12 +8,22 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/pricing"
 	"github.com/justinas/nosurf"
 )
-var functions = template.FuncMap{}
+var functions = template.FuncMap{
+	"money": pricing.FormatMoney,
+	"amount": pricing.FormatAmount,
+	"shortDate": ShortDate,
+	"weekday": Weekday,
+	"price": Price,
+	"rate": pricing.FormatRate,
+	"baseCurrency": pricing.BaseCurrency,
+}
 
 var app *config.AppConfig
 var pathToTemplates = "./templates"
@@ -23,12 +33,54 @@ func NewRenderer(a *config.AppConfig){
 	app = a
 }
 	
+// ShortDate returns a date in YYYY-MM-DD format
+func ShortDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// Weekday returns the name of a day of the week, 0 being Sunday
+func Weekday(day int) string {
+	return time.Weekday(day).String()
+}
+
+// Price formats an amount in cents in the currency the guest picked
+func Price(currency models.ExchangeRate, cents int) string {
+	return pricing.FormatIn(cents, currency)
+}
+
+// addCurrency sets the currencies guests can pick and the one they picked,
+// which is kept in the session under "currency". A currency that lost its
+// rate falls back to the base currency
+func addCurrency(td *models.TemplateData, r *http.Request) {
+	if app.ExchangeRates == nil {
+		return
+	}
+
+	rates, err := app.ExchangeRates()
+	if err != nil {
+		app.ErrorLog.Println(err)
+		return
+	}
+	td.Currencies = rates
+
+	code := app.Session.GetString(r.Context(), "currency")
+	for _, rate := range rates {
+		if rate.Code == code {
+			td.Currency = rate
+		}
+	}
+}
+
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
 	td.Flash = app.Session.PopString(r.Context(), "flash")
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 
 	td.CSRFToken = nosurf.Token(r)
+	addCurrency(td, r)
+	if app.Session.Exists(r.Context(), "user_id") {
+		td.IsAuthenticated = 1
+	}
 	return td
 }
 
@@ -68,6 +120,33 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 	return nil
 }
 
+// Mail renders an email template, one of the *.mail.tmpl files, to a string
+func Mail(tmpl string, td *models.TemplateData) (string, error) {
+	var tc map[string]*template.Template
+
+	if app.UseCache {
+		tc = app.TemplateCache
+	} else {
+		var err error
+		tc, err = CreateTemplateCache()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	t, ok := tc[tmpl]
+	if !ok {
+		return "", fmt.Errorf("can't get template %s from cache", tmpl)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, td); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
 func CreateTemplateCache() (map[string]*template.Template, error) {
 	myCache := map[string]*template.Template{}
 
@@ -77,6 +156,13 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 		return myCache, err
 	}
 
+	// emails are rendered from *.mail.tmpl the same way
+	mails, err := filepath.Glob(fmt.Sprintf("%s/*.mail.tmpl", pathToTemplates))
+	if err != nil {
+		return myCache, err
+	}
+	pages = append(pages, mails...)
+
 	// range through all files ending whit *.page.tmpl
 	for _, page := range pages {
 		name := filepath.Base(page)
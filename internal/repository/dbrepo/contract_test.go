@@ -0,0 +1,75 @@
+package dbrepo_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/driver"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/migrations"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/dbrepo"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository/repotest"
+)
+
+func TestMemoryRepo_Contract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return dbrepo.NewMemoryRepo(&config.AppConfig{})
+	})
+}
+
+func TestSQLiteRepo_Contract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		db, err := driver.ConnectSQLite(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.SQL.Close() })
+
+		migrate(t, db, "sqlite")
+
+		return dbrepo.NewSQLiteRepo(db.SQL, &config.AppConfig{})
+	})
+}
+
+// TestPostgresRepo_Contract runs against the database in TEST_DATABASE_URL,
+// which is emptied before every test. The suite is run twice, so rows a test
+// leaves behind that the next run trips over are caught
+func TestPostgresRepo_Contract(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := driver.ConnectSQL(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	migrate(t, db, "postgres")
+
+	newRepo := func(t *testing.T) repository.DatabaseRepo {
+		_, err := db.SQL.Exec(`truncate reservation, room_restrictions, users, rate_plans, promo_codes, fee_rules, payments, invoices, exchange_rates, stay_rules, api_keys, webhooks, webhook_deliveries, ical_feeds, waitlist_entries restart identity cascade`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dbrepo.NewPostgresRepo(db.SQL, &config.AppConfig{})
+	}
+
+	t.Run("first run", func(t *testing.T) { repotest.Run(t, newRepo) })
+	t.Run("rerun", func(t *testing.T) { repotest.Run(t, newRepo) })
+}
+
+func migrate(t *testing.T, db *driver.DB, dialect string) {
+	t.Helper()
+
+	m, err := migrations.New(db.SQL, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
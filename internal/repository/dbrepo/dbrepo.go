@@ -1,31 +1,1239 @@
 package dbrepo
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
 	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
 )
 
-type postgresDBRepo struct {
+// sqlDBRepo is the repository over a SQL database. Its queries are written
+// once for every database it runs on, the dialect holds what differs
+type sqlDBRepo struct {
 	App *config.AppConfig
 	DB *sql.DB
+	dialect dialect
 }
 
-type testDBRepo struct {
-	App *config.AppConfig
-	DB *sql.DB
+// dialect is what differs between the databases sqlDBRepo runs on. Both
+// drivers take $1 placeholders, so the queries themselves are shared
+type dialect struct {
+	// roomQuery selects a room a booking or block claims by id
+	roomQuery string
+	// dbError translates the driver's constraint violations into the
+	// repository errors
+	dbError func(error) error
 }
 
 func NewPostgresRepo (conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
-	return &postgresDBRepo{
+	return &sqlDBRepo{
 		App: a,
 		DB: conn,
+		dialect: postgresDialect,
 	}
 }
 
-func NewTestingRepo (a *config.AppConfig) repository.DatabaseRepo {
-	return &testDBRepo{
+func NewSQLiteRepo (conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &sqlDBRepo{
 		App: a,
+		DB: conn,
+		dialect: sqliteDialect,
+	}
+}
+
+// nullID turns a zero id into NULL for optional foreign keys
+func nullID(id int) interface{} {
+	if id > 0 {
+		return id
+	}
+	return nil
+}
+
+// validateRatePlan checks the rules every implementation enforces on rate plans
+func validateRatePlan(p models.RatePlan) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: a rate plan needs a name", repository.ErrInvalid)
+	}
+
+	if p.EndDate.Before(p.StartDate) {
+		return fmt.Errorf("%w: the end date must not be before the start date", repository.ErrInvalid)
+	}
+
+	if p.NightlyRate < 0 {
+		return fmt.Errorf("%w: the nightly rate can not be negative", repository.ErrInvalid)
+	}
+
+	for _, m := range p.WeekdayModifiers {
+		if m <= -100 {
+			return fmt.Errorf("%w: a weekday modifier must be above -100%%", repository.ErrInvalid)
+		}
+	}
+
+	return nil
+}
+
+// encodeInts stores numbers as a comma separated list
+func encodeInts(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+// decodeInts reads a list written by encodeInts
+func decodeInts(s string) ([]int, error) {
+	var numbers []int
+
+	if strings.TrimSpace(s) == "" {
+		return numbers, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number list %q", s)
+		}
+		numbers = append(numbers, n)
+	}
+
+	return numbers, nil
+}
+
+// encodeModifiers stores weekday modifiers as a comma separated list, Sunday first
+func encodeModifiers(mods [7]int) string {
+	return encodeInts(mods[:])
+}
+
+// decodeModifiers reads weekday modifiers written by encodeModifiers
+func decodeModifiers(s string) ([7]int, error) {
+	var mods [7]int
+
+	numbers, err := decodeInts(s)
+	if err != nil || len(numbers) != len(mods) {
+		return mods, fmt.Errorf("invalid weekday modifiers %q", s)
+	}
+	copy(mods[:], numbers)
+
+	return mods, nil
+}
+
+// expectOneRow turns an update or delete that matched nothing into ErrNotFound
+func expectOneRow(result sql.Result, what string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", what, repository.ErrNotFound)
+	}
+	return nil
+}
+
+const ratePlanColumns = `
+		p.id, p.name, p.room_id, p.start_date, p.end_date, p.nightly_rate,
+		p.weekday_modifiers, p.priority, p.created_at, p.updated_at,
+		coalesce(r.room_name, '')`
+
+// scanRatePlan reads a row selected with ratePlanColumns
+func scanRatePlan(row interface{ Scan(...interface{}) error }) (models.RatePlan, error) {
+	var p models.RatePlan
+	var roomID sql.NullInt64
+	var modifiers string
+
+	err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&roomID,
+		&p.StartDate,
+		&p.EndDate,
+		&p.NightlyRate,
+		&modifiers,
+		&p.Priority,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Room.RoomName,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	p.RoomID = int(roomID.Int64)
+	p.Room.ID = p.RoomID
+
+	p.WeekdayModifiers, err = decodeModifiers(modifiers)
+	return p, err
+}
+
+// promoCodePattern is what a promo code may look like once normalized
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{1,32}$`)
+
+// normalizePromoCode makes promo codes case insensitive
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validatePromoCode checks the rules every implementation enforces on promo
+// codes; p.Code must already be normalized
+func validatePromoCode(p models.PromoCode) error {
+	if !promoCodePattern.MatchString(p.Code) {
+		return fmt.Errorf("%w: a promo code is 1 to 32 letters, digits, - or _", repository.ErrInvalid)
+	}
+
+	switch p.Kind {
+	case models.PromoPercent:
+		if p.Amount <= 0 || p.Amount > 100 {
+			return fmt.Errorf("%w: a percentage discount must be from 1 to 100", repository.ErrInvalid)
+		}
+	case models.PromoFixed:
+		if p.Amount <= 0 {
+			return fmt.Errorf("%w: a fixed discount must be above 0", repository.ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unknown promo code kind %q", repository.ErrInvalid, p.Kind)
+	}
+
+	if p.ValidTo.Before(p.ValidFrom) {
+		return fmt.Errorf("%w: the end date must not be before the start date", repository.ErrInvalid)
+	}
+
+	if p.MaxUses < 0 || p.MinNights < 0 {
+		return fmt.Errorf("%w: max uses and min nights can not be negative", repository.ErrInvalid)
+	}
+
+	for _, id := range p.RoomIDs {
+		if id <= 0 {
+			return fmt.Errorf("%w: invalid room id %d", repository.ErrInvalid, id)
+		}
+	}
+
+	return nil
+}
+
+// returnPromoCode counts one use less of the promo code a reservation was
+// booked with, inside the transaction that cancels it, so a code with few uses
+// isn't used up by bookings that didn't go ahead
+func returnPromoCode(ctx context.Context, tx *sql.Tx, reservationID int) error {
+	var code string
+	err := tx.QueryRowContext(ctx, `select promo_code from reservation where id = $1`, reservationID).Scan(&code)
+	if err != nil || code == "" {
+		return err
+	}
+
+	stmt := `update promo_codes set uses = uses - 1, updated_at = $1 where code = $2 and uses > 0`
+
+	_, err = tx.ExecContext(ctx, stmt, time.Now(), normalizePromoCode(code))
+	return err
+}
+
+// redeemPromoCode counts one more use of a promo code inside the booking
+// transaction. The check and the increment are one statement, so two bookings
+// can not both take the last use
+func redeemPromoCode(ctx context.Context, tx *sql.Tx, code string) error {
+	code = normalizePromoCode(code)
+
+	stmt := `update promo_codes set uses = uses + 1, updated_at = $1
+		where code = $2 and (max_uses = 0 or uses < max_uses)`
+
+	result, err := tx.ExecContext(ctx, stmt, time.Now(), code)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return nil
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `select count(id) from promo_codes where code = $1`, code).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: promo code %s does not exist", repository.ErrInvalid, code)
+	}
+
+	return fmt.Errorf("%w: promo code %s has been used up", repository.ErrConflict, code)
+}
+
+const promoCodeColumns = `
+		id, code, kind, amount, valid_from, valid_to, max_uses, uses, min_nights,
+		room_ids, created_at, updated_at`
+
+// scanPromoCode reads a row selected with promoCodeColumns
+func scanPromoCode(row interface{ Scan(...interface{}) error }) (models.PromoCode, error) {
+	var p models.PromoCode
+	var roomIDs string
+
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Kind,
+		&p.Amount,
+		&p.ValidFrom,
+		&p.ValidTo,
+		&p.MaxUses,
+		&p.Uses,
+		&p.MinNights,
+		&roomIDs,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	p.RoomIDs, err = decodeInts(roomIDs)
+	return p, err
+}
+
+// validateFeeRule checks the rules every implementation enforces on fee rules
+func validateFeeRule(f models.FeeRule) error {
+	if strings.TrimSpace(f.Name) == "" {
+		return fmt.Errorf("%w: a fee needs a name", repository.ErrInvalid)
+	}
+
+	switch f.Kind {
+	case models.FeePerStay, models.FeePerNight, models.FeePerGuest, models.FeePercent:
+	default:
+		return fmt.Errorf("%w: unknown fee kind %q", repository.ErrInvalid, f.Kind)
+	}
+
+	if f.Amount < 0 {
+		return fmt.Errorf("%w: a fee can not be negative", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+const feeRuleColumns = `
+		f.id, f.name, f.kind, f.amount, f.tax, f.room_id, f.created_at, f.updated_at,
+		coalesce(r.room_name, '')`
+
+// scanFeeRule reads a row selected with feeRuleColumns
+func scanFeeRule(row interface{ Scan(...interface{}) error }) (models.FeeRule, error) {
+	var f models.FeeRule
+	var roomID sql.NullInt64
+
+	err := row.Scan(
+		&f.ID,
+		&f.Name,
+		&f.Kind,
+		&f.Amount,
+		&f.Tax,
+		&roomID,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+		&f.Room.RoomName,
+	)
+	if err != nil {
+		return f, err
+	}
+
+	f.RoomID = int(roomID.Int64)
+	f.Room.ID = f.RoomID
+
+	return f, nil
+}
+
+// reservationStatus is the status a reservation is stored with, reservations
+// made without a payment are confirmed
+func reservationStatus(status string) string {
+	if status == "" {
+		return models.ReservationConfirmed
+	}
+	return status
+}
+
+// validateReservationStatus checks a status a reservation is moved to
+func validateReservationStatus(status string) error {
+	switch status {
+	case models.ReservationPendingPayment, models.ReservationConfirmed, models.ReservationCancelled:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown reservation status %q", repository.ErrInvalid, status)
+}
+
+// withSchedule fills in the payment schedule of a reservation made without
+// one: the whole total is paid at booking, as it was before deposits
+func withSchedule(res models.Reservation) models.Reservation {
+	if res.BalanceDueDate.IsZero() {
+		res.Deposit = res.Quote.Total
+		res.BalanceDueDate = res.StartDate
+	}
+	return res
+}
+
+// withGuests fills in the guests of a reservation made without them: one adult
+func withGuests(res models.Reservation) models.Reservation {
+	if res.Adults == 0 && res.Children == 0 {
+		res.Adults = 1
+	}
+	return res
+}
+
+// validateGuests checks the rules every implementation enforces on the
+// guests of a reservation
+func validateGuests(res models.Reservation) error {
+	if res.Adults < 1 || res.Children < 0 {
+		return fmt.Errorf("%w: a reservation needs at least one adult", repository.ErrInvalid)
+	}
+	return nil
+}
+
+// confirmationAlphabet leaves out letters and digits that are easy to mix up
+const confirmationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newConfirmationCode returns a random code a guest finds their reservation with
+func newConfirmationCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = confirmationAlphabet[int(b[i])%len(confirmationAlphabet)]
+	}
+	return string(b)
+}
+
+// encodePolicy stores the cancellation policy of a reservation as JSON, a
+// reservation without one stores nothing
+func encodePolicy(p models.CancellationPolicy) (string, error) {
+	if p.ID == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+const reservationColumns = `
+		r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+		r.room_id, r.price_quote, r.status, r.payment_intent_id, r.confirmation_code,
+		r.cancellation_policy, r.deposit, r.balance_due_date, r.balance_intent_id,
+		r.adults, r.children, r.payment_expires_at, r.created_at, r.updated_at,
+		rm.id, rm.room_name, rm.nightly_rate`
+
+// scanReservation reads a row selected with reservationColumns
+func scanReservation(row interface{ Scan(...interface{}) error }) (models.Reservation, error) {
+	var res models.Reservation
+	var quote, policy string
+	var paymentExpires sql.NullTime
+
+	err := row.Scan(
+		&res.ID,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.StartDate,
+		&res.EndDate,
+		&res.RoomID,
+		&quote,
+		&res.Status,
+		&res.PaymentIntentID,
+		&res.ConfirmationCode,
+		&policy,
+		&res.Deposit,
+		&res.BalanceDueDate,
+		&res.BalanceIntentID,
+		&res.Adults,
+		&res.Children,
+		&paymentExpires,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+		&res.Room.ID,
+		&res.Room.RoomName,
+		&res.Room.NightlyRate,
+	)
+	if err != nil {
+		return res, err
+	}
+
+	res.PaymentExpiresAt = paymentExpires.Time
+
+	if quote != "" {
+		if err := json.Unmarshal([]byte(quote), &res.Quote); err != nil {
+			return res, err
+		}
+	}
+
+	if policy != "" {
+		err = json.Unmarshal([]byte(policy), &res.Policy)
+	}
+
+	return res, err
+}
+
+// validateCancellationPolicy checks the rules every implementation enforces
+// on cancellation policies
+func validateCancellationPolicy(p models.CancellationPolicy) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: a cancellation policy needs a name", repository.ErrInvalid)
+	}
+
+	if p.DepositPercent < 0 || p.DepositPercent > 100 || p.PartialRefundPercent < 0 || p.PartialRefundPercent > 100 {
+		return fmt.Errorf("%w: percentages must be from 0 to 100", repository.ErrInvalid)
+	}
+
+	if p.BalanceDays < 0 || p.PartialRefundDays < 0 {
+		return fmt.Errorf("%w: days can not be negative", repository.ErrInvalid)
 	}
-}
\ No newline at end of file
+
+	if p.FullRefundDays < p.PartialRefundDays {
+		return fmt.Errorf("%w: the full refund can not end before the partial refund", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+const cancellationPolicyColumns = `
+		id, name, deposit_percent, balance_days, full_refund_days, partial_refund_days,
+		partial_refund_percent, created_at, updated_at`
+
+// scanCancellationPolicy reads a row selected with cancellationPolicyColumns
+func scanCancellationPolicy(row interface{ Scan(...interface{}) error }) (models.CancellationPolicy, error) {
+	var p models.CancellationPolicy
+
+	err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.DepositPercent,
+		&p.BalanceDays,
+		&p.FullRefundDays,
+		&p.PartialRefundDays,
+		&p.PartialRefundPercent,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+
+	return p, err
+}
+
+// validatePayment checks the rules every implementation enforces on ledger entries
+func validatePayment(p models.Payment) error {
+	switch p.Kind {
+	case models.PaymentDeposit, models.PaymentBalance, models.PaymentRefund, models.PaymentFailed:
+	default:
+		return fmt.Errorf("%w: unknown payment kind %q", repository.ErrInvalid, p.Kind)
+	}
+
+	if p.Amount < 0 {
+		return fmt.Errorf("%w: a payment can not be negative", repository.ErrInvalid)
+	}
+
+	if p.Reference == "" {
+		return fmt.Errorf("%w: a payment needs a reference", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+const paymentColumns = `
+		id, reservation_id, kind, amount, intent_id, reference, created_at`
+
+// scanPayment reads a row selected with paymentColumns
+func scanPayment(row interface{ Scan(...interface{}) error }) (models.Payment, error) {
+	var p models.Payment
+
+	err := row.Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.Kind,
+		&p.Amount,
+		&p.IntentID,
+		&p.Reference,
+		&p.CreatedAt,
+	)
+
+	return p, err
+}
+
+// validateRoom checks the rules every implementation enforces on rooms
+func validateRoom(room models.Room) error {
+	if strings.TrimSpace(room.RoomName) == "" {
+		return fmt.Errorf("%w: a room needs a name", repository.ErrInvalid)
+	}
+
+	if room.NightlyRate < 0 {
+		return fmt.Errorf("%w: the nightly rate can not be negative", repository.ErrInvalid)
+	}
+
+	if room.MaxOccupancy < 1 || room.Beds < 1 {
+		return fmt.Errorf("%w: a room sleeps at least one guest in at least one bed", repository.ErrInvalid)
+	}
+
+	if room.IncludedGuests < 1 {
+		return fmt.Errorf("%w: the nightly rate is for at least one guest", repository.ErrInvalid)
+	}
+
+	if room.ExtraGuestRate < 0 {
+		return fmt.Errorf("%w: the extra guest rate can not be negative", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+// maxInvoiceTries is how many numbers InsertInvoice tries when another
+// invoice takes the next number first
+const maxInvoiceTries = 5
+
+// validateInvoice checks the rules every implementation enforces on invoices
+func validateInvoice(inv models.Invoice) error {
+	if inv.ReservationID <= 0 {
+		return fmt.Errorf("%w: an invoice needs a reservation", repository.ErrInvalid)
+	}
+
+	if strings.TrimSpace(inv.Seller.Name) == "" {
+		return fmt.Errorf("%w: an invoice needs a seller", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+const invoiceColumns = `
+		id, number, reservation_id, seller, issued_at, created_at, updated_at`
+
+// scanInvoice reads a row selected with invoiceColumns
+func scanInvoice(row interface{ Scan(...interface{}) error }) (models.Invoice, error) {
+	var inv models.Invoice
+	var seller string
+
+	err := row.Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&seller,
+		&inv.IssuedAt,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	if err != nil {
+		return inv, err
+	}
+
+	err = json.Unmarshal([]byte(seller), &inv.Seller)
+	return inv, err
+}
+
+// currencyCodePattern matches ISO 4217 currency codes
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// normalizeCurrencyCode stores and looks up currency codes in upper case
+func normalizeCurrencyCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validateExchangeRate checks the rules every implementation enforces on exchange rates
+func validateExchangeRate(r models.ExchangeRate) error {
+	if !currencyCodePattern.MatchString(r.Code) {
+		return fmt.Errorf("%w: a currency code is 3 upper case letters, e.g. EUR", repository.ErrInvalid)
+	}
+
+	if utf8.RuneCountInString(r.Symbol) > 8 {
+		return fmt.Errorf("%w: a currency symbol is at most 8 characters", repository.ErrInvalid)
+	}
+
+	if r.Rate <= 0 {
+		return fmt.Errorf("%w: an exchange rate must be above 0", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+const exchangeRateColumns = `
+		id, code, symbol, rate, created_at, updated_at`
+
+// scanExchangeRate reads a row selected with exchangeRateColumns
+func scanExchangeRate(row interface{ Scan(...interface{}) error }) (models.ExchangeRate, error) {
+	var r models.ExchangeRate
+
+	err := row.Scan(
+		&r.ID,
+		&r.Code,
+		&r.Symbol,
+		&r.Rate,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+
+	return r, err
+}
+
+// validateStayRule checks the rules every implementation enforces on stay rules
+func validateStayRule(s models.StayRule) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("%w: a stay rule needs a name", repository.ErrInvalid)
+	}
+
+	if s.EndDate.Before(s.StartDate) {
+		return fmt.Errorf("%w: the end date must not be before the start date", repository.ErrInvalid)
+	}
+
+	if s.MinNights < 0 || s.MaxNights < 0 || s.MinLeadDays < 0 || s.MaxLeadDays < 0 {
+		return fmt.Errorf("%w: nights and days can not be negative", repository.ErrInvalid)
+	}
+
+	if s.MaxNights > 0 && s.MaxNights < s.MinNights {
+		return fmt.Errorf("%w: the maximum nights must not be below the minimum", repository.ErrInvalid)
+	}
+
+	if s.MaxLeadDays > 0 && s.MaxLeadDays < s.MinLeadDays {
+		return fmt.Errorf("%w: the booking horizon must not be below the lead time", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+// encodeWeekdays stores a set of weekdays as a comma separated list of their
+// numbers, Sunday being 0
+func encodeWeekdays(days [7]bool) string {
+	var numbers []int
+	for d, set := range days {
+		if set {
+			numbers = append(numbers, d)
+		}
+	}
+	return encodeInts(numbers)
+}
+
+// decodeWeekdays reads a set of weekdays written by encodeWeekdays
+func decodeWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+
+	numbers, err := decodeInts(s)
+	if err != nil {
+		return days, err
+	}
+
+	for _, d := range numbers {
+		if d < 0 || d >= len(days) {
+			return days, fmt.Errorf("invalid weekdays %q", s)
+		}
+		days[d] = true
+	}
+
+	return days, nil
+}
+
+const stayRuleColumns = `
+		s.id, s.name, s.room_id, s.start_date, s.end_date, s.min_nights, s.max_nights,
+		s.closed_to_arrival, s.closed_to_departure, s.min_lead_days, s.max_lead_days,
+		s.created_at, s.updated_at, coalesce(r.room_name, '')`
+
+// scanStayRule reads a row selected with stayRuleColumns
+func scanStayRule(row interface{ Scan(...interface{}) error }) (models.StayRule, error) {
+	var s models.StayRule
+	var roomID sql.NullInt64
+	var arrival, departure string
+
+	err := row.Scan(
+		&s.ID,
+		&s.Name,
+		&roomID,
+		&s.StartDate,
+		&s.EndDate,
+		&s.MinNights,
+		&s.MaxNights,
+		&arrival,
+		&departure,
+		&s.MinLeadDays,
+		&s.MaxLeadDays,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+		&s.Room.RoomName,
+	)
+	if err != nil {
+		return s, err
+	}
+
+	s.RoomID = int(roomID.Int64)
+	s.Room.ID = s.RoomID
+
+	if s.ClosedToArrival, err = decodeWeekdays(arrival); err != nil {
+		return s, err
+	}
+
+	s.ClosedToDeparture, err = decodeWeekdays(departure)
+	return s, err
+}
+
+// hashPattern matches the hex SHA-256 an API key is stored as
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// validateAPIKey checks the rules every implementation enforces on API keys
+func validateAPIKey(k models.APIKey) error {
+	if strings.TrimSpace(k.Name) == "" {
+		return fmt.Errorf("%w: an API key needs a name", repository.ErrInvalid)
+	}
+
+	if k.Prefix == "" || len(k.Prefix) > 16 || !hashPattern.MatchString(k.Hash) {
+		return fmt.Errorf("%w: an API key needs a prefix and the hash of the key", repository.ErrInvalid)
+	}
+
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("%w: an API key needs at least one scope", repository.ErrInvalid)
+	}
+	for _, scope := range k.Scopes {
+		known := false
+		for _, s := range models.APIScopes {
+			known = known || s == scope
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown API key scope %q", repository.ErrInvalid, scope)
+		}
+	}
+
+	if k.RateLimit <= 0 {
+		return fmt.Errorf("%w: an API key must be allowed at least one request a minute", repository.ErrInvalid)
+	}
+
+	if k.ExpiresOn.IsZero() {
+		return fmt.Errorf("%w: an API key needs an expiry date", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+const apiKeyColumns = `
+		id, name, prefix, key_hash, scopes, rate_limit, expires_on, created_at, updated_at`
+
+// scanAPIKey reads a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+
+	err := row.Scan(
+		&k.ID,
+		&k.Name,
+		&k.Prefix,
+		&k.Hash,
+		&scopes,
+		&k.RateLimit,
+		&k.ExpiresOn,
+		&k.CreatedAt,
+		&k.UpdatedAt,
+	)
+	if err != nil {
+		return k, err
+	}
+
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+
+	return k, nil
+}
+
+// blockRestriction is the restriction a block gets when it doesn't say
+const blockRestriction = 2
+
+// externalRestriction is the restriction of the blocks imported from calendar feeds
+const externalRestriction = 3
+
+// holdRestriction is the restriction of the short holds guests get on a room
+// while they fill in their reservation. Holds are not blocks
+const holdRestriction = 4
+
+// holdExpired reports if a restriction is a hold that ran out by now. Expired
+// holds no longer take their room, even before DeleteExpiredHolds removes them
+func holdExpired(r models.RoomRestriction, now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(dbTime(now))
+}
+
+// validateBlock checks the rules every implementation enforces on blocks,
+// the room restrictions that are not reservations
+func validateBlock(r models.RoomRestriction) error {
+	if r.ReservationID != 0 || r.RestrictionID == 1 {
+		return fmt.Errorf("%w: a block is not a reservation", repository.ErrInvalid)
+	}
+
+	if r.RestrictionID == externalRestriction {
+		return fmt.Errorf("%w: external blocks come from calendar feeds", repository.ErrInvalid)
+	}
+
+	if r.RestrictionID == holdRestriction {
+		return fmt.Errorf("%w: holds are placed by guests booking", repository.ErrInvalid)
+	}
+
+	if !r.EndDate.After(r.StartDate) {
+		return fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+// validateHold checks the rules every implementation enforces on holds
+func validateHold(h models.RoomRestriction) error {
+	if !h.EndDate.After(h.StartDate) {
+		return fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	if h.ExpiresAt.IsZero() {
+		return fmt.Errorf("%w: a hold needs an expiry", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+// releaseHold deletes a hold inside a transaction, so the booking or hold
+// replacing it can claim its nights. A hold that has expired and been deleted
+// already is no error
+func releaseHold(ctx context.Context, tx *sql.Tx, id int) error {
+	if id == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = $2`, id, holdRestriction)
+	return err
+}
+
+const blockColumns = `
+		rr.id, rr.start_date, rr.end_date, rr.room_id, rr.restriction_id, rr.created_at, rr.updated_at,
+		coalesce(rr.reservation_id, 0), coalesce(rr.ical_feed_id, 0), rr.external_uid, rr.expires_at,
+		coalesce(rm.room_name, ''), coalesce(re.restriction_name, '')`
+
+// scanBlock reads a row selected with blockColumns from room_restrictions
+// rr joined with rooms rm and restrictions re, a block or a reservation
+func scanBlock(row interface{ Scan(...interface{}) error }) (models.RoomRestriction, error) {
+	var r models.RoomRestriction
+	var expires sql.NullTime
+
+	err := row.Scan(
+		&r.ID,
+		&r.StartDate,
+		&r.EndDate,
+		&r.RoomID,
+		&r.RestrictionID,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&r.ReservationID,
+		&r.ICalFeedID,
+		&r.ExternalUID,
+		&expires,
+		&r.Room.RoomName,
+		&r.Restriction.RestrictionName,
+	)
+
+	r.ExpiresAt = expires.Time
+	r.Room.ID = r.RoomID
+	r.Restriction.ID = r.RestrictionID
+
+	return r, err
+}
+
+// validateWebhook checks the rules every implementation enforces on webhooks
+func validateWebhook(w models.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(w.URL) > 2048 {
+		return fmt.Errorf("%w: a webhook needs an http or https URL", repository.ErrInvalid)
+	}
+
+	if w.Secret == "" || len(w.Secret) > 64 {
+		return fmt.Errorf("%w: a webhook needs a secret of up to 64 characters", repository.ErrInvalid)
+	}
+
+	if len(w.Events) == 0 {
+		return fmt.Errorf("%w: a webhook needs at least one event", repository.ErrInvalid)
+	}
+	for _, event := range w.Events {
+		known := false
+		for _, e := range models.WebhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown webhook event %q", repository.ErrInvalid, event)
+		}
+	}
+
+	return nil
+}
+
+const webhookColumns = `
+		id, url, secret, events, active, created_at, updated_at`
+
+// scanWebhook reads a row selected with webhookColumns
+func scanWebhook(row interface{ Scan(...interface{}) error }) (models.Webhook, error) {
+	var w models.Webhook
+	var events string
+
+	err := row.Scan(
+		&w.ID,
+		&w.URL,
+		&w.Secret,
+		&events,
+		&w.Active,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	if err != nil {
+		return w, err
+	}
+
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+
+	return w, nil
+}
+
+// validateWebhookDelivery checks the rules every implementation enforces on
+// webhook deliveries
+func validateWebhookDelivery(d models.WebhookDelivery) error {
+	switch d.Status {
+	case models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		return fmt.Errorf("%w: unknown delivery status %q", repository.ErrInvalid, d.Status)
+	}
+
+	if d.Event == "" || d.Payload == "" {
+		return fmt.Errorf("%w: a delivery needs an event and a payload", repository.ErrInvalid)
+	}
+
+	if d.Attempts < 0 {
+		return fmt.Errorf("%w: a delivery can't have been tried %d times", repository.ErrInvalid, d.Attempts)
+	}
+
+	return nil
+}
+
+// dbTime is how times are stored: in UTC, to the second, so they compare the
+// same way in every database
+func dbTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// nullTime stores a zero time as null
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return dbTime(t)
+}
+
+// truncateError keeps an error short enough for the delivery log
+func truncateError(s string) string {
+	if len(s) <= 1024 {
+		return s
+	}
+
+	s = s[:1024]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+const deliveryColumns = `
+		d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_code, d.last_error,
+		d.next_attempt_at, d.delivered_at, d.created_at, d.updated_at, w.url, w.secret, w.active`
+
+// scanWebhookDelivery reads a row selected with deliveryColumns from
+// webhook_deliveries d joined with webhooks w
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var delivered sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.ResponseCode,
+		&d.LastError,
+		&d.NextAttemptAt,
+		&delivered,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Webhook.URL,
+		&d.Webhook.Secret,
+		&d.Webhook.Active,
+	)
+
+	d.DeliveredAt = delivered.Time
+	d.Webhook.ID = d.WebhookID
+
+	return d, err
+}
+
+// validateICalFeed checks the rules every implementation enforces on calendar feeds
+func validateICalFeed(f models.ICalFeed) error {
+	u, err := url.Parse(f.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal") || u.Host == "" || len(f.URL) > 2048 {
+		return fmt.Errorf("%w: a calendar feed needs an http, https or webcal URL", repository.ErrInvalid)
+	}
+
+	if len(f.Name) > 255 {
+		return fmt.Errorf("%w: the name of a calendar feed can't be longer than 255 characters", repository.ErrInvalid)
+	}
+
+	return nil
+}
+
+// externalEvents checks the events a feed is synced with and keys them by
+// UID. An event whose UID was already seen is left out, the first one counts
+func externalEvents(events []models.RoomRestriction) ([]models.RoomRestriction, map[string]models.RoomRestriction, error) {
+	var unique []models.RoomRestriction
+	byUID := make(map[string]models.RoomRestriction)
+
+	for _, e := range events {
+		if e.ExternalUID == "" || len(e.ExternalUID) > 255 {
+			return nil, nil, fmt.Errorf("%w: an external block needs a UID of up to 255 characters", repository.ErrInvalid)
+		}
+		if !e.EndDate.After(e.StartDate) {
+			return nil, nil, fmt.Errorf("%w: event %s ends before it starts", repository.ErrInvalid, e.ExternalUID)
+		}
+		if _, ok := byUID[e.ExternalUID]; ok {
+			continue
+		}
+		byUID[e.ExternalUID] = e
+		unique = append(unique, e)
+	}
+
+	return unique, byUID, nil
+}
+
+// sameNights reports if two restrictions cover the same nights
+func sameNights(a, b models.RoomRestriction) bool {
+	layout := "2006-01-02"
+	return a.StartDate.Format(layout) == b.StartDate.Format(layout) && a.EndDate.Format(layout) == b.EndDate.Format(layout)
+}
+
+// feedBlocks selects the blocks matching where inside a transaction, joined
+// as blockColumns needs
+func feedBlocks(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) ([]models.RoomRestriction, error) {
+	var blocks []models.RoomRestriction
+
+	query := `select` + blockColumns + `
+	from
+		room_restrictions rr
+		left join rooms rm on (rr.room_id = rm.id)
+		left join restrictions re on (rr.restriction_id = re.id)
+	where
+		` + where + `
+	order by
+		rr.start_date, rr.id`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return blocks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+const icalFeedColumns = `
+		f.id, f.room_id, f.name, f.url, f.last_synced_at, f.last_error, f.created_at, f.updated_at,
+		coalesce(rm.room_name, '')`
+
+// scanICalFeed reads a row selected with icalFeedColumns from ical_feeds f
+// joined with rooms rm
+func scanICalFeed(row interface{ Scan(...interface{}) error }) (models.ICalFeed, error) {
+	var f models.ICalFeed
+	var synced sql.NullTime
+
+	err := row.Scan(
+		&f.ID,
+		&f.RoomID,
+		&f.Name,
+		&f.URL,
+		&synced,
+		&f.LastError,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+		&f.Room.RoomName,
+	)
+
+	f.LastSyncedAt = synced.Time
+	f.Room.ID = f.RoomID
+
+	return f, err
+}
+
+// validateWaitlistEntry checks the rules every implementation enforces on
+// waitlist entries
+func validateWaitlistEntry(e models.WaitlistEntry) error {
+	if !e.EndDate.After(e.StartDate) {
+		return fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+	if e.Adults < 1 || e.Children < 0 {
+		return fmt.Errorf("%w: a waitlist entry needs at least one adult", repository.ErrInvalid)
+	}
+	if strings.TrimSpace(e.Email) == "" {
+		return fmt.Errorf("%w: a waitlist entry needs an email address", repository.ErrInvalid)
+	}
+	return nil
+}
+
+// newWaitlistToken returns the random secret of a waitlist entry's link
+func newWaitlistToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+const waitlistColumns = `
+		w.id, w.room_id, w.start_date, w.end_date, w.adults, w.children, w.first_name, w.last_name,
+		w.email, w.token, w.status, w.notified_at, w.hold_expires_at, coalesce(w.hold_id, 0), w.created_at,
+		w.updated_at, coalesce(rm.room_name, '')`
+
+// scanWaitlistEntry reads a row selected with waitlistColumns from
+// waitlist_entries w joined with rooms rm
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+	var notified, expires sql.NullTime
+
+	err := row.Scan(
+		&e.ID,
+		&e.RoomID,
+		&e.StartDate,
+		&e.EndDate,
+		&e.Adults,
+		&e.Children,
+		&e.FirstName,
+		&e.LastName,
+		&e.Email,
+		&e.Token,
+		&e.Status,
+		&notified,
+		&expires,
+		&e.HoldID,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.Room.RoomName,
+	)
+
+	e.NotifiedAt = notified.Time
+	e.HoldExpiresAt = expires.Time
+	e.Room.ID = e.RoomID
+
+	return e, err
+}
@@ -0,0 +1,464 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/ical"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// FaultFunc decides if a call to a MemoryRepo method fails. It gets the
+// arguments of the call and returns the error to give back, or nil
+type FaultFunc func(args ...interface{}) error
+
+// MemoryRepo is a repository.DatabaseRepo that keeps everything in maps. It
+// follows the same booking rules as the database repositories, so tests and
+// demos see real availability, and lets tests inject failures
+type MemoryRepo struct {
+	App *config.AppConfig
+
+	mu                sync.Mutex
+	rooms             map[int]models.Room
+	restrictions      map[int]models.Restriction
+	reservations      map[int]models.Reservation
+	roomRestrictions  map[int]models.RoomRestriction
+	users             map[int]models.User
+	ratePlans         map[int]models.RatePlan
+	promoCodes        map[int]models.PromoCode
+	feeRules          map[int]models.FeeRule
+	policies          map[int]models.CancellationPolicy
+	payments          map[int]models.Payment
+	invoices          map[int]models.Invoice
+	exchangeRates     map[int]models.ExchangeRate
+	stayRules         map[int]models.StayRule
+	apiKeys           map[int]models.APIKey
+	webhooks          map[int]models.Webhook
+	webhookDeliveries map[int]models.WebhookDelivery
+	icalFeeds         map[int]models.ICalFeed
+	waitlist          map[int]models.WaitlistEntry
+	lastID            int
+	faults            map[string]FaultFunc
+}
+
+// NewMemoryRepo creates an in-memory repository seeded with the same rooms
+// and restriction types as the database migrations
+func NewMemoryRepo(a *config.AppConfig) *MemoryRepo {
+	m := &MemoryRepo{
+		App:               a,
+		rooms:             make(map[int]models.Room),
+		restrictions:      make(map[int]models.Restriction),
+		reservations:      make(map[int]models.Reservation),
+		roomRestrictions:  make(map[int]models.RoomRestriction),
+		users:             make(map[int]models.User),
+		ratePlans:         make(map[int]models.RatePlan),
+		promoCodes:        make(map[int]models.PromoCode),
+		feeRules:          make(map[int]models.FeeRule),
+		invoices:          make(map[int]models.Invoice),
+		exchangeRates:     make(map[int]models.ExchangeRate),
+		stayRules:         make(map[int]models.StayRule),
+		apiKeys:           make(map[int]models.APIKey),
+		webhooks:          make(map[int]models.Webhook),
+		webhookDeliveries: make(map[int]models.WebhookDelivery),
+		icalFeeds:         make(map[int]models.ICalFeed),
+		waitlist:          make(map[int]models.WaitlistEntry),
+		policies:          make(map[int]models.CancellationPolicy),
+		payments:          make(map[int]models.Payment),
+		faults:            make(map[string]FaultFunc),
+	}
+
+	m.AddRoom(models.Room{ID: 1, RoomName: "General's Quarters", NightlyRate: 9900})
+	m.AddRoom(models.Room{ID: 2, RoomName: "Major's Suite", NightlyRate: 12900, MaxOccupancy: 4, Beds: 2})
+
+	now := time.Now()
+	m.restrictions[1] = models.Restriction{ID: 1, RestrictionName: "Reservation", CreatedAt: now, UpdatedAt: now}
+	m.restrictions[2] = models.Restriction{ID: 2, RestrictionName: "Owner Block", CreatedAt: now, UpdatedAt: now}
+	m.restrictions[3] = models.Restriction{ID: 3, RestrictionName: "External", CreatedAt: now, UpdatedAt: now}
+	m.restrictions[4] = models.Restriction{ID: 4, RestrictionName: "Hold", CreatedAt: now, UpdatedAt: now}
+
+	for _, p := range []models.CancellationPolicy{
+		{ID: 1, Name: "Flexible", DepositPercent: 20, BalanceDays: 3, FullRefundDays: 1},
+		{ID: 2, Name: "Moderate", DepositPercent: 30, BalanceDays: 14, FullRefundDays: 5, PartialRefundDays: 1, PartialRefundPercent: 50},
+		{ID: 3, Name: "Strict", DepositPercent: 50, BalanceDays: 30, FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50},
+	} {
+		p.CreatedAt = now
+		p.UpdatedAt = now
+		m.policies[p.ID] = p
+	}
+
+	return m
+}
+
+// AddRoom adds or replaces a room; rooms get the moderate cancellation policy
+// unless they have another one, as in the database
+func (m *MemoryRepo) AddRoom(room models.Room) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if room.CancellationPolicyID == 0 {
+		room.CancellationPolicyID = 2
+	}
+
+	if room.MaxOccupancy == 0 {
+		room.MaxOccupancy = 2
+	}
+
+	if room.Beds == 0 {
+		room.Beds = 1
+	}
+
+	if room.IncludedGuests == 0 {
+		room.IncludedGuests = 2
+	}
+
+	if room.ICalToken == "" {
+		room.ICalToken, _ = ical.GenerateToken()
+	}
+
+	if room.CreatedAt.IsZero() {
+		room.CreatedAt = time.Now()
+		room.UpdatedAt = room.CreatedAt
+	}
+	m.rooms[room.ID] = room
+}
+
+// SetFault makes every call to the named method consult fn before doing any work
+func (m *MemoryRepo) SetFault(method string, fn FaultFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.faults[method] = fn
+}
+
+// ClearFaults removes all injected failures
+func (m *MemoryRepo) ClearFaults() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.faults = make(map[string]FaultFunc)
+}
+
+// fault returns the injected error for a method call, if any; callers hold the lock
+func (m *MemoryRepo) fault(method string, args ...interface{}) error {
+	fn, ok := m.faults[method]
+	if !ok {
+		return nil
+	}
+	return fn(args...)
+}
+
+// withCode gives a reservation a confirmation code unless it has one;
+// callers hold the lock
+func (m *MemoryRepo) withCode(res models.Reservation) models.Reservation {
+	if res.ConfirmationCode == "" {
+		res.ConfirmationCode = newConfirmationCode()
+	}
+	return res
+}
+
+// reservationWithRoom fills in the room of a reservation the way the sql join
+// does; callers hold the lock
+func (m *MemoryRepo) reservationWithRoom(res models.Reservation) models.Reservation {
+	room := m.rooms[res.RoomID]
+	res.Room = models.Room{ID: room.ID, RoomName: room.RoomName, NightlyRate: room.NightlyRate}
+	return res
+}
+
+// nextID hands out ids the way a database sequence does; callers hold the lock
+func (m *MemoryRepo) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+// overlaps reports if the stay from start to end collides with a restriction
+func overlaps(start, end time.Time, r models.RoomRestriction) bool {
+	return start.Before(r.EndDate) && end.After(r.StartDate)
+}
+
+// checkRoomFree makes sure the dates are valid and the room exists and is
+// free; a hold that expired by now doesn't take the room. Callers hold the lock
+func (m *MemoryRepo) checkRoomFree(roomID int, start, end, now time.Time) error {
+	if !end.After(start) {
+		return fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, roomID)
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == roomID && overlaps(start, end, r) && !holdExpired(r, now) {
+			return fmt.Errorf("%w: room %d is not available for these dates", repository.ErrConflict, roomID)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryRepo) AllUsers() bool {
+	return true
+}
+
+// InsertReservation stores a reservation and returns its new id
+func (m *MemoryRepo) InsertReservation(res models.Reservation, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertReservation", res); err != nil {
+		return 0, err
+	}
+
+	res = withGuests(res)
+	if err := validateGuests(res); err != nil {
+		return 0, err
+	}
+
+	if err := m.checkRoomFree(res.RoomID, res.StartDate, res.EndDate, now); err != nil {
+		return 0, err
+	}
+
+	res = m.withCode(withSchedule(res))
+	res.ID = m.nextID()
+	res.Status = reservationStatus(res.Status)
+	if !res.PaymentExpiresAt.IsZero() {
+		res.PaymentExpiresAt = dbTime(res.PaymentExpiresAt)
+	}
+	res.CreatedAt = time.Now()
+	res.UpdatedAt = res.CreatedAt
+	m.reservations[res.ID] = res
+
+	return res.ID, nil
+}
+
+// CreateBooking stores a reservation, blocks its room for the stay and
+// redeems its promo code, all or nothing. The guest's hold on the room, if
+// any, is taken over. Faults set for InsertReservation and
+// InsertRoomRestriction fail the matching step
+func (m *MemoryRepo) CreateBooking(res models.Reservation, now time.Time) (id int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, method := range []string{"CreateBooking", "InsertReservation", "InsertRoomRestriction"} {
+		if err := m.fault(method, res); err != nil {
+			return 0, err
+		}
+	}
+
+	res = withGuests(res)
+	if err := validateGuests(res); err != nil {
+		return 0, err
+	}
+
+	// the hold is given back if the booking fails
+	if hold, ok := m.roomRestrictions[res.HoldID]; ok && hold.RestrictionID == holdRestriction {
+		delete(m.roomRestrictions, hold.ID)
+		defer func() {
+			if err != nil {
+				m.roomRestrictions[hold.ID] = hold
+			}
+		}()
+	}
+
+	if err := m.checkRoomFree(res.RoomID, res.StartDate, res.EndDate, now); err != nil {
+		return 0, err
+	}
+
+	var promo *models.PromoCode
+	if res.Quote.PromoCode != "" {
+		code := normalizePromoCode(res.Quote.PromoCode)
+		for id := range m.promoCodes {
+			if m.promoCodes[id].Code == code {
+				p := m.promoCodes[id]
+				promo = &p
+			}
+		}
+		if promo == nil {
+			return 0, fmt.Errorf("%w: promo code %s does not exist", repository.ErrInvalid, code)
+		}
+		if promo.MaxUses > 0 && promo.Uses >= promo.MaxUses {
+			return 0, fmt.Errorf("%w: promo code %s has been used up", repository.ErrConflict, code)
+		}
+	}
+
+	created := time.Now()
+
+	res = m.withCode(withSchedule(res))
+	res.ID = m.nextID()
+	res.Status = reservationStatus(res.Status)
+	if !res.PaymentExpiresAt.IsZero() {
+		res.PaymentExpiresAt = dbTime(res.PaymentExpiresAt)
+	}
+	res.HoldID = 0
+	res.CreatedAt = created
+	res.UpdatedAt = created
+	m.reservations[res.ID] = res
+
+	r := models.RoomRestriction{
+		ID:            m.nextID(),
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: res.ID,
+		RestrictionID: 1,
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	m.roomRestrictions[r.ID] = r
+
+	if promo != nil {
+		promo.Uses++
+		promo.UpdatedAt = created
+		m.promoCodes[promo.ID] = *promo
+	}
+
+	return res.ID, nil
+}
+
+// InsertRoomRestriction stores a room restriction
+func (m *MemoryRepo) InsertRoomRestriction(r models.RoomRestriction, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertRoomRestriction", r); err != nil {
+		return err
+	}
+
+	if err := m.checkRoomFree(r.RoomID, r.StartDate, r.EndDate, now); err != nil {
+		return err
+	}
+
+	if _, ok := m.restrictions[r.RestrictionID]; !ok {
+		return fmt.Errorf("%w: restriction %d does not exist", repository.ErrInvalid, r.RestrictionID)
+	}
+
+	if r.ReservationID > 0 {
+		if _, ok := m.reservations[r.ReservationID]; !ok {
+			return fmt.Errorf("%w: reservation %d does not exist", repository.ErrInvalid, r.ReservationID)
+		}
+	}
+
+	r.ID = m.nextID()
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	m.roomRestrictions[r.ID] = r
+
+	return nil
+}
+
+// SerachAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
+func (m *MemoryRepo) SerachAvailabilityByDatesByRoomID(start, end time.Time, roomID int, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("SerachAvailabilityByDatesByRoomID", start, end, roomID); err != nil {
+		return false, err
+	}
+
+	if !end.After(start) {
+		return false, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == roomID && overlaps(start, end, r) && !holdExpired(r, now) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
+// that sleep at least guests people
+func (m *MemoryRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int, now time.Time) ([]models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+
+	if err := m.fault("SearchAvailabilityForAllRooms", start, end, guests); err != nil {
+		return rooms, err
+	}
+
+	if !end.After(start) {
+		return rooms, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	taken := make(map[int]bool)
+	for _, r := range m.roomRestrictions {
+		if overlaps(start, end, r) && !holdExpired(r, now) {
+			taken[r.RoomID] = true
+		}
+	}
+
+	for id, room := range m.rooms {
+		if !taken[id] && room.MaxOccupancy >= guests {
+			rooms = append(rooms, models.Room{ID: room.ID, RoomName: room.RoomName, NightlyRate: room.NightlyRate, MaxOccupancy: room.MaxOccupancy, Beds: room.Beds})
+		}
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].ID < rooms[j].ID
+	})
+
+	return rooms, nil
+}
+
+// GetRoomByID gets a room by id
+func (m *MemoryRepo) GetRoomByID(id int) (models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetRoomByID", id); err != nil {
+		return models.Room{}, err
+	}
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return models.Room{}, fmt.Errorf("room %d: %w", id, repository.ErrNotFound)
+	}
+
+	return room, nil
+}
+
+// AllRooms returns every room, ordered by id
+func (m *MemoryRepo) AllRooms() ([]models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+
+	if err := m.fault("AllRooms"); err != nil {
+		return rooms, err
+	}
+
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].ID < rooms[j].ID
+	})
+
+	return rooms, nil
+}
+
+// GetReservationByID gets a reservation with its room by id
+func (m *MemoryRepo) GetReservationByID(id int) (models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetReservationByID", id); err != nil {
+		return models.Reservation{}, err
+	}
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return models.Reservation{}, fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.reservationWithRoom(res), nil
+}
@@ -0,0 +1,144 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllAPIKeys returns every API key, ordered by name
+func (m *MemoryRepo) AllAPIKeys() ([]models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllAPIKeys"); err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	for _, k := range m.apiKeys {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// GetAPIKeyByID gets an API key by id
+func (m *MemoryRepo) GetAPIKeyByID(id int) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetAPIKeyByID", id); err != nil {
+		return models.APIKey{}, err
+	}
+
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return models.APIKey{}, fmt.Errorf("API key %d: %w", id, repository.ErrNotFound)
+	}
+
+	return k, nil
+}
+
+// GetAPIKeyByPrefix gets the API key a request is made with by the prefix of the key
+func (m *MemoryRepo) GetAPIKeyByPrefix(prefix string) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetAPIKeyByPrefix", prefix); err != nil {
+		return models.APIKey{}, err
+	}
+
+	for _, k := range m.apiKeys {
+		if k.Prefix == prefix {
+			return k, nil
+		}
+	}
+
+	return models.APIKey{}, fmt.Errorf("API key %s: %w", prefix, repository.ErrNotFound)
+}
+
+// InsertAPIKey adds an API key and returns its new id; a prefix another key
+// has gives ErrConflict
+func (m *MemoryRepo) InsertAPIKey(k models.APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertAPIKey", k); err != nil {
+		return 0, err
+	}
+
+	if err := validateAPIKey(k); err != nil {
+		return 0, err
+	}
+
+	for _, existing := range m.apiKeys {
+		if existing.Prefix == k.Prefix {
+			return 0, fmt.Errorf("%w: another API key starts with %s", repository.ErrConflict, k.Prefix)
+		}
+	}
+
+	k.ID = m.nextID()
+	k.Scopes = append([]string(nil), k.Scopes...)
+	k.CreatedAt = time.Now()
+	k.UpdatedAt = k.CreatedAt
+	m.apiKeys[k.ID] = k
+
+	return k.ID, nil
+}
+
+// UpdateAPIKey saves changes to the name, scopes, rate limit and expiry of
+// an API key; the key itself never changes
+func (m *MemoryRepo) UpdateAPIKey(k models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateAPIKey", k); err != nil {
+		return err
+	}
+
+	existing, ok := m.apiKeys[k.ID]
+	if !ok {
+		return fmt.Errorf("API key %d: %w", k.ID, repository.ErrNotFound)
+	}
+
+	k.Prefix, k.Hash = existing.Prefix, existing.Hash
+	if err := validateAPIKey(k); err != nil {
+		return err
+	}
+
+	k.Scopes = append([]string(nil), k.Scopes...)
+	k.CreatedAt = existing.CreatedAt
+	k.UpdatedAt = time.Now()
+	m.apiKeys[k.ID] = k
+
+	return nil
+}
+
+// DeleteAPIKey removes an API key, requests made with it are refused from then on
+func (m *MemoryRepo) DeleteAPIKey(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteAPIKey", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.apiKeys[id]; !ok {
+		return fmt.Errorf("API key %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.apiKeys, id)
+
+	return nil
+}
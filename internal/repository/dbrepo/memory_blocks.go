@@ -0,0 +1,115 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllBlocks returns every block, the room restrictions that are not
+// reservations or holds, ordered by start date
+func (m *MemoryRepo) AllBlocks() ([]models.RoomRestriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllBlocks"); err != nil {
+		return nil, err
+	}
+
+	var blocks []models.RoomRestriction
+	for _, r := range m.roomRestrictions {
+		if r.ReservationID == 0 && r.RestrictionID != holdRestriction {
+			blocks = append(blocks, m.withBlockNames(r))
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		if !blocks[i].StartDate.Equal(blocks[j].StartDate) {
+			return blocks[i].StartDate.Before(blocks[j].StartDate)
+		}
+		return blocks[i].ID < blocks[j].ID
+	})
+
+	return blocks, nil
+}
+
+// GetBlockByID gets a block by id
+func (m *MemoryRepo) GetBlockByID(id int) (models.RoomRestriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetBlockByID", id); err != nil {
+		return models.RoomRestriction{}, err
+	}
+
+	r, ok := m.roomRestrictions[id]
+	if !ok || r.ReservationID != 0 || r.RestrictionID == holdRestriction {
+		return models.RoomRestriction{}, fmt.Errorf("block %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.withBlockNames(r), nil
+}
+
+// InsertBlock closes a room for a range of nights and returns the id of the
+// block. Without a restriction id it is an owner block; a room taken on any
+// of the nights gives ErrConflict
+func (m *MemoryRepo) InsertBlock(r models.RoomRestriction, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertBlock", r); err != nil {
+		return 0, err
+	}
+
+	if r.RestrictionID == 0 {
+		r.RestrictionID = blockRestriction
+	}
+	if err := validateBlock(r); err != nil {
+		return 0, err
+	}
+
+	if err := m.checkRoomFree(r.RoomID, r.StartDate, r.EndDate, now); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.restrictions[r.RestrictionID]; !ok {
+		return 0, fmt.Errorf("%w: restriction %d does not exist", repository.ErrInvalid, r.RestrictionID)
+	}
+
+	r.ID = m.nextID()
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	m.roomRestrictions[r.ID] = r
+
+	return r.ID, nil
+}
+
+// DeleteBlock opens the nights of a block again; reservations are cancelled, not deleted
+func (m *MemoryRepo) DeleteBlock(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteBlock", id); err != nil {
+		return err
+	}
+
+	r, ok := m.roomRestrictions[id]
+	if !ok || r.ReservationID != 0 || r.RestrictionID == holdRestriction {
+		return fmt.Errorf("block %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.roomRestrictions, id)
+
+	return nil
+}
+
+// withBlockNames fills in the room and restriction of a block, as the
+// database repositories join them
+func (m *MemoryRepo) withBlockNames(r models.RoomRestriction) models.RoomRestriction {
+	r.Room = models.Room{ID: r.RoomID, RoomName: m.rooms[r.RoomID].RoomName}
+	r.Restriction = m.restrictions[r.RestrictionID]
+	return r
+}
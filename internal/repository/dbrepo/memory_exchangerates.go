@@ -0,0 +1,156 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// checkExchangeRate validates an exchange rate and checks no other rate has
+// its currency, as the unique index does; callers hold the lock
+func (m *MemoryRepo) checkExchangeRate(r models.ExchangeRate) error {
+	if err := validateExchangeRate(r); err != nil {
+		return err
+	}
+
+	for _, existing := range m.exchangeRates {
+		if existing.Code == r.Code && existing.ID != r.ID {
+			return fmt.Errorf("%w: currency %s already has an exchange rate", repository.ErrConflict, r.Code)
+		}
+	}
+
+	return nil
+}
+
+// AllExchangeRates returns every exchange rate, ordered by currency code
+func (m *MemoryRepo) AllExchangeRates() ([]models.ExchangeRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllExchangeRates"); err != nil {
+		return nil, err
+	}
+
+	var rates []models.ExchangeRate
+	for _, r := range m.exchangeRates {
+		rates = append(rates, r)
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Code < rates[j].Code
+	})
+
+	return rates, nil
+}
+
+// GetExchangeRateByID gets an exchange rate by id
+func (m *MemoryRepo) GetExchangeRateByID(id int) (models.ExchangeRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetExchangeRateByID", id); err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	r, ok := m.exchangeRates[id]
+	if !ok {
+		return models.ExchangeRate{}, fmt.Errorf("exchange rate %d: %w", id, repository.ErrNotFound)
+	}
+
+	return r, nil
+}
+
+// GetExchangeRateByCode gets the exchange rate of a currency, in any case
+func (m *MemoryRepo) GetExchangeRateByCode(code string) (models.ExchangeRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetExchangeRateByCode", code); err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	code = normalizeCurrencyCode(code)
+
+	for _, r := range m.exchangeRates {
+		if r.Code == code {
+			return r, nil
+		}
+	}
+
+	return models.ExchangeRate{}, fmt.Errorf("exchange rate %s: %w", code, repository.ErrNotFound)
+}
+
+// InsertExchangeRate adds an exchange rate and returns its new id; a currency
+// that already has one gives ErrConflict
+func (m *MemoryRepo) InsertExchangeRate(r models.ExchangeRate) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertExchangeRate", r); err != nil {
+		return 0, err
+	}
+
+	r.ID = 0
+	r.Code = normalizeCurrencyCode(r.Code)
+	if err := m.checkExchangeRate(r); err != nil {
+		return 0, err
+	}
+
+	r.ID = m.nextID()
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	m.exchangeRates[r.ID] = r
+
+	return r.ID, nil
+}
+
+// UpdateExchangeRate saves changes to an existing exchange rate
+func (m *MemoryRepo) UpdateExchangeRate(r models.ExchangeRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateExchangeRate", r); err != nil {
+		return err
+	}
+
+	r.Code = normalizeCurrencyCode(r.Code)
+	if err := validateExchangeRate(r); err != nil {
+		return err
+	}
+
+	existing, ok := m.exchangeRates[r.ID]
+	if !ok {
+		return fmt.Errorf("exchange rate %d: %w", r.ID, repository.ErrNotFound)
+	}
+
+	if err := m.checkExchangeRate(r); err != nil {
+		return err
+	}
+
+	r.CreatedAt = existing.CreatedAt
+	r.UpdatedAt = time.Now()
+	m.exchangeRates[r.ID] = r
+
+	return nil
+}
+
+// DeleteExchangeRate removes an exchange rate
+func (m *MemoryRepo) DeleteExchangeRate(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteExchangeRate", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.exchangeRates[id]; !ok {
+		return fmt.Errorf("exchange rate %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.exchangeRates, id)
+
+	return nil
+}
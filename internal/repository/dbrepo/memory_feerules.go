@@ -0,0 +1,161 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// feeRuleWithRoom fills in the room of a fee rule the way the sql join does; callers hold the lock
+func (m *MemoryRepo) feeRuleWithRoom(f models.FeeRule) models.FeeRule {
+	f.Room = models.Room{ID: f.RoomID}
+	if room, ok := m.rooms[f.RoomID]; ok {
+		f.Room.RoomName = room.RoomName
+	}
+	return f
+}
+
+// checkFeeRule validates a fee rule and its room; callers hold the lock
+func (m *MemoryRepo) checkFeeRule(f models.FeeRule) error {
+	if err := validateFeeRule(f); err != nil {
+		return err
+	}
+
+	if f.RoomID != 0 {
+		if _, ok := m.rooms[f.RoomID]; !ok {
+			return fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, f.RoomID)
+		}
+	}
+
+	return nil
+}
+
+// sortedFeeRules returns the fee rules that pass keep, ordered by id; callers hold the lock
+func (m *MemoryRepo) sortedFeeRules(keep func(f models.FeeRule) bool) []models.FeeRule {
+	var rules []models.FeeRule
+
+	for _, f := range m.feeRules {
+		if keep(f) {
+			rules = append(rules, m.feeRuleWithRoom(f))
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+
+	return rules
+}
+
+// AllFeeRules returns every fee rule, in the order they are added to a quote
+func (m *MemoryRepo) AllFeeRules() ([]models.FeeRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllFeeRules"); err != nil {
+		return nil, err
+	}
+
+	return m.sortedFeeRules(func(f models.FeeRule) bool { return true }), nil
+}
+
+// GetFeeRuleByID gets a fee rule by id
+func (m *MemoryRepo) GetFeeRuleByID(id int) (models.FeeRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetFeeRuleByID", id); err != nil {
+		return models.FeeRule{}, err
+	}
+
+	f, ok := m.feeRules[id]
+	if !ok {
+		return models.FeeRule{}, fmt.Errorf("fee rule %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.feeRuleWithRoom(f), nil
+}
+
+// InsertFeeRule adds a fee rule and returns its new id
+func (m *MemoryRepo) InsertFeeRule(f models.FeeRule) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertFeeRule", f); err != nil {
+		return 0, err
+	}
+
+	if err := m.checkFeeRule(f); err != nil {
+		return 0, err
+	}
+
+	f.ID = m.nextID()
+	f.CreatedAt = time.Now()
+	f.UpdatedAt = f.CreatedAt
+	f.Room = models.Room{}
+	m.feeRules[f.ID] = f
+
+	return f.ID, nil
+}
+
+// UpdateFeeRule saves changes to an existing fee rule
+func (m *MemoryRepo) UpdateFeeRule(f models.FeeRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateFeeRule", f); err != nil {
+		return err
+	}
+
+	if err := m.checkFeeRule(f); err != nil {
+		return err
+	}
+
+	existing, ok := m.feeRules[f.ID]
+	if !ok {
+		return fmt.Errorf("fee rule %d: %w", f.ID, repository.ErrNotFound)
+	}
+
+	f.CreatedAt = existing.CreatedAt
+	f.UpdatedAt = time.Now()
+	f.Room = models.Room{}
+	m.feeRules[f.ID] = f
+
+	return nil
+}
+
+// DeleteFeeRule removes a fee rule
+func (m *MemoryRepo) DeleteFeeRule(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteFeeRule", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.feeRules[id]; !ok {
+		return fmt.Errorf("fee rule %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.feeRules, id)
+
+	return nil
+}
+
+// FeeRulesForRoom returns the fee rules for a room and for every room, in the
+// order they are added to a quote
+func (m *MemoryRepo) FeeRulesForRoom(roomID int) ([]models.FeeRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("FeeRulesForRoom", roomID); err != nil {
+		return nil, err
+	}
+
+	return m.sortedFeeRules(func(f models.FeeRule) bool {
+		return f.RoomID == 0 || f.RoomID == roomID
+	}), nil
+}
@@ -0,0 +1,94 @@
+package dbrepo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// PlaceHold holds a room for a guest filling in their reservation until the
+// hold's ExpiresAt, and returns the id of the hold. The hold h.ID, if set, is
+// released first so a guest keeps one hold as they change their stay; a room
+// taken on any of the nights gives ErrConflict
+func (m *MemoryRepo) PlaceHold(h models.RoomRestriction, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("PlaceHold", h); err != nil {
+		return 0, err
+	}
+
+	if err := validateHold(h); err != nil {
+		return 0, err
+	}
+
+	previous, held := m.roomRestrictions[h.ID]
+	if held && previous.RestrictionID == holdRestriction {
+		delete(m.roomRestrictions, h.ID)
+	}
+
+	if err := m.checkRoomFree(h.RoomID, h.StartDate, h.EndDate, now); err != nil {
+		if held && previous.RestrictionID == holdRestriction {
+			m.roomRestrictions[h.ID] = previous
+		}
+		return 0, err
+	}
+
+	created := time.Now()
+
+	r := models.RoomRestriction{
+		ID:            m.nextID(),
+		StartDate:     h.StartDate,
+		EndDate:       h.EndDate,
+		RoomID:        h.RoomID,
+		RestrictionID: holdRestriction,
+		ExpiresAt:     dbTime(h.ExpiresAt),
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	m.roomRestrictions[r.ID] = r
+
+	return r.ID, nil
+}
+
+// DeleteHold lets go of a hold before it expires
+func (m *MemoryRepo) DeleteHold(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteHold", id); err != nil {
+		return err
+	}
+
+	r, ok := m.roomRestrictions[id]
+	if !ok || r.RestrictionID != holdRestriction {
+		return fmt.Errorf("hold %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.roomRestrictions, id)
+
+	return nil
+}
+
+// DeleteExpiredHolds deletes the holds that expired by now and returns how
+// many there were
+func (m *MemoryRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteExpiredHolds", now); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for id, r := range m.roomRestrictions {
+		if r.RestrictionID == holdRestriction && !r.ExpiresAt.After(dbTime(now)) {
+			delete(m.roomRestrictions, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// RoomRestrictionsForRoom returns the reservations, blocks and live holds of
+// a room that end after since, ordered by start date
+func (m *MemoryRepo) RoomRestrictionsForRoom(roomID int, since, now time.Time) ([]models.RoomRestriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("RoomRestrictionsForRoom", roomID, since); err != nil {
+		return nil, err
+	}
+
+	var restrictions []models.RoomRestriction
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == roomID && r.EndDate.After(since) && !holdExpired(r, now) {
+			restrictions = append(restrictions, m.withBlockNames(r))
+		}
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool {
+		if !restrictions[i].StartDate.Equal(restrictions[j].StartDate) {
+			return restrictions[i].StartDate.Before(restrictions[j].StartDate)
+		}
+		return restrictions[i].ID < restrictions[j].ID
+	})
+
+	return restrictions, nil
+}
+
+// SetRoomICalToken changes the token the calendar feed of a room is read
+// with, the old feed URL stops working
+func (m *MemoryRepo) SetRoomICalToken(roomID int, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("SetRoomICalToken", roomID, token); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(token) == "" {
+		return fmt.Errorf("%w: a calendar feed needs a token", repository.ErrInvalid)
+	}
+
+	room, ok := m.rooms[roomID]
+	if !ok {
+		return fmt.Errorf("room %d: %w", roomID, repository.ErrNotFound)
+	}
+
+	room.ICalToken = token
+	room.UpdatedAt = time.Now()
+	m.rooms[roomID] = room
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package dbrepo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllICalFeeds returns every calendar feed, ordered by room
+func (m *MemoryRepo) AllICalFeeds() ([]models.ICalFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllICalFeeds"); err != nil {
+		return nil, err
+	}
+
+	return m.icalFeedsWhere(func(models.ICalFeed) bool { return true }), nil
+}
+
+// ICalFeedsForRoom returns the calendar feeds of a room
+func (m *MemoryRepo) ICalFeedsForRoom(roomID int) ([]models.ICalFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("ICalFeedsForRoom", roomID); err != nil {
+		return nil, err
+	}
+
+	return m.icalFeedsWhere(func(f models.ICalFeed) bool { return f.RoomID == roomID }), nil
+}
+
+// icalFeedsWhere lists the feeds keep accepts, ordered by room and id
+func (m *MemoryRepo) icalFeedsWhere(keep func(models.ICalFeed) bool) []models.ICalFeed {
+	var feeds []models.ICalFeed
+	for _, f := range m.icalFeeds {
+		if keep(f) {
+			feeds = append(feeds, m.withFeedRoom(f))
+		}
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		if feeds[i].RoomID != feeds[j].RoomID {
+			return feeds[i].RoomID < feeds[j].RoomID
+		}
+		return feeds[i].ID < feeds[j].ID
+	})
+
+	return feeds
+}
+
+// GetICalFeedByID gets a calendar feed by id
+func (m *MemoryRepo) GetICalFeedByID(id int) (models.ICalFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetICalFeedByID", id); err != nil {
+		return models.ICalFeed{}, err
+	}
+
+	f, ok := m.icalFeeds[id]
+	if !ok {
+		return models.ICalFeed{}, fmt.Errorf("calendar feed %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.withFeedRoom(f), nil
+}
+
+// InsertICalFeed adds a calendar feed to a room and returns its new id
+func (m *MemoryRepo) InsertICalFeed(f models.ICalFeed) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertICalFeed", f); err != nil {
+		return 0, err
+	}
+
+	if err := validateICalFeed(f); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.rooms[f.RoomID]; !ok {
+		return 0, fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, f.RoomID)
+	}
+
+	f.ID = m.nextID()
+	f.LastSyncedAt = time.Time{}
+	f.LastError = ""
+	f.CreatedAt = time.Now()
+	f.UpdatedAt = f.CreatedAt
+	f.Room = models.Room{}
+	m.icalFeeds[f.ID] = f
+
+	return f.ID, nil
+}
+
+// DeleteICalFeed removes a calendar feed with the blocks imported from it
+func (m *MemoryRepo) DeleteICalFeed(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteICalFeed", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.icalFeeds[id]; !ok {
+		return fmt.Errorf("calendar feed %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.icalFeeds, id)
+	for rid, r := range m.roomRestrictions {
+		if r.ICalFeedID == id {
+			delete(m.roomRestrictions, rid)
+		}
+	}
+
+	return nil
+}
+
+// SetICalFeedSynced saves when a calendar feed was last synced and why it
+// failed, lastError is empty if it didn't
+func (m *MemoryRepo) SetICalFeedSynced(id int, at time.Time, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("SetICalFeedSynced", id, at, lastError); err != nil {
+		return err
+	}
+
+	f, ok := m.icalFeeds[id]
+	if !ok {
+		return fmt.Errorf("calendar feed %d: %w", id, repository.ErrNotFound)
+	}
+
+	f.LastSyncedAt = dbTime(at)
+	f.LastError = truncateError(lastError)
+	f.UpdatedAt = time.Now()
+	m.icalFeeds[id] = f
+
+	return nil
+}
+
+// SyncICalFeed makes the external blocks of a calendar feed match its events,
+// keyed on ExternalUID. A block whose event is gone or moved is removed, an
+// event without a block gets one unless the room is taken on its nights.
+// Syncing the same events again changes nothing
+func (m *MemoryRepo) SyncICalFeed(feedID int, events []models.RoomRestriction, now time.Time) (models.ICalSync, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result models.ICalSync
+
+	if err := m.fault("SyncICalFeed", feedID, events); err != nil {
+		return result, err
+	}
+
+	events, byUID, err := externalEvents(events)
+	if err != nil {
+		return result, err
+	}
+
+	f, ok := m.icalFeeds[feedID]
+	if !ok {
+		return result, fmt.Errorf("calendar feed %d: %w", feedID, repository.ErrNotFound)
+	}
+
+	var existing []models.RoomRestriction
+	for _, r := range m.roomRestrictions {
+		if r.ICalFeedID == feedID {
+			existing = append(existing, r)
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool {
+		if !existing[i].StartDate.Equal(existing[j].StartDate) {
+			return existing[i].StartDate.Before(existing[j].StartDate)
+		}
+		return existing[i].ID < existing[j].ID
+	})
+
+	kept := make(map[string]bool)
+	for _, b := range existing {
+		if e, ok := byUID[b.ExternalUID]; ok && sameNights(e, b) {
+			kept[b.ExternalUID] = true
+			continue
+		}
+
+		delete(m.roomRestrictions, b.ID)
+		result.Removed = append(result.Removed, m.withBlockNames(b))
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].StartDate.Before(events[j].StartDate) })
+
+	for _, e := range events {
+		if kept[e.ExternalUID] {
+			continue
+		}
+
+		e.RoomID = f.RoomID
+		err := m.checkRoomFree(e.RoomID, e.StartDate, e.EndDate, now)
+		if errors.Is(err, repository.ErrConflict) {
+			result.Conflicts = append(result.Conflicts, e)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		b := models.RoomRestriction{
+			ID:            m.nextID(),
+			StartDate:     e.StartDate,
+			EndDate:       e.EndDate,
+			RoomID:        f.RoomID,
+			RestrictionID: externalRestriction,
+			ICalFeedID:    feedID,
+			ExternalUID:   e.ExternalUID,
+			CreatedAt:     time.Now(),
+		}
+		b.UpdatedAt = b.CreatedAt
+		m.roomRestrictions[b.ID] = b
+		result.Added = append(result.Added, m.withBlockNames(b))
+	}
+
+	return result, nil
+}
+
+// withFeedRoom fills in the room of a feed, as the database repositories join it
+func (m *MemoryRepo) withFeedRoom(f models.ICalFeed) models.ICalFeed {
+	f.Room = models.Room{ID: f.RoomID, RoomName: m.rooms[f.RoomID].RoomName}
+	return f
+}
@@ -0,0 +1,68 @@
+package dbrepo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// InsertInvoice issues an invoice with the next number and returns it. A
+// reservation has one invoice, a second fails with ErrConflict
+func (m *MemoryRepo) InsertInvoice(inv models.Invoice) (models.Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertInvoice", inv); err != nil {
+		return inv, err
+	}
+
+	if err := validateInvoice(inv); err != nil {
+		return inv, err
+	}
+
+	if _, ok := m.reservations[inv.ReservationID]; !ok {
+		return inv, fmt.Errorf("%w: reservation %d does not exist", repository.ErrInvalid, inv.ReservationID)
+	}
+
+	inv.Number = 0
+	for _, other := range m.invoices {
+		if other.ReservationID == inv.ReservationID {
+			return inv, fmt.Errorf("%w: reservation %d has an invoice", repository.ErrConflict, inv.ReservationID)
+		}
+		if other.Number >= inv.Number {
+			inv.Number = other.Number
+		}
+	}
+	inv.Number++
+
+	if inv.IssuedAt.IsZero() {
+		inv.IssuedAt = time.Now()
+	}
+
+	inv.ID = m.nextID()
+	inv.CreatedAt = time.Now()
+	inv.UpdatedAt = inv.CreatedAt
+	m.invoices[inv.ID] = inv
+
+	return inv, nil
+}
+
+// GetInvoiceByReservation gets the invoice of a reservation
+func (m *MemoryRepo) GetInvoiceByReservation(reservationID int) (models.Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetInvoiceByReservation", reservationID); err != nil {
+		return models.Invoice{}, err
+	}
+
+	for _, inv := range m.invoices {
+		if inv.ReservationID == reservationID {
+			return inv, nil
+		}
+	}
+
+	return models.Invoice{}, fmt.Errorf("invoice of reservation %d: %w", reservationID, repository.ErrNotFound)
+}
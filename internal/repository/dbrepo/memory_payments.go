@@ -0,0 +1,204 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// GetReservationByPaymentIntent gets the reservation whose deposit or balance
+// is paid with a gateway intent
+func (m *MemoryRepo) GetReservationByPaymentIntent(intentID string) (models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetReservationByPaymentIntent", intentID); err != nil {
+		return models.Reservation{}, err
+	}
+
+	if intentID != "" {
+		for _, res := range m.reservations {
+			if res.PaymentIntentID == intentID || res.BalanceIntentID == intentID {
+				return m.reservationWithRoom(res), nil
+			}
+		}
+	}
+
+	return models.Reservation{}, fmt.Errorf("payment intent %q: %w", intentID, repository.ErrNotFound)
+}
+
+// UpdateReservationStatus moves a reservation from one status to another. It
+// fails with ErrConflict when the reservation is no longer in status from
+func (m *MemoryRepo) UpdateReservationStatus(id int, from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateReservationStatus", id, from, to); err != nil {
+		return err
+	}
+
+	if err := validateReservationStatus(to); err != nil {
+		return err
+	}
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+
+	if res.Status != from {
+		return fmt.Errorf("%w: reservation %d is %s, not %s", repository.ErrConflict, id, res.Status, from)
+	}
+
+	res.Status = to
+	res.UpdatedAt = time.Now()
+	m.reservations[id] = res
+
+	return nil
+}
+
+// SetBalanceIntent records the gateway intent the balance of a reservation is
+// paid with. It fails with ErrConflict when the balance already has one
+func (m *MemoryRepo) SetBalanceIntent(id int, intentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("SetBalanceIntent", id, intentID); err != nil {
+		return err
+	}
+
+	if intentID == "" {
+		return fmt.Errorf("%w: the balance needs a payment intent", repository.ErrInvalid)
+	}
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+
+	if res.BalanceIntentID != "" {
+		return fmt.Errorf("%w: the balance of reservation %d is already asked for", repository.ErrConflict, id)
+	}
+
+	res.BalanceIntentID = intentID
+	res.UpdatedAt = time.Now()
+	m.reservations[id] = res
+
+	return nil
+}
+
+// DueBalances returns the confirmed reservations whose balance is due on day
+// or before and has not been asked for yet, the earliest due first
+func (m *MemoryRepo) DueBalances(day time.Time) ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.fault("DueBalances", day); err != nil {
+		return reservations, err
+	}
+
+	for _, res := range m.reservations {
+		if res.Status == models.ReservationConfirmed && res.Deposit < res.Quote.Total &&
+			!res.BalanceDueDate.After(day) && res.BalanceIntentID == "" {
+			reservations = append(reservations, m.reservationWithRoom(res))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].BalanceDueDate.Equal(reservations[j].BalanceDueDate) {
+			return reservations[i].BalanceDueDate.Before(reservations[j].BalanceDueDate)
+		}
+		return reservations[i].ID < reservations[j].ID
+	})
+
+	return reservations, nil
+}
+
+// UnpaidReservations returns the reservations still waiting for their
+// deposit whose time to pay ran out by now, the earliest first
+func (m *MemoryRepo) UnpaidReservations(now time.Time) ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.fault("UnpaidReservations", now); err != nil {
+		return reservations, err
+	}
+
+	for _, res := range m.reservations {
+		if res.Status == models.ReservationPendingPayment && !res.PaymentExpiresAt.IsZero() &&
+			!res.PaymentExpiresAt.After(dbTime(now)) {
+			reservations = append(reservations, m.reservationWithRoom(res))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].PaymentExpiresAt.Equal(reservations[j].PaymentExpiresAt) {
+			return reservations[i].PaymentExpiresAt.Before(reservations[j].PaymentExpiresAt)
+		}
+		return reservations[i].ID < reservations[j].ID
+	})
+
+	return reservations, nil
+}
+
+// InsertPayment adds an entry to the payments ledger and returns its new id.
+// An entry with the same kind and reference fails with ErrConflict
+func (m *MemoryRepo) InsertPayment(p models.Payment) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertPayment", p); err != nil {
+		return 0, err
+	}
+
+	if err := validatePayment(p); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.reservations[p.ReservationID]; !ok {
+		return 0, fmt.Errorf("%w: reservation %d does not exist", repository.ErrInvalid, p.ReservationID)
+	}
+
+	for _, other := range m.payments {
+		if other.Kind == p.Kind && other.Reference == p.Reference {
+			return 0, fmt.Errorf("%w: %s %s is already recorded", repository.ErrConflict, p.Kind, p.Reference)
+		}
+	}
+
+	p.ID = m.nextID()
+	p.CreatedAt = time.Now()
+	m.payments[p.ID] = p
+
+	return p.ID, nil
+}
+
+// PaymentsForReservation returns the ledger of a reservation, oldest first
+func (m *MemoryRepo) PaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var payments []models.Payment
+
+	if err := m.fault("PaymentsForReservation", reservationID); err != nil {
+		return payments, err
+	}
+
+	for _, p := range m.payments {
+		if p.ReservationID == reservationID {
+			payments = append(payments, p)
+		}
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].ID < payments[j].ID
+	})
+
+	return payments, nil
+}
@@ -0,0 +1,105 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllCancellationPolicies returns every cancellation policy, ordered by id
+func (m *MemoryRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var policies []models.CancellationPolicy
+
+	if err := m.fault("AllCancellationPolicies"); err != nil {
+		return policies, err
+	}
+
+	for _, p := range m.policies {
+		policies = append(policies, p)
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+
+	return policies, nil
+}
+
+// GetCancellationPolicyByID gets a cancellation policy by id
+func (m *MemoryRepo) GetCancellationPolicyByID(id int) (models.CancellationPolicy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetCancellationPolicyByID", id); err != nil {
+		return models.CancellationPolicy{}, err
+	}
+
+	p, ok := m.policies[id]
+	if !ok {
+		return p, fmt.Errorf("cancellation policy %d: %w", id, repository.ErrNotFound)
+	}
+
+	return p, nil
+}
+
+// UpdateCancellationPolicy saves changes to a cancellation policy. Reservations
+// keep the policy they were made with
+func (m *MemoryRepo) UpdateCancellationPolicy(p models.CancellationPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateCancellationPolicy", p); err != nil {
+		return err
+	}
+
+	if err := validateCancellationPolicy(p); err != nil {
+		return err
+	}
+
+	old, ok := m.policies[p.ID]
+	if !ok {
+		return fmt.Errorf("cancellation policy %d: %w", p.ID, repository.ErrNotFound)
+	}
+
+	p.CreatedAt = old.CreatedAt
+	p.UpdatedAt = time.Now()
+	m.policies[p.ID] = p
+
+	return nil
+}
+
+// UpdateRoom saves changes to the name, rate and cancellation policy of a room
+func (m *MemoryRepo) UpdateRoom(room models.Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateRoom", room); err != nil {
+		return err
+	}
+
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+
+	if _, ok := m.policies[room.CancellationPolicyID]; !ok {
+		return fmt.Errorf("%w: cancellation policy %d does not exist", repository.ErrInvalid, room.CancellationPolicyID)
+	}
+
+	old, ok := m.rooms[room.ID]
+	if !ok {
+		return fmt.Errorf("room %d: %w", room.ID, repository.ErrNotFound)
+	}
+
+	room.ICalToken = old.ICalToken
+	room.CreatedAt = old.CreatedAt
+	room.UpdatedAt = time.Now()
+	m.rooms[room.ID] = room
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// checkPromoCode normalizes and validates a promo code, making sure no other
+// promo code has the same code; callers hold the lock
+func (m *MemoryRepo) checkPromoCode(p *models.PromoCode) error {
+	p.Code = normalizePromoCode(p.Code)
+	if err := validatePromoCode(*p); err != nil {
+		return err
+	}
+
+	for id, existing := range m.promoCodes {
+		if id != p.ID && existing.Code == p.Code {
+			return fmt.Errorf("%w: promo code %s already exists", repository.ErrConflict, p.Code)
+		}
+	}
+
+	return nil
+}
+
+// AllPromoCodes returns every promo code, ordered by code
+func (m *MemoryRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var codes []models.PromoCode
+
+	if err := m.fault("AllPromoCodes"); err != nil {
+		return codes, err
+	}
+
+	for _, p := range m.promoCodes {
+		codes = append(codes, p)
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+
+	return codes, nil
+}
+
+// GetPromoCodeByID gets a promo code by id
+func (m *MemoryRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetPromoCodeByID", id); err != nil {
+		return models.PromoCode{}, err
+	}
+
+	p, ok := m.promoCodes[id]
+	if !ok {
+		return models.PromoCode{}, fmt.Errorf("promo code %d: %w", id, repository.ErrNotFound)
+	}
+
+	return p, nil
+}
+
+// GetPromoCodeByCode gets a promo code by the code guests type, in any case
+func (m *MemoryRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetPromoCodeByCode", code); err != nil {
+		return models.PromoCode{}, err
+	}
+
+	code = normalizePromoCode(code)
+	for _, p := range m.promoCodes {
+		if p.Code == code {
+			return p, nil
+		}
+	}
+
+	return models.PromoCode{}, fmt.Errorf("promo code %s: %w", code, repository.ErrNotFound)
+}
+
+// InsertPromoCode adds a promo code and returns its new id
+func (m *MemoryRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertPromoCode", p); err != nil {
+		return 0, err
+	}
+
+	p.ID = 0
+	if err := m.checkPromoCode(&p); err != nil {
+		return 0, err
+	}
+
+	p.ID = m.nextID()
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	m.promoCodes[p.ID] = p
+
+	return p.ID, nil
+}
+
+// UpdatePromoCode saves changes to a promo code; the use count is left alone
+func (m *MemoryRepo) UpdatePromoCode(p models.PromoCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdatePromoCode", p); err != nil {
+		return err
+	}
+
+	if err := m.checkPromoCode(&p); err != nil {
+		return err
+	}
+
+	existing, ok := m.promoCodes[p.ID]
+	if !ok {
+		return fmt.Errorf("promo code %d: %w", p.ID, repository.ErrNotFound)
+	}
+
+	p.Uses = existing.Uses
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = time.Now()
+	m.promoCodes[p.ID] = p
+
+	return nil
+}
+
+// DeletePromoCode removes a promo code
+func (m *MemoryRepo) DeletePromoCode(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeletePromoCode", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.promoCodes[id]; !ok {
+		return fmt.Errorf("promo code %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.promoCodes, id)
+
+	return nil
+}
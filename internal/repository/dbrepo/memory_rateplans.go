@@ -0,0 +1,181 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// withRoom fills in the room of a rate plan the way the sql join does; callers hold the lock
+func (m *MemoryRepo) withRoom(p models.RatePlan) models.RatePlan {
+	p.Room = models.Room{ID: p.RoomID}
+	if room, ok := m.rooms[p.RoomID]; ok {
+		p.Room.RoomName = room.RoomName
+	}
+	return p
+}
+
+// checkRatePlan validates a rate plan and its room; callers hold the lock
+func (m *MemoryRepo) checkRatePlan(p models.RatePlan) error {
+	if err := validateRatePlan(p); err != nil {
+		return err
+	}
+
+	if p.RoomID != 0 {
+		if _, ok := m.rooms[p.RoomID]; !ok {
+			return fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, p.RoomID)
+		}
+	}
+
+	return nil
+}
+
+// AllRatePlans returns every rate plan, highest priority first
+func (m *MemoryRepo) AllRatePlans() ([]models.RatePlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var plans []models.RatePlan
+
+	if err := m.fault("AllRatePlans"); err != nil {
+		return plans, err
+	}
+
+	for _, p := range m.ratePlans {
+		plans = append(plans, m.withRoom(p))
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		a, b := plans[i], plans[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if !a.StartDate.Equal(b.StartDate) {
+			return a.StartDate.Before(b.StartDate)
+		}
+		return a.ID < b.ID
+	})
+
+	return plans, nil
+}
+
+// GetRatePlanByID gets a rate plan by id
+func (m *MemoryRepo) GetRatePlanByID(id int) (models.RatePlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetRatePlanByID", id); err != nil {
+		return models.RatePlan{}, err
+	}
+
+	p, ok := m.ratePlans[id]
+	if !ok {
+		return models.RatePlan{}, fmt.Errorf("rate plan %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.withRoom(p), nil
+}
+
+// InsertRatePlan adds a rate plan and returns its new id
+func (m *MemoryRepo) InsertRatePlan(p models.RatePlan) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertRatePlan", p); err != nil {
+		return 0, err
+	}
+
+	if err := m.checkRatePlan(p); err != nil {
+		return 0, err
+	}
+
+	p.ID = m.nextID()
+	p.Room = models.Room{}
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	m.ratePlans[p.ID] = p
+
+	return p.ID, nil
+}
+
+// UpdateRatePlan saves changes to an existing rate plan
+func (m *MemoryRepo) UpdateRatePlan(p models.RatePlan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateRatePlan", p); err != nil {
+		return err
+	}
+
+	if err := m.checkRatePlan(p); err != nil {
+		return err
+	}
+
+	existing, ok := m.ratePlans[p.ID]
+	if !ok {
+		return fmt.Errorf("rate plan %d: %w", p.ID, repository.ErrNotFound)
+	}
+
+	p.Room = models.Room{}
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = time.Now()
+	m.ratePlans[p.ID] = p
+
+	return nil
+}
+
+// DeleteRatePlan removes a rate plan
+func (m *MemoryRepo) DeleteRatePlan(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteRatePlan", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.ratePlans[id]; !ok {
+		return fmt.Errorf("rate plan %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.ratePlans, id)
+
+	return nil
+}
+
+// RatePlansForRoom returns the plans for a room, or for every room, that
+// cover at least one night from start up to end
+func (m *MemoryRepo) RatePlansForRoom(roomID int, start, end time.Time) ([]models.RatePlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var plans []models.RatePlan
+
+	if err := m.fault("RatePlansForRoom", roomID, start, end); err != nil {
+		return plans, err
+	}
+
+	if !end.After(start) {
+		return plans, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	for _, p := range m.ratePlans {
+		if p.RoomID != 0 && p.RoomID != roomID {
+			continue
+		}
+		if p.StartDate.Before(end) && !p.EndDate.Before(start) {
+			plans = append(plans, m.withRoom(p))
+		}
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Priority != plans[j].Priority {
+			return plans[i].Priority > plans[j].Priority
+		}
+		return plans[i].ID > plans[j].ID
+	})
+
+	return plans, nil
+}
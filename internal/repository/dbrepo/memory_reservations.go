@@ -0,0 +1,120 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllReservations returns every reservation with its room, the latest stay first
+func (m *MemoryRepo) AllReservations() ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.fault("AllReservations"); err != nil {
+		return reservations, err
+	}
+
+	for _, res := range m.reservations {
+		reservations = append(reservations, m.reservationWithRoom(res))
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].StartDate.Equal(reservations[j].StartDate) {
+			return reservations[i].StartDate.After(reservations[j].StartDate)
+		}
+		return reservations[i].ID > reservations[j].ID
+	})
+
+	return reservations, nil
+}
+
+// GetReservationByCode gets a reservation by its confirmation code, in any case
+func (m *MemoryRepo) GetReservationByCode(code string) (models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetReservationByCode", code); err != nil {
+		return models.Reservation{}, err
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	if code != "" {
+		for _, res := range m.reservations {
+			if res.ConfirmationCode == code {
+				return m.reservationWithRoom(res), nil
+			}
+		}
+	}
+
+	return models.Reservation{}, fmt.Errorf("confirmation code %q: %w", code, repository.ErrNotFound)
+}
+
+// CancelReservation cancels a reservation and frees its room. Cancelling it
+// again fails with ErrConflict
+func (m *MemoryRepo) CancelReservation(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("CancelReservation", id); err != nil {
+		return err
+	}
+
+	return m.cancelReservation(id, "")
+}
+
+// CancelUnpaidReservation cancels a reservation still waiting for its
+// deposit and frees its room. A reservation paid or cancelled in the
+// meantime fails with ErrConflict
+func (m *MemoryRepo) CancelUnpaidReservation(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("CancelUnpaidReservation", id); err != nil {
+		return err
+	}
+
+	return m.cancelReservation(id, models.ReservationPendingPayment)
+}
+
+// cancelReservation cancels a reservation with status from, or any that is
+// not cancelled when from is empty, deletes its room restriction and gives
+// back the use of its promo code
+func (m *MemoryRepo) cancelReservation(id int, from string) error {
+	res, ok := m.reservations[id]
+	if !ok {
+		return fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+
+	if res.Status == models.ReservationCancelled || (from != "" && res.Status != from) {
+		return fmt.Errorf("%w: reservation %d is %s", repository.ErrConflict, id, res.Status)
+	}
+
+	res.Status = models.ReservationCancelled
+	res.UpdatedAt = time.Now()
+	m.reservations[id] = res
+
+	for rid, r := range m.roomRestrictions {
+		if r.ReservationID == id {
+			delete(m.roomRestrictions, rid)
+		}
+	}
+
+	code := normalizePromoCode(res.Quote.PromoCode)
+	for pid, p := range m.promoCodes {
+		if code != "" && p.Code == code && p.Uses > 0 {
+			p.Uses--
+			p.UpdatedAt = res.UpdatedAt
+			m.promoCodes[pid] = p
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// stayRuleWithRoom fills in the room of a stay rule the way the sql join does; callers hold the lock
+func (m *MemoryRepo) stayRuleWithRoom(s models.StayRule) models.StayRule {
+	s.Room = models.Room{ID: s.RoomID}
+	if room, ok := m.rooms[s.RoomID]; ok {
+		s.Room.RoomName = room.RoomName
+	}
+	return s
+}
+
+// checkStayRule validates a stay rule and its room; callers hold the lock
+func (m *MemoryRepo) checkStayRule(s models.StayRule) error {
+	if err := validateStayRule(s); err != nil {
+		return err
+	}
+
+	if s.RoomID != 0 {
+		if _, ok := m.rooms[s.RoomID]; !ok {
+			return fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, s.RoomID)
+		}
+	}
+
+	return nil
+}
+
+// sortedStayRules returns the stay rules that pass keep, ordered by start
+// date; callers hold the lock
+func (m *MemoryRepo) sortedStayRules(keep func(s models.StayRule) bool) []models.StayRule {
+	var rules []models.StayRule
+
+	for _, s := range m.stayRules {
+		if keep(s) {
+			rules = append(rules, m.stayRuleWithRoom(s))
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if !rules[i].StartDate.Equal(rules[j].StartDate) {
+			return rules[i].StartDate.Before(rules[j].StartDate)
+		}
+		return rules[i].ID < rules[j].ID
+	})
+
+	return rules
+}
+
+// AllStayRules returns every stay rule, by start date
+func (m *MemoryRepo) AllStayRules() ([]models.StayRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllStayRules"); err != nil {
+		return nil, err
+	}
+
+	return m.sortedStayRules(func(s models.StayRule) bool { return true }), nil
+}
+
+// GetStayRuleByID gets a stay rule by id
+func (m *MemoryRepo) GetStayRuleByID(id int) (models.StayRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetStayRuleByID", id); err != nil {
+		return models.StayRule{}, err
+	}
+
+	s, ok := m.stayRules[id]
+	if !ok {
+		return models.StayRule{}, fmt.Errorf("stay rule %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.stayRuleWithRoom(s), nil
+}
+
+// InsertStayRule adds a stay rule and returns its new id
+func (m *MemoryRepo) InsertStayRule(s models.StayRule) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertStayRule", s); err != nil {
+		return 0, err
+	}
+
+	if err := m.checkStayRule(s); err != nil {
+		return 0, err
+	}
+
+	s.ID = m.nextID()
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	s.Room = models.Room{}
+	m.stayRules[s.ID] = s
+
+	return s.ID, nil
+}
+
+// UpdateStayRule saves changes to an existing stay rule
+func (m *MemoryRepo) UpdateStayRule(s models.StayRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateStayRule", s); err != nil {
+		return err
+	}
+
+	if err := m.checkStayRule(s); err != nil {
+		return err
+	}
+
+	existing, ok := m.stayRules[s.ID]
+	if !ok {
+		return fmt.Errorf("stay rule %d: %w", s.ID, repository.ErrNotFound)
+	}
+
+	s.CreatedAt = existing.CreatedAt
+	s.UpdatedAt = time.Now()
+	s.Room = models.Room{}
+	m.stayRules[s.ID] = s
+
+	return nil
+}
+
+// DeleteStayRule removes a stay rule
+func (m *MemoryRepo) DeleteStayRule(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteStayRule", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.stayRules[id]; !ok {
+		return fmt.Errorf("stay rule %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.stayRules, id)
+
+	return nil
+}
+
+// StayRulesForRoom returns the stay rules for a room and for every room, by
+// start date
+func (m *MemoryRepo) StayRulesForRoom(roomID int) ([]models.StayRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("StayRulesForRoom", roomID); err != nil {
+		return nil, err
+	}
+
+	return m.sortedStayRules(func(s models.StayRule) bool {
+		return s.RoomID == 0 || s.RoomID == roomID
+	}), nil
+}
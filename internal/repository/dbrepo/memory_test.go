@@ -0,0 +1,74 @@
+package dbrepo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/config"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+func TestMemoryRepo(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{})
+
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	id, err := repo.InsertReservation(models.Reservation{StartDate: start, EndDate: end, RoomID: 1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertRoomRestriction(models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        1,
+		ReservationID: id,
+		RestrictionID: 1,
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checking out on the day the next guest arrives is not an overlap
+	available, err := repo.SerachAvailabilityByDatesByRoomID(end, end.AddDate(0, 0, 2), 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("room 1 is not available from the checkout day of the previous stay")
+	}
+
+	available, err = repo.SerachAvailabilityByDatesByRoomID(start.AddDate(0, 0, -1), start.AddDate(0, 0, 1), 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("room 1 is available over an existing reservation")
+	}
+
+	_, err = repo.InsertReservation(models.Reservation{StartDate: start, EndDate: end, RoomID: 99}, time.Now())
+	if err == nil {
+		t.Error("inserted a reservation for a room that does not exist")
+	}
+
+	repo.SetFault("GetRoomByID", func(args ...interface{}) error {
+		if args[0].(int) == 2 {
+			return errors.New("some error")
+		}
+		return nil
+	})
+
+	if _, err := repo.GetRoomByID(2); err == nil {
+		t.Error("injected fault was not returned")
+	}
+	if _, err := repo.GetRoomByID(1); err != nil {
+		t.Errorf("fault for room 2 failed the lookup of room 1: %s", err)
+	}
+
+	repo.ClearFaults()
+	if _, err := repo.GetRoomByID(2); err != nil {
+		t.Errorf("fault still active after ClearFaults: %s", err)
+	}
+}
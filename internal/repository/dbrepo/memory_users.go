@@ -0,0 +1,74 @@
+package dbrepo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// InsertUser adds a user, storing a bcrypt hash of u.Password
+func (m *MemoryRepo) InsertUser(u models.User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertUser", u); err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(u.Email) == "" || u.Password == "" {
+		return 0, fmt.Errorf("%w: a user needs an email and a password", repository.ErrInvalid)
+	}
+
+	for _, existing := range m.users {
+		if existing.Email == u.Email {
+			return 0, fmt.Errorf("%w: user %s already exists", repository.ErrConflict, u.Email)
+		}
+	}
+
+	// the lowest cost keeps tests fast; it is only ever used in memory
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	u.ID = m.nextID()
+	u.Password = string(hashedPassword)
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	m.users[u.ID] = u
+
+	return u.ID, nil
+}
+
+// Authenticate checks an email and password, returning the user id and password hash
+func (m *MemoryRepo) Authenticate(email, testPassword string) (int, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("Authenticate", email, testPassword); err != nil {
+		return 0, "", err
+	}
+
+	for _, u := range m.users {
+		if u.Email != email {
+			continue
+		}
+
+		err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(testPassword))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			break
+		}
+		if err != nil {
+			return 0, "", err
+		}
+
+		return u.ID, u.Password, nil
+	}
+
+	return 0, "", fmt.Errorf("%w: incorrect email or password", repository.ErrInvalid)
+}
@@ -0,0 +1,128 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// InsertWaitlistEntry puts a guest on the waitlist of a room and returns the
+// new entry's id. The entry starts waiting, with a new token unless it has one
+func (m *MemoryRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertWaitlistEntry", e); err != nil {
+		return 0, err
+	}
+
+	if err := validateWaitlistEntry(e); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.rooms[e.RoomID]; !ok {
+		return 0, fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, e.RoomID)
+	}
+
+	if e.Token == "" {
+		e.Token = newWaitlistToken()
+	}
+	for _, other := range m.waitlist {
+		if other.Token == e.Token {
+			return 0, fmt.Errorf("%w: the token is taken", repository.ErrConflict)
+		}
+	}
+
+	e.ID = m.nextID()
+	e.Status = models.WaitlistWaiting
+	e.NotifiedAt = time.Time{}
+	e.HoldExpiresAt = time.Time{}
+	e.CreatedAt = time.Now()
+	e.UpdatedAt = e.CreatedAt
+	e.Room = models.Room{}
+	m.waitlist[e.ID] = e
+
+	return e.ID, nil
+}
+
+// GetWaitlistEntryByToken gets the waitlist entry a link was mailed for
+func (m *MemoryRepo) GetWaitlistEntryByToken(token string) (models.WaitlistEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetWaitlistEntryByToken", token); err != nil {
+		return models.WaitlistEntry{}, err
+	}
+
+	for _, e := range m.waitlist {
+		if e.Token == token {
+			return m.withWaitlistRoom(e), nil
+		}
+	}
+
+	return models.WaitlistEntry{}, fmt.Errorf("waitlist entry: %w", repository.ErrNotFound)
+}
+
+// OpenWaitlistEntries returns the entries waiting or notified, in the order
+// the guests joined
+func (m *MemoryRepo) OpenWaitlistEntries() ([]models.WaitlistEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("OpenWaitlistEntries"); err != nil {
+		return nil, err
+	}
+
+	var entries []models.WaitlistEntry
+	for _, e := range m.waitlist {
+		if e.Status == models.WaitlistWaiting || e.Status == models.WaitlistNotified {
+			entries = append(entries, m.withWaitlistRoom(e))
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	return entries, nil
+}
+
+// UpdateWaitlistEntry saves the status of a waitlist entry, when its guest
+// was told and their turn ends, and the hold on the room meanwhile
+func (m *MemoryRepo) UpdateWaitlistEntry(e models.WaitlistEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateWaitlistEntry", e); err != nil {
+		return err
+	}
+
+	saved, ok := m.waitlist[e.ID]
+	if !ok {
+		return fmt.Errorf("waitlist entry %d: %w", e.ID, repository.ErrNotFound)
+	}
+
+	saved.Status = e.Status
+	saved.NotifiedAt = time.Time{}
+	if !e.NotifiedAt.IsZero() {
+		saved.NotifiedAt = dbTime(e.NotifiedAt)
+	}
+	saved.HoldExpiresAt = time.Time{}
+	if !e.HoldExpiresAt.IsZero() {
+		saved.HoldExpiresAt = dbTime(e.HoldExpiresAt)
+	}
+	saved.HoldID = e.HoldID
+	saved.UpdatedAt = time.Now()
+	m.waitlist[e.ID] = saved
+
+	return nil
+}
+
+// withWaitlistRoom fills in the name of the room an entry waits for
+func (m *MemoryRepo) withWaitlistRoom(e models.WaitlistEntry) models.WaitlistEntry {
+	e.Room = models.Room{ID: e.RoomID, RoomName: m.rooms[e.RoomID].RoomName}
+	return e
+}
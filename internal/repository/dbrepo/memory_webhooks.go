@@ -0,0 +1,296 @@
+package dbrepo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllWebhooks returns every webhook, ordered by URL
+func (m *MemoryRepo) AllWebhooks() ([]models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("AllWebhooks"); err != nil {
+		return nil, err
+	}
+
+	var hooks []models.Webhook
+	for _, w := range m.webhooks {
+		hooks = append(hooks, w)
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		if hooks[i].URL != hooks[j].URL {
+			return hooks[i].URL < hooks[j].URL
+		}
+		return hooks[i].ID < hooks[j].ID
+	})
+
+	return hooks, nil
+}
+
+// WebhooksForEvent returns the active webhooks subscribed to event
+func (m *MemoryRepo) WebhooksForEvent(event string) ([]models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("WebhooksForEvent", event); err != nil {
+		return nil, err
+	}
+
+	var hooks []models.Webhook
+	for _, w := range m.webhooks {
+		if w.Active && w.Subscribes(event) {
+			hooks = append(hooks, w)
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+
+	return hooks, nil
+}
+
+// GetWebhookByID gets a webhook by id
+func (m *MemoryRepo) GetWebhookByID(id int) (models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetWebhookByID", id); err != nil {
+		return models.Webhook{}, err
+	}
+
+	w, ok := m.webhooks[id]
+	if !ok {
+		return models.Webhook{}, fmt.Errorf("webhook %d: %w", id, repository.ErrNotFound)
+	}
+
+	return w, nil
+}
+
+// InsertWebhook adds a webhook and returns its new id
+func (m *MemoryRepo) InsertWebhook(w models.Webhook) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertWebhook", w); err != nil {
+		return 0, err
+	}
+
+	if err := validateWebhook(w); err != nil {
+		return 0, err
+	}
+
+	w.ID = m.nextID()
+	w.Events = append([]string(nil), w.Events...)
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+	m.webhooks[w.ID] = w
+
+	return w.ID, nil
+}
+
+// UpdateWebhook saves changes to a webhook
+func (m *MemoryRepo) UpdateWebhook(w models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateWebhook", w); err != nil {
+		return err
+	}
+
+	if err := validateWebhook(w); err != nil {
+		return err
+	}
+
+	existing, ok := m.webhooks[w.ID]
+	if !ok {
+		return fmt.Errorf("webhook %d: %w", w.ID, repository.ErrNotFound)
+	}
+
+	w.Events = append([]string(nil), w.Events...)
+	w.CreatedAt = existing.CreatedAt
+	w.UpdatedAt = time.Now()
+	m.webhooks[w.ID] = w
+
+	return nil
+}
+
+// DeleteWebhook removes a webhook with its deliveries
+func (m *MemoryRepo) DeleteWebhook(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DeleteWebhook", id); err != nil {
+		return err
+	}
+
+	if _, ok := m.webhooks[id]; !ok {
+		return fmt.Errorf("webhook %d: %w", id, repository.ErrNotFound)
+	}
+
+	delete(m.webhooks, id)
+	for did, d := range m.webhookDeliveries {
+		if d.WebhookID == id {
+			delete(m.webhookDeliveries, did)
+		}
+	}
+
+	return nil
+}
+
+// InsertWebhookDelivery queues an event for a webhook and returns the id of
+// the delivery
+func (m *MemoryRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("InsertWebhookDelivery", d); err != nil {
+		return 0, err
+	}
+
+	if d.Status == "" {
+		d.Status = models.DeliveryPending
+	}
+	if err := validateWebhookDelivery(d); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.webhooks[d.WebhookID]; !ok {
+		return 0, fmt.Errorf("%w: webhook %d does not exist", repository.ErrInvalid, d.WebhookID)
+	}
+
+	d.ID = m.nextID()
+	d.LastError = truncateError(d.LastError)
+	d.NextAttemptAt = dbTime(d.NextAttemptAt)
+	if !d.DeliveredAt.IsZero() {
+		d.DeliveredAt = dbTime(d.DeliveredAt)
+	}
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = d.CreatedAt
+	d.Webhook = models.Webhook{}
+	m.webhookDeliveries[d.ID] = d
+
+	return d.ID, nil
+}
+
+// GetWebhookDeliveryByID gets a delivery by id, with the URL and secret of its webhook
+func (m *MemoryRepo) GetWebhookDeliveryByID(id int) (models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("GetWebhookDeliveryByID", id); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	d, ok := m.webhookDeliveries[id]
+	if !ok {
+		return models.WebhookDelivery{}, fmt.Errorf("webhook delivery %d: %w", id, repository.ErrNotFound)
+	}
+
+	return m.withWebhook(d), nil
+}
+
+// UpdateWebhookDelivery records an attempt at a delivery: its status,
+// attempts, last response and when it is tried next
+func (m *MemoryRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("UpdateWebhookDelivery", d); err != nil {
+		return err
+	}
+
+	if err := validateWebhookDelivery(d); err != nil {
+		return err
+	}
+
+	existing, ok := m.webhookDeliveries[d.ID]
+	if !ok {
+		return fmt.Errorf("webhook delivery %d: %w", d.ID, repository.ErrNotFound)
+	}
+
+	existing.Status = d.Status
+	existing.Attempts = d.Attempts
+	existing.ResponseCode = d.ResponseCode
+	existing.LastError = truncateError(d.LastError)
+	existing.NextAttemptAt = dbTime(d.NextAttemptAt)
+	existing.DeliveredAt = time.Time{}
+	if !d.DeliveredAt.IsZero() {
+		existing.DeliveredAt = dbTime(d.DeliveredAt)
+	}
+	existing.UpdatedAt = time.Now()
+	m.webhookDeliveries[d.ID] = existing
+
+	return nil
+}
+
+// DueWebhookDeliveries returns the pending deliveries of active webhooks
+// due by now, the longest waiting first
+func (m *MemoryRepo) DueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("DueWebhookDeliveries", now); err != nil {
+		return nil, err
+	}
+
+	now = dbTime(now)
+
+	var due []models.WebhookDelivery
+	for _, d := range m.webhookDeliveries {
+		if d.Status == models.DeliveryPending && !d.NextAttemptAt.After(now) && m.webhooks[d.WebhookID].Active {
+			due = append(due, m.withWebhook(d))
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	if len(due) > 100 {
+		due = due[:100]
+	}
+
+	return due, nil
+}
+
+// WebhookDeliveries returns the latest limit deliveries of a webhook, or of
+// every webhook when webhookID is 0, newest first; a limit of 0 returns them all
+func (m *MemoryRepo) WebhookDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fault("WebhookDeliveries", webhookID, limit); err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, d := range m.webhookDeliveries {
+		if webhookID == 0 || d.WebhookID == webhookID {
+			deliveries = append(deliveries, m.withWebhook(d))
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// withWebhook fills in the webhook of a delivery, as the database
+// repositories join it
+func (m *MemoryRepo) withWebhook(d models.WebhookDelivery) models.WebhookDelivery {
+	w := m.webhooks[d.WebhookID]
+	d.Webhook = models.Webhook{ID: w.ID, URL: w.URL, Secret: w.Secret, Active: w.Active}
+	return d
+}
@@ -1,175 +1,35 @@
 package dbrepo
 
 import (
-	"context"
-	"time"
+	"errors"
+	"fmt"
 
-	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"github.com/jackc/pgconn"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
-	
+// postgresDialect runs the repository on Postgres, locking the room a
+// booking or block claims until its transaction ends
+var postgresDialect = dialect{
+	roomQuery: `select id from rooms where id = $1 for update`,
+	dbError:   pgError,
 }
 
-
-//InsertReservation insert a reservation into database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	defer cancel()
-
-	var newID int
-
-	stmt := `insert into reservation (first_name, last_name, email, phone,
-		start_date, end_date, room_id, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
-		
-	err := m.DB.QueryRowContext(ctx, stmt,
-		res.FirstName,
-		res.LastName,
-		res.Email,
-		res.Phone,
-		res.StartDate,
-		res.EndDate,
-		res.RoomID,
-		time.Now(),
-		time.Now(),
-		).Scan(&newID)
-
-	if err != nil {
-		return 0, err
-	}
-	
-	return newID, nil
-}
-
-//InsertRoomRestriction insert a room restrictioninto the database
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	defer cancel()
-
-	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
-		created_at, updated_at, restriction_id)
-		values
-		($1, $2, $3, $4, $5, $6, $7)`
-
-	_, err := m.DB.ExecContext(ctx, stmt,
-		r.StartDate,
-		r.EndDate,
-		r.RoomID,
-		r.ReservationID,
-		time.Now(),
-		time.Now(),
-		r.RestrictionID,
-		)
-	if err != nil {
+// pgError translates constraint violations into the repository errors
+func pgError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
 		return err
 	}
 
-	return nil
-}
-
-//SerachAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
-func (m *postgresDBRepo) SerachAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error ){
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	defer cancel()
-
-	var numRows int
-
-	query := `
-			select
-				count(ID) 
-			from
-				room_restrictions 
-			where
-				room_id = $1
-				and $2 < end_date and $3 > start_date;`
-
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
-	err := row.Scan(&numRows)
-	if err != nil {
-		return false, err
-	}
-	
-	if numRows == 0 {
-		return true, nil
+	switch pgErr.Code {
+	case "23505", "23P01":
+		// unique_violation, exclusion_violation
+		return fmt.Errorf("%w: %s", repository.ErrConflict, pgErr.Message)
+	case "23503", "23502", "23514":
+		// foreign_key_violation, not_null_violation, check_violation
+		return fmt.Errorf("%w: %s", repository.ErrInvalid, pgErr.Message)
 	}
 
-	return false, nil
+	return err
 }
-
-
-// SearchAvailabilityForAllRooms slice of rooms for availability rooms, if any, for given dat  range
-func (m * postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	defer cancel()
-
-	var rooms []models.Room
-
-	query := `
-	select 
-		r.id, r.room_name
-	from
-		rooms r 
-	where 
-		r.id not in (
-			select 
-				rr.room_id 
-			from 
-				room_restrictions rr 
-			where 
-				$1 < rr.end_date and $2 > rr.start_date)`
-
-
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
-	if err != nil {
-		return rooms, err
-	}
-	for rows.Next() {
-		var room models.Room
-		err := rows.Scan(
-			&room.ID,
-			&room.RoomName,
-		)
-		if err != nil {
-			return rooms, err
-		}
-		rooms = append(rooms, room)
-	}
-
-	if err = rows.Err(); err != nil {
-		return rooms, err
-	}
-
-	return rooms, nil
-}
-
-//GetRoomByID gets a room by id
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	defer cancel()
-
-	var room models.Room
-
-	query := `
-	select 
-		id, room_name, created_at, updated_at
-	from 
-		rooms
-	where
-		id = $1
-	`
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
-	if err != nil {
-		return room, err
-	}
-
-	return room, nil
-
-}
\ No newline at end of file
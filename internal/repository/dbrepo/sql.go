@@ -0,0 +1,451 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+func (m *sqlDBRepo) AllUsers() bool {
+	return true
+}
+
+// InsertReservation inserts a reservation into the database
+func (m *sqlDBRepo) InsertReservation(res models.Reservation, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = m.claimRoom(ctx, tx, res.RoomID, res.StartDate, res.EndDate, now)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := m.insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// CreateBooking stores a reservation, blocks its room for the stay and
+// redeems its promo code, all in one transaction so either everything is
+// booked or nothing is. The guest's hold on the room, if any, is taken over
+func (m *sqlDBRepo) CreateBooking(res models.Reservation, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = releaseHold(ctx, tx, res.HoldID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.claimRoom(ctx, tx, res.RoomID, res.StartDate, res.EndDate, now)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := m.insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.insertRoomRestriction(ctx, tx, models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: newID,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if res.Quote.PromoCode != "" {
+		err = redeemPromoCode(ctx, tx, res.Quote.PromoCode)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// insertReservation inserts a reservation row inside a transaction
+func (m *sqlDBRepo) insertReservation(ctx context.Context, tx *sql.Tx, res models.Reservation) (int, error) {
+	var newID int
+
+	res = withGuests(withSchedule(res))
+	if err := validateGuests(res); err != nil {
+		return 0, err
+	}
+	if res.ConfirmationCode == "" {
+		res.ConfirmationCode = newConfirmationCode()
+	}
+
+	quote, err := json.Marshal(res.Quote)
+	if err != nil {
+		return 0, err
+	}
+
+	policy, err := encodePolicy(res.Policy)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into reservation (first_name, last_name, email, phone,
+		start_date, end_date, room_id, subtotal, discount, fees, taxes, total, promo_code,
+		price_quote, status, payment_intent_id, confirmation_code, cancellation_policy,
+		deposit, balance_due_date, balance_intent_id, adults, children, payment_expires_at,
+		created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+		$19, $20, $21, $22, $23, $24, $25, $26) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		res.Quote.Subtotal,
+		res.Quote.Discount,
+		res.Quote.FeesTotal,
+		res.Quote.TaxTotal,
+		res.Quote.Total,
+		res.Quote.PromoCode,
+		string(quote),
+		reservationStatus(res.Status),
+		res.PaymentIntentID,
+		res.ConfirmationCode,
+		policy,
+		res.Deposit,
+		res.BalanceDueDate,
+		res.BalanceIntentID,
+		res.Adults,
+		res.Children,
+		nullTime(res.PaymentExpiresAt),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database
+func (m *sqlDBRepo) InsertRoomRestriction(r models.RoomRestriction, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.claimRoom(ctx, tx, r.RoomID, r.StartDate, r.EndDate, now)
+	if err != nil {
+		return err
+	}
+
+	err = m.insertRoomRestriction(ctx, tx, r)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertRoomRestriction inserts a room restriction row inside a transaction
+func (m *sqlDBRepo) insertRoomRestriction(ctx context.Context, tx *sql.Tx, r models.RoomRestriction) error {
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+		created_at, updated_at, restriction_id)
+		values
+		($1, $2, $3, $4, $5, $6, $7)`
+
+	// a zero reservation id means the restriction is not tied to a reservation
+	_, err := tx.ExecContext(ctx, stmt,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		nullID(r.ReservationID),
+		time.Now(),
+		time.Now(),
+		r.RestrictionID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return nil
+}
+
+// SerachAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
+func (m *sqlDBRepo) SerachAvailabilityByDatesByRoomID(start, end time.Time, roomID int, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if !end.After(start) {
+		return false, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	var numRows int
+
+	query := `
+			select
+				count(id)
+			from
+				room_restrictions
+			where
+				room_id = $1
+				and $2 < end_date and $3 > start_date
+				and (expires_at is null or expires_at > $4);`
+
+	row := m.DB.QueryRowContext(ctx, query, roomID, start, end, dbTime(now))
+	err := row.Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+
+	if numRows == 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
+// that sleep at least guests people
+func (m *sqlDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int, now time.Time) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	if !end.After(start) {
+		return rooms, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	query := `
+	select
+		r.id, r.room_name, r.nightly_rate, r.max_occupancy, r.beds
+	from
+		rooms r
+	where
+		r.max_occupancy >= $3
+		and r.id not in (
+			select
+				rr.room_id
+			from
+				room_restrictions rr
+			where
+				$1 < rr.end_date and $2 > rr.start_date
+				and (rr.expires_at is null or rr.expires_at > $4))
+	order by r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, guests, dbTime(now))
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.NightlyRate,
+			&room.MaxOccupancy,
+			&room.Beds,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetRoomByID gets a room by id
+func (m *sqlDBRepo) GetRoomByID(id int) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var room models.Room
+
+	query := `
+	select
+		id, room_name, nightly_rate, cancellation_policy_id, max_occupancy, beds, included_guests, extra_guest_rate, ical_token, created_at, updated_at
+	from
+		rooms
+	where
+		id = $1
+	`
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.NightlyRate,
+		&room.CancellationPolicyID,
+		&room.MaxOccupancy,
+		&room.Beds,
+		&room.IncludedGuests,
+		&room.ExtraGuestRate,
+		&room.ICalToken,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return room, fmt.Errorf("room %d: %w", id, repository.ErrNotFound)
+	}
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// AllRooms returns every room, ordered by id
+func (m *sqlDBRepo) AllRooms() ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, nightly_rate, cancellation_policy_id, max_occupancy, beds, included_guests, extra_guest_rate, ical_token, created_at, updated_at from rooms order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.NightlyRate,
+			&room.CancellationPolicyID,
+			&room.MaxOccupancy,
+			&room.Beds,
+			&room.IncludedGuests,
+			&room.ExtraGuestRate,
+			&room.ICalToken,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetReservationByID gets a reservation with its room by id
+func (m *sqlDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + reservationColumns + `
+	from
+		reservation r
+		left join rooms rm on (r.room_id = rm.id)
+	where
+		r.id = $1
+	`
+	res, err := scanReservation(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+
+	return res, err
+}
+
+// claimRoom makes sure the dates are valid and the room exists and is free;
+// a hold that expired by now doesn't take the room. Where the database has row locks
+// the room stays locked for the rest of the transaction, so two bookings can
+// not take the same night; SQLite has a single writer, so the transaction
+// keeps the check and the insert that follows it together
+func (m *sqlDBRepo) claimRoom(ctx context.Context, tx *sql.Tx, roomID int, start, end, now time.Time) error {
+	if !end.After(start) {
+		return fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	var id int
+	err := tx.QueryRowContext(ctx, m.dialect.roomQuery, roomID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: room %d does not exist", repository.ErrInvalid, roomID)
+	}
+	if err != nil {
+		return err
+	}
+
+	var numRows int
+	query := `
+		select
+			count(id)
+		from
+			room_restrictions
+		where
+			room_id = $1
+			and $2 < end_date and $3 > start_date
+			and (expires_at is null or expires_at > $4)`
+
+	err = tx.QueryRowContext(ctx, query, roomID, start, end, dbTime(now)).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return fmt.Errorf("%w: room %d is not available for these dates", repository.ErrConflict, roomID)
+	}
+
+	return nil
+}
+
+// dbError translates constraint violations into the repository errors
+func (m *sqlDBRepo) dbError(err error) error {
+	return m.dialect.dbError(err)
+}
@@ -0,0 +1,152 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllAPIKeys returns every API key, ordered by name
+func (m *sqlDBRepo) AllAPIKeys() ([]models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var keys []models.APIKey
+
+	query := `select` + apiKeyColumns + ` from api_keys order by name, id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByID gets an API key by id
+func (m *sqlDBRepo) GetAPIKeyByID(id int) (models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + apiKeyColumns + ` from api_keys where id = $1`
+
+	k, err := scanAPIKey(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return k, fmt.Errorf("API key %d: %w", id, repository.ErrNotFound)
+	}
+
+	return k, err
+}
+
+// GetAPIKeyByPrefix gets the API key a request is made with by the prefix of the key
+func (m *sqlDBRepo) GetAPIKeyByPrefix(prefix string) (models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + apiKeyColumns + ` from api_keys where prefix = $1`
+
+	k, err := scanAPIKey(m.DB.QueryRowContext(ctx, query, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return k, fmt.Errorf("API key %s: %w", prefix, repository.ErrNotFound)
+	}
+
+	return k, err
+}
+
+// InsertAPIKey adds an API key and returns its new id; a prefix another key
+// has gives ErrConflict
+func (m *sqlDBRepo) InsertAPIKey(k models.APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateAPIKey(k); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into api_keys (name, prefix, key_hash, scopes, rate_limit, expires_on, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		k.Name,
+		k.Prefix,
+		k.Hash,
+		strings.Join(k.Scopes, ","),
+		k.RateLimit,
+		k.ExpiresOn,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateAPIKey saves changes to the name, scopes, rate limit and expiry of
+// an API key; the key itself never changes
+func (m *sqlDBRepo) UpdateAPIKey(k models.APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	existing, err := m.GetAPIKeyByID(k.ID)
+	if err != nil {
+		return err
+	}
+
+	k.Prefix, k.Hash = existing.Prefix, existing.Hash
+	if err := validateAPIKey(k); err != nil {
+		return err
+	}
+
+	stmt := `update api_keys set name = $1, scopes = $2, rate_limit = $3, expires_on = $4, updated_at = $5
+		where id = $6`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		k.Name,
+		strings.Join(k.Scopes, ","),
+		k.RateLimit,
+		k.ExpiresOn,
+		time.Now(),
+		k.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("API key %d", k.ID))
+}
+
+// DeleteAPIKey removes an API key, requests made with it are refused from then on
+func (m *sqlDBRepo) DeleteAPIKey(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from api_keys where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("API key %d", id))
+}
@@ -0,0 +1,137 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllBlocks returns every block, the room restrictions that are not
+// reservations or holds, ordered by start date
+func (m *sqlDBRepo) AllBlocks() ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var blocks []models.RoomRestriction
+
+	query := `select` + blockColumns + `
+	from
+		room_restrictions rr
+		left join rooms rm on (rr.room_id = rm.id)
+		left join restrictions re on (rr.restriction_id = re.id)
+	where
+		rr.reservation_id is null and rr.restriction_id <> $1
+	order by
+		rr.start_date, rr.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, holdRestriction)
+	if err != nil {
+		return blocks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return blocks, err
+	}
+
+	return blocks, nil
+}
+
+// GetBlockByID gets a block by id
+func (m *sqlDBRepo) GetBlockByID(id int) (models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + blockColumns + `
+	from
+		room_restrictions rr
+		left join rooms rm on (rr.room_id = rm.id)
+		left join restrictions re on (rr.restriction_id = re.id)
+	where
+		rr.id = $1 and rr.reservation_id is null and rr.restriction_id <> $2`
+
+	b, err := scanBlock(m.DB.QueryRowContext(ctx, query, id, holdRestriction))
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, fmt.Errorf("block %d: %w", id, repository.ErrNotFound)
+	}
+
+	return b, err
+}
+
+// InsertBlock closes a room for a range of nights and returns the id of the
+// block. Without a restriction id it is an owner block; a room taken on any
+// of the nights gives ErrConflict
+func (m *sqlDBRepo) InsertBlock(r models.RoomRestriction, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if r.RestrictionID == 0 {
+		r.RestrictionID = blockRestriction
+	}
+	if err := validateBlock(r); err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = m.claimRoom(ctx, tx, r.RoomID, r.StartDate, r.EndDate, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+		created_at, updated_at, restriction_id)
+		values
+		($1, $2, $3, null, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		time.Now(),
+		time.Now(),
+		r.RestrictionID,
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteBlock opens the nights of a block again; reservations are cancelled, not deleted
+func (m *sqlDBRepo) DeleteBlock(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from room_restrictions where id = $1 and reservation_id is null and restriction_id <> $2`,
+		id, holdRestriction)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("block %d", id))
+}
@@ -0,0 +1,144 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllExchangeRates returns every exchange rate, ordered by currency code
+func (m *sqlDBRepo) AllExchangeRates() ([]models.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rates []models.ExchangeRate
+
+	query := `select` + exchangeRateColumns + ` from exchange_rates order by code`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanExchangeRate(rows)
+		if err != nil {
+			return rates, err
+		}
+		rates = append(rates, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+
+	return rates, nil
+}
+
+// GetExchangeRateByID gets an exchange rate by id
+func (m *sqlDBRepo) GetExchangeRateByID(id int) (models.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + exchangeRateColumns + ` from exchange_rates where id = $1`
+
+	r, err := scanExchangeRate(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, fmt.Errorf("exchange rate %d: %w", id, repository.ErrNotFound)
+	}
+
+	return r, err
+}
+
+// GetExchangeRateByCode gets the exchange rate of a currency, in any case
+func (m *sqlDBRepo) GetExchangeRateByCode(code string) (models.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	code = normalizeCurrencyCode(code)
+
+	query := `select` + exchangeRateColumns + ` from exchange_rates where code = $1`
+
+	r, err := scanExchangeRate(m.DB.QueryRowContext(ctx, query, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, fmt.Errorf("exchange rate %s: %w", code, repository.ErrNotFound)
+	}
+
+	return r, err
+}
+
+// InsertExchangeRate adds an exchange rate and returns its new id; a currency
+// that already has one gives ErrConflict
+func (m *sqlDBRepo) InsertExchangeRate(r models.ExchangeRate) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r.Code = normalizeCurrencyCode(r.Code)
+	if err := validateExchangeRate(r); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into exchange_rates (code, symbol, rate, created_at, updated_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		r.Code,
+		r.Symbol,
+		r.Rate,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateExchangeRate saves changes to an existing exchange rate
+func (m *sqlDBRepo) UpdateExchangeRate(r models.ExchangeRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r.Code = normalizeCurrencyCode(r.Code)
+	if err := validateExchangeRate(r); err != nil {
+		return err
+	}
+
+	stmt := `update exchange_rates set code = $1, symbol = $2, rate = $3, updated_at = $4
+		where id = $5`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		r.Code,
+		r.Symbol,
+		r.Rate,
+		time.Now(),
+		r.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("exchange rate %d", r.ID))
+}
+
+// DeleteExchangeRate removes an exchange rate
+func (m *sqlDBRepo) DeleteExchangeRate(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from exchange_rates where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("exchange rate %d", id))
+}
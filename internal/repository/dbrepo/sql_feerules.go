@@ -0,0 +1,162 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// queryFeeRules runs a fee rule query and scans every row
+func (m *sqlDBRepo) queryFeeRules(ctx context.Context, query string, args ...interface{}) ([]models.FeeRule, error) {
+	var rules []models.FeeRule
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanFeeRule(rows)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// AllFeeRules returns every fee rule, in the order they are added to a quote
+func (m *sqlDBRepo) AllFeeRules() ([]models.FeeRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + feeRuleColumns + `
+	from
+		fee_rules f
+		left join rooms r on (f.room_id = r.id)
+	order by
+		f.id`
+
+	return m.queryFeeRules(ctx, query)
+}
+
+// GetFeeRuleByID gets a fee rule by id
+func (m *sqlDBRepo) GetFeeRuleByID(id int) (models.FeeRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + feeRuleColumns + `
+	from
+		fee_rules f
+		left join rooms r on (f.room_id = r.id)
+	where
+		f.id = $1`
+
+	f, err := scanFeeRule(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return f, fmt.Errorf("fee rule %d: %w", id, repository.ErrNotFound)
+	}
+
+	return f, err
+}
+
+// InsertFeeRule adds a fee rule and returns its new id
+func (m *sqlDBRepo) InsertFeeRule(f models.FeeRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateFeeRule(f); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into fee_rules (name, kind, amount, tax, room_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		f.Name,
+		f.Kind,
+		f.Amount,
+		f.Tax,
+		nullID(f.RoomID),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateFeeRule saves changes to an existing fee rule
+func (m *sqlDBRepo) UpdateFeeRule(f models.FeeRule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateFeeRule(f); err != nil {
+		return err
+	}
+
+	stmt := `update fee_rules set name = $1, kind = $2, amount = $3, tax = $4, room_id = $5,
+		updated_at = $6
+		where id = $7`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		f.Name,
+		f.Kind,
+		f.Amount,
+		f.Tax,
+		nullID(f.RoomID),
+		time.Now(),
+		f.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("fee rule %d", f.ID))
+}
+
+// DeleteFeeRule removes a fee rule
+func (m *sqlDBRepo) DeleteFeeRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from fee_rules where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("fee rule %d", id))
+}
+
+// FeeRulesForRoom returns the fee rules for a room and for every room, in the
+// order they are added to a quote
+func (m *sqlDBRepo) FeeRulesForRoom(roomID int) ([]models.FeeRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + feeRuleColumns + `
+	from
+		fee_rules f
+		left join rooms r on (f.room_id = r.id)
+	where
+		f.room_id is null or f.room_id = $1
+	order by
+		f.id`
+
+	return m.queryFeeRules(ctx, query, roomID)
+}
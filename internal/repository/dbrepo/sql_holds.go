@@ -0,0 +1,93 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+)
+
+// PlaceHold holds a room for a guest filling in their reservation until the
+// hold's ExpiresAt, and returns the id of the hold. The hold h.ID, if set, is
+// released first so a guest keeps one hold as they change their stay; a room
+// taken on any of the nights gives ErrConflict
+func (m *sqlDBRepo) PlaceHold(h models.RoomRestriction, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateHold(h); err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = releaseHold(ctx, tx, h.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.claimRoom(ctx, tx, h.RoomID, h.StartDate, h.EndDate, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+		restriction_id, expires_at, created_at, updated_at)
+		values
+		($1, $2, $3, null, $4, $5, $6, $7) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		h.StartDate,
+		h.EndDate,
+		h.RoomID,
+		holdRestriction,
+		dbTime(h.ExpiresAt),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteHold lets go of a hold before it expires
+func (m *sqlDBRepo) DeleteHold(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = $2`, id, holdRestriction)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("hold %d", id))
+}
+
+// DeleteExpiredHolds deletes the holds that expired by now and returns how
+// many there were
+func (m *sqlDBRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from room_restrictions where restriction_id = $1 and expires_at <= $2`,
+		holdRestriction, dbTime(now))
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
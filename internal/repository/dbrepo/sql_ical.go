@@ -0,0 +1,71 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// RoomRestrictionsForRoom returns the reservations, blocks and live holds of
+// a room that end after since, ordered by start date
+func (m *sqlDBRepo) RoomRestrictionsForRoom(roomID int, since, now time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `select` + blockColumns + `
+	from
+		room_restrictions rr
+		left join rooms rm on (rr.room_id = rm.id)
+		left join restrictions re on (rr.restriction_id = re.id)
+	where
+		rr.room_id = $1 and rr.end_date > $2
+		and (rr.expires_at is null or rr.expires_at > $3)
+	order by
+		rr.start_date, rr.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, since, dbTime(now))
+	if err != nil {
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanBlock(rows)
+		if err != nil {
+			return restrictions, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// SetRoomICalToken changes the token the calendar feed of a room is read
+// with, the old feed URL stops working
+func (m *sqlDBRepo) SetRoomICalToken(roomID int, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if strings.TrimSpace(token) == "" {
+		return fmt.Errorf("%w: a calendar feed needs a token", repository.ErrInvalid)
+	}
+
+	stmt := `update rooms set ical_token = $1, updated_at = $2 where id = $3`
+
+	result, err := m.DB.ExecContext(ctx, stmt, token, time.Now(), roomID)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("room %d", roomID))
+}
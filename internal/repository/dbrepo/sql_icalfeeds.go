@@ -0,0 +1,256 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllICalFeeds returns every calendar feed, ordered by room
+func (m *sqlDBRepo) AllICalFeeds() ([]models.ICalFeed, error) {
+	return m.icalFeeds(`select` + icalFeedColumns + `
+	from
+		ical_feeds f
+		left join rooms rm on (f.room_id = rm.id)
+	order by
+		f.room_id, f.id`)
+}
+
+// ICalFeedsForRoom returns the calendar feeds of a room
+func (m *sqlDBRepo) ICalFeedsForRoom(roomID int) ([]models.ICalFeed, error) {
+	return m.icalFeeds(`select`+icalFeedColumns+`
+	from
+		ical_feeds f
+		left join rooms rm on (f.room_id = rm.id)
+	where
+		f.room_id = $1
+	order by
+		f.id`, roomID)
+}
+
+// icalFeeds runs a query selecting icalFeedColumns
+func (m *sqlDBRepo) icalFeeds(query string, args ...interface{}) ([]models.ICalFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var feeds []models.ICalFeed
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return feeds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanICalFeed(rows)
+		if err != nil {
+			return feeds, err
+		}
+		feeds = append(feeds, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return feeds, err
+	}
+
+	return feeds, nil
+}
+
+// GetICalFeedByID gets a calendar feed by id
+func (m *sqlDBRepo) GetICalFeedByID(id int) (models.ICalFeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + icalFeedColumns + `
+	from
+		ical_feeds f
+		left join rooms rm on (f.room_id = rm.id)
+	where
+		f.id = $1`
+
+	f, err := scanICalFeed(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return f, fmt.Errorf("calendar feed %d: %w", id, repository.ErrNotFound)
+	}
+
+	return f, err
+}
+
+// InsertICalFeed adds a calendar feed to a room and returns its new id
+func (m *sqlDBRepo) InsertICalFeed(f models.ICalFeed) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateICalFeed(f); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into ical_feeds (room_id, name, url, last_error, created_at, updated_at)
+		values ($1, $2, $3, '', $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		f.RoomID,
+		f.Name,
+		f.URL,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// DeleteICalFeed removes a calendar feed with the blocks imported from it
+func (m *sqlDBRepo) DeleteICalFeed(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where ical_feed_id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	result, err := tx.ExecContext(ctx, `delete from ical_feeds where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	if err = expectOneRow(result, fmt.Sprintf("calendar feed %d", id)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetICalFeedSynced saves when a calendar feed was last synced and why it
+// failed, lastError is empty if it didn't
+func (m *sqlDBRepo) SetICalFeedSynced(id int, at time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update ical_feeds set last_synced_at = $1, last_error = $2, updated_at = $3 where id = $4`
+
+	result, err := m.DB.ExecContext(ctx, stmt, dbTime(at), truncateError(lastError), time.Now(), id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("calendar feed %d", id))
+}
+
+// SyncICalFeed makes the external blocks of a calendar feed match its events,
+// keyed on ExternalUID. A block whose event is gone or moved is removed, an
+// event without a block gets one unless the room is taken on its nights.
+// Syncing the same events again changes nothing
+func (m *sqlDBRepo) SyncICalFeed(feedID int, events []models.RoomRestriction, now time.Time) (models.ICalSync, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var result models.ICalSync
+
+	events, byUID, err := externalEvents(events)
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var roomID int
+	err = tx.QueryRowContext(ctx, `select room_id from ical_feeds where id = $1`, feedID).Scan(&roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, fmt.Errorf("calendar feed %d: %w", feedID, repository.ErrNotFound)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	existing, err := feedBlocks(ctx, tx, `rr.ical_feed_id = $1`, feedID)
+	if err != nil {
+		return result, err
+	}
+
+	kept := make(map[string]bool)
+	for _, b := range existing {
+		if e, ok := byUID[b.ExternalUID]; ok && sameNights(e, b) {
+			kept[b.ExternalUID] = true
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1`, b.ID)
+		if err != nil {
+			return result, m.dbError(err)
+		}
+		result.Removed = append(result.Removed, b)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].StartDate.Before(events[j].StartDate) })
+
+	for _, e := range events {
+		if kept[e.ExternalUID] {
+			continue
+		}
+
+		e.RoomID = roomID
+		err = m.claimRoom(ctx, tx, roomID, e.StartDate, e.EndDate, now)
+		if errors.Is(err, repository.ErrConflict) {
+			result.Conflicts = append(result.Conflicts, e)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		var newID int
+
+		stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+			created_at, updated_at, restriction_id, ical_feed_id, external_uid)
+			values
+			($1, $2, $3, null, $4, $5, $6, $7, $8) returning id`
+
+		err = tx.QueryRowContext(ctx, stmt,
+			e.StartDate,
+			e.EndDate,
+			roomID,
+			time.Now(),
+			time.Now(),
+			externalRestriction,
+			feedID,
+			e.ExternalUID,
+		).Scan(&newID)
+		if err != nil {
+			return result, m.dbError(err)
+		}
+
+		added, err := feedBlocks(ctx, tx, `rr.id = $1`, newID)
+		if err != nil {
+			return result, err
+		}
+		result.Added = append(result.Added, added...)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// InsertInvoice issues an invoice with the next number and returns it. A
+// reservation has one invoice, a second fails with ErrConflict. When another
+// invoice takes the number first the next one is tried, so numbers have no gaps
+func (m *sqlDBRepo) InsertInvoice(inv models.Invoice) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateInvoice(inv); err != nil {
+		return inv, err
+	}
+
+	seller, err := json.Marshal(inv.Seller)
+	if err != nil {
+		return inv, err
+	}
+
+	if inv.IssuedAt.IsZero() {
+		inv.IssuedAt = time.Now()
+	}
+
+	for try := 0; try < maxInvoiceTries; try++ {
+		_, err = m.GetInvoiceByReservation(inv.ReservationID)
+		if err == nil {
+			return inv, fmt.Errorf("%w: reservation %d has an invoice", repository.ErrConflict, inv.ReservationID)
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return inv, err
+		}
+
+		err = m.DB.QueryRowContext(ctx, `select coalesce(max(number), 0) + 1 from invoices`).Scan(&inv.Number)
+		if err != nil {
+			return inv, err
+		}
+
+		now := time.Now()
+
+		stmt := `insert into invoices (number, reservation_id, seller, issued_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6) returning id`
+
+		err = m.DB.QueryRowContext(ctx, stmt,
+			inv.Number,
+			inv.ReservationID,
+			string(seller),
+			inv.IssuedAt,
+			now,
+			now,
+		).Scan(&inv.ID)
+		err = m.dbError(err)
+		if errors.Is(err, repository.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return inv, err
+		}
+
+		inv.CreatedAt = now
+		inv.UpdatedAt = now
+		return inv, nil
+	}
+
+	return inv, fmt.Errorf("%w: no free invoice number after %d tries", repository.ErrConflict, maxInvoiceTries)
+}
+
+// GetInvoiceByReservation gets the invoice of a reservation
+func (m *sqlDBRepo) GetInvoiceByReservation(reservationID int) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + invoiceColumns + ` from invoices where reservation_id = $1`
+
+	inv, err := scanInvoice(m.DB.QueryRowContext(ctx, query, reservationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return inv, fmt.Errorf("invoice of reservation %d: %w", reservationID, repository.ErrNotFound)
+	}
+
+	return inv, err
+}
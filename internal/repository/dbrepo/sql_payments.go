@@ -0,0 +1,257 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// GetReservationByPaymentIntent gets the reservation whose deposit or balance
+// is paid with a gateway intent
+func (m *sqlDBRepo) GetReservationByPaymentIntent(intentID string) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if intentID == "" {
+		return models.Reservation{}, fmt.Errorf("payment intent %q: %w", intentID, repository.ErrNotFound)
+	}
+
+	query := `select` + reservationColumns + `
+	from
+		reservation r
+		left join rooms rm on (r.room_id = rm.id)
+	where
+		r.payment_intent_id = $1 or r.balance_intent_id = $1`
+
+	res, err := scanReservation(m.DB.QueryRowContext(ctx, query, intentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, fmt.Errorf("payment intent %s: %w", intentID, repository.ErrNotFound)
+	}
+
+	return res, err
+}
+
+// UpdateReservationStatus moves a reservation from one status to another. It
+// fails with ErrConflict when the reservation is no longer in status from, so
+// only one of two concurrent updates wins
+func (m *sqlDBRepo) UpdateReservationStatus(id int, from, to string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateReservationStatus(to); err != nil {
+		return err
+	}
+
+	stmt := `update reservation set status = $1, updated_at = $2 where id = $3 and status = $4`
+
+	result, err := m.DB.ExecContext(ctx, stmt, to, time.Now(), id, from)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return nil
+	}
+
+	var status string
+	err = m.DB.QueryRowContext(ctx, `select status from reservation where id = $1`, id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: reservation %d is %s, not %s", repository.ErrConflict, id, status, from)
+}
+
+// SetBalanceIntent records the gateway intent the balance of a reservation is
+// paid with. It fails with ErrConflict when the balance already has one, so
+// the balance is asked for once
+func (m *sqlDBRepo) SetBalanceIntent(id int, intentID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if intentID == "" {
+		return fmt.Errorf("%w: the balance needs a payment intent", repository.ErrInvalid)
+	}
+
+	stmt := `update reservation set balance_intent_id = $1, updated_at = $2 where id = $3 and balance_intent_id = ''`
+
+	result, err := m.DB.ExecContext(ctx, stmt, intentID, time.Now(), id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return nil
+	}
+
+	var count int
+	err = m.DB.QueryRowContext(ctx, `select count(id) from reservation where id = $1`, id).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+	}
+
+	return fmt.Errorf("%w: the balance of reservation %d is already asked for", repository.ErrConflict, id)
+}
+
+// DueBalances returns the confirmed reservations whose balance is due on day
+// or before and has not been asked for yet, the earliest due first
+func (m *sqlDBRepo) DueBalances(day time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select` + reservationColumns + `
+	from
+		reservation r
+		left join rooms rm on (r.room_id = rm.id)
+	where
+		r.status = $1 and r.deposit < r.total and r.balance_due_date <= $2
+		and r.balance_intent_id = ''
+	order by
+		r.balance_due_date, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ReservationConfirmed, day)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// UnpaidReservations returns the reservations still waiting for their
+// deposit whose time to pay ran out by now, the earliest first
+func (m *sqlDBRepo) UnpaidReservations(now time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select` + reservationColumns + `
+	from
+		reservation r
+		left join rooms rm on (r.room_id = rm.id)
+	where
+		r.status = $1 and r.payment_expires_at <= $2
+	order by
+		r.payment_expires_at, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ReservationPendingPayment, dbTime(now))
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// InsertPayment adds an entry to the payments ledger and returns its new id.
+// An entry with the same kind and reference fails with ErrConflict, so an
+// event the gateway sends twice is recorded once
+func (m *sqlDBRepo) InsertPayment(p models.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validatePayment(p); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into payments (reservation_id, kind, amount, intent_id, reference, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Kind,
+		p.Amount,
+		p.IntentID,
+		p.Reference,
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// PaymentsForReservation returns the ledger of a reservation, oldest first
+func (m *sqlDBRepo) PaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var payments []models.Payment
+
+	query := `select` + paymentColumns + `
+	from
+		payments
+	where
+		reservation_id = $1
+	order by
+		id`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
@@ -0,0 +1,129 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllCancellationPolicies returns every cancellation policy, ordered by id
+func (m *sqlDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := `select` + cancellationPolicyColumns + ` from cancellation_policies order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanCancellationPolicy(rows)
+		if err != nil {
+			return policies, err
+		}
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+// GetCancellationPolicyByID gets a cancellation policy by id
+func (m *sqlDBRepo) GetCancellationPolicyByID(id int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + cancellationPolicyColumns + ` from cancellation_policies where id = $1`
+
+	p, err := scanCancellationPolicy(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("cancellation policy %d: %w", id, repository.ErrNotFound)
+	}
+
+	return p, err
+}
+
+// UpdateCancellationPolicy saves changes to a cancellation policy. Reservations
+// keep the policy they were made with
+func (m *sqlDBRepo) UpdateCancellationPolicy(p models.CancellationPolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateCancellationPolicy(p); err != nil {
+		return err
+	}
+
+	stmt := `update cancellation_policies set name = $1, deposit_percent = $2, balance_days = $3,
+		full_refund_days = $4, partial_refund_days = $5, partial_refund_percent = $6, updated_at = $7
+		where id = $8`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		p.Name,
+		p.DepositPercent,
+		p.BalanceDays,
+		p.FullRefundDays,
+		p.PartialRefundDays,
+		p.PartialRefundPercent,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("cancellation policy %d", p.ID))
+}
+
+// UpdateRoom saves changes to the name, rate and cancellation policy of a room
+func (m *sqlDBRepo) UpdateRoom(room models.Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, `select count(id) from cancellation_policies where id = $1`,
+		room.CancellationPolicyID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: cancellation policy %d does not exist", repository.ErrInvalid, room.CancellationPolicyID)
+	}
+
+	stmt := `update rooms set room_name = $1, nightly_rate = $2, cancellation_policy_id = $3,
+		max_occupancy = $4, beds = $5, included_guests = $6, extra_guest_rate = $7, updated_at = $8
+		where id = $9`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		room.RoomName,
+		room.NightlyRate,
+		room.CancellationPolicyID,
+		room.MaxOccupancy,
+		room.Beds,
+		room.IncludedGuests,
+		room.ExtraGuestRate,
+		time.Now(),
+		room.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("room %d", room.ID))
+}
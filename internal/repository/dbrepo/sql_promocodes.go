@@ -0,0 +1,161 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// queryPromoCodes runs a promo code query and scans every row
+func (m *sqlDBRepo) queryPromoCodes(ctx context.Context, query string, args ...interface{}) ([]models.PromoCode, error) {
+	var codes []models.PromoCode
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return codes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPromoCode(rows)
+		if err != nil {
+			return codes, err
+		}
+		codes = append(codes, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return codes, err
+	}
+
+	return codes, nil
+}
+
+// AllPromoCodes returns every promo code, ordered by code
+func (m *sqlDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + promoCodeColumns + ` from promo_codes order by code`
+
+	return m.queryPromoCodes(ctx, query)
+}
+
+// GetPromoCodeByID gets a promo code by id
+func (m *sqlDBRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + promoCodeColumns + ` from promo_codes where id = $1`
+
+	p, err := scanPromoCode(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("promo code %d: %w", id, repository.ErrNotFound)
+	}
+
+	return p, err
+}
+
+// GetPromoCodeByCode gets a promo code by the code guests type, in any case
+func (m *sqlDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	code = normalizePromoCode(code)
+
+	query := `select` + promoCodeColumns + ` from promo_codes where code = $1`
+
+	p, err := scanPromoCode(m.DB.QueryRowContext(ctx, query, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("promo code %s: %w", code, repository.ErrNotFound)
+	}
+
+	return p, err
+}
+
+// InsertPromoCode adds a promo code and returns its new id
+func (m *sqlDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	p.Code = normalizePromoCode(p.Code)
+	if err := validatePromoCode(p); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into promo_codes (code, kind, amount, valid_from, valid_to, max_uses,
+		uses, min_nights, room_ids, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.Code,
+		p.Kind,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MaxUses,
+		p.Uses,
+		p.MinNights,
+		encodeInts(p.RoomIDs),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdatePromoCode saves changes to a promo code; the use count is left alone
+func (m *sqlDBRepo) UpdatePromoCode(p models.PromoCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	p.Code = normalizePromoCode(p.Code)
+	if err := validatePromoCode(p); err != nil {
+		return err
+	}
+
+	stmt := `update promo_codes set code = $1, kind = $2, amount = $3, valid_from = $4,
+		valid_to = $5, max_uses = $6, min_nights = $7, room_ids = $8, updated_at = $9
+		where id = $10`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		p.Code,
+		p.Kind,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MaxUses,
+		p.MinNights,
+		encodeInts(p.RoomIDs),
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("promo code %d", p.ID))
+}
+
+// DeletePromoCode removes a promo code
+func (m *sqlDBRepo) DeletePromoCode(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from promo_codes where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("promo code %d", id))
+}
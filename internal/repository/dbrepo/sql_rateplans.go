@@ -0,0 +1,172 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// queryRatePlans runs a rate plan query and scans every row
+func (m *sqlDBRepo) queryRatePlans(ctx context.Context, query string, args ...interface{}) ([]models.RatePlan, error) {
+	var plans []models.RatePlan
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return plans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanRatePlan(rows)
+		if err != nil {
+			return plans, err
+		}
+		plans = append(plans, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return plans, err
+	}
+
+	return plans, nil
+}
+
+// AllRatePlans returns every rate plan, highest priority first
+func (m *sqlDBRepo) AllRatePlans() ([]models.RatePlan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + ratePlanColumns + `
+	from
+		rate_plans p
+		left join rooms r on (p.room_id = r.id)
+	order by
+		p.priority desc, p.start_date, p.id`
+
+	return m.queryRatePlans(ctx, query)
+}
+
+// GetRatePlanByID gets a rate plan by id
+func (m *sqlDBRepo) GetRatePlanByID(id int) (models.RatePlan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + ratePlanColumns + `
+	from
+		rate_plans p
+		left join rooms r on (p.room_id = r.id)
+	where
+		p.id = $1`
+
+	p, err := scanRatePlan(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("rate plan %d: %w", id, repository.ErrNotFound)
+	}
+
+	return p, err
+}
+
+// InsertRatePlan adds a rate plan and returns its new id
+func (m *sqlDBRepo) InsertRatePlan(p models.RatePlan) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateRatePlan(p); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into rate_plans (name, room_id, start_date, end_date, nightly_rate,
+		weekday_modifiers, priority, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.Name,
+		nullID(p.RoomID),
+		p.StartDate,
+		p.EndDate,
+		p.NightlyRate,
+		encodeModifiers(p.WeekdayModifiers),
+		p.Priority,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateRatePlan saves changes to an existing rate plan
+func (m *sqlDBRepo) UpdateRatePlan(p models.RatePlan) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateRatePlan(p); err != nil {
+		return err
+	}
+
+	stmt := `update rate_plans set name = $1, room_id = $2, start_date = $3, end_date = $4,
+		nightly_rate = $5, weekday_modifiers = $6, priority = $7, updated_at = $8
+		where id = $9`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		p.Name,
+		nullID(p.RoomID),
+		p.StartDate,
+		p.EndDate,
+		p.NightlyRate,
+		encodeModifiers(p.WeekdayModifiers),
+		p.Priority,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("rate plan %d", p.ID))
+}
+
+// DeleteRatePlan removes a rate plan
+func (m *sqlDBRepo) DeleteRatePlan(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from rate_plans where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("rate plan %d", id))
+}
+
+// RatePlansForRoom returns the plans for a room, or for every room, that
+// cover at least one night from start up to end
+func (m *sqlDBRepo) RatePlansForRoom(roomID int, start, end time.Time) ([]models.RatePlan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: the end date must be after the start date", repository.ErrInvalid)
+	}
+
+	query := `select` + ratePlanColumns + `
+	from
+		rate_plans p
+		left join rooms r on (p.room_id = r.id)
+	where
+		(p.room_id is null or p.room_id = $1)
+		and p.start_date < $2 and p.end_date >= $3
+	order by
+		p.priority desc, p.id desc`
+
+	return m.queryRatePlans(ctx, query, roomID, end, start)
+}
@@ -0,0 +1,136 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllReservations returns every reservation with its room, the latest stay first
+func (m *sqlDBRepo) AllReservations() ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select` + reservationColumns + `
+	from
+		reservation r
+		left join rooms rm on (r.room_id = rm.id)
+	order by
+		r.start_date desc, r.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetReservationByCode gets a reservation by its confirmation code, in any case
+func (m *sqlDBRepo) GetReservationByCode(code string) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return models.Reservation{}, fmt.Errorf("confirmation code %q: %w", code, repository.ErrNotFound)
+	}
+
+	query := `select` + reservationColumns + `
+	from
+		reservation r
+		left join rooms rm on (r.room_id = rm.id)
+	where
+		r.confirmation_code = $1`
+
+	res, err := scanReservation(m.DB.QueryRowContext(ctx, query, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, fmt.Errorf("confirmation code %s: %w", code, repository.ErrNotFound)
+	}
+
+	return res, err
+}
+
+// CancelReservation cancels a reservation and frees its room, in one
+// transaction. Cancelling it again fails with ErrConflict
+func (m *sqlDBRepo) CancelReservation(id int) error {
+	return m.cancelReservation(id, "")
+}
+
+// CancelUnpaidReservation cancels a reservation still waiting for its
+// deposit and frees its room, in one transaction. A reservation paid or
+// cancelled in the meantime fails with ErrConflict
+func (m *sqlDBRepo) CancelUnpaidReservation(id int) error {
+	return m.cancelReservation(id, models.ReservationPendingPayment)
+}
+
+// cancelReservation cancels a reservation with status from, or any that is
+// not cancelled when from is empty, deletes its room restriction and gives
+// back the use of its promo code
+func (m *sqlDBRepo) cancelReservation(id int, from string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update reservation set status = $1, updated_at = $2
+		where id = $3 and status <> $1 and ($4 = '' or status = $4)`
+
+	result, err := tx.ExecContext(ctx, stmt, models.ReservationCancelled, time.Now(), id, from)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var status string
+		err = tx.QueryRowContext(ctx, `select status from reservation where id = $1`, id).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("reservation %d: %w", id, repository.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: reservation %d is %s", repository.ErrConflict, id, status)
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = returnPromoCode(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
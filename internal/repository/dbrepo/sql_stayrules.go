@@ -0,0 +1,174 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// queryStayRules runs a stay rule query and scans every row
+func (m *sqlDBRepo) queryStayRules(ctx context.Context, query string, args ...interface{}) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanStayRule(rows)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// AllStayRules returns every stay rule, by start date
+func (m *sqlDBRepo) AllStayRules() ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + stayRuleColumns + `
+	from
+		stay_rules s
+		left join rooms r on (s.room_id = r.id)
+	order by
+		s.start_date, s.id`
+
+	return m.queryStayRules(ctx, query)
+}
+
+// GetStayRuleByID gets a stay rule by id
+func (m *sqlDBRepo) GetStayRuleByID(id int) (models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + stayRuleColumns + `
+	from
+		stay_rules s
+		left join rooms r on (s.room_id = r.id)
+	where
+		s.id = $1`
+
+	s, err := scanStayRule(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, fmt.Errorf("stay rule %d: %w", id, repository.ErrNotFound)
+	}
+
+	return s, err
+}
+
+// InsertStayRule adds a stay rule and returns its new id
+func (m *sqlDBRepo) InsertStayRule(s models.StayRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateStayRule(s); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into stay_rules (name, room_id, start_date, end_date, min_nights, max_nights,
+			closed_to_arrival, closed_to_departure, min_lead_days, max_lead_days, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		s.Name,
+		nullID(s.RoomID),
+		s.StartDate,
+		s.EndDate,
+		s.MinNights,
+		s.MaxNights,
+		encodeWeekdays(s.ClosedToArrival),
+		encodeWeekdays(s.ClosedToDeparture),
+		s.MinLeadDays,
+		s.MaxLeadDays,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateStayRule saves changes to an existing stay rule
+func (m *sqlDBRepo) UpdateStayRule(s models.StayRule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateStayRule(s); err != nil {
+		return err
+	}
+
+	stmt := `update stay_rules set name = $1, room_id = $2, start_date = $3, end_date = $4,
+		min_nights = $5, max_nights = $6, closed_to_arrival = $7, closed_to_departure = $8,
+		min_lead_days = $9, max_lead_days = $10, updated_at = $11
+		where id = $12`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		s.Name,
+		nullID(s.RoomID),
+		s.StartDate,
+		s.EndDate,
+		s.MinNights,
+		s.MaxNights,
+		encodeWeekdays(s.ClosedToArrival),
+		encodeWeekdays(s.ClosedToDeparture),
+		s.MinLeadDays,
+		s.MaxLeadDays,
+		time.Now(),
+		s.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("stay rule %d", s.ID))
+}
+
+// DeleteStayRule removes a stay rule
+func (m *sqlDBRepo) DeleteStayRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from stay_rules where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("stay rule %d", id))
+}
+
+// StayRulesForRoom returns the stay rules for a room and for every room, by
+// start date
+func (m *sqlDBRepo) StayRulesForRoom(roomID int) ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + stayRuleColumns + `
+	from
+		stay_rules s
+		left join rooms r on (s.room_id = r.id)
+	where
+		s.room_id is null or s.room_id = $1
+	order by
+		s.start_date, s.id`
+
+	return m.queryStayRules(ctx, query, roomID)
+}
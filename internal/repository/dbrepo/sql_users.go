@@ -0,0 +1,78 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// InsertUser adds a user, storing a bcrypt hash of u.Password
+func (m *sqlDBRepo) InsertUser(u models.User) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if strings.TrimSpace(u.Email) == "" || u.Password == "" {
+		return 0, fmt.Errorf("%w: a user needs an email and a password", repository.ErrInvalid)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into users (first_name, last_name, email, password, access_level,
+		created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		string(hashedPassword),
+		u.AccesLevel,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// Authenticate checks an email and password, returning the user id and password hash
+func (m *sqlDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	row := m.DB.QueryRowContext(ctx, `select id, password from users where email = $1`, email)
+	err := row.Scan(&id, &hashedPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", fmt.Errorf("%w: incorrect email or password", repository.ErrInvalid)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return 0, "", fmt.Errorf("%w: incorrect email or password", repository.ErrInvalid)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	return id, hashedPassword, nil
+}
@@ -0,0 +1,134 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// InsertWaitlistEntry puts a guest on the waitlist of a room and returns the
+// new entry's id. The entry starts waiting, with a new token unless it has one
+func (m *sqlDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateWaitlistEntry(e); err != nil {
+		return 0, err
+	}
+	if e.Token == "" {
+		e.Token = newWaitlistToken()
+	}
+
+	var newID int
+
+	stmt := `insert into waitlist_entries (room_id, start_date, end_date, adults, children,
+			first_name, last_name, email, token, status, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		e.RoomID,
+		e.StartDate,
+		e.EndDate,
+		e.Adults,
+		e.Children,
+		e.FirstName,
+		e.LastName,
+		e.Email,
+		e.Token,
+		models.WaitlistWaiting,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// GetWaitlistEntryByToken gets the waitlist entry a link was mailed for
+func (m *sqlDBRepo) GetWaitlistEntryByToken(token string) (models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + waitlistColumns + `
+	from
+		waitlist_entries w
+		left join rooms rm on (w.room_id = rm.id)
+	where
+		w.token = $1`
+
+	e, err := scanWaitlistEntry(m.DB.QueryRowContext(ctx, query, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return e, fmt.Errorf("waitlist entry: %w", repository.ErrNotFound)
+	}
+
+	return e, err
+}
+
+// OpenWaitlistEntries returns the entries waiting or notified, in the order
+// the guests joined
+func (m *sqlDBRepo) OpenWaitlistEntries() ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	query := `select` + waitlistColumns + `
+	from
+		waitlist_entries w
+		left join rooms rm on (w.room_id = rm.id)
+	where
+		w.status in ($1, $2)
+	order by
+		w.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.WaitlistWaiting, models.WaitlistNotified)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// UpdateWaitlistEntry saves the status of a waitlist entry, when its guest
+// was told and their turn ends, and the hold on the room meanwhile
+func (m *sqlDBRepo) UpdateWaitlistEntry(e models.WaitlistEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update waitlist_entries set status = $1, notified_at = $2, hold_expires_at = $3, hold_id = $4,
+		updated_at = $5 where id = $6`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		e.Status,
+		nullTime(e.NotifiedAt),
+		nullTime(e.HoldExpiresAt),
+		nullID(e.HoldID),
+		time.Now(),
+		e.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("waitlist entry %d", e.ID))
+}
@@ -0,0 +1,300 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// AllWebhooks returns every webhook, ordered by URL
+func (m *sqlDBRepo) AllWebhooks() ([]models.Webhook, error) {
+	return m.webhooks(`select` + webhookColumns + ` from webhooks order by url, id`)
+}
+
+// WebhooksForEvent returns the active webhooks subscribed to event
+func (m *sqlDBRepo) WebhooksForEvent(event string) ([]models.Webhook, error) {
+	all, err := m.webhooks(`select`+webhookColumns+` from webhooks where active = $1 order by id`, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []models.Webhook
+	for _, w := range all {
+		if w.Subscribes(event) {
+			hooks = append(hooks, w)
+		}
+	}
+
+	return hooks, nil
+}
+
+// webhooks runs a query selecting webhookColumns
+func (m *sqlDBRepo) webhooks(query string, args ...interface{}) ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hooks []models.Webhook
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return hooks, err
+		}
+		hooks = append(hooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+// GetWebhookByID gets a webhook by id
+func (m *sqlDBRepo) GetWebhookByID(id int) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + webhookColumns + ` from webhooks where id = $1`
+
+	w, err := scanWebhook(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return w, fmt.Errorf("webhook %d: %w", id, repository.ErrNotFound)
+	}
+
+	return w, err
+}
+
+// InsertWebhook adds a webhook and returns its new id
+func (m *sqlDBRepo) InsertWebhook(w models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateWebhook(w); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into webhooks (url, secret, events, active, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		w.URL,
+		w.Secret,
+		strings.Join(w.Events, ","),
+		w.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateWebhook saves changes to a webhook
+func (m *sqlDBRepo) UpdateWebhook(w models.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateWebhook(w); err != nil {
+		return err
+	}
+
+	stmt := `update webhooks set url = $1, secret = $2, events = $3, active = $4, updated_at = $5
+		where id = $6`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		w.URL,
+		w.Secret,
+		strings.Join(w.Events, ","),
+		w.Active,
+		time.Now(),
+		w.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("webhook %d", w.ID))
+}
+
+// DeleteWebhook removes a webhook with its deliveries
+func (m *sqlDBRepo) DeleteWebhook(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from webhooks where id = $1`, id)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("webhook %d", id))
+}
+
+// InsertWebhookDelivery queues an event for a webhook and returns the id of
+// the delivery
+func (m *sqlDBRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if d.Status == "" {
+		d.Status = models.DeliveryPending
+	}
+	if err := validateWebhookDelivery(d); err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	stmt := `insert into webhook_deliveries (webhook_id, event, payload, status, attempts,
+		response_code, last_error, next_attempt_at, delivered_at, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		d.WebhookID,
+		d.Event,
+		d.Payload,
+		d.Status,
+		d.Attempts,
+		d.ResponseCode,
+		truncateError(d.LastError),
+		dbTime(d.NextAttemptAt),
+		nullTime(d.DeliveredAt),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.dbError(err)
+	}
+
+	return newID, nil
+}
+
+// GetWebhookDeliveryByID gets a delivery by id, with the URL and secret of its webhook
+func (m *sqlDBRepo) GetWebhookDeliveryByID(id int) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select` + deliveryColumns + `
+	from
+		webhook_deliveries d
+		join webhooks w on (d.webhook_id = w.id)
+	where
+		d.id = $1`
+
+	d, err := scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, fmt.Errorf("webhook delivery %d: %w", id, repository.ErrNotFound)
+	}
+
+	return d, err
+}
+
+// UpdateWebhookDelivery records an attempt at a delivery: its status,
+// attempts, last response and when it is tried next
+func (m *sqlDBRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := validateWebhookDelivery(d); err != nil {
+		return err
+	}
+
+	stmt := `update webhook_deliveries set status = $1, attempts = $2, response_code = $3,
+		last_error = $4, next_attempt_at = $5, delivered_at = $6, updated_at = $7
+		where id = $8`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		d.Status,
+		d.Attempts,
+		d.ResponseCode,
+		truncateError(d.LastError),
+		dbTime(d.NextAttemptAt),
+		nullTime(d.DeliveredAt),
+		time.Now(),
+		d.ID,
+	)
+	if err != nil {
+		return m.dbError(err)
+	}
+
+	return expectOneRow(result, fmt.Sprintf("webhook delivery %d", d.ID))
+}
+
+// DueWebhookDeliveries returns the pending deliveries of active webhooks
+// due by now, the longest waiting first
+func (m *sqlDBRepo) DueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	query := `select` + deliveryColumns + `
+	from
+		webhook_deliveries d
+		join webhooks w on (d.webhook_id = w.id)
+	where
+		d.status = $1 and d.next_attempt_at <= $2 and w.active = $3
+	order by
+		d.next_attempt_at, d.id
+	limit 100`
+
+	return m.deliveries(query, models.DeliveryPending, dbTime(now), true)
+}
+
+// WebhookDeliveries returns the latest limit deliveries of a webhook, or of
+// every webhook when webhookID is 0, newest first; a limit of 0 returns them all
+func (m *sqlDBRepo) WebhookDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	query := `select` + deliveryColumns + `
+	from
+		webhook_deliveries d
+		join webhooks w on (d.webhook_id = w.id)
+	where
+		$1 = 0 or d.webhook_id = $1
+	order by
+		d.id desc`
+
+	if limit > 0 {
+		return m.deliveries(query+` limit $2`, webhookID, limit)
+	}
+
+	return m.deliveries(query, webhookID)
+}
+
+// deliveries runs a query selecting deliveryColumns
+func (m *sqlDBRepo) deliveries(query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,34 @@
+package dbrepo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDialect runs the repository on SQLite. It has no row locks, a
+// transaction is the only writer
+var sqliteDialect = dialect{
+	roomQuery: `select id from rooms where id = $1`,
+	dbError:   sqliteError,
+}
+
+// sqliteError translates constraint violations into the repository errors
+func sqliteError(err error) error {
+	var liteErr *sqlite.Error
+	if !errors.As(err, &liteErr) {
+		return err
+	}
+
+	switch liteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return fmt.Errorf("%w: %s", repository.ErrConflict, liteErr.Error())
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY, sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return fmt.Errorf("%w: %s", repository.ErrInvalid, liteErr.Error())
+	}
+
+	return err
+}
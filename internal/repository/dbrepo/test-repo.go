@@ -1,84 +0,0 @@
-package dbrepo
-
-import (
-	"errors"
-	"log"
-	"time"
-
-	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
-)
-
-func (m *testDBRepo) AllUsers() bool {
-	return true
-	
-}
-
-//InsertReservation insert a reservation into database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	// if the room id is 2, then fail; otherwise, pass
-	if res.RoomID == 2 {
-		return 0, errors.New("some error")
-	}
-
-	return 1, nil
-}
-
-//InsertRoomRestriction insert a room restrictioninto the database
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	if r.RoomID == 1000 {
-		return errors.New("some error")
-	}
-	return nil
-}
-
-//SerachAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
-func (m *testDBRepo) SerachAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error ){
-	return false, nil
-}
-
-
-// SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	var rooms []models.Room
-
-	// if the start date is after 2049-12-31, then return empty slice,
-	// indicating no rooms are available;
-	layout := "2006-01-02"
-	str := "2049-12-31"
-	t, err := time.Parse(layout, str)
-	if err != nil {
-		log.Println(err)
-	}
-
-	testDateToFail, err := time.Parse(layout, "2060-01-01")
-	if err != nil {
-		log.Println(err)
-	}
-
-	if start == testDateToFail {
-		return rooms, errors.New("some error")
-	}
-
-	if start.After(t) {
-		return rooms, nil
-	}
-
-	// otherwise, put an entry into the slice, indicating that some room is
-	// available for search dates
-	room := models.Room{
-		ID: 1,
-	}
-	rooms = append(rooms, room)
-
-	return rooms, nil
-}
-
-//GetRoomByID gets a room by id
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
-	var room models.Room
-
-	if id != 3 && id != 4 {
-		return room, errors.New("some error, room id does not exist")
-	}
-	return room, nil
-}
\ No newline at end of file
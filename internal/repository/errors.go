@@ -0,0 +1,18 @@
+package repository
+
+import "errors"
+
+// The errors every DatabaseRepo implementation returns, possibly wrapped with
+// more detail, so callers can test them with errors.Is
+var (
+	// ErrNotFound means the requested record does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict means the change collides with existing data, like a booking
+	// over dates that are already taken
+	ErrConflict = errors.New("conflict")
+
+	// ErrInvalid means the input was rejected, like a stay that ends before it
+	// starts or a reference to a room that does not exist
+	ErrInvalid = errors.New("invalid")
+)
@@ -9,9 +9,115 @@ import (
 type DatabaseRepo interface {
 	AllUsers() bool
 
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SerachAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error )
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
+	InsertReservation(res models.Reservation, now time.Time) (int, error)
+	CreateBooking(res models.Reservation, now time.Time) (int, error)
+	InsertRoomRestriction(r models.RoomRestriction, now time.Time) error
+	SerachAvailabilityByDatesByRoomID(start, end time.Time, roomID int, now time.Time) (bool, error )
+	SearchAvailabilityForAllRooms(start, end time.Time, guests int, now time.Time) ([]models.Room, error)
 	GetRoomByID(id int) (models.Room, error)
+	GetReservationByID(id int) (models.Reservation, error)
+	GetReservationByPaymentIntent(intentID string) (models.Reservation, error)
+	GetReservationByCode(code string) (models.Reservation, error)
+	AllReservations() ([]models.Reservation, error)
+	UpdateReservationStatus(id int, from, to string) error
+	CancelReservation(id int) error
+	AllRooms() ([]models.Room, error)
+	UpdateRoom(room models.Room) error
+
+	InsertUser(u models.User) (int, error)
+	Authenticate(email, testPassword string) (int, string, error)
+
+	AllRatePlans() ([]models.RatePlan, error)
+	GetRatePlanByID(id int) (models.RatePlan, error)
+	InsertRatePlan(p models.RatePlan) (int, error)
+	UpdateRatePlan(p models.RatePlan) error
+	DeleteRatePlan(id int) error
+	RatePlansForRoom(roomID int, start, end time.Time) ([]models.RatePlan, error)
+
+	AllPromoCodes() ([]models.PromoCode, error)
+	GetPromoCodeByID(id int) (models.PromoCode, error)
+	GetPromoCodeByCode(code string) (models.PromoCode, error)
+	InsertPromoCode(p models.PromoCode) (int, error)
+	UpdatePromoCode(p models.PromoCode) error
+	DeletePromoCode(id int) error
+
+	AllFeeRules() ([]models.FeeRule, error)
+	GetFeeRuleByID(id int) (models.FeeRule, error)
+	InsertFeeRule(f models.FeeRule) (int, error)
+	UpdateFeeRule(f models.FeeRule) error
+	DeleteFeeRule(id int) error
+	FeeRulesForRoom(roomID int) ([]models.FeeRule, error)
+
+	AllCancellationPolicies() ([]models.CancellationPolicy, error)
+	GetCancellationPolicyByID(id int) (models.CancellationPolicy, error)
+	UpdateCancellationPolicy(p models.CancellationPolicy) error
+
+	InsertPayment(p models.Payment) (int, error)
+	PaymentsForReservation(reservationID int) ([]models.Payment, error)
+	SetBalanceIntent(id int, intentID string) error
+	DueBalances(day time.Time) ([]models.Reservation, error)
+	UnpaidReservations(now time.Time) ([]models.Reservation, error)
+	CancelUnpaidReservation(id int) error
+
+	InsertInvoice(inv models.Invoice) (models.Invoice, error)
+	GetInvoiceByReservation(reservationID int) (models.Invoice, error)
+
+	AllExchangeRates() ([]models.ExchangeRate, error)
+	GetExchangeRateByID(id int) (models.ExchangeRate, error)
+	GetExchangeRateByCode(code string) (models.ExchangeRate, error)
+	InsertExchangeRate(r models.ExchangeRate) (int, error)
+	UpdateExchangeRate(r models.ExchangeRate) error
+	DeleteExchangeRate(id int) error
+
+	AllStayRules() ([]models.StayRule, error)
+	GetStayRuleByID(id int) (models.StayRule, error)
+	InsertStayRule(s models.StayRule) (int, error)
+	UpdateStayRule(s models.StayRule) error
+	DeleteStayRule(id int) error
+	StayRulesForRoom(roomID int) ([]models.StayRule, error)
+
+	AllAPIKeys() ([]models.APIKey, error)
+	GetAPIKeyByID(id int) (models.APIKey, error)
+	GetAPIKeyByPrefix(prefix string) (models.APIKey, error)
+	InsertAPIKey(k models.APIKey) (int, error)
+	UpdateAPIKey(k models.APIKey) error
+	DeleteAPIKey(id int) error
+
+	AllBlocks() ([]models.RoomRestriction, error)
+	GetBlockByID(id int) (models.RoomRestriction, error)
+	InsertBlock(r models.RoomRestriction, now time.Time) (int, error)
+	DeleteBlock(id int) error
+
+	AllWebhooks() ([]models.Webhook, error)
+	WebhooksForEvent(event string) ([]models.Webhook, error)
+	GetWebhookByID(id int) (models.Webhook, error)
+	InsertWebhook(w models.Webhook) (int, error)
+	UpdateWebhook(w models.Webhook) error
+	DeleteWebhook(id int) error
+
+	InsertWebhookDelivery(d models.WebhookDelivery) (int, error)
+	GetWebhookDeliveryByID(id int) (models.WebhookDelivery, error)
+	UpdateWebhookDelivery(d models.WebhookDelivery) error
+	DueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error)
+	WebhookDeliveries(webhookID, limit int) ([]models.WebhookDelivery, error)
+
+	RoomRestrictionsForRoom(roomID int, since, now time.Time) ([]models.RoomRestriction, error)
+	SetRoomICalToken(roomID int, token string) error
+
+	AllICalFeeds() ([]models.ICalFeed, error)
+	ICalFeedsForRoom(roomID int) ([]models.ICalFeed, error)
+	GetICalFeedByID(id int) (models.ICalFeed, error)
+	InsertICalFeed(f models.ICalFeed) (int, error)
+	DeleteICalFeed(id int) error
+	SetICalFeedSynced(id int, at time.Time, lastError string) error
+	SyncICalFeed(feedID int, events []models.RoomRestriction, now time.Time) (models.ICalSync, error)
+
+	InsertWaitlistEntry(e models.WaitlistEntry) (int, error)
+	GetWaitlistEntryByToken(token string) (models.WaitlistEntry, error)
+	OpenWaitlistEntries() ([]models.WaitlistEntry, error)
+	UpdateWaitlistEntry(e models.WaitlistEntry) error
+
+	PlaceHold(h models.RoomRestriction, now time.Time) (int, error)
+	DeleteHold(id int) error
+	DeleteExpiredHolds(now time.Time) (int, error)
 }
\ No newline at end of file
@@ -0,0 +1,2323 @@
+// Package repotest holds the contract every repository.DatabaseRepo
+// implementation must satisfy. Implementations run it from their own tests:
+//
+//	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo { ... })
+package repotest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// Factory returns an empty repository for one test. It must hold the seeded
+// rooms 1 and 2, the restriction types 1 (Reservation) and 2 (Owner Block) and
+// the cancellation policies 1 to 3 (Flexible, Moderate and Strict), and
+// nothing else. Tests that change seeded rows put them back
+type Factory func(t *testing.T) repository.DatabaseRepo
+
+// now is when the contract runs, for the calls that ask: the holds the
+// tests place expire after it
+var now = time.Date(2049, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+// date returns midnight UTC of a day in January 2050
+func date(day int) time.Time {
+	return time.Date(2050, time.January, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Run runs the whole contract against repositories made by newRepo
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("GetRoomByID", func(t *testing.T) { testGetRoomByID(t, newRepo(t)) })
+	t.Run("InsertReservation", func(t *testing.T) { testInsertReservation(t, newRepo(t)) })
+	t.Run("GetReservationByID", func(t *testing.T) { testGetReservationByID(t, newRepo(t)) })
+	t.Run("InsertRoomRestriction", func(t *testing.T) { testInsertRoomRestriction(t, newRepo(t)) })
+	t.Run("SerachAvailabilityByDatesByRoomID", func(t *testing.T) { testAvailabilityByRoom(t, newRepo(t)) })
+	t.Run("SearchAvailabilityForAllRooms", func(t *testing.T) { testAvailabilityForAllRooms(t, newRepo(t)) })
+	t.Run("AllRooms", func(t *testing.T) { testAllRooms(t, newRepo(t)) })
+	t.Run("Authenticate", func(t *testing.T) { testAuthenticate(t, newRepo(t)) })
+	t.Run("RatePlans", func(t *testing.T) { testRatePlans(t, newRepo(t)) })
+	t.Run("PromoCodes", func(t *testing.T) { testPromoCodes(t, newRepo(t)) })
+	t.Run("CreateBooking", func(t *testing.T) { testCreateBooking(t, newRepo(t)) })
+	t.Run("FeeRules", func(t *testing.T) { testFeeRules(t, newRepo(t)) })
+	t.Run("ReservationStatus", func(t *testing.T) { testReservationStatus(t, newRepo(t)) })
+	t.Run("CancellationPolicies", func(t *testing.T) { testCancellationPolicies(t, newRepo(t)) })
+	t.Run("UpdateRoom", func(t *testing.T) { testUpdateRoom(t, newRepo(t)) })
+	t.Run("CancelReservation", func(t *testing.T) { testCancelReservation(t, newRepo(t)) })
+	t.Run("PaymentSchedule", func(t *testing.T) { testPaymentSchedule(t, newRepo(t)) })
+	t.Run("Payments", func(t *testing.T) { testPayments(t, newRepo(t)) })
+	t.Run("Invoices", func(t *testing.T) { testInvoices(t, newRepo(t)) })
+	t.Run("ExchangeRates", func(t *testing.T) { testExchangeRates(t, newRepo(t)) })
+	t.Run("StayRules", func(t *testing.T) { testStayRules(t, newRepo(t)) })
+	t.Run("Guests", func(t *testing.T) { testGuests(t, newRepo(t)) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, newRepo(t)) })
+	t.Run("Blocks", func(t *testing.T) { testBlocks(t, newRepo(t)) })
+	t.Run("Webhooks", func(t *testing.T) { testWebhooks(t, newRepo(t)) })
+	t.Run("WebhookDeliveries", func(t *testing.T) { testWebhookDeliveries(t, newRepo(t)) })
+	t.Run("RoomCalendar", func(t *testing.T) { testRoomCalendar(t, newRepo(t)) })
+	t.Run("ICalFeeds", func(t *testing.T) { testICalFeeds(t, newRepo(t)) })
+	t.Run("SyncICalFeed", func(t *testing.T) { testSyncICalFeed(t, newRepo(t)) })
+	t.Run("Waitlist", func(t *testing.T) { testWaitlist(t, newRepo(t)) })
+	t.Run("Holds", func(t *testing.T) { testHolds(t, newRepo(t)) })
+	t.Run("UnpaidReservations", func(t *testing.T) { testUnpaidReservations(t, newRepo(t)) })
+}
+
+// book stores a reservation with its room restriction, failing the test on error
+func book(t *testing.T, repo repository.DatabaseRepo, roomID int, start, end time.Time) int {
+	t.Helper()
+
+	id, err := repo.InsertReservation(models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@example.com",
+		Phone:     "555 555 555",
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    roomID,
+	}, now)
+	if err != nil {
+		t.Fatalf("InsertReservation: %s", err)
+	}
+
+	err = repo.InsertRoomRestriction(models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        roomID,
+		ReservationID: id,
+		RestrictionID: 1,
+	}, now)
+	if err != nil {
+		t.Fatalf("InsertRoomRestriction: %s", err)
+	}
+
+	return id
+}
+
+func testGetRoomByID(t *testing.T, repo repository.DatabaseRepo) {
+	room, err := repo.GetRoomByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.ID != 1 || room.RoomName == "" || room.NightlyRate <= 0 || room.MaxOccupancy != 2 || room.Beds != 1 || room.IncludedGuests != 2 || room.ExtraGuestRate != 0 {
+		t.Errorf("got room %+v for id 1", room)
+	}
+
+	_, err = repo.GetRoomByID(1000)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a room that does not exist, wanted ErrNotFound", err)
+	}
+}
+
+func testInsertReservation(t *testing.T, repo repository.DatabaseRepo) {
+	first := book(t, repo, 1, date(10), date(12))
+	second := book(t, repo, 2, date(10), date(12))
+
+	if first <= 0 || second <= 0 {
+		t.Errorf("got reservation ids %d and %d, wanted positive ids", first, second)
+	}
+	if first == second {
+		t.Errorf("two reservations got the same id %d", first)
+	}
+
+	tests := []struct {
+		name   string
+		roomID int
+		start  int
+		end    int
+		want   error
+	}{
+		{"room does not exist", 1000, 10, 12, repository.ErrInvalid},
+		{"ends before it starts", 1, 22, 20, repository.ErrInvalid},
+		{"no nights", 1, 20, 20, repository.ErrInvalid},
+		{"dates taken", 1, 11, 13, repository.ErrConflict},
+	}
+
+	for _, e := range tests {
+		_, err := repo.InsertReservation(models.Reservation{
+			Email:     "john@example.com",
+			StartDate: date(e.start),
+			EndDate:   date(e.end),
+			RoomID:    e.roomID,
+		}, now)
+		if !errors.Is(err, e.want) {
+			t.Errorf("%s: got error %v, wanted %v", e.name, err, e.want)
+		}
+	}
+}
+
+func testInsertRoomRestriction(t *testing.T, repo repository.DatabaseRepo) {
+	// an owner block has no reservation behind it
+	err := repo.InsertRoomRestriction(models.RoomRestriction{
+		StartDate:     date(20),
+		EndDate:       date(22),
+		RoomID:        2,
+		RestrictionID: 2,
+	}, now)
+	if err != nil {
+		t.Fatalf("owner block: %s", err)
+	}
+
+	available, err := repo.SerachAvailabilityByDatesByRoomID(date(21), date(23), 2, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("room 2 is available over an owner block")
+	}
+
+	tests := []struct {
+		name          string
+		roomID        int
+		start         int
+		end           int
+		restrictionID int
+		want          error
+	}{
+		{"room does not exist", 1000, 20, 22, 2, repository.ErrInvalid},
+		{"restriction type does not exist", 1, 20, 22, 1000, repository.ErrInvalid},
+		{"ends before it starts", 1, 22, 20, 2, repository.ErrInvalid},
+		{"overlaps the block", 2, 19, 21, 2, repository.ErrConflict},
+	}
+
+	for _, e := range tests {
+		err := repo.InsertRoomRestriction(models.RoomRestriction{
+			StartDate:     date(e.start),
+			EndDate:       date(e.end),
+			RoomID:        e.roomID,
+			RestrictionID: e.restrictionID,
+		}, now)
+		if !errors.Is(err, e.want) {
+			t.Errorf("%s: got error %v, wanted %v", e.name, err, e.want)
+		}
+	}
+}
+
+func testAvailabilityByRoom(t *testing.T, repo repository.DatabaseRepo) {
+	// room 1 is taken from the 10th (check in) to the 15th (check out)
+	book(t, repo, 1, date(10), date(15))
+
+	tests := []struct {
+		name      string
+		roomID    int
+		start     int
+		end       int
+		available bool
+	}{
+		{"check in on the checkout day", 1, 15, 17, true},
+		{"check out on the check in day", 1, 8, 10, true},
+		{"well before", 1, 1, 5, true},
+		{"overlaps the start", 1, 9, 11, false},
+		{"overlaps the end", 1, 14, 16, false},
+		{"inside the stay", 1, 11, 12, false},
+		{"around the stay", 1, 9, 16, false},
+		{"same dates", 1, 10, 15, false},
+		{"other room", 2, 10, 15, true},
+	}
+
+	for _, e := range tests {
+		available, err := repo.SerachAvailabilityByDatesByRoomID(date(e.start), date(e.end), e.roomID, now)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		if available != e.available {
+			t.Errorf("%s: got available %t, wanted %t", e.name, available, e.available)
+		}
+	}
+
+	_, err := repo.SerachAvailabilityByDatesByRoomID(date(20), date(18), 1, now)
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a search that ends before it starts, wanted ErrInvalid", err)
+	}
+}
+
+func testAvailabilityForAllRooms(t *testing.T, repo repository.DatabaseRepo) {
+	book(t, repo, 1, date(10), date(15))
+
+	// room 1 sleeps 2 and room 2 sleeps 4
+	tests := []struct {
+		name   string
+		start  int
+		end    int
+		guests int
+		rooms  []int
+	}{
+		{"room 1 taken", 12, 14, 1, []int{2}},
+		{"back to back with the stay", 15, 18, 2, []int{1, 2}},
+		{"before the stay", 5, 10, 1, []int{1, 2}},
+		{"too many for room 1", 5, 10, 3, []int{2}},
+		{"too many for every room", 5, 10, 5, nil},
+	}
+
+	for _, e := range tests {
+		rooms, err := repo.SearchAvailabilityForAllRooms(date(e.start), date(e.end), e.guests, now)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+
+		if len(rooms) != len(e.rooms) {
+			t.Errorf("%s: got rooms %v, wanted ids %v", e.name, rooms, e.rooms)
+			continue
+		}
+
+		// rooms come back in id order on every driver
+		for i, room := range rooms {
+			if room.ID != e.rooms[i] {
+				t.Errorf("%s: got rooms %v, wanted ids %v in order", e.name, rooms, e.rooms)
+			}
+			if room.RoomName == "" {
+				t.Errorf("%s: room %d has no name", e.name, room.ID)
+			}
+			if room.MaxOccupancy < e.guests || room.Beds < 1 {
+				t.Errorf("%s: room %d sleeps %d in %d beds", e.name, room.ID, room.MaxOccupancy, room.Beds)
+			}
+		}
+	}
+
+	book(t, repo, 2, date(11), date(13))
+
+	rooms, err := repo.SearchAvailabilityForAllRooms(date(12), date(14), 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 0 {
+		t.Errorf("got rooms %v when both are taken", rooms)
+	}
+
+	_, err = repo.SearchAvailabilityForAllRooms(date(20), date(20), 1, now)
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a search without nights, wanted ErrInvalid", err)
+	}
+}
+
+func testGetReservationByID(t *testing.T, repo repository.DatabaseRepo) {
+	quote := models.Quote{
+		RoomID:    2,
+		StartDate: date(10),
+		EndDate:   date(12),
+		Nights: []models.NightPrice{
+			{Date: date(10), Amount: 10000},
+			{Date: date(11), Amount: 12000},
+		},
+		Subtotal: 22000,
+		Fees: []models.Fee{
+			{Name: "Cleaning", Amount: 3000},
+			{Name: "City tax", Tax: true, Amount: 400},
+		},
+		FeesTotal: 3000,
+		TaxTotal:  400,
+		Total:     25400,
+	}
+
+	id, err := repo.InsertReservation(models.Reservation{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     "jane@example.com",
+		StartDate: date(10),
+		EndDate:   date(12),
+		RoomID:    2,
+		Quote:     quote,
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != id || res.LastName != "Doe" || res.Room.ID != 2 || res.Room.RoomName == "" {
+		t.Errorf("got reservation %+v", res)
+	}
+	if !res.StartDate.Equal(date(10)) || !res.EndDate.Equal(date(12)) {
+		t.Errorf("got dates %s - %s, wanted %s - %s", res.StartDate, res.EndDate, date(10), date(12))
+	}
+	if res.Quote.Total != quote.Total || len(res.Quote.Nights) != 2 || res.Quote.Nights[1].Amount != 12000 ||
+		len(res.Quote.Fees) != 2 || !res.Quote.Fees[1].Tax || res.Quote.TaxTotal != 400 {
+		t.Errorf("got quote %+v, wanted %+v", res.Quote, quote)
+	}
+
+	_, err = repo.GetReservationByID(id + 1000)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a reservation that does not exist, wanted ErrNotFound", err)
+	}
+}
+
+func testAllRooms(t *testing.T, repo repository.DatabaseRepo) {
+	rooms, err := repo.AllRooms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 || rooms[0].ID != 1 || rooms[1].ID != 2 {
+		t.Errorf("got rooms %+v, wanted rooms 1 and 2", rooms)
+	}
+}
+
+func testAuthenticate(t *testing.T, repo repository.DatabaseRepo) {
+	id, err := repo.InsertUser(models.User{
+		FirstName:  "Admin",
+		Email:      "admin@example.com",
+		Password:   "secret",
+		AccesLevel: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertUser(models.User{Email: "admin@example.com", Password: "other"})
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a duplicate email, wanted ErrConflict", err)
+	}
+
+	gotID, hash, err := repo.Authenticate("admin@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotID != id || hash == "" || hash == "secret" {
+		t.Errorf("got id %d and hash %q, wanted id %d and a password hash", gotID, hash, id)
+	}
+
+	_, _, err = repo.Authenticate("admin@example.com", "wrong")
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a wrong password, wanted ErrInvalid", err)
+	}
+
+	_, _, err = repo.Authenticate("nobody@example.com", "secret")
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for an unknown email, wanted ErrInvalid", err)
+	}
+}
+
+func testRatePlans(t *testing.T, repo repository.DatabaseRepo) {
+	var weekend [7]int
+	weekend[time.Saturday] = 25
+
+	// every room, 5th to 10th
+	allID, err := repo.InsertRatePlan(models.RatePlan{
+		Name:             "Winter",
+		StartDate:        date(5),
+		EndDate:          date(10),
+		NightlyRate:      8000,
+		WeekdayModifiers: weekend,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room 2 only, 8th to 20th
+	roomID, err := repo.InsertRatePlan(models.RatePlan{
+		Name:      "Suite special",
+		RoomID:    2,
+		StartDate: date(8),
+		EndDate:   date(20),
+		Priority:  3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := repo.GetRatePlanByID(allID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Winter" || p.RoomID != 0 || p.NightlyRate != 8000 || p.WeekdayModifiers != weekend {
+		t.Errorf("got rate plan %+v", p)
+	}
+	if !p.StartDate.Equal(date(5)) || !p.EndDate.Equal(date(10)) {
+		t.Errorf("got dates %s - %s, wanted %s - %s", p.StartDate, p.EndDate, date(5), date(10))
+	}
+
+	plans, err := repo.AllRatePlans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 2 || plans[0].ID != roomID || plans[0].Room.RoomName == "" {
+		t.Errorf("got plans %+v, wanted the room 2 plan first", plans)
+	}
+
+	tests := []struct {
+		name   string
+		roomID int
+		start  time.Time
+		end    time.Time
+		want   int
+	}{
+		{"before both", 2, date(1), date(5), 0},
+		{"first night of a plan", 2, date(4), date(6), 1},
+		{"last night of a plan", 1, date(10), date(11), 1},
+		{"day after a plan", 1, date(11), date(12), 0},
+		{"both plans", 2, date(9), date(10), 2},
+		{"other room plan left out", 1, date(9), date(10), 1},
+	}
+
+	for _, tt := range tests {
+		plans, err := repo.RatePlansForRoom(tt.roomID, tt.start, tt.end)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if len(plans) != tt.want {
+			t.Errorf("%s: got %d plans, wanted %d", tt.name, len(plans), tt.want)
+		}
+	}
+
+	p.NightlyRate = 9000
+	p.RoomID = 1
+	if err := repo.UpdateRatePlan(p); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = repo.GetRatePlanByID(allID)
+	if p.NightlyRate != 9000 || p.RoomID != 1 {
+		t.Errorf("got rate plan %+v after update", p)
+	}
+
+	p.EndDate = date(1)
+	if err := repo.UpdateRatePlan(p); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for an end date before the start date, wanted ErrInvalid", err)
+	}
+
+	_, err = repo.InsertRatePlan(models.RatePlan{Name: "Nowhere", RoomID: 1000, StartDate: date(1), EndDate: date(2)})
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a room that does not exist, wanted ErrInvalid", err)
+	}
+
+	if err := repo.DeleteRatePlan(allID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetRatePlanByID(allID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a deleted plan, wanted ErrNotFound", err)
+	}
+	if err := repo.DeleteRatePlan(allID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+	p.ID = allID
+	p.EndDate = date(10)
+	if err := repo.UpdateRatePlan(p); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a deleted plan, wanted ErrNotFound", err)
+	}
+}
+
+func testPromoCodes(t *testing.T, repo repository.DatabaseRepo) {
+	id, err := repo.InsertPromoCode(models.PromoCode{
+		Code:      " summer10 ",
+		Kind:      models.PromoPercent,
+		Amount:    10,
+		ValidFrom: date(1),
+		ValidTo:   date(31),
+		MaxUses:   5,
+		MinNights: 2,
+		RoomIDs:   []int{1, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := repo.GetPromoCodeByCode("Summer10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != id || p.Code != "SUMMER10" || p.Amount != 10 || p.MaxUses != 5 || p.MinNights != 2 || len(p.RoomIDs) != 2 || p.RoomIDs[1] != 2 {
+		t.Errorf("got promo code %+v", p)
+	}
+	if !p.ValidFrom.Equal(date(1)) || !p.ValidTo.Equal(date(31)) {
+		t.Errorf("got validity %s - %s, wanted %s - %s", p.ValidFrom, p.ValidTo, date(1), date(31))
+	}
+
+	_, err = repo.InsertPromoCode(models.PromoCode{Code: "SUMMER10", Kind: models.PromoFixed, Amount: 500, ValidFrom: date(1), ValidTo: date(2)})
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a duplicate code, wanted ErrConflict", err)
+	}
+
+	invalid := []models.PromoCode{
+		{Code: "BAD CODE", Kind: models.PromoFixed, Amount: 500, ValidFrom: date(1), ValidTo: date(2)},
+		{Code: "TOOMUCH", Kind: models.PromoPercent, Amount: 101, ValidFrom: date(1), ValidTo: date(2)},
+		{Code: "NOKIND", Kind: "free", Amount: 1, ValidFrom: date(1), ValidTo: date(2)},
+		{Code: "BACKWARDS", Kind: models.PromoFixed, Amount: 500, ValidFrom: date(2), ValidTo: date(1)},
+	}
+	for _, p := range invalid {
+		if _, err := repo.InsertPromoCode(p); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %+v, wanted ErrInvalid", err, p)
+		}
+	}
+
+	p.Kind = models.PromoFixed
+	p.Amount = 2500
+	p.RoomIDs = nil
+	if err := repo.UpdatePromoCode(p); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = repo.GetPromoCodeByID(id)
+	if p.Kind != models.PromoFixed || p.Amount != 2500 || len(p.RoomIDs) != 0 {
+		t.Errorf("got promo code %+v after update", p)
+	}
+
+	codes, err := repo.AllPromoCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 1 {
+		t.Errorf("got %d promo codes, wanted 1", len(codes))
+	}
+
+	if err := repo.DeletePromoCode(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetPromoCodeByCode("SUMMER10"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a deleted code, wanted ErrNotFound", err)
+	}
+	if err := repo.DeletePromoCode(id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testCreateBooking(t *testing.T, repo repository.DatabaseRepo) {
+	_, err := repo.InsertPromoCode(models.PromoCode{
+		Code:      "ONCE",
+		Kind:      models.PromoFixed,
+		Amount:    1000,
+		ValidFrom: date(1),
+		ValidTo:   date(31),
+		MaxUses:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@example.com",
+		StartDate: date(10),
+		EndDate:   date(12),
+		RoomID:    1,
+		Quote:     models.Quote{Subtotal: 20000, PromoCode: "once", Discount: 1000, Total: 19000},
+	}
+
+	id, err := repo.CreateBooking(res, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Quote.PromoCode != "once" || saved.Quote.Discount != 1000 || saved.Quote.Total != 19000 {
+		t.Errorf("got quote %+v", saved.Quote)
+	}
+
+	available, err := repo.SerachAvailabilityByDatesByRoomID(date(10), date(12), 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("the booked room is still available")
+	}
+
+	p, _ := repo.GetPromoCodeByCode("ONCE")
+	if p.Uses != 1 {
+		t.Errorf("got %d uses, wanted 1", p.Uses)
+	}
+
+	// the only use is gone, so the whole booking fails and room 2 stays free
+	res.RoomID = 2
+	_, err = repo.CreateBooking(res, now)
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a used up code, wanted ErrConflict", err)
+	}
+	available, _ = repo.SerachAvailabilityByDatesByRoomID(date(10), date(12), 2, now)
+	if !available {
+		t.Error("a failed booking blocked the room")
+	}
+
+	res.Quote.PromoCode = "NOSUCHCODE"
+	_, err = repo.CreateBooking(res, now)
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for an unknown code, wanted ErrInvalid", err)
+	}
+
+	// a taken room does not use up the code
+	_, err = repo.InsertPromoCode(models.PromoCode{Code: "MANY", Kind: models.PromoPercent, Amount: 5, ValidFrom: date(1), ValidTo: date(31)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.RoomID = 1
+	res.Quote.PromoCode = "MANY"
+	_, err = repo.CreateBooking(res, now)
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a taken room, wanted ErrConflict", err)
+	}
+	p, _ = repo.GetPromoCodeByCode("MANY")
+	if p.Uses != 0 {
+		t.Errorf("got %d uses after a failed booking, wanted 0", p.Uses)
+	}
+
+	_, err = repo.CreateBooking(models.Reservation{Email: "x@example.com", StartDate: date(10), EndDate: date(12), RoomID: 1000}, now)
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a room that does not exist, wanted ErrInvalid", err)
+	}
+
+	// a cancelled booking gives its use back, as does one not paid in time
+	if err := repo.CancelReservation(id); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := repo.GetPromoCodeByCode("ONCE"); p.Uses != 0 {
+		t.Errorf("got %d uses after the booking was cancelled, wanted 0", p.Uses)
+	}
+
+	res.RoomID = 2
+	res.Quote.PromoCode = "once"
+	res.Status = models.ReservationPendingPayment
+	unpaid, err := repo.CreateBooking(res, now)
+	if err != nil {
+		t.Fatalf("got error %v booking with the use given back", err)
+	}
+	if err := repo.CancelUnpaidReservation(unpaid); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := repo.GetPromoCodeByCode("ONCE"); p.Uses != 0 {
+		t.Errorf("got %d uses after the booking wasn't paid, wanted 0", p.Uses)
+	}
+
+	// a reservation cancelled twice gives its use back once
+	if err := repo.CancelReservation(unpaid); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v cancelling twice, wanted ErrConflict", err)
+	}
+	if p, _ := repo.GetPromoCodeByCode("ONCE"); p.Uses != 0 {
+		t.Errorf("got %d uses after cancelling twice, wanted 0", p.Uses)
+	}
+}
+
+func testFeeRules(t *testing.T, repo repository.DatabaseRepo) {
+	cleaning, err := repo.InsertFeeRule(models.FeeRule{Name: "Cleaning", Kind: models.FeePerStay, Amount: 3000, RoomID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vat, err := repo.InsertFeeRule(models.FeeRule{Name: "VAT", Kind: models.FeePercent, Amount: 800, Tax: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := repo.GetFeeRuleByID(cleaning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Cleaning" || f.Kind != models.FeePerStay || f.Amount != 3000 || f.Tax || f.RoomID != 2 || f.Room.RoomName == "" {
+		t.Errorf("got fee rule %+v", f)
+	}
+
+	rules, err := repo.FeeRulesForRoom(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].ID != vat || !rules[0].Tax || rules[0].RoomID != 0 {
+		t.Errorf("got %+v for room 1, wanted only VAT", rules)
+	}
+
+	rules, _ = repo.FeeRulesForRoom(2)
+	if len(rules) != 2 || rules[0].ID != cleaning || rules[1].ID != vat {
+		t.Errorf("got %+v for room 2, wanted cleaning then VAT", rules)
+	}
+
+	invalid := []models.FeeRule{
+		{Kind: models.FeePerStay, Amount: 100},
+		{Name: "Towels", Kind: "per_towel", Amount: 100},
+		{Name: "Refund", Kind: models.FeePerNight, Amount: -100},
+		{Name: "Lost room", Kind: models.FeePerNight, Amount: 100, RoomID: 1000},
+	}
+	for _, f := range invalid {
+		if _, err := repo.InsertFeeRule(f); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %+v, wanted ErrInvalid", err, f)
+		}
+	}
+
+	f.Kind = models.FeePerGuest
+	f.Amount = 250
+	f.Tax = true
+	f.RoomID = 0
+	if err := repo.UpdateFeeRule(f); err != nil {
+		t.Fatal(err)
+	}
+	f, _ = repo.GetFeeRuleByID(cleaning)
+	if f.Kind != models.FeePerGuest || f.Amount != 250 || !f.Tax || f.RoomID != 0 {
+		t.Errorf("got fee rule %+v after update", f)
+	}
+
+	f.ID = cleaning + 1000
+	if err := repo.UpdateFeeRule(f); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a missing rule, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteFeeRule(cleaning); err != nil {
+		t.Fatal(err)
+	}
+	rules, _ = repo.AllFeeRules()
+	if len(rules) != 1 || rules[0].ID != vat {
+		t.Errorf("got %+v after delete, wanted only VAT", rules)
+	}
+	if err := repo.DeleteFeeRule(cleaning); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testReservationStatus(t *testing.T, repo repository.DatabaseRepo) {
+	// reservations made without a payment are confirmed
+	plain := book(t, repo, 1, date(1), date(3))
+
+	res, err := repo.GetReservationByID(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != models.ReservationConfirmed || res.PaymentIntentID != "" {
+		t.Errorf("got status %q and intent %q, wanted a confirmed reservation without intent", res.Status, res.PaymentIntentID)
+	}
+
+	id, err := repo.CreateBooking(models.Reservation{
+		FirstName:       "Jane",
+		LastName:        "Doe",
+		Email:           "jane@example.com",
+		StartDate:       date(10),
+		EndDate:         date(12),
+		RoomID:          2,
+		Status:          models.ReservationPendingPayment,
+		PaymentIntentID: "pi_123",
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = repo.GetReservationByPaymentIntent("pi_123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != id || res.Status != models.ReservationPendingPayment || res.Room.RoomName == "" {
+		t.Errorf("got reservation %+v", res)
+	}
+
+	for _, intentID := range []string{"pi_other", ""} {
+		_, err = repo.GetReservationByPaymentIntent(intentID)
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("got error %v for intent %q, wanted ErrNotFound", err, intentID)
+		}
+	}
+
+	err = repo.UpdateReservationStatus(id, models.ReservationPendingPayment, models.ReservationConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != models.ReservationConfirmed {
+		t.Errorf("got status %q after the update, wanted %q", res.Status, models.ReservationConfirmed)
+	}
+
+	// a second update from pending loses
+	err = repo.UpdateReservationStatus(id, models.ReservationPendingPayment, models.ReservationConfirmed)
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a reservation no longer pending, wanted ErrConflict", err)
+	}
+
+	err = repo.UpdateReservationStatus(id, models.ReservationConfirmed, "lost")
+	if !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for an unknown status, wanted ErrInvalid", err)
+	}
+
+	err = repo.UpdateReservationStatus(id+1000, models.ReservationPendingPayment, models.ReservationConfirmed)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a reservation that does not exist, wanted ErrNotFound", err)
+	}
+}
+
+func testCancellationPolicies(t *testing.T, repo repository.DatabaseRepo) {
+	policies, err := repo.AllCancellationPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 3 || policies[0].Name != "Flexible" || policies[1].Name != "Moderate" || policies[2].Name != "Strict" {
+		t.Fatalf("got policies %+v, wanted Flexible, Moderate and Strict", policies)
+	}
+
+	strict, err := repo.GetCancellationPolicyByID(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strict.DepositPercent != 50 || strict.FullRefundDays != 14 {
+		t.Errorf("got policy %+v", strict)
+	}
+	defer repo.UpdateCancellationPolicy(strict)
+
+	changed := strict
+	changed.DepositPercent = 100
+	changed.PartialRefundPercent = 25
+	if err := repo.UpdateCancellationPolicy(changed); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetCancellationPolicyByID(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DepositPercent != 100 || got.PartialRefundPercent != 25 || got.Name != "Strict" {
+		t.Errorf("got policy %+v after the update", got)
+	}
+
+	invalid := []models.CancellationPolicy{
+		{ID: 3, Name: "", DepositPercent: 50},
+		{ID: 3, Name: "Strict", DepositPercent: 101},
+		{ID: 3, Name: "Strict", PartialRefundPercent: -1},
+		{ID: 3, Name: "Strict", BalanceDays: -1},
+		{ID: 3, Name: "Strict", FullRefundDays: 3, PartialRefundDays: 7},
+	}
+	for _, p := range invalid {
+		if err := repo.UpdateCancellationPolicy(p); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for policy %+v, wanted ErrInvalid", err, p)
+		}
+	}
+
+	_, err = repo.GetCancellationPolicyByID(99)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a policy that does not exist, wanted ErrNotFound", err)
+	}
+
+	err = repo.UpdateCancellationPolicy(models.CancellationPolicy{ID: 99, Name: "Gone"})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a policy that does not exist, wanted ErrNotFound", err)
+	}
+}
+
+func testUpdateRoom(t *testing.T, repo repository.DatabaseRepo) {
+	room, err := repo.GetRoomByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.CancellationPolicyID != 2 {
+		t.Errorf("got policy %d for room 1, wanted the moderate policy 2", room.CancellationPolicyID)
+	}
+	defer repo.UpdateRoom(room)
+
+	changed := room
+	changed.RoomName = "General's Quarters, renovated"
+	changed.NightlyRate = 10900
+	changed.CancellationPolicyID = 3
+	changed.MaxOccupancy = 3
+	changed.Beds = 2
+	changed.IncludedGuests = 1
+	changed.ExtraGuestRate = 1500
+	if err := repo.UpdateRoom(changed); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetRoomByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RoomName != changed.RoomName || got.NightlyRate != 10900 || got.CancellationPolicyID != 3 || got.MaxOccupancy != 3 || got.Beds != 2 || got.IncludedGuests != 1 || got.ExtraGuestRate != 1500 {
+		t.Errorf("got room %+v after the update", got)
+	}
+
+	for _, r := range []models.Room{
+		{ID: 1, RoomName: "", CancellationPolicyID: 2, MaxOccupancy: 2, Beds: 1, IncludedGuests: 2},
+		{ID: 1, RoomName: "Room", NightlyRate: -1, CancellationPolicyID: 2, MaxOccupancy: 2, Beds: 1, IncludedGuests: 2},
+		{ID: 1, RoomName: "Room", CancellationPolicyID: 99, MaxOccupancy: 2, Beds: 1, IncludedGuests: 2},
+		{ID: 1, RoomName: "Room", CancellationPolicyID: 2, MaxOccupancy: 0, Beds: 1, IncludedGuests: 2},
+		{ID: 1, RoomName: "Room", CancellationPolicyID: 2, MaxOccupancy: 2, Beds: 0, IncludedGuests: 2},
+		{ID: 1, RoomName: "Room", CancellationPolicyID: 2, MaxOccupancy: 2, Beds: 1, IncludedGuests: 0},
+		{ID: 1, RoomName: "Room", CancellationPolicyID: 2, MaxOccupancy: 2, Beds: 1, IncludedGuests: 2, ExtraGuestRate: -1},
+	} {
+		if err := repo.UpdateRoom(r); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for room %+v, wanted ErrInvalid", err, r)
+		}
+	}
+
+	err = repo.UpdateRoom(models.Room{ID: 99, RoomName: "Attic", CancellationPolicyID: 2, MaxOccupancy: 2, Beds: 1, IncludedGuests: 2})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a room that does not exist, wanted ErrNotFound", err)
+	}
+}
+
+func testCancelReservation(t *testing.T, repo repository.DatabaseRepo) {
+	id, err := repo.CreateBooking(models.Reservation{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     "jane@example.com",
+		StartDate: date(10),
+		EndDate:   date(12),
+		RoomID:    1,
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := book(t, repo, 2, date(20), date(22))
+
+	res, err := repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ConfirmationCode) != 8 {
+		t.Fatalf("got confirmation code %q, wanted 8 characters", res.ConfirmationCode)
+	}
+
+	found, err := repo.GetReservationByCode(" " + strings.ToLower(res.ConfirmationCode) + " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != id || found.Room.RoomName == "" {
+		t.Errorf("got reservation %+v for code %s", found, res.ConfirmationCode)
+	}
+
+	for _, code := range []string{"", "NOSUCHCD"} {
+		if _, err := repo.GetReservationByCode(code); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("got error %v for code %q, wanted ErrNotFound", err, code)
+		}
+	}
+
+	all, err := repo.AllReservations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].ID != later || all[1].ID != id || all[1].Room.RoomName == "" {
+		t.Errorf("got reservations %+v, wanted the later stay first", all)
+	}
+
+	if err := repo.CancelReservation(id); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != models.ReservationCancelled {
+		t.Errorf("got status %q after cancelling, wanted %q", res.Status, models.ReservationCancelled)
+	}
+
+	available, err := repo.SerachAvailabilityByDatesByRoomID(date(10), date(12), 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("cancelling did not free the room")
+	}
+
+	available, err = repo.SerachAvailabilityByDatesByRoomID(date(20), date(22), 2, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("cancelling freed the room of another reservation")
+	}
+
+	if err := repo.CancelReservation(id); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v cancelling twice, wanted ErrConflict", err)
+	}
+	if err := repo.CancelReservation(id + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v cancelling a reservation that does not exist, wanted ErrNotFound", err)
+	}
+}
+
+func testPaymentSchedule(t *testing.T, repo repository.DatabaseRepo) {
+	policy, err := repo.GetCancellationPolicyByID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a schedule the whole total is paid at booking
+	plain, err := repo.CreateBooking(models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@example.com",
+		StartDate: date(5),
+		EndDate:   date(7),
+		RoomID:    1,
+		Quote:     models.Quote{Total: 20000},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.GetReservationByID(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Deposit != 20000 || !res.BalanceDueDate.Equal(date(5)) || res.Policy.ID != 0 {
+		t.Errorf("got deposit %d due %s and policy %+v, wanted the total at booking", res.Deposit, res.BalanceDueDate, res.Policy)
+	}
+
+	due := func(start, dueDay, roomID int) int {
+		id, err := repo.CreateBooking(models.Reservation{
+			FirstName:      "Jane",
+			LastName:       "Doe",
+			Email:          "jane@example.com",
+			StartDate:      date(start),
+			EndDate:        date(start + 2),
+			RoomID:         roomID,
+			Status:         models.ReservationConfirmed,
+			Quote:          models.Quote{Total: 30000},
+			Policy:         policy,
+			Deposit:        9000,
+			BalanceDueDate: date(dueDay),
+		}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	first := due(20, 6, 1)
+	second := due(15, 1, 2)
+	due(25, 11, 2)
+
+	res, err = repo.GetReservationByID(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Deposit != 9000 || res.Balance() != 21000 || !res.BalanceDueDate.Equal(date(6)) || res.Policy.Name != "Moderate" {
+		t.Errorf("got deposit %d due %s and policy %+v", res.Deposit, res.BalanceDueDate, res.Policy)
+	}
+
+	balances, err := repo.DueBalances(date(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 2 || balances[0].ID != second || balances[1].ID != first {
+		t.Fatalf("got due balances %+v, wanted reservations %d and %d", balances, second, first)
+	}
+
+	if err := repo.SetBalanceIntent(first, "pi_balance"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetBalanceIntent(first, "pi_again"); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v asking for a balance twice, wanted ErrConflict", err)
+	}
+	if err := repo.SetBalanceIntent(first+1000, "pi_none"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a reservation that does not exist, wanted ErrNotFound", err)
+	}
+
+	res, err = repo.GetReservationByPaymentIntent("pi_balance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != first || res.BalanceIntentID != "pi_balance" {
+		t.Errorf("got reservation %+v for the balance intent", res)
+	}
+
+	if err := repo.CancelReservation(second); err != nil {
+		t.Fatal(err)
+	}
+
+	balances, err = repo.DueBalances(date(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 0 {
+		t.Errorf("got due balances %+v, wanted none once asked for or cancelled", balances)
+	}
+}
+
+func testPayments(t *testing.T, repo repository.DatabaseRepo) {
+	id := book(t, repo, 1, date(10), date(12))
+
+	entries := []models.Payment{
+		{ReservationID: id, Kind: models.PaymentDeposit, Amount: 9000, IntentID: "pi_1", Reference: "pi_1"},
+		{ReservationID: id, Kind: models.PaymentBalance, Amount: 21000, IntentID: "pi_2", Reference: "pi_2"},
+		{ReservationID: id, Kind: models.PaymentRefund, Amount: 5000, IntentID: "pi_2", Reference: "re_1"},
+	}
+	for _, p := range entries {
+		if _, err := repo.InsertPayment(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := repo.InsertPayment(entries[0])
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v recording a payment twice, wanted ErrConflict", err)
+	}
+
+	invalid := []models.Payment{
+		{ReservationID: id, Kind: "gift", Amount: 100, Reference: "x"},
+		{ReservationID: id, Kind: models.PaymentRefund, Amount: -100, Reference: "re_2"},
+		{ReservationID: id, Kind: models.PaymentRefund, Amount: 100},
+		{ReservationID: id + 1000, Kind: models.PaymentDeposit, Amount: 100, Reference: "pi_9"},
+	}
+	for _, p := range invalid {
+		if _, err := repo.InsertPayment(p); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for payment %+v, wanted ErrInvalid", err, p)
+		}
+	}
+
+	ledger, err := repo.PaymentsForReservation(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledger) != 3 {
+		t.Fatalf("got ledger %+v, wanted 3 entries", ledger)
+	}
+	for i, p := range ledger {
+		if p.Kind != entries[i].Kind || p.Amount != entries[i].Amount || p.Reference != entries[i].Reference || p.ID == 0 {
+			t.Errorf("got entry %+v, wanted %+v", p, entries[i])
+		}
+	}
+
+	ledger, err = repo.PaymentsForReservation(id + 1000)
+	if err != nil || len(ledger) != 0 {
+		t.Errorf("got ledger %+v and error %v for a reservation that does not exist", ledger, err)
+	}
+}
+
+func testInvoices(t *testing.T, repo repository.DatabaseRepo) {
+	first := book(t, repo, 1, date(10), date(12))
+	second := book(t, repo, 2, date(10), date(12))
+
+	seller := models.Company{Name: "Fort Smythe", Address: "1 Main St", TaxID: "PL123", Email: "owner@example.com"}
+
+	_, err := repo.GetInvoiceByReservation(first)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v before issuing, wanted ErrNotFound", err)
+	}
+
+	inv, err := repo.InsertInvoice(models.Invoice{ReservationID: first, Seller: seller, Number: 77})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.ID == 0 || inv.Number != 1 || inv.IssuedAt.IsZero() {
+		t.Errorf("got invoice %+v, wanted number 1", inv)
+	}
+
+	next, err := repo.InsertInvoice(models.Invoice{ReservationID: second, Seller: seller})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Number != 2 || next.Code() != "INV-000002" {
+		t.Errorf("got invoice %+v, wanted number 2", next)
+	}
+
+	_, err = repo.InsertInvoice(models.Invoice{ReservationID: first, Seller: seller})
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v issuing a second invoice, wanted ErrConflict", err)
+	}
+
+	invalid := []models.Invoice{
+		{ReservationID: first + 1000, Seller: seller},
+		{ReservationID: 0, Seller: seller},
+		{ReservationID: first},
+	}
+	for _, inv := range invalid {
+		if _, err := repo.InsertInvoice(inv); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for invoice %+v, wanted ErrInvalid", err, inv)
+		}
+	}
+
+	got, err := repo.GetInvoiceByReservation(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != inv.ID || got.Number != 1 || got.Seller != seller {
+		t.Errorf("got invoice %+v, wanted %+v", got, inv)
+	}
+}
+
+func testExchangeRates(t *testing.T, repo repository.DatabaseRepo) {
+	eur, err := repo.InsertExchangeRate(models.ExchangeRate{Code: "eur", Symbol: "€", Rate: 920000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gbp, err := repo.InsertExchangeRate(models.ExchangeRate{Code: "GBP", Symbol: "£", Rate: 790000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := repo.GetExchangeRateByID(eur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Code != "EUR" || r.Symbol != "€" || r.Rate != 920000 {
+		t.Errorf("got exchange rate %+v", r)
+	}
+
+	r, err = repo.GetExchangeRateByCode(" gbp ")
+	if err != nil || r.ID != gbp {
+		t.Errorf("got %+v, %v for gbp, wanted rate %d", r, err, gbp)
+	}
+	if _, err := repo.GetExchangeRateByCode("PLN"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a currency without a rate, wanted ErrNotFound", err)
+	}
+
+	rates, err := repo.AllExchangeRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 || rates[0].ID != eur || rates[1].ID != gbp {
+		t.Errorf("got %+v, wanted EUR then GBP", rates)
+	}
+
+	if _, err := repo.InsertExchangeRate(models.ExchangeRate{Code: "EUR", Rate: 1000000}); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a second EUR rate, wanted ErrConflict", err)
+	}
+
+	invalid := []models.ExchangeRate{
+		{Code: "EURO", Rate: 920000},
+		{Code: "E1R", Rate: 920000},
+		{Code: "PLN", Rate: 0},
+		{Code: "PLN", Symbol: "zlotych!!!", Rate: 4000000},
+	}
+	for _, r := range invalid {
+		if _, err := repo.InsertExchangeRate(r); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %+v, wanted ErrInvalid", err, r)
+		}
+	}
+
+	r, _ = repo.GetExchangeRateByID(eur)
+	r.Rate = 930000
+	r.Symbol = "EUR "
+	if err := repo.UpdateExchangeRate(r); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = repo.GetExchangeRateByID(eur)
+	if r.Rate != 930000 || r.Symbol != "EUR " {
+		t.Errorf("got exchange rate %+v after update", r)
+	}
+
+	r.Code = "GBP"
+	if err := repo.UpdateExchangeRate(r); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v renaming EUR to GBP, wanted ErrConflict", err)
+	}
+
+	r.ID = eur + 1000
+	r.Code = "EUR"
+	if err := repo.UpdateExchangeRate(r); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a missing rate, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteExchangeRate(eur); err != nil {
+		t.Fatal(err)
+	}
+	rates, _ = repo.AllExchangeRates()
+	if len(rates) != 1 || rates[0].ID != gbp {
+		t.Errorf("got %+v after delete, wanted only GBP", rates)
+	}
+	if err := repo.DeleteExchangeRate(eur); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testStayRules(t *testing.T, repo repository.DatabaseRepo) {
+	summer := models.StayRule{Name: "Summer", RoomID: 2, StartDate: date(10), EndDate: date(20), MinNights: 3, MaxNights: 14, MinLeadDays: 2}
+	summer.ClosedToArrival[time.Saturday] = true
+	summer.ClosedToDeparture[time.Sunday] = true
+	summerID, err := repo.InsertStayRule(summer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	always, err := repo.InsertStayRule(models.StayRule{Name: "Horizon", StartDate: date(1), EndDate: date(31), MaxLeadDays: 365})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := repo.GetStayRuleByID(summerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "Summer" || s.RoomID != 2 || s.Room.RoomName == "" || !s.StartDate.Equal(date(10)) || !s.EndDate.Equal(date(20)) ||
+		s.MinNights != 3 || s.MaxNights != 14 || s.MinLeadDays != 2 || s.MaxLeadDays != 0 ||
+		s.ClosedToArrival != summer.ClosedToArrival || s.ClosedToDeparture != summer.ClosedToDeparture {
+		t.Errorf("got stay rule %+v", s)
+	}
+
+	rules, err := repo.StayRulesForRoom(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].ID != always || rules[0].RoomID != 0 {
+		t.Errorf("got %+v for room 1, wanted only the horizon", rules)
+	}
+
+	rules, _ = repo.StayRulesForRoom(2)
+	if len(rules) != 2 || rules[0].ID != always || rules[1].ID != summerID {
+		t.Errorf("got %+v for room 2, wanted the horizon then summer", rules)
+	}
+
+	invalid := []models.StayRule{
+		{StartDate: date(1), EndDate: date(2)},
+		{Name: "Backwards", StartDate: date(5), EndDate: date(4)},
+		{Name: "Negative", StartDate: date(1), EndDate: date(2), MinNights: -1},
+		{Name: "Too short", StartDate: date(1), EndDate: date(2), MinNights: 5, MaxNights: 3},
+		{Name: "Too soon", StartDate: date(1), EndDate: date(2), MinLeadDays: 30, MaxLeadDays: 7},
+		{Name: "Lost room", StartDate: date(1), EndDate: date(2), RoomID: 1000},
+	}
+	for _, s := range invalid {
+		if _, err := repo.InsertStayRule(s); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %+v, wanted ErrInvalid", err, s)
+		}
+	}
+
+	s.MinNights = 2
+	s.ClosedToArrival = [7]bool{}
+	s.ClosedToDeparture[time.Monday] = true
+	s.RoomID = 0
+	if err := repo.UpdateStayRule(s); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = repo.GetStayRuleByID(summerID)
+	if s.MinNights != 2 || s.ClosedToArrival != [7]bool{} || !s.ClosedToDeparture[time.Sunday] || !s.ClosedToDeparture[time.Monday] || s.RoomID != 0 {
+		t.Errorf("got stay rule %+v after update", s)
+	}
+
+	s.ID = summerID + 1000
+	if err := repo.UpdateStayRule(s); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a missing rule, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteStayRule(summerID); err != nil {
+		t.Fatal(err)
+	}
+	rules, _ = repo.AllStayRules()
+	if len(rules) != 1 || rules[0].ID != always {
+		t.Errorf("got %+v after delete, wanted only the horizon", rules)
+	}
+	if err := repo.DeleteStayRule(summerID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testGuests(t *testing.T, repo repository.DatabaseRepo) {
+	family := models.Reservation{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     "jane@example.com",
+		StartDate: date(10),
+		EndDate:   date(12),
+		RoomID:    2,
+		Adults:    2,
+		Children:  1,
+	}
+
+	id, err := repo.CreateBooking(family, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Adults != 2 || res.Children != 1 || res.Guests() != 3 {
+		t.Errorf("got %d adults and %d children, wanted 2 and 1", res.Adults, res.Children)
+	}
+
+	// reservations made without guests are for one adult
+	id, err = repo.InsertReservation(models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@example.com", StartDate: date(10), EndDate: date(12), RoomID: 1}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ = repo.GetReservationByID(id)
+	if res.Adults != 1 || res.Children != 0 {
+		t.Errorf("got %d adults and %d children, wanted one adult", res.Adults, res.Children)
+	}
+
+	for _, r := range []models.Reservation{
+		{FirstName: "Kid", LastName: "Alone", Email: "kid@example.com", StartDate: date(20), EndDate: date(21), RoomID: 1, Children: 1},
+		{FirstName: "Odd", LastName: "Count", Email: "odd@example.com", StartDate: date(20), EndDate: date(21), RoomID: 1, Adults: 1, Children: -1},
+	} {
+		if _, err := repo.CreateBooking(r, now); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v booking for %d adults and %d children, wanted ErrInvalid", err, r.Adults, r.Children)
+		}
+	}
+
+	// nothing was kept of the refused bookings
+	free, err := repo.SerachAvailabilityByDatesByRoomID(date(20), date(21), 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !free {
+		t.Error("a refused booking blocked its room")
+	}
+}
+
+func testAPIKeys(t *testing.T, repo repository.DatabaseRepo) {
+	hash := strings.Repeat("ab", 32)
+	partner := models.APIKey{Name: "Partner", Prefix: "partner1", Hash: hash, Scopes: []string{models.ScopeReadAvailability, models.ScopeCreateReservation}, RateLimit: 30, ExpiresOn: date(31)}
+	partnerID, err := repo.InsertAPIKey(partner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agency, err := repo.InsertAPIKey(models.APIKey{Name: "Agency", Prefix: "agency01", Hash: strings.Repeat("cd", 32), Scopes: []string{models.ScopeReadReservations}, RateLimit: 60, ExpiresOn: date(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := repo.GetAPIKeyByID(partnerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Name != "Partner" || k.Prefix != "partner1" || k.Hash != hash || k.RateLimit != 30 || !k.ExpiresOn.Equal(date(31)) ||
+		len(k.Scopes) != 2 || !k.HasScope(models.ScopeCreateReservation) || k.HasScope(models.ScopeReadReservations) {
+		t.Errorf("got API key %+v", k)
+	}
+
+	k, err = repo.GetAPIKeyByPrefix("agency01")
+	if err != nil || k.ID != agency {
+		t.Errorf("got %+v, %v for agency01, wanted key %d", k, err, agency)
+	}
+	if _, err := repo.GetAPIKeyByPrefix("nope0000"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for an unknown prefix, wanted ErrNotFound", err)
+	}
+
+	keys, err := repo.AllAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != agency || keys[1].ID != partnerID {
+		t.Errorf("got %+v, wanted Agency then Partner", keys)
+	}
+
+	if _, err := repo.InsertAPIKey(partner); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a second key with prefix partner1, wanted ErrConflict", err)
+	}
+
+	invalid := []models.APIKey{
+		{Prefix: "other001", Hash: hash, Scopes: []string{models.ScopeReadAvailability}, RateLimit: 60, ExpiresOn: date(31)},
+		{Name: "No hash", Prefix: "other001", Hash: "abc", Scopes: []string{models.ScopeReadAvailability}, RateLimit: 60, ExpiresOn: date(31)},
+		{Name: "No scopes", Prefix: "other001", Hash: hash, RateLimit: 60, ExpiresOn: date(31)},
+		{Name: "Unknown scope", Prefix: "other001", Hash: hash, Scopes: []string{"delete-everything"}, RateLimit: 60, ExpiresOn: date(31)},
+		{Name: "No requests", Prefix: "other001", Hash: hash, Scopes: []string{models.ScopeReadAvailability}, ExpiresOn: date(31)},
+		{Name: "Forever", Prefix: "other001", Hash: hash, Scopes: []string{models.ScopeReadAvailability}, RateLimit: 60},
+	}
+	for _, k := range invalid {
+		if _, err := repo.InsertAPIKey(k); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %s, wanted ErrInvalid", err, k.Name)
+		}
+	}
+
+	// an update changes what the key may do, never the key itself
+	k, _ = repo.GetAPIKeyByID(partnerID)
+	k.Name = "Partner site"
+	k.Scopes = []string{models.ScopeReadAvailability}
+	k.RateLimit = 120
+	k.ExpiresOn = date(20)
+	k.Prefix = "changed1"
+	k.Hash = strings.Repeat("ef", 32)
+	if err := repo.UpdateAPIKey(k); err != nil {
+		t.Fatal(err)
+	}
+	k, _ = repo.GetAPIKeyByID(partnerID)
+	if k.Name != "Partner site" || len(k.Scopes) != 1 || k.RateLimit != 120 || !k.ExpiresOn.Equal(date(20)) || k.Prefix != "partner1" || k.Hash != hash {
+		t.Errorf("got API key %+v after update", k)
+	}
+
+	k.ID = partnerID + 1000
+	if err := repo.UpdateAPIKey(k); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a missing key, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteAPIKey(partnerID); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = repo.AllAPIKeys()
+	if len(keys) != 1 || keys[0].ID != agency {
+		t.Errorf("got %+v after delete, wanted only Agency", keys)
+	}
+	if err := repo.DeleteAPIKey(partnerID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testBlocks(t *testing.T, repo repository.DatabaseRepo) {
+	resID := book(t, repo, 1, date(10), date(12))
+
+	owner, err := repo.InsertBlock(models.RoomRestriction{RoomID: 2, StartDate: date(5), EndDate: date(8)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	early, err := repo.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: date(2), EndDate: date(3), RestrictionID: 2}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := repo.GetBlockByID(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.RoomID != 2 || b.Room.RoomName == "" || b.RestrictionID != 2 || b.Restriction.RestrictionName != "Owner Block" ||
+		!b.StartDate.Equal(date(5)) || !b.EndDate.Equal(date(8)) {
+		t.Errorf("got block %+v", b)
+	}
+
+	// the room is closed for the block
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(6), date(7), 2, now); ok {
+		t.Error("room 2 is available on blocked nights")
+	}
+
+	blocks, err := repo.AllBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].ID != early || blocks[1].ID != owner {
+		t.Errorf("got %+v, wanted the block on the 2nd then the 5th and not the reservation", blocks)
+	}
+
+	if _, err := repo.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: date(11), EndDate: date(13)}, now); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v blocking booked nights, wanted ErrConflict", err)
+	}
+
+	invalid := []models.RoomRestriction{
+		{RoomID: 1, StartDate: date(20), EndDate: date(20)},
+		{RoomID: 1000, StartDate: date(20), EndDate: date(21)},
+		{RoomID: 1, StartDate: date(20), EndDate: date(21), RestrictionID: 1},
+		{RoomID: 1, StartDate: date(20), EndDate: date(21), ReservationID: resID},
+	}
+	for _, r := range invalid {
+		if _, err := repo.InsertBlock(r, now); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %+v, wanted ErrInvalid", err, r)
+		}
+	}
+
+	if _, err := repo.GetBlockByID(owner + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a missing block, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteBlock(owner); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(6), date(7), 2, now); !ok {
+		t.Error("room 2 is still closed after its block was deleted")
+	}
+	if err := repo.DeleteBlock(owner); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testWebhooks(t *testing.T, repo repository.DatabaseRepo) {
+	channel := models.Webhook{URL: "https://channel.example.com/hook", Secret: "s3cret", Events: []string{models.EventReservationCreated, models.EventBlockAdded}, Active: true}
+	channelID, err := repo.InsertWebhook(channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := repo.InsertWebhook(models.Webhook{URL: "http://accounts.example.com/in", Secret: "other", Events: []string{models.EventReservationCreated}, Active: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := repo.GetWebhookByID(channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.URL != channel.URL || w.Secret != "s3cret" || !w.Active || len(w.Events) != 2 || !w.Subscribes(models.EventBlockAdded) {
+		t.Errorf("got webhook %+v", w)
+	}
+
+	hooks, err := repo.AllWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 2 || hooks[0].ID != accounts || hooks[1].ID != channelID || hooks[0].Active {
+		t.Errorf("got %+v, wanted accounts then channel", hooks)
+	}
+
+	// inactive webhooks and those not subscribed are left out
+	hooks, err = repo.WebhooksForEvent(models.EventReservationCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 || hooks[0].ID != channelID {
+		t.Errorf("got %+v for reservation.created, wanted only the channel", hooks)
+	}
+	if hooks, _ := repo.WebhooksForEvent(models.EventReservationCancelled); len(hooks) != 0 {
+		t.Errorf("got %+v for reservation.cancelled, wanted none", hooks)
+	}
+
+	invalid := []models.Webhook{
+		{URL: "ftp://example.com", Secret: "s", Events: []string{models.EventBlockAdded}},
+		{URL: "not a url", Secret: "s", Events: []string{models.EventBlockAdded}},
+		{URL: "https://example.com", Events: []string{models.EventBlockAdded}},
+		{URL: "https://example.com", Secret: "s"},
+		{URL: "https://example.com", Secret: "s", Events: []string{"room.painted"}},
+	}
+	for _, w := range invalid {
+		if _, err := repo.InsertWebhook(w); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for %+v, wanted ErrInvalid", err, w)
+		}
+	}
+
+	w.Events = []string{models.EventReservationCancelled}
+	w.Active = false
+	w.Secret = "rotated"
+	if err := repo.UpdateWebhook(w); err != nil {
+		t.Fatal(err)
+	}
+	w, _ = repo.GetWebhookByID(channelID)
+	if w.Active || w.Secret != "rotated" || len(w.Events) != 1 || w.Events[0] != models.EventReservationCancelled {
+		t.Errorf("got webhook %+v after update", w)
+	}
+
+	w.ID = channelID + 1000
+	if err := repo.UpdateWebhook(w); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a missing webhook, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteWebhook(accounts); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteWebhook(accounts); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting twice, wanted ErrNotFound", err)
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, repo repository.DatabaseRepo) {
+	hook, err := repo.InsertWebhook(models.Webhook{URL: "https://channel.example.com/hook", Secret: "s3cret", Events: []string{models.EventReservationCreated}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, err := repo.InsertWebhook(models.Webhook{URL: "https://paused.example.com/hook", Secret: "s3cret", Events: []string{models.EventReservationCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2050, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := repo.InsertWebhookDelivery(models.WebhookDelivery{WebhookID: hook, Event: models.EventReservationCreated, Payload: `{"n":1}`, NextAttemptAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := repo.InsertWebhookDelivery(models.WebhookDelivery{WebhookID: hook, Event: models.EventReservationCreated, Payload: `{"n":2}`, NextAttemptAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertWebhookDelivery(models.WebhookDelivery{WebhookID: paused, Event: models.EventReservationCreated, Payload: `{"n":3}`, NextAttemptAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := repo.GetWebhookDeliveryByID(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != models.DeliveryPending || d.Payload != `{"n":1}` || d.Attempts != 0 || !d.NextAttemptAt.Equal(now) || !d.DeliveredAt.IsZero() ||
+		d.Webhook.URL != "https://channel.example.com/hook" || d.Webhook.Secret != "s3cret" {
+		t.Errorf("got delivery %+v", d)
+	}
+
+	// only pending deliveries of active webhooks that are due
+	due, err := repo.DueWebhookDeliveries(now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].ID != first {
+		t.Errorf("got %+v due, wanted only the first delivery", due)
+	}
+	if due, _ := repo.DueWebhookDeliveries(now.Add(2 * time.Hour)); len(due) != 2 || due[0].ID != first || due[1].ID != later {
+		t.Errorf("got %+v due later, wanted both deliveries of the active webhook", due)
+	}
+
+	d.Attempts = 1
+	d.ResponseCode = 500
+	d.LastError = strings.Repeat("x", 2000)
+	d.NextAttemptAt = now.Add(30 * time.Minute)
+	if err := repo.UpdateWebhookDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := repo.DueWebhookDeliveries(now.Add(time.Minute)); len(due) != 0 {
+		t.Errorf("got %+v due after a retry was scheduled, wanted none", due)
+	}
+
+	d.Status = models.DeliveryDelivered
+	d.Attempts = 2
+	d.ResponseCode = 204
+	d.LastError = ""
+	d.DeliveredAt = now.Add(30 * time.Minute)
+	if err := repo.UpdateWebhookDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+	d, _ = repo.GetWebhookDeliveryByID(first)
+	if d.Status != models.DeliveryDelivered || d.Attempts != 2 || d.ResponseCode != 204 || !d.DeliveredAt.Equal(now.Add(30*time.Minute)) {
+		t.Errorf("got delivery %+v after it was delivered", d)
+	}
+
+	d.Status = "lost"
+	if err := repo.UpdateWebhookDelivery(d); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for an unknown status, wanted ErrInvalid", err)
+	}
+	d.ID = first + 1000
+	d.Status = models.DeliveryFailed
+	if err := repo.UpdateWebhookDelivery(d); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v updating a missing delivery, wanted ErrNotFound", err)
+	}
+
+	if _, err := repo.InsertWebhookDelivery(models.WebhookDelivery{WebhookID: hook + 1000, Event: models.EventReservationCreated, Payload: "{}", NextAttemptAt: now}); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a delivery to a missing webhook, wanted ErrInvalid", err)
+	}
+
+	log, err := repo.WebhookDeliveries(hook, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].ID != later || log[1].ID != first {
+		t.Errorf("got %+v for the webhook, wanted the later delivery first", log)
+	}
+	if log, _ := repo.WebhookDeliveries(0, 2); len(log) != 2 || log[1].ID != later {
+		t.Errorf("got %+v for all webhooks, wanted the two newest", log)
+	}
+	if log, _ := repo.WebhookDeliveries(0, 0); len(log) != 3 {
+		t.Errorf("got %d deliveries with no limit, wanted all 3", len(log))
+	}
+
+	// deleting a webhook deletes its deliveries
+	repo.DeleteWebhook(hook)
+	if _, err := repo.GetWebhookDeliveryByID(first); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a delivery of a deleted webhook, wanted ErrNotFound", err)
+	}
+}
+
+func testRoomCalendar(t *testing.T, repo repository.DatabaseRepo) {
+	past := book(t, repo, 1, date(1), date(3))
+	resID := book(t, repo, 1, date(10), date(12))
+	book(t, repo, 2, date(10), date(12))
+
+	block, err := repo.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: date(5), EndDate: date(8)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restrictions, err := repo.RoomRestrictionsForRoom(1, date(3), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 2 || restrictions[0].ID != block || restrictions[0].ReservationID != 0 || restrictions[1].ReservationID != resID {
+		t.Fatalf("got %+v, wanted the block then the reservation, and not the stay that ended", restrictions)
+	}
+	if r := restrictions[1]; r.Room.RoomName == "" || r.Restriction.RestrictionName != "Reservation" || !r.StartDate.Equal(date(10)) || !r.EndDate.Equal(date(12)) {
+		t.Errorf("got reservation restriction %+v", r)
+	}
+
+	// cancelled stays leave the calendar
+	if err := repo.CancelReservation(resID); err != nil {
+		t.Fatal(err)
+	}
+	if restrictions, _ := repo.RoomRestrictionsForRoom(1, date(3), now); len(restrictions) != 1 {
+		t.Errorf("got %+v after the cancellation, wanted the block", restrictions)
+	}
+	if restrictions, _ := repo.RoomRestrictionsForRoom(1, date(1), now); len(restrictions) != 2 || restrictions[0].ReservationID != past {
+		t.Errorf("got %+v since the 1st, wanted the first stay too", restrictions)
+	}
+
+	room, err := repo.GetRoomByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.ICalToken == "" {
+		t.Fatal("room 1 has no calendar token")
+	}
+	if other, _ := repo.GetRoomByID(2); other.ICalToken == room.ICalToken {
+		t.Error("both rooms have the same calendar token")
+	}
+
+	if err := repo.SetRoomICalToken(1, "new-token"); err != nil {
+		t.Fatal(err)
+	}
+	if room, _ := repo.GetRoomByID(1); room.ICalToken != "new-token" {
+		t.Errorf("got token %q, wanted the new one", room.ICalToken)
+	}
+
+	// changing the room keeps its token
+	room, _ = repo.GetRoomByID(1)
+	room.RoomName = "Renamed"
+	room.ICalToken = "ignored"
+	if err := repo.UpdateRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	if rooms, _ := repo.AllRooms(); rooms[0].ICalToken != "new-token" {
+		t.Errorf("got token %q after updating the room, wanted it kept", rooms[0].ICalToken)
+	}
+
+	if err := repo.SetRoomICalToken(1, " "); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a blank token, wanted ErrInvalid", err)
+	}
+	if err := repo.SetRoomICalToken(1000, "token"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a missing room, wanted ErrNotFound", err)
+	}
+}
+
+func testICalFeeds(t *testing.T, repo repository.DatabaseRepo) {
+	id, err := repo.InsertICalFeed(models.ICalFeed{RoomID: 2, Name: "Airbnb", URL: "https://example.com/calendar.ics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := repo.InsertICalFeed(models.ICalFeed{RoomID: 1, URL: "webcal://example.com/other.ics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := repo.GetICalFeedByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.RoomID != 2 || f.Room.RoomName == "" || f.Name != "Airbnb" || f.URL != "https://example.com/calendar.ics" || !f.LastSyncedAt.IsZero() || f.LastError != "" {
+		t.Errorf("got feed %+v", f)
+	}
+
+	feeds, err := repo.AllICalFeeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 || feeds[0].ID != first || feeds[1].ID != id {
+		t.Errorf("got %+v, wanted the feeds ordered by room", feeds)
+	}
+
+	if feeds, _ := repo.ICalFeedsForRoom(2); len(feeds) != 1 || feeds[0].ID != id {
+		t.Errorf("got %+v for room 2", feeds)
+	}
+
+	at := time.Date(2050, time.January, 1, 12, 30, 0, 0, time.UTC)
+	if err := repo.SetICalFeedSynced(id, at, "404 Not Found"); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := repo.GetICalFeedByID(id); !f.LastSyncedAt.Equal(at) || f.LastError != "404 Not Found" {
+		t.Errorf("got feed %+v after a failed sync", f)
+	}
+	if err := repo.SetICalFeedSynced(id, at.Add(time.Hour), ""); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := repo.GetICalFeedByID(id); !f.LastSyncedAt.Equal(at.Add(time.Hour)) || f.LastError != "" {
+		t.Errorf("got feed %+v after a sync", f)
+	}
+
+	for _, bad := range []models.ICalFeed{
+		{RoomID: 1, URL: "ftp://example.com/calendar.ics"},
+		{RoomID: 1, URL: "calendar.ics"},
+		{RoomID: 1000, URL: "https://example.com/calendar.ics"},
+	} {
+		if _, err := repo.InsertICalFeed(bad); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for feed %+v, wanted ErrInvalid", err, bad)
+		}
+	}
+
+	if err := repo.DeleteICalFeed(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetICalFeedByID(id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a deleted feed, wanted ErrNotFound", err)
+	}
+	if err := repo.DeleteICalFeed(id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting a deleted feed, wanted ErrNotFound", err)
+	}
+	if err := repo.SetICalFeedSynced(id, at, ""); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v syncing a deleted feed, wanted ErrNotFound", err)
+	}
+}
+
+func testSyncICalFeed(t *testing.T, repo repository.DatabaseRepo) {
+	feed, err := repo.InsertICalFeed(models.ICalFeed{RoomID: 1, URL: "https://example.com/calendar.ics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := repo.InsertICalFeed(models.ICalFeed{RoomID: 1, URL: "https://example.com/other.ics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resID := book(t, repo, 1, date(20), date(22))
+
+	event := func(uid string, start, end int) models.RoomRestriction {
+		return models.RoomRestriction{ExternalUID: uid, StartDate: date(start), EndDate: date(end)}
+	}
+
+	events := []models.RoomRestriction{
+		event("b@airbnb", 10, 12),
+		event("a@airbnb", 2, 5),
+		// taken by the reservation here
+		event("c@airbnb", 21, 23),
+		// the same event twice, the first counts
+		event("a@airbnb", 7, 8),
+	}
+
+	sync, err := repo.SyncICalFeed(feed, events, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sync.Added) != 2 || len(sync.Removed) != 0 || len(sync.Conflicts) != 1 || sync.Conflicts[0].ExternalUID != "c@airbnb" {
+		t.Fatalf("got %+v, wanted two blocks and a conflict", sync)
+	}
+	a := sync.Added[0]
+	if a.ExternalUID != "a@airbnb" || a.ICalFeedID != feed || a.RoomID != 1 || a.ReservationID != 0 || a.RestrictionID != 3 ||
+		a.Restriction.RestrictionName != "External" || a.Room.RoomName == "" || !a.StartDate.Equal(date(2)) || !a.EndDate.Equal(date(5)) {
+		t.Errorf("got external block %+v", a)
+	}
+
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(3), date(4), 1, now); ok {
+		t.Error("room 1 is available on nights booked elsewhere")
+	}
+	if b, err := repo.GetBlockByID(a.ID); err != nil || b.ExternalUID != "a@airbnb" || b.ICalFeedID != feed {
+		t.Errorf("got block %+v, %v", b, err)
+	}
+
+	// syncing the same events again changes nothing
+	again, err := repo.SyncICalFeed(feed, events, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Added) != 0 || len(again.Removed) != 0 || len(again.Conflicts) != 1 {
+		t.Errorf("got %+v syncing again, wanted no changes", again)
+	}
+
+	// an event that moved is blocked again, one that is gone is opened
+	moved, err := repo.SyncICalFeed(feed, []models.RoomRestriction{event("a@airbnb", 2, 5), event("b@airbnb", 11, 13)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved.Added) != 1 || !moved.Added[0].StartDate.Equal(date(11)) || len(moved.Removed) != 1 || moved.Removed[0].ExternalUID != "b@airbnb" {
+		t.Errorf("got %+v after the event moved", moved)
+	}
+
+	blocks, _ := repo.RoomRestrictionsForRoom(1, date(1), now)
+	var ids []int
+	for _, b := range blocks {
+		if b.ICalFeedID == feed {
+			ids = append(ids, b.ID)
+		}
+	}
+	if len(ids) != 2 || ids[0] != a.ID {
+		t.Errorf("got blocks %v, wanted the first one kept", ids)
+	}
+
+	// the same UID in another feed is another event
+	if sync, err := repo.SyncICalFeed(other, []models.RoomRestriction{event("a@airbnb", 15, 16)}, now); err != nil || len(sync.Added) != 1 {
+		t.Errorf("got %+v, %v for another feed", sync, err)
+	}
+
+	// the reservation is not touched
+	if res, err := repo.GetReservationByID(resID); err != nil || res.Status == models.ReservationCancelled {
+		t.Errorf("got reservation %+v, %v", res, err)
+	}
+
+	for _, bad := range [][]models.RoomRestriction{
+		{event("", 2, 3)},
+		{event("x@airbnb", 3, 3)},
+	} {
+		if _, err := repo.SyncICalFeed(feed, bad, now); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for events %+v, wanted ErrInvalid", err, bad)
+		}
+	}
+	if _, err := repo.SyncICalFeed(1000, nil, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a missing feed, wanted ErrNotFound", err)
+	}
+
+	// an empty calendar opens every night it blocked
+	empty, err := repo.SyncICalFeed(feed, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Removed) != 2 {
+		t.Errorf("got %+v for an empty calendar, wanted both blocks removed", empty)
+	}
+
+	// deleting a feed opens its nights
+	if err := repo.DeleteICalFeed(other); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(15), date(16), 1, now); !ok {
+		t.Error("room 1 is still closed after its feed was deleted")
+	}
+
+	if _, err := repo.InsertBlock(models.RoomRestriction{RoomID: 1, StartDate: date(2), EndDate: date(3), RestrictionID: 3}, now); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v inserting an external block by hand, wanted ErrInvalid", err)
+	}
+}
+
+func testWaitlist(t *testing.T, repo repository.DatabaseRepo) {
+	entry := models.WaitlistEntry{
+		RoomID:    2,
+		StartDate: date(10),
+		EndDate:   date(12),
+		Adults:    2,
+		Children:  1,
+		FirstName: "Wanda",
+		LastName:  "Waiting",
+		Email:     "wanda@example.com",
+	}
+
+	first, err := repo.InsertWaitlistEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Token = "second-token"
+	second, err := repo.InsertWaitlistEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := repo.GetWaitlistEntryByToken("second-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != second || e.RoomID != 2 || e.Room.RoomName == "" || !e.StartDate.Equal(date(10)) || !e.EndDate.Equal(date(12)) ||
+		e.Guests() != 3 || e.FirstName != "Wanda" || e.Email != "wanda@example.com" || e.Status != models.WaitlistWaiting || !e.NotifiedAt.IsZero() {
+		t.Errorf("got entry %+v", e)
+	}
+
+	entries, err := repo.OpenWaitlistEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != first || entries[1].ID != second || len(entries[0].Token) != 32 {
+		t.Fatalf("got %+v, wanted both entries in the order they joined with a token", entries)
+	}
+
+	if _, err := repo.InsertWaitlistEntry(entry); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v for a token that is taken, wanted ErrConflict", err)
+	}
+
+	at := time.Date(2050, time.January, 1, 12, 30, 0, 0, time.UTC)
+	hold, err := repo.PlaceHold(models.RoomRestriction{RoomID: 2, StartDate: date(10), EndDate: date(12), ExpiresAt: at.Add(24 * time.Hour)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notified := entries[0]
+	notified.Status = models.WaitlistNotified
+	notified.NotifiedAt = at
+	notified.HoldExpiresAt = at.Add(24 * time.Hour)
+	notified.HoldID = hold
+	if err := repo.UpdateWaitlistEntry(notified); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := repo.GetWaitlistEntryByToken(notified.Token); e.Status != models.WaitlistNotified || !e.NotifiedAt.Equal(at) ||
+		!e.HoldExpiresAt.Equal(at.Add(24*time.Hour)) || e.HoldID != hold {
+		t.Errorf("got entry %+v after it was notified", e)
+	}
+
+	notified.Status = models.WaitlistExpired
+	notified.HoldID = 0
+	if err := repo.UpdateWaitlistEntry(notified); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := repo.GetWaitlistEntryByToken(notified.Token); e.HoldID != 0 {
+		t.Errorf("got hold %d after the entry expired, wanted none", e.HoldID)
+	}
+	if entries, _ := repo.OpenWaitlistEntries(); len(entries) != 1 || entries[0].ID != second {
+		t.Errorf("got %+v, wanted the expired entry left out", entries)
+	}
+
+	for _, bad := range []models.WaitlistEntry{
+		{RoomID: 1, StartDate: date(12), EndDate: date(12), Adults: 1, Email: "wanda@example.com"},
+		{RoomID: 1, StartDate: date(10), EndDate: date(12), Adults: 0, Email: "wanda@example.com"},
+		{RoomID: 1, StartDate: date(10), EndDate: date(12), Adults: 1},
+		{RoomID: 1000, StartDate: date(10), EndDate: date(12), Adults: 1, Email: "wanda@example.com"},
+	} {
+		if _, err := repo.InsertWaitlistEntry(bad); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("got error %v for entry %+v, wanted ErrInvalid", err, bad)
+		}
+	}
+
+	if _, err := repo.GetWaitlistEntryByToken("no-such-token"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for an unknown token, wanted ErrNotFound", err)
+	}
+	if err := repo.UpdateWaitlistEntry(models.WaitlistEntry{ID: 100000, Status: models.WaitlistExpired}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for an unknown entry, wanted ErrNotFound", err)
+	}
+}
+
+func testHolds(t *testing.T, repo repository.DatabaseRepo) {
+	expires := time.Date(2049, time.December, 31, 12, 0, 0, 0, time.UTC)
+
+	hold, err := repo.PlaceHold(models.RoomRestriction{RoomID: 1, StartDate: date(2), EndDate: date(4), ExpiresAt: expires}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the room is taken while it is held, and the hold is no block
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(3), date(4), 1, now); ok {
+		t.Error("room 1 is available on held nights")
+	}
+	if _, err := repo.PlaceHold(models.RoomRestriction{RoomID: 1, StartDate: date(3), EndDate: date(5), ExpiresAt: expires}, now); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v holding held nights, wanted ErrConflict", err)
+	}
+	if blocks, _ := repo.AllBlocks(); len(blocks) != 0 {
+		t.Errorf("got blocks %+v, wanted none", blocks)
+	}
+	if _, err := repo.GetBlockByID(hold); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v getting a hold as a block, wanted ErrNotFound", err)
+	}
+	if err := repo.DeleteBlock(hold); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting a hold as a block, wanted ErrNotFound", err)
+	}
+	if _, err := repo.InsertBlock(models.RoomRestriction{RoomID: 2, StartDate: date(2), EndDate: date(3), RestrictionID: 4}, now); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v inserting a hold as a block, wanted ErrInvalid", err)
+	}
+
+	restrictions, err := repo.RoomRestrictionsForRoom(1, date(1), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 1 || restrictions[0].ID != hold || restrictions[0].RestrictionID != 4 ||
+		restrictions[0].Restriction.RestrictionName != "Hold" || !restrictions[0].ExpiresAt.Equal(expires) {
+		t.Errorf("got %+v, wanted the hold", restrictions)
+	}
+
+	// the guest changing their stay keeps one hold
+	moved, err := repo.PlaceHold(models.RoomRestriction{ID: hold, RoomID: 1, StartDate: date(3), EndDate: date(5), ExpiresAt: expires}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(2), date(3), 1, now); !ok {
+		t.Error("room 1 is still held on the nights the guest moved from")
+	}
+
+	// a failed booking leaves the hold in place
+	if _, err := repo.CreateBooking(models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@example.com",
+		StartDate: date(3), EndDate: date(5), RoomID: 1, HoldID: moved, Quote: models.Quote{PromoCode: "NOSUCHCODE"}}, now); err == nil {
+		t.Fatal("booked with a promo code that does not exist")
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(3), date(5), 1, now); ok {
+		t.Error("room 1 is no longer held after a failed booking")
+	}
+
+	// the booking takes over the hold
+	resID, err := repo.CreateBooking(models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@example.com",
+		StartDate: date(3), EndDate: date(5), RoomID: 1, HoldID: moved}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restrictions, _ = repo.RoomRestrictionsForRoom(1, date(1), now)
+	if len(restrictions) != 1 || restrictions[0].ReservationID != resID {
+		t.Errorf("got %+v, wanted only the reservation", restrictions)
+	}
+	if err := repo.DeleteHold(moved); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting a hold booked, wanted ErrNotFound", err)
+	}
+
+	// a hold can't be placed without an expiry
+	if _, err := repo.PlaceHold(models.RoomRestriction{RoomID: 2, StartDate: date(2), EndDate: date(4)}, now); !errors.Is(err, repository.ErrInvalid) {
+		t.Errorf("got error %v for a hold without an expiry, wanted ErrInvalid", err)
+	}
+
+	early, err := repo.PlaceHold(models.RoomRestriction{RoomID: 2, StartDate: date(2), EndDate: date(4), ExpiresAt: expires}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late, err := repo.PlaceHold(models.RoomRestriction{RoomID: 2, StartDate: date(6), EndDate: date(8), ExpiresAt: expires.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := repo.DeleteExpiredHolds(expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("deleted %d holds, wanted the one that expired", n)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(2), date(4), 2, now); !ok {
+		t.Error("room 2 is still held after the hold expired")
+	}
+	if err := repo.DeleteHold(early); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting an expired hold, wanted ErrNotFound", err)
+	}
+
+	if err := repo.DeleteHold(late); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(6), date(8), 2, now); !ok {
+		t.Error("room 2 is still held after the hold was let go of")
+	}
+	if err := repo.DeleteHold(resID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v deleting a reservation as a hold, wanted ErrNotFound", err)
+	}
+
+	// a hold that ran out doesn't take the room before it is deleted
+	stale, err := repo.PlaceHold(models.RoomRestriction{RoomID: 2, StartDate: date(10), EndDate: date(12), ExpiresAt: now.Add(-time.Minute)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(10), date(12), 2, now); !ok {
+		t.Error("room 2 is taken by a hold that expired")
+	}
+	// whether it expired goes by the caller's clock
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(10), date(12), 2, now.Add(-time.Hour)); ok {
+		t.Error("room 2 is available an hour before its hold expires")
+	}
+	if rooms, _ := repo.SearchAvailabilityForAllRooms(date(10), date(12), 1, now); len(rooms) != 2 {
+		t.Errorf("got rooms %+v free around a hold that expired, wanted both", rooms)
+	}
+	if restrictions, _ := repo.RoomRestrictionsForRoom(2, date(9), now); len(restrictions) != 0 {
+		t.Errorf("got %+v, wanted the expired hold left out", restrictions)
+	}
+	if _, err := repo.CreateBooking(models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@example.com",
+		StartDate: date(10), EndDate: date(12), RoomID: 2}, now); err != nil {
+		t.Errorf("got error %v booking the nights of a hold that expired", err)
+	}
+	if n, _ := repo.DeleteExpiredHolds(now); n != 1 {
+		t.Errorf("deleted %d holds, wanted the stale hold %d", n, stale)
+	}
+}
+
+func testUnpaidReservations(t *testing.T, repo repository.DatabaseRepo) {
+	expires := time.Date(2049, time.December, 31, 12, 0, 0, 0, time.UTC)
+
+	booking := func(roomID, start int, status string, expiresAt time.Time) int {
+		t.Helper()
+
+		id, err := repo.CreateBooking(models.Reservation{
+			FirstName:        "John",
+			LastName:         "Smith",
+			Email:            "john@example.com",
+			StartDate:        date(start),
+			EndDate:          date(start + 2),
+			RoomID:           roomID,
+			Status:           status,
+			PaymentExpiresAt: expiresAt,
+		}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	late := booking(1, 10, models.ReservationPendingPayment, expires.Add(time.Hour))
+	early := booking(2, 10, models.ReservationPendingPayment, expires)
+	paid := booking(1, 20, models.ReservationConfirmed, time.Time{})
+
+	saved, err := repo.GetReservationByID(early)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.PaymentExpiresAt.Equal(expires) {
+		t.Errorf("got payment expiry %s, wanted %s", saved.PaymentExpiresAt, expires)
+	}
+
+	unpaid, err := repo.UnpaidReservations(expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpaid) != 1 || unpaid[0].ID != early || unpaid[0].Room.RoomName == "" {
+		t.Errorf("got %+v, wanted only the reservation whose time to pay ran out", unpaid)
+	}
+
+	if err := repo.CancelUnpaidReservation(early); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(10), date(12), 2, now); !ok {
+		t.Error("room 2 is still taken after its unpaid reservation was cancelled")
+	}
+	if saved, _ := repo.GetReservationByID(early); saved.Status != models.ReservationCancelled {
+		t.Errorf("got status %q, wanted cancelled", saved.Status)
+	}
+	if err := repo.CancelUnpaidReservation(early); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v cancelling twice, wanted ErrConflict", err)
+	}
+
+	// a reservation paid in the meantime stands
+	if err := repo.CancelUnpaidReservation(paid); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("got error %v cancelling a paid reservation, wanted ErrConflict", err)
+	}
+	if ok, _ := repo.SerachAvailabilityByDatesByRoomID(date(20), date(22), 1, now); ok {
+		t.Error("room 1 is free after a paid reservation was refused cancelling")
+	}
+	if err := repo.CancelUnpaidReservation(paid + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v for a missing reservation, wanted ErrNotFound", err)
+	}
+
+	unpaid, _ = repo.UnpaidReservations(expires.Add(time.Hour))
+	if len(unpaid) != 1 || unpaid[0].ID != late {
+		t.Errorf("got %+v an hour later, wanted the other reservation", unpaid)
+	}
+}
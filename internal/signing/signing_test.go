@@ -0,0 +1,44 @@
+package signing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2050, time.January, 1, 12, 0, 0, 0, time.UTC)
+	payload := []byte(`{"event":"reservation.created"}`)
+	header := Sign("s3cret", payload, now)
+
+	if want := "t=" + "2524651200" + ",v1=" + Signature("s3cret", "2524651200", payload); header != want {
+		t.Errorf("Sign gave %q, wanted %q", header, want)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		valid   bool
+	}{
+		{"valid", "s3cret", payload, header, now.Add(time.Minute), true},
+		{"signed a little ahead", "s3cret", payload, header, now.Add(-time.Minute), true},
+		{"one of many signatures", "s3cret", payload, header + ",v1=abc", now, true},
+		{"wrong secret", "other", payload, header, now, false},
+		{"changed payload", "s3cret", []byte(`{"event":"reservation.cancelled"}`), header, now, false},
+		{"too old", "s3cret", payload, header, now.Add(5*time.Minute + time.Second), false},
+		{"too new", "s3cret", payload, header, now.Add(-5*time.Minute - time.Second), false},
+		{"no timestamp", "s3cret", payload, header[strings.Index(header, ",")+1:], now, false},
+		{"no signature", "s3cret", payload, header[:strings.Index(header, ",")], now, false},
+		{"empty", "s3cret", payload, "", now, false},
+	}
+
+	for _, e := range tests {
+		err := Verify(e.secret, e.payload, e.header, e.now, 5*time.Minute)
+		if (err == nil) != e.valid {
+			t.Errorf("Verify for %s gave %v, wanted valid %v", e.name, err, e.valid)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package stayrules checks stays against the rules the owner sets on how
+// long guests stay, when they arrive and leave, and how far ahead they book
+package stayrules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// Violation tells the guest which rule a stay breaks. It is a
+// repository.ErrInvalid, so handlers that don't look closer answer 400
+type Violation struct {
+	Reason string
+}
+
+func (e *Violation) Error() string {
+	return "stay rule: " + e.Reason
+}
+
+func (e *Violation) Unwrap() error {
+	return repository.ErrInvalid
+}
+
+// Check makes sure a stay in a room from start to end, booked at now, keeps to
+// every rule that applies to it, and returns a *Violation for the first rule
+// it breaks. Rules apply by the arrival date, except closed departure days,
+// which apply by the departure date
+func Check(rules []models.StayRule, roomID int, start, end, now time.Time) error {
+	nights := days(start, end)
+	lead := days(day(now), start)
+
+	for _, rule := range rules {
+		if rule.Covers(roomID, start) {
+			if err := checkArrival(rule, start, nights, lead); err != nil {
+				return err
+			}
+		}
+
+		if rule.Covers(roomID, end) && rule.ClosedToDeparture[end.Weekday()] {
+			return &Violation{Reason: fmt.Sprintf("We have no departures on %ss, please pick another departure date", end.Weekday())}
+		}
+	}
+
+	return nil
+}
+
+// checkArrival checks the limits of a rule that covers the arrival date
+func checkArrival(rule models.StayRule, start time.Time, nights, lead int) error {
+	arrival := start.Format("2006-01-02")
+
+	switch {
+	case lead < rule.MinLeadDays:
+		return &Violation{Reason: fmt.Sprintf("Stays arriving on %s must be booked at least %s ahead", arrival, plural(rule.MinLeadDays, "day"))}
+	case rule.MaxLeadDays > 0 && lead > rule.MaxLeadDays:
+		return &Violation{Reason: fmt.Sprintf("Stays arriving on %s can't be booked yet, we take bookings up to %s ahead", arrival, plural(rule.MaxLeadDays, "day"))}
+	case nights < rule.MinNights:
+		return &Violation{Reason: fmt.Sprintf("Stays arriving on %s are at least %s", arrival, plural(rule.MinNights, "night"))}
+	case rule.MaxNights > 0 && nights > rule.MaxNights:
+		return &Violation{Reason: fmt.Sprintf("Stays arriving on %s are at most %s", arrival, plural(rule.MaxNights, "night"))}
+	case rule.ClosedToArrival[start.Weekday()]:
+		return &Violation{Reason: fmt.Sprintf("We have no arrivals on %ss, please pick another arrival date", start.Weekday())}
+	}
+
+	return nil
+}
+
+// Day sums up the rules for arriving or leaving on one day, as a date picker
+// shows them
+type Day struct {
+	// MinNights and MaxNights bound stays arriving on the day, MaxNights is 0
+	// when there is no upper bound
+	MinNights int
+	MaxNights int
+	// NoArrival is true when stays can't arrive on the day, because it is
+	// closed to arrivals or can't be booked at now, too soon or too far ahead
+	NoArrival bool
+	// NoDeparture is true when stays can't leave on the day
+	NoDeparture bool
+}
+
+// ForDay works out the rules for a room on one day the way Check applies
+// them: the tightest bounds of every rule covering the day win
+func ForDay(rules []models.StayRule, roomID int, date, now time.Time) Day {
+	d := Day{MinNights: 1}
+	lead := days(day(now), date)
+
+	for _, rule := range rules {
+		if !rule.Covers(roomID, date) {
+			continue
+		}
+
+		if rule.MinNights > d.MinNights {
+			d.MinNights = rule.MinNights
+		}
+		if rule.MaxNights > 0 && (d.MaxNights == 0 || rule.MaxNights < d.MaxNights) {
+			d.MaxNights = rule.MaxNights
+		}
+
+		d.NoArrival = d.NoArrival || rule.ClosedToArrival[date.Weekday()] ||
+			lead < rule.MinLeadDays || (rule.MaxLeadDays > 0 && lead > rule.MaxLeadDays)
+		d.NoDeparture = d.NoDeparture || rule.ClosedToDeparture[date.Weekday()]
+	}
+
+	return d
+}
+
+// days counts the days from one midnight to another
+func days(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// day is the calendar day of now as midnight UTC, the way stay dates are kept
+func day(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// plural puts a count in front of a unit, e.g. "1 night" or "3 nights"
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
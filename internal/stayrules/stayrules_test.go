@@ -0,0 +1,100 @@
+package stayrules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/models"
+	"github.com/arkadiuszekprogramista/bookingapp/internal/repository"
+)
+
+// june is a day in June 2050; June 1 is a Wednesday
+func june(day int) time.Time {
+	return time.Date(2050, time.June, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestCheck(t *testing.T) {
+	weekend := models.StayRule{ID: 1, Name: "Weekends", RoomID: 1, StartDate: june(1), EndDate: june(30), MinNights: 2, MaxNights: 7}
+	weekend.ClosedToArrival[time.Saturday] = true
+	weekend.ClosedToDeparture[time.Sunday] = true
+
+	lead := models.StayRule{ID: 2, Name: "Lead time", StartDate: june(1), EndDate: june(30), MinLeadDays: 3, MaxLeadDays: 60}
+
+	rules := []models.StayRule{weekend, lead}
+	now := time.Date(2050, time.May, 20, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		room   int
+		start  time.Time
+		end    time.Time
+		now    time.Time
+		reason string
+	}{
+		{"keeps to every rule", 1, june(1), june(3), now, ""},
+		{"too short", 1, june(1), june(2), now, "at least 2 nights"},
+		{"too long", 1, june(1), june(9), now, "at most 7 nights"},
+		{"arrives on a Saturday", 1, june(4), june(6), now, "no arrivals on Saturdays"},
+		{"leaves on a Sunday", 1, june(3), june(5), now, "no departures on Sundays"},
+		{"other rooms are not limited", 2, june(4), june(5), now, ""},
+		{"booked too late", 2, june(1), june(2), time.Date(2050, time.May, 30, 9, 0, 0, 0, time.UTC), "at least 3 days ahead"},
+		{"booked too early", 2, june(1), june(2), time.Date(2050, time.March, 1, 9, 0, 0, 0, time.UTC), "up to 60 days ahead"},
+		{"arrives before the rules", 1, time.Date(2050, time.May, 28, 0, 0, 0, 0, time.UTC), time.Date(2050, time.May, 29, 0, 0, 0, 0, time.UTC), now, ""},
+		{"arrives before the rules and leaves on a Sunday", 1, time.Date(2050, time.May, 28, 0, 0, 0, 0, time.UTC), june(5), now, "no departures on Sundays"},
+		{"leaves on a Sunday after the rules", 1, june(29), time.Date(2050, time.July, 3, 0, 0, 0, 0, time.UTC), now, ""},
+	}
+
+	for _, tt := range tests {
+		err := Check(rules, tt.room, tt.start, tt.end, tt.now)
+
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: got error %v, wanted none", tt.name, err)
+			}
+			continue
+		}
+
+		var v *Violation
+		if !errors.As(err, &v) || !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("%s: got error %v, wanted a Violation", tt.name, err)
+			continue
+		}
+		if !strings.Contains(v.Reason, tt.reason) {
+			t.Errorf("%s: got reason %q, wanted it to mention %q", tt.name, v.Reason, tt.reason)
+		}
+	}
+}
+
+func TestForDay(t *testing.T) {
+	weekend := models.StayRule{ID: 1, Name: "Weekends", RoomID: 1, StartDate: june(1), EndDate: june(30), MinNights: 2, MaxNights: 7}
+	weekend.ClosedToArrival[time.Saturday] = true
+	weekend.ClosedToDeparture[time.Sunday] = true
+
+	peak := models.StayRule{ID: 2, Name: "Peak", StartDate: june(10), EndDate: june(20), MinNights: 4, MaxNights: 10, MinLeadDays: 12}
+
+	rules := []models.StayRule{weekend, peak}
+	now := time.Date(2050, time.May, 30, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		room int
+		date time.Time
+		want Day
+	}{
+		{"no rules", 1, june(30).AddDate(0, 0, 1), Day{MinNights: 1}},
+		{"weekday", 1, june(1), Day{MinNights: 2, MaxNights: 7}},
+		{"Saturday", 1, june(4), Day{MinNights: 2, MaxNights: 7, NoArrival: true}},
+		{"Sunday", 1, june(5), Day{MinNights: 2, MaxNights: 7, NoDeparture: true}},
+		{"the tightest bounds win", 1, june(14), Day{MinNights: 4, MaxNights: 7}},
+		{"too soon to book", 1, june(10), Day{MinNights: 4, MaxNights: 7, NoArrival: true}},
+		{"other room", 2, june(14), Day{MinNights: 4, MaxNights: 10}},
+	}
+
+	for _, e := range tests {
+		if got := ForDay(rules, e.room, e.date, now); got != e.want {
+			t.Errorf("%s: got %+v, wanted %+v", e.name, got, e.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package webhooks sends events to the URLs partners subscribe, signed so
+// they can tell the events came from us, and says when to retry the ones
+// that failed
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkadiuszekprogramista/bookingapp/internal/signing"
+)
+
+// Headers sent with every event
+const (
+	// SignatureHeader carries the signature, as t=<unix time>,v1=<hex HMAC-SHA256>
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader carries the event, like reservation.created
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader carries the id of the delivery, which stays the same
+	// when it is retried
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// MaxAttempts is how many times an event is sent before it is given up on
+const MaxAttempts = 10
+
+// firstBackoff is the wait after the first failed attempt, it doubles after
+// every failure up to maxBackoff
+const (
+	firstBackoff = time.Minute
+	maxBackoff   = 6 * time.Hour
+)
+
+// Tolerance is how old a signature may be before Verify refuses it
+const Tolerance = 5 * time.Minute
+
+// ErrInvalidSignature is returned by Verify for payloads that were not
+// signed with the secret, or were signed too long ago
+var ErrInvalidSignature = errors.New("webhooks: invalid signature")
+
+// Envelope is the body of every event
+type Envelope struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Payload makes the body of an event
+func Payload(event string, data interface{}, now time.Time) ([]byte, error) {
+	return json.Marshal(Envelope{Event: event, CreatedAt: now.UTC().Truncate(time.Second), Data: data})
+}
+
+// GenerateSecret makes a secret to sign the events of a webhook with
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign gives the signature header of a payload sent at t
+func Sign(secret string, payload []byte, t time.Time) string {
+	return signing.Sign(secret, payload, t)
+}
+
+// Verify checks a payload against a signature header made by Sign at most
+// Tolerance before now. Receivers do the same to trust an event
+func Verify(secret string, payload []byte, header string, now time.Time) error {
+	if err := signing.Verify(secret, payload, header, now, Tolerance); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Backoff is how long to wait before trying an event again after it failed
+// attempts times: a minute after the first failure, doubling up to six hours
+func Backoff(attempts int) time.Duration {
+	wait := firstBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// Sender posts events to webhooks
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender makes a sender that gives up on a webhook after timeout
+func NewSender(timeout time.Duration) *Sender {
+	return &Sender{Client: &http.Client{Timeout: timeout}}
+}
+
+// Send posts the payload of an event to url, signed with secret at now. It
+// returns the status the webhook answered with, and an error unless it was
+// a 2xx; the status is 0 when there was no answer
+func (s *Sender) Send(ctx context.Context, url, secret, event string, deliveryID int, payload []byte, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bookings-webhooks/1")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(deliveryID))
+	req.Header.Set(SignatureHeader, Sign(secret, payload, now))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// read a little of the answer so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2050, time.January, 1, 12, 0, 0, 0, time.UTC)
+	payload := []byte(`{"event":"reservation.created"}`)
+	header := Sign("s3cret", payload, now)
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		valid   bool
+	}{
+		{"valid", "s3cret", payload, header, now.Add(time.Minute), true},
+		{"wrong secret", "other", payload, header, now, false},
+		{"changed payload", "s3cret", []byte(`{"event":"reservation.cancelled"}`), header, now, false},
+		{"too old", "s3cret", payload, header, now.Add(Tolerance + time.Second), false},
+		{"no timestamp", "s3cret", payload, header[strings.Index(header, ",")+1:], now, false},
+		{"empty", "s3cret", payload, "", now, false},
+	}
+
+	for _, e := range tests {
+		err := Verify(e.secret, e.payload, e.header, e.now)
+		if (err == nil) != e.valid {
+			t.Errorf("Verify for %s gave %v, wanted valid %v", e.name, err, e.valid)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+
+	for _, e := range tests {
+		if got := Backoff(e.attempts); got != e.expected {
+			t.Errorf("Backoff after %d attempts gave %v, wanted %v", e.attempts, got, e.expected)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateSecret()
+
+	if !strings.HasPrefix(a, "whsec_") || len(a) > 64 || a == b {
+		t.Errorf("GenerateSecret gave %q and %q", a, b)
+	}
+}
+
+func TestSender_Send(t *testing.T) {
+	now := time.Now()
+	payload, err := Payload("block.added", map[string]int{"room_id": 1}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify("s3cret", body, r.Header.Get(SignatureHeader), time.Now()); err != nil {
+			t.Errorf("the webhook got a payload it can't verify: %v", err)
+		}
+		if r.Header.Get(EventHeader) != "block.added" || r.Header.Get(DeliveryHeader) != "7" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("the webhook got headers %v", r.Header)
+		}
+		if !strings.Contains(string(body), `"data":{"room_id":1}`) {
+			t.Errorf("the webhook got %s", body)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := NewSender(time.Second)
+
+	code, err := s.Send(context.Background(), srv.URL, "s3cret", "block.added", 7, payload, now)
+	if err != nil || code != http.StatusNoContent {
+		t.Errorf("Send gave %d, %v", code, err)
+	}
+
+	status = http.StatusInternalServerError
+	code, err = s.Send(context.Background(), srv.URL, "s3cret", "block.added", 7, payload, now)
+	if err == nil || code != http.StatusInternalServerError {
+		t.Errorf("Send to a failing webhook gave %d, %v", code, err)
+	}
+
+	code, err = s.Send(context.Background(), "http://127.0.0.1:1", "s3cret", "block.added", 7, payload, now)
+	if err == nil || code != 0 {
+		t.Errorf("Send to nowhere gave %d, %v", code, err)
+	}
+}
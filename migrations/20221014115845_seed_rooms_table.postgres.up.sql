@@ -1,3 +0,0 @@
-INSERT INTO public.rooms (room_name,created_at,updated_at) VALUES
-	 ('General''s Quartance','2022-10-12 13:11:57.943','2022-10-12 13:12:19.601'),
-	 ('Major''s Suite','2022-10-12 18:16:44.544','2022-10-12 18:16:49.809');
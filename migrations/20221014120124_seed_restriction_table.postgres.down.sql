@@ -1 +0,0 @@
-delete from restrictions;
\ No newline at end of file
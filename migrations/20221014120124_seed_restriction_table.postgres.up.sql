@@ -1,3 +0,0 @@
-INSERT INTO public.restrictions (restriction_name,created_at,updated_at) VALUES
-	 ('Reservation','2022-10-12 13:42:01.347','2022-10-12 16:42:13.692'),
-	 ('Owner Block','2023-02-01 18:06:58.284','2023-02-01 18:07:49.734');
@@ -117,4 +117,70 @@ function Prompt() {
     }
 
 
-}
\ No newline at end of file
+}
+
+// dateKey formats a date picker day as yyyy-mm-dd
+function dateKey(date) {
+    let pad = n => (n < 10 ? "0" : "") + n;
+    return date.getFullYear() + "-" + pad(date.getMonth() + 1) + "-" + pad(date.getDate());
+}
+
+// roomCalendar loads the calendar of a room for the next year and makes a
+// DateRangePicker follow it: arrivals only on days stays can start, departures
+// only when every night before them is free and the stay is as long as the
+// stay rules of its arrival day want, and the price of each night under its day
+function roomCalendar(roomID, rangePicker) {
+    let start = new Date();
+    let end = new Date();
+    end.setDate(end.getDate() + 365);
+
+    fetch('/rooms/' + roomID + '/calendar.json?start=' + dateKey(start) + '&end=' + dateKey(end))
+        .then(response => response.json())
+        .then(data => {
+            let days = {};
+            (data.days || []).forEach(d => days[d.date] = d);
+
+            let cell = (date, d) => '<span class="day-number">' + date.getDate() + '</span>'
+                + '<span class="day-price">' + (d && d.available ? d.price_label : '') + '</span>';
+
+            rangePicker.datepickers[0].setOptions({
+                beforeShowDay: date => {
+                    let d = days[dateKey(date)];
+                    if (d === undefined) {
+                        return true;
+                    }
+                    return {
+                        enabled: d.available && !d.no_arrival,
+                        classes: d.available ? '' : 'unavailable',
+                        content: cell(date, d),
+                    };
+                },
+            });
+
+            rangePicker.datepickers[1].setOptions({
+                beforeShowDay: date => {
+                    let d = days[dateKey(date)];
+                    let arrival = rangePicker.dates[0];
+                    if (arrival === undefined || !(date.getTime() > arrival)) {
+                        return {enabled: d === undefined || (d.available && !d.no_arrival), content: cell(date, d)};
+                    }
+
+                    let first = days[dateKey(new Date(arrival))];
+                    let nights = 0;
+                    for (let night = new Date(arrival); night < date; night.setDate(night.getDate() + 1)) {
+                        let n = days[dateKey(night)];
+                        if (n !== undefined && !n.available) {
+                            return {enabled: false, classes: 'unavailable'};
+                        }
+                        nights++;
+                    }
+
+                    let enabled = !(d && d.no_departure);
+                    if (first !== undefined) {
+                        enabled = enabled && nights >= first.min_nights && (!first.max_nights || nights <= first.max_nights);
+                    }
+                    return {enabled: enabled, content: cell(date, d)};
+                },
+            });
+        });
+}